@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// builtinAliases are shortcuts for the most used compound commands. Aliases
+// defined in the configuration take precedence over them.
+var builtinAliases = map[string]string{
+	"ac": "apps create",
+	"al": "apps list",
+	"rc": "routes create",
+	"rd": "routes delete",
+	"ri": "routes inspect",
+	"rl": "routes list",
+	"ru": "routes update",
+}
+
+// expandAliases replaces the command named in args by its expansion when it
+// is an alias. The arguments following it are kept, so that aliases can be
+// given further arguments and flags. Actual commands cannot be shadowed.
+func expandAliases(app *cli.App, args []string, aliases map[string]string) []string {
+	takesValue := make(map[string]bool)
+	for _, f := range app.Flags {
+		if _, ok := f.(cli.BoolFlag); ok {
+			continue
+		}
+		for _, name := range strings.Split(f.GetName(), ",") {
+			name = strings.TrimSpace(name)
+			takesValue["-"+name] = true
+			takesValue["--"+name] = true
+		}
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			if takesValue[arg] {
+				i++
+			}
+			continue
+		}
+
+		if app.Command(arg) != nil {
+			return args
+		}
+		expansion, ok := aliases[arg]
+		if !ok {
+			expansion, ok = builtinAliases[arg]
+		}
+		if !ok {
+			return args
+		}
+
+		expanded := append([]string{}, args[:i]...)
+		expanded = append(expanded, strings.Fields(expansion)...)
+		return append(expanded, args[i+1:]...)
+	}
+	return args
+}
+
+type aliasCmd struct{}
+
+func aliasesCmd() cli.Command {
+	a := aliasCmd{}
+	return cli.Command{
+		Name:  "alias",
+		Usage: "manage command shortcuts",
+		Subcommands: []cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"l"},
+				Usage:   "list aliases, built-in and user-defined",
+				Action:  a.list,
+			},
+			{
+				Name:      "set",
+				Aliases:   []string{"s"},
+				Usage:     "define `alias` as a shortcut for a command",
+				ArgsUsage: "`alias` \"command [arguments...]\"",
+				Action:    a.set,
+			},
+			{
+				Name:      "unset",
+				Aliases:   []string{"u"},
+				Usage:     "remove a user-defined `alias`",
+				ArgsUsage: "`alias`",
+				Action:    a.unset,
+			},
+		},
+	}
+}
+
+func (a *aliasCmd) list(c *cli.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	all := make(map[string]string)
+	for name, expansion := range builtinAliases {
+		all[name] = expansion
+	}
+	for name, expansion := range cfg.Aliases {
+		all[name] = expansion
+	}
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "alias", "\t", "command", "\n")
+	for _, name := range names {
+		fmt.Fprint(w, name, "\t", all[name], "\n")
+	}
+	return w.Flush()
+}
+
+func (a *aliasCmd) set(c *cli.Context) error {
+	name := c.Args().Get(0)
+	expansion := strings.Join(c.Args().Tail(), " ")
+	if name == "" || strings.TrimSpace(expansion) == "" {
+		return usageError("alias set takes two arguments: an alias and the command it stands for")
+	}
+	if newFn().Command(name) != nil {
+		return usageError("%s is a command, it cannot be an alias", name)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Aliases == nil {
+		cfg.Aliases = make(map[string]string)
+	}
+	cfg.Aliases[name] = expansion
+	if err := storeConfig(cfg); err != nil {
+		return err
+	}
+
+	progress(name, "now stands for", expansion)
+	return nil
+}
+
+func (a *aliasCmd) unset(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return usageError("missing alias name")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Aliases[name]; !ok {
+		return &fnError{Kind: kindNotFound, Message: fmt.Sprintf("alias %s does not exist", name)}
+	}
+	delete(cfg.Aliases, name)
+	if err := storeConfig(cfg); err != nil {
+		return err
+	}
+
+	progress("alias", name, "removed")
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandAliases(t *testing.T) {
+	app := newFn()
+	aliases := map[string]string{"dpl": "deploy --all", "apps": "routes list"}
+
+	cases := []struct {
+		args, want []string
+	}{
+		{[]string{"fn", "dpl", "myapp"}, []string{"fn", "deploy", "--all", "myapp"}},
+		{[]string{"fn", "--context", "prod", "dpl"}, []string{"fn", "--context", "prod", "deploy", "--all"}},
+		{[]string{"fn", "-v", "rl", "myapp"}, []string{"fn", "-v", "routes", "list", "myapp"}},
+		{[]string{"fn", "apps", "list"}, []string{"fn", "apps", "list"}},
+		{[]string{"fn", "unknown"}, []string{"fn", "unknown"}},
+	}
+
+	for _, c := range cases {
+		if got := expandAliases(app, c.args, aliases); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("expanding %v: expected %v, got %v", c.args, c.want, got)
+		}
+	}
+}
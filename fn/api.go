@@ -1,37 +1,81 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 
 	httptransport "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
 	fnclient "github.com/iron-io/functions_go/client"
-	"log"
-	"net/url"
+	fnmodels "github.com/iron-io/functions_go/models"
 )
 
-func host() string {
-	apiURL := os.Getenv("API_URL")
+func apiURL() *url.URL {
+	apiURL := globals.apiURL
 	if apiURL == "" {
-		apiURL = "http://localhost:8080"
+		apiURL = firstNonEmpty(os.Getenv("API_URL"), defaultAPIURL)
 	}
 
 	u, err := url.Parse(apiURL)
 	if err != nil {
-		log.Fatalln("Couldn't parse API URL:", err)
+		logger.error("could not parse the API URL", "url", apiURL, "error", err)
+		os.Exit(1)
 	}
 
-	return u.Host
+	return u
+}
+
+func host() string {
+	return apiURL().Host
 }
 
 func apiClient() *fnclient.Functions {
 	transport := httptransport.New(host(), "/v1", []string{"http"})
-	if os.Getenv("IRON_TOKEN") != "" {
-		transport.DefaultAuthentication = httptransport.BearerToken(os.Getenv("IRON_TOKEN"))
-	}
+	transport.Transport = apiTransport{}
 
 	// create the API client, with the transport
 	client := fnclient.New(transport, strfmt.Default)
 
 	return client
 }
+
+// apiCall performs a raw request against the API, relative to the configured
+// API address, for the endpoints the swagger client does not cover. A JSON
+// response is decoded into v, unless v is nil.
+func apiCall(method, path string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequestWithContext(cmdContext(), method, path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := (&http.Client{Transport: apiTransport{}}).Do(req)
+	if err != nil {
+		return classify(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		e := &fnError{
+			Kind:    kindFromStatus(resp.StatusCode),
+			Message: fmt.Sprintf("%s %s: %s", method, path, resp.Status),
+			Status:  resp.StatusCode,
+		}
+		var apiErr fnmodels.Error
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != nil {
+			e.Message = fmt.Sprintf("%s %s: %s", method, path, apiErr.Error.Message)
+		}
+		return e
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
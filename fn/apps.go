@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 
-	"context"
 	"github.com/iron-io/functions_go"
 	fnclient "github.com/iron-io/functions_go/client"
 	apiapps "github.com/iron-io/functions_go/client/apps"
@@ -45,14 +44,14 @@ func apps() cli.Command {
 				Name:      "inspect",
 				Aliases:   []string{"i"},
 				Usage:     "retrieve one or all apps properties",
-				ArgsUsage: "`app` [property.[key]]",
+				ArgsUsage: "[`app`] [property.[key]]",
 				Action:    a.inspect,
 			},
 			{
 				Name:      "update",
 				Aliases:   []string{"u"},
 				Usage:     "update an `app`",
-				ArgsUsage: "`app`",
+				ArgsUsage: "[`app`]",
 				Action:    a.update,
 				Flags: []cli.Flag{
 					cli.StringSliceFlag{
@@ -86,6 +85,7 @@ func apps() cli.Command {
 				Aliases: []string{"l"},
 				Usage:   "list all apps",
 				Action:  a.list,
+				Flags:   []cli.Flag{failOnEmptyFlag},
 			},
 			{
 				Name:   "delete",
@@ -98,21 +98,18 @@ func apps() cli.Command {
 
 func (a *appsCmd) list(c *cli.Context) error {
 	resp, err := a.client.Apps.GetApps(&apiapps.GetAppsParams{
-		Context: context.Background(),
+		Context: cacheable(cmdContext()),
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiapps.GetAppsAppNotFound:
-			return fmt.Errorf("error: %v", err.(*apiapps.GetAppsAppNotFound).Payload.Error.Message)
-		case *apiapps.GetAppsAppDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiapps.GetAppsAppDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
 	if len(resp.Payload.Apps) == 0 {
-		fmt.Println("no apps found")
+		if c.Bool("fail-on-empty") {
+			return emptyError("apps")
+		}
+		progress("no apps found")
 		return nil
 	}
 
@@ -125,7 +122,7 @@ func (a *appsCmd) list(c *cli.Context) error {
 
 func (a *appsCmd) create(c *cli.Context) error {
 	if c.Args().First() == "" {
-		return errors.New("error: missing app name after create command")
+		return usageError("missing app name after create command")
 	}
 
 	body := &models.AppWrapper{App: &models.App{
@@ -134,49 +131,45 @@ func (a *appsCmd) create(c *cli.Context) error {
 	}}
 
 	resp, err := a.client.Apps.PostApps(&apiapps.PostAppsParams{
-		Context: context.Background(),
+		Context: cmdContext(),
 		Body:    body,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiapps.PostAppsBadRequest:
-			return fmt.Errorf("error: %v", err.(*apiapps.PostAppsBadRequest).Payload.Error.Message)
-		case *apiapps.PostAppsConflict:
-			return fmt.Errorf("error: %v", err.(*apiapps.PostAppsConflict).Payload.Error.Message)
-		case *apiapps.PostAppsDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiapps.PostAppsDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
-	fmt.Println(resp.Payload.App.Name, "created")
+	progress(resp.Payload.App.Name, "created")
 	return nil
 }
 
 func (a *appsCmd) update(c *cli.Context) error {
-	if c.Args().First() == "" {
-		return errors.New("error: missing app name after update command")
+	args, err := appArgs(c)
+	if err != nil {
+		return err
+	}
+	if args.First() == "" {
+		return usageError("missing app name after update command")
 	}
 
-	appName := c.Args().First()
+	appName := args.First()
 
 	patchedApp := &functions.App{
 		Config: extractEnvConfig(c.StringSlice("config")),
 	}
 
-	err := a.patchApp(appName, patchedApp)
+	err = a.patchApp(appName, patchedApp)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("app", appName, "updated")
+	progress("app", appName, "updated")
 	return nil
 }
 
 func (a *appsCmd) configSet(c *cli.Context) error {
 	if c.Args().Get(0) == "" || c.Args().Get(1) == "" || c.Args().Get(2) == "" {
-		return errors.New("error: application configuration setting takes three arguments: an app name, a key and a value")
+		return usageError("application configuration setting takes three arguments: an app name, a key and a value")
 	}
 
 	appName := c.Args().Get(0)
@@ -190,16 +183,16 @@ func (a *appsCmd) configSet(c *cli.Context) error {
 	app.Config[key] = value
 
 	if err := a.patchApp(appName, app); err != nil {
-		return fmt.Errorf("error updating app configuration: %v", err)
+		return err
 	}
 
-	fmt.Println(appName, "updated", key, "with", value)
+	progress(appName, "updated", key, "with", value)
 	return nil
 }
 
 func (a *appsCmd) configUnset(c *cli.Context) error {
 	if c.Args().Get(0) == "" || c.Args().Get(1) == "" {
-		return errors.New("error: application configuration setting takes three arguments: an app name, a key and a value")
+		return usageError("application configuration setting takes three arguments: an app name, a key and a value")
 	}
 
 	appName := c.Args().Get(0)
@@ -212,27 +205,35 @@ func (a *appsCmd) configUnset(c *cli.Context) error {
 	app.Config["-"+key] = ""
 
 	if err := a.patchApp(appName, app); err != nil {
-		return fmt.Errorf("error updating app configuration: %v", err)
+		return err
 	}
 
-	fmt.Printf("removed key '%s' from app '%s' \n", key, appName)
+	progressf("removed key '%s' from app '%s'\n", key, appName)
 	return nil
 }
 
 func (a *appsCmd) patchApp(appName string, app *functions.App) error {
+	if globals.offline {
+		// the patch is queued, and merged into the app by fn sync
+		var config map[string]string
+		if app != nil {
+			config = app.Config
+		}
+		_, err := a.client.Apps.PatchAppsApp(&apiapps.PatchAppsAppParams{
+			Context: cmdContext(),
+			App:     appName,
+			Body:    &models.AppWrapper{App: &models.App{Config: config}},
+		})
+		return apiError(err)
+	}
+
 	resp, err := a.client.Apps.GetAppsApp(&apiapps.GetAppsAppParams{
-		Context: context.Background(),
+		Context: cmdContext(),
 		App:     appName,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiapps.GetAppsAppNotFound:
-			return fmt.Errorf("error: %v", err.(*apiapps.GetAppsAppNotFound).Payload.Error.Message)
-		case *apiapps.GetAppsAppDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiapps.GetAppsAppDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
 	if resp.Payload.App.Config == nil {
@@ -255,57 +256,42 @@ func (a *appsCmd) patchApp(appName string, app *functions.App) error {
 	body := &models.AppWrapper{App: resp.Payload.App}
 
 	_, err = a.client.Apps.PatchAppsApp(&apiapps.PatchAppsAppParams{
-		Context: context.Background(),
+		Context: cmdContext(),
 		App:     appName,
 		Body:    body,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiapps.PatchAppsAppBadRequest:
-			return errors.New(err.(*apiapps.PatchAppsAppBadRequest).Payload.Error.Message)
-		case *apiapps.PatchAppsAppNotFound:
-			return errors.New(err.(*apiapps.PatchAppsAppNotFound).Payload.Error.Message)
-		case *apiapps.PatchAppsAppDefault:
-			return errors.New(err.(*apiapps.PatchAppsAppDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
 	return nil
 }
 
 func (a *appsCmd) inspect(c *cli.Context) error {
-	if c.Args().Get(0) == "" {
-		return errors.New("error: missing app name after the inspect command")
+	args, err := appArgs(c)
+	if err != nil {
+		return err
+	}
+	if args.Get(0) == "" {
+		return usageError("missing app name after the inspect command")
 	}
 
-	appName := c.Args().First()
-	prop := c.Args().Get(1)
+	appName := args.First()
+	prop := args.Get(1)
 
 	resp, err := a.client.Apps.GetAppsApp(&apiapps.GetAppsAppParams{
-		Context: context.Background(),
+		Context: cmdContext(),
 		App:     appName,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiapps.GetAppsAppNotFound:
-			return fmt.Errorf("error: %v", err.(*apiapps.GetAppsAppNotFound).Payload.Error.Message)
-		case *apiapps.GetAppsAppDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiapps.GetAppsAppDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "\t")
 
-	if prop == "" {
-		enc.Encode(resp.Payload.App)
-		return nil
-	}
-
 	// TODO: we really need to marshal it here just to
 	// unmarshal as map[string]interface{}?
 	data, err := json.Marshal(resp.Payload.App)
@@ -318,6 +304,29 @@ func (a *appsCmd) inspect(c *cli.Context) error {
 		return fmt.Errorf("error inspect app: %v", err)
 	}
 
+	// usage against the quota, on servers enforcing them
+	quota, err := appQuotaReport(a.client, appName)
+	if err != nil {
+		return err
+	}
+	if quota != nil {
+		inspect["quota"] = quota
+	}
+
+	if prop == "" {
+		enc.Encode(inspect)
+		return nil
+	}
+
+	// jsonq only walks plain maps
+	if data, err = json.Marshal(inspect); err != nil {
+		return fmt.Errorf("error inspect app: %v", err)
+	}
+	inspect = nil
+	if err := json.Unmarshal(data, &inspect); err != nil {
+		return fmt.Errorf("error inspect app: %v", err)
+	}
+
 	jq := jsonq.NewQuery(inspect)
 	field, err := jq.Interface(strings.Split(prop, ".")...)
 	if err != nil {
@@ -331,24 +340,104 @@ func (a *appsCmd) inspect(c *cli.Context) error {
 func (a *appsCmd) delete(c *cli.Context) error {
 	appName := c.Args().First()
 	if appName == "" {
-		return errors.New("error: deleting an app takes one argument, an app name")
+		return usageError("deleting an app takes one argument, an app name")
 	}
 
 	_, err := a.client.Apps.DeleteAppsApp(&apiapps.DeleteAppsAppParams{
-		Context: context.Background(),
+		Context: cmdContext(),
 		App:     appName,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiapps.DeleteAppsAppNotFound:
-			return errors.New(err.(*apiapps.DeleteAppsAppNotFound).Payload.Error.Message)
-		case *apiapps.DeleteAppsAppDefault:
-			return errors.New(err.(*apiapps.DeleteAppsAppDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
-	fmt.Println("app", appName, "deleted")
+	progress("app", appName, "deleted")
 	return nil
 }
+
+// defaultApp is the app commands act on when they are given none: that of the
+// function file of the current directory, or else that of the context.
+func defaultApp() (string, error) {
+	ff, err := loadFuncfile()
+	if err != nil {
+		if _, ok := err.(*notFoundError); !ok {
+			return "", err
+		}
+	} else if ff.App != "" {
+		return ff.App, nil
+	}
+	return globals.app, nil
+}
+
+// appFlag and pathFlag name the app and the route commands act on, which
+// can also be given first on the command line.
+var (
+	appFlag = cli.StringFlag{
+		Name:  "app",
+		Usage: "`app` to act on, the default app of the function file or the context otherwise",
+	}
+	pathFlag = cli.StringFlag{
+		Name:  "path",
+		Usage: "`path` of the route to act on",
+	}
+)
+
+// appArgs returns the arguments of c, starting with an app, then the path of
+// a route when given with --path. The app is that of --app, the first
+// argument when it is not the path of a route, or else the default app, left
+// out when there is none. With --path, the arguments all follow the path.
+func appArgs(c *cli.Context) (cli.Args, error) {
+	args := c.Args()
+	app, routePath := c.String("app"), c.String("path")
+	if app == "" && routePath == "" && len(args) > 0 && !strings.HasPrefix(args[0], "/") {
+		return args, nil
+	}
+	if app == "" {
+		var err error
+		if app, err = defaultApp(); err != nil {
+			return nil, err
+		}
+	}
+	if routePath != "" {
+		args = append(cli.Args{routePath}, args...)
+	}
+	if app == "" {
+		return args, nil
+	}
+	return append(cli.Args{app}, args...), nil
+}
+
+// routeArgs returns the arguments of c as appArgs does, once checked that they
+// hold the arguments named by names, in order: app, path or other ones.
+func routeArgs(c *cli.Context, names ...string) (cli.Args, error) {
+	args, err := appArgs(c)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if i < len(args) && argPresent(name, args[i]) {
+			continue
+		}
+		usage := strings.TrimSpace(firstNonEmpty(c.Command.HelpName, c.Command.Name) + " " + strings.Replace(c.Command.ArgsUsage, "`", "", -1))
+		switch name {
+		case "app":
+			return nil, usageError("the app is missing, give it with --app or first, or set a default app, usage: %s", usage)
+		case "path":
+			return nil, usageError("the path of the route is missing, give it with --path or after the app, usage: %s", usage)
+		}
+		return nil, usageError("the %s is missing, usage: %s", name, usage)
+	}
+	return args, nil
+}
+
+func argPresent(name, arg string) bool {
+	switch name {
+	case "app":
+		// without a default app, the path of the route comes first
+		return arg != "" && !strings.HasPrefix(arg, "/")
+	case "path":
+		return arg != ""
+	}
+	return true
+}
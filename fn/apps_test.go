@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestAppArgs(t *testing.T) {
+	defer func(app string) { globals.app = app }(globals.app)
+	argsOf := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("call", flag.ContinueOnError)
+		set.Parse(args)
+		return cli.NewContext(nil, set, nil)
+	}
+
+	globals.app = ""
+	if args, err := appArgs(argsOf("/hello")); err != nil || !reflect.DeepEqual([]string(args), []string{"/hello"}) {
+		t.Errorf("expected the arguments as they are without a default app, got %v, %v", args, err)
+	}
+
+	globals.app = "myapp"
+	cases := []struct {
+		args, want []string
+	}{
+		{nil, []string{"myapp"}},
+		{[]string{"/hello"}, []string{"myapp", "/hello"}},
+		{[]string{"/hello", "acme/hello"}, []string{"myapp", "/hello", "acme/hello"}},
+		{[]string{"other", "/hello"}, []string{"other", "/hello"}},
+	}
+	for _, c := range cases {
+		args, err := appArgs(argsOf(c.args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([]string(args), c.want) {
+			t.Errorf("appArgs(%v) = %v, want %v", c.args, args, c.want)
+		}
+	}
+}
+
+func TestDefaultAppOfFuncfile(t *testing.T) {
+	defer func(app string) { globals.app = app }(globals.app)
+	globals.app = "myapp"
+
+	dir, err := ioutil.TempDir("", "fn-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "func.yaml"), []byte("name: acme/hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if app, err := defaultApp(); err != nil || app != "myapp" {
+		t.Errorf("expected the app of the context without one in the function file, got %q, %v", app, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "func.yaml"), []byte("name: acme/hello\napp: shop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if app, err := defaultApp(); err != nil || app != "shop" {
+		t.Errorf("expected the app of the function file, got %q, %v", app, err)
+	}
+}
+
+func TestRouteArgs(t *testing.T) {
+	defer func(app string) { globals.app = app }(globals.app)
+	contextOf := func(flags map[string]string, args ...string) *cli.Context {
+		set := flag.NewFlagSet("set", flag.ContinueOnError)
+		set.String("app", "", "")
+		set.String("path", "", "")
+		for k, v := range flags {
+			set.Set(k, v)
+		}
+		set.Parse(args)
+		cmd := cli.Command{Name: "set", HelpName: "fn routes config set", ArgsUsage: "[`app`] /path <key> <value>"}
+		c := cli.NewContext(nil, set, nil)
+		c.Command = cmd
+		return c
+	}
+
+	globals.app = ""
+	cases := []struct {
+		flags   map[string]string
+		args    []string
+		want    []string
+		missing string
+	}{
+		{nil, []string{"myapp", "/hello", "LOG", "debug"}, []string{"myapp", "/hello", "LOG", "debug"}, ""},
+		{map[string]string{"app": "myapp", "path": "/hello"}, []string{"LOG", "debug"}, []string{"myapp", "/hello", "LOG", "debug"}, ""},
+		{map[string]string{"app": "myapp"}, []string{"/hello", "LOG", ""}, []string{"myapp", "/hello", "LOG", ""}, ""},
+		{nil, []string{"/hello", "LOG", "debug"}, nil, "the app is missing"},
+		{map[string]string{"app": "myapp"}, nil, nil, "the path of the route is missing"},
+		{map[string]string{"path": "/hello"}, []string{"LOG"}, nil, "the app is missing"},
+		{map[string]string{"app": "myapp", "path": "/hello"}, []string{"LOG"}, nil, "the value is missing, usage: fn routes config set [app] /path <key> <value>"},
+	}
+	for _, c := range cases {
+		args, err := routeArgs(contextOf(c.flags, c.args...), "app", "path", "key", "value")
+		if c.missing != "" {
+			if err == nil || !strings.Contains(err.Error(), c.missing) {
+				t.Errorf("routeArgs(%v, %v): expected %q, got %v", c.flags, c.args, c.missing, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual([]string(args), c.want) {
+			t.Errorf("routeArgs(%v, %v) = %v, %v, want %v", c.flags, c.args, args, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// auditEntry records an operation that deliberately disturbed an
+// installation, so it can be told apart from a real incident afterwards.
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	APIURL  string    `json:"api_url"`
+	Action  string    `json:"action"`
+	App     string    `json:"app"`
+	Path    string    `json:"path"`
+	Details string    `json:"details,omitempty"`
+}
+
+func auditPath() string {
+	return filepath.Join(fnHome(), "audit.log")
+}
+
+// audit appends an entry to the audit log, one JSON object per line.
+func audit(action, appName, route, details string) error {
+	if err := os.MkdirAll(fnHome(), 0700); err != nil {
+		return err
+	}
+	entry, err := json.Marshal(auditEntry{
+		Time:    time.Now().UTC(),
+		User:    firstNonEmpty(os.Getenv("USER"), os.Getenv("USERNAME")),
+		APIURL:  apiURL().String(),
+		Action:  action,
+		App:     appName,
+		Path:    route,
+		Details: details,
+	})
+	if err != nil {
+		return err
+	}
+	entry = append(entry, '\n')
+
+	if source, _ := stateEncryption(); source != 0 {
+		// an encrypted log is rewritten as a whole
+		b, err := readState(auditPath())
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return writeState(auditPath(), append(b, entry...))
+	}
+
+	f, err := os.OpenFile(auditPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(entry)
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Contexts of production installations can cap how many times a minute fn
+// calls functions through them, so that a load test or a replay aimed at the
+// wrong context does not hit production. The calls of the last minute are
+// kept in ~/.fn/budget, to count those of previous runs too.
+
+const budgetWindow = time.Minute
+
+// callBudget counts calls against the budget of a context.
+type callBudget struct {
+	context string
+	limit   int
+	// override lets calls go over the budget, which are still counted.
+	override bool
+
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func budgetPath(context string) string {
+	return filepath.Join(fnHome(), "budget", url.PathEscape(context)+".json")
+}
+
+// loadBudget returns the budget of the context in use, nil when it has none.
+func loadBudget(override bool) (*callBudget, error) {
+	if globals.callBudget <= 0 {
+		return nil, nil
+	}
+	b := &callBudget{context: globals.contextName, limit: globals.callBudget, override: override}
+	data, err := readState(budgetPath(b.context))
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &b.calls); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", budgetPath(b.context), err)
+	}
+	return b, nil
+}
+
+func (b *callBudget) prune(now time.Time) {
+	i := 0
+	for i < len(b.calls) && now.Sub(b.calls[i]) >= budgetWindow {
+		i++
+	}
+	b.calls = b.calls[i:]
+}
+
+func (b *callBudget) exceeded(n int) error {
+	return usageError("context %s allows %d calls a minute and %d were made in the last one, %d more would exceed it; use --override-budget to go over it",
+		b.context, b.limit, len(b.calls), n)
+}
+
+// check fails when n more calls would exceed the budget, before a run whose
+// number of calls is known.
+func (b *callBudget) check(n int) error {
+	if b == nil || b.override {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(time.Now())
+	if len(b.calls)+n > b.limit {
+		return b.exceeded(n)
+	}
+	return nil
+}
+
+// take counts a call, failing when the budget is spent.
+func (b *callBudget) take() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.prune(now)
+	if !b.override && len(b.calls) >= b.limit {
+		return b.exceeded(1)
+	}
+	b.calls = append(b.calls, now)
+	return nil
+}
+
+// save stores the calls of the last minute for the next runs.
+func (b *callBudget) save() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(time.Now())
+	p := budgetPath(b.context)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(b.calls)
+	if err != nil {
+		return err
+	}
+	return writeState(p, data)
+}
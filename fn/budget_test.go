@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCallBudget(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.contextName = "prod"
+	globals.callBudget = 3
+
+	b, err := loadBudget(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.check(4); err == nil {
+		t.Error("expected 4 calls to exceed a budget of 3")
+	}
+	for i := 0; i < 3; i++ {
+		if err := b.take(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.take(); err == nil {
+		t.Error("expected the 4th call to exceed the budget")
+	} else if e := classify(err); e.Kind != kindValidation {
+		t.Errorf("expected a validation error, got %v", e.Kind)
+	}
+	if err := b.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the calls of previous runs count
+	b, err = loadBudget(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.check(1); err == nil {
+		t.Error("expected the calls of the previous run to be counted")
+	}
+	b, err = loadBudget(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.take(); err != nil {
+		t.Errorf("expected the budget to be overridden, got %v", err)
+	}
+
+	// contexts without a budget have no limit
+	globals.callBudget = 0
+	if b, err := loadBudget(false); b != nil || err != nil {
+		t.Errorf("expected no budget, got %v %v", b, err)
+	}
+}
+
+func TestLoadTestBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	b := &callBudget{context: "prod", limit: 5}
+	report := loadTest(srv.URL, nil, callOptions{budget: b}, loadOptions{concurrency: 3, iterations: 20})
+	if report.Calls != 5 {
+		t.Errorf("expected the load test to stop after 5 calls, made %d", report.Calls)
+	}
+	if report.Stopped == "" || report.failed() != 0 {
+		t.Errorf("expected the load test to be stopped by the budget, got %q and %v", report.Stopped, report.Errors)
+	}
+}
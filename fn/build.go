@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/urfave/cli"
@@ -14,22 +15,41 @@ func build() cli.Command {
 		Name:   "build",
 		Usage:  "build function version",
 		Flags:  flags,
+		Before: loadValues,
 		Action: cmd.build,
 	}
 }
 
 type buildcmd struct {
-	verbose bool
+	verbose            bool
+	verifyReproducible bool
+	builder            string
+	sbom               sbomOptions
 }
 
 func (b *buildcmd) flags() []cli.Flag {
-	return []cli.Flag{
+	flags := []cli.Flag{
 		cli.BoolFlag{
 			Name:        "v",
 			Usage:       "verbose mode",
 			Destination: &b.verbose,
 		},
+		cli.BoolFlag{
+			Name:        "verify-reproducible",
+			Usage:       "build twice without cache and check both images are identical",
+			Destination: &b.verifyReproducible,
+		},
+		buildArgFlag,
+		platformFlag,
+		nativeFlag,
+		builderFlag(&b.builder),
+		registryFlag,
+		envFlag,
+		valuesFlag,
+		setFlag,
 	}
+	flags = append(flags, sbomFlags(&b.sbom)...)
+	return append(flags, cacheFlags...)
 }
 
 // build will take the found valid function and build it
@@ -45,12 +65,52 @@ func (b *buildcmd) build(c *cli.Context) error {
 		return err
 	}
 
+	if err := b.sbom.check(); err != nil {
+		return err
+	}
+
 	fmt.Fprintln(verbwriter, "building", fn)
-	ff, err := buildfunc(verbwriter, fn)
+	opts := buildOptionsFrom(c, b.builder)
+	if b.verifyReproducible {
+		if b.builder != "docker" {
+			return usageError("--verify-reproducible compares the images of the Docker daemon, it needs the docker builder")
+		}
+		return verifyReproducible(verbwriter, fn, opts)
+	}
+	ff, _, err := buildfunc(verbwriter, os.Stdout, fn, opts)
 	if err != nil {
 		return err
 	}
+	if b.sbom.format != "" {
+		if _, err := generateSBOM(os.Stdout, ff.FullName(), ff, b.sbom); err != nil {
+			return err
+		}
+	}
 
 	fmt.Printf("Function %v built successfully.\n", ff.FullName())
 	return nil
 }
+
+// verifyReproducible builds the function twice from scratch, and fails unless
+// both builds give the same image.
+func verifyReproducible(verbwriter io.Writer, fn string, opts buildOptions) error {
+	var ids [2]string
+	var ff *funcfile
+	for i := range ids {
+		var err error
+		opts.noCache = true
+		ff, _, err = buildfunc(verbwriter, os.Stdout, fn, opts)
+		if err != nil {
+			return err
+		}
+		if ids[i], err = imageID(ff.FullName()); err != nil {
+			return err
+		}
+	}
+
+	if ids[0] != ids[1] {
+		return fmt.Errorf("function %v is not reproducible: built %v then %v", ff.FullName(), ids[0], ids[1])
+	}
+	fmt.Printf("Function %v built reproducibly: %v\n", ff.FullName(), ids[0])
+	return nil
+}
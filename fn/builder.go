@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// buildOptions tell builders how to build the image of a function.
+type buildOptions struct {
+	builder string
+
+	// buildArgs are the build-time variables of the Dockerfile, as
+	// KEY=VALUE, those given last taking precedence.
+	buildArgs []string
+	noCache   bool
+
+	// platforms are those the image is built for, as os/arch, that of the
+	// builder by default.
+	platforms []string
+
+	// cacheFrom and cacheTo are the caches layers are imported from and
+	// exported to, as image references or BuildKit cache specs, like
+	// type=local,dest=/tmp/cache. cacheDir is the directory local caches of
+	// every function are kept in.
+	cacheFrom []string
+	cacheTo   []string
+	cacheDir  string
+
+	// native builds Go functions with the local toolchain, instrumented for
+	// coverage with cover, whatever their Dockerfile.
+	native bool
+	cover  bool
+
+	// app is the one the function is deployed to, told to hooks.
+	app string
+
+	// push is only told to daemonless builders, which push images as they
+	// build them, there being no daemon to keep them in.
+	push bool
+}
+
+// builder builds the image of the function of dir from its Dockerfile,
+// returning its digest when it pushed it. Builders other than docker need no
+// Docker daemon, and push as they build.
+type builder func(out io.Writer, dir string, ff *funcfile, epoch int64, opts buildOptions) (string, error)
+
+var builders = map[string]builder{
+	"docker":   dockerBuilder,
+	"buildkit": buildkitBuilder,
+	"kaniko":   kanikoBuilder,
+}
+
+func builderNames() []string {
+	var names []string
+	for name := range builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// platformFlag sets the platforms images are built for, overriding those of
+// function files.
+var platformFlag = cli.StringSliceFlag{
+	Name:  "platform",
+	Usage: "`PLATFORM` to build the image for, as os/arch, eg. linux/arm64, overriding the platforms of the function file, can be repeated or comma-separated",
+}
+
+// cacheFlags control the cache of builds, for builds of monorepos or CI
+// builders without a warm cache to go faster.
+var cacheFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "no-cache",
+		Usage: "build without the cached layers of previous builds",
+	},
+	cli.StringSliceFlag{
+		Name:  "cache-from",
+		Usage: "`CACHE` to import layers from, an image or a BuildKit cache spec like type=registry,ref=acme/cache, can be repeated",
+	},
+	cli.StringSliceFlag{
+		Name:  "cache-to",
+		Usage: "`CACHE` to export layers to, an image or a BuildKit cache spec like type=local,dest=/tmp/cache, can be repeated",
+	},
+	cli.StringFlag{
+		Name:   "cache-dir",
+		Usage:  "`DIR` the local caches of every function are kept in, for builders without a warm cache to reuse them, needing a docker-container buildx builder with docker",
+		EnvVar: "FN_BUILD_CACHE",
+	},
+}
+
+// buildOptionsFrom returns the options of the build the flags of c tell.
+func buildOptionsFrom(c *cli.Context, builder string) buildOptions {
+	return buildOptions{
+		builder:   builder,
+		buildArgs: buildArgs(c),
+		noCache:   c.Bool("no-cache"),
+		platforms: platforms(c),
+		cacheFrom: c.StringSlice("cache-from"),
+		cacheTo:   c.StringSlice("cache-to"),
+		cacheDir:  c.String("cache-dir"),
+		native:    c.Bool("native"),
+	}
+}
+
+// cacheSpec returns the BuildKit cache spec of a cache, images standing for
+// registry caches.
+func cacheSpec(cache string) string {
+	if strings.Contains(cache, "=") {
+		return cache
+	}
+	return "type=registry,ref=" + cache
+}
+
+// withCacheDir adds the local cache of the function in opts.cacheDir to the
+// caches of opts. Functions have caches of their own, which they can export
+// to concurrently. With the docker builder, exporting them needs a buildx
+// builder of the docker-container driver, see checkCacheExport.
+func withCacheDir(opts buildOptions, ff *funcfile) (buildOptions, error) {
+	if opts.cacheDir == "" || opts.noCache {
+		return opts, nil
+	}
+	dir := filepath.Join(opts.cacheDir, strings.Replace(cleanImageName(ff.Name), "/", "_", -1))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return opts, err
+	}
+	opts.cacheFrom = append(opts.cacheFrom[:len(opts.cacheFrom):len(opts.cacheFrom)], "type=local,src="+dir)
+	opts.cacheTo = append(opts.cacheTo[:len(opts.cacheTo):len(opts.cacheTo)], "type=local,dest="+dir+",mode=max")
+	return opts, nil
+}
+
+// platforms returns the platforms given with --platform.
+func platforms(c *cli.Context) []string {
+	var ps []string
+	for _, p := range c.StringSlice("platform") {
+		for _, p := range strings.Split(p, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				ps = append(ps, p)
+			}
+		}
+	}
+	return ps
+}
+
+// builderFlag selects the builder of images, for environments without a
+// Docker daemon.
+func builderFlag(dest *string) cli.Flag {
+	return cli.StringFlag{
+		Name:        "builder",
+		Usage:       "`BUILDER` of the images - docker, buildkit (at $BUILDKIT_HOST) or kaniko",
+		EnvVar:      "FN_BUILDER",
+		Value:       "docker",
+		Destination: dest,
+	}
+}
+
+// dockerBuilder builds with the Docker daemon, sending it a build context
+// whose bytes only depend on the files of dir. Images for other platforms, or
+// whose layers are exported to caches, are built with buildx, those for
+// several platforms being pushed as they are built, as the daemon cannot keep
+// them.
+func dockerBuilder(out io.Writer, dir string, ff *funcfile, epoch int64, opts buildOptions) (string, error) {
+	buildx := len(opts.platforms) > 0 || len(opts.cacheTo) > 0
+	for _, c := range opts.cacheFrom {
+		// only buildx reads cache specs
+		buildx = buildx || strings.Contains(c, "=")
+	}
+
+	if len(opts.cacheTo) > 0 {
+		if err := checkCacheExport(); err != nil {
+			return "", err
+		}
+	}
+
+	args := []string{"build", "-t", ff.FullName()}
+	var metadata string
+	if buildx {
+		args = append([]string{"buildx"}, args...)
+		if len(opts.platforms) > 0 {
+			args = append(args, "--platform", strings.Join(opts.platforms, ","))
+		}
+	}
+	switch {
+	case buildx && len(opts.platforms) <= 1:
+		args = append(args, "--load")
+	case buildx:
+		if opts.push {
+			f, err := ioutil.TempFile("", "fn-buildx")
+			if err != nil {
+				return "", err
+			}
+			f.Close()
+			defer os.Remove(f.Name())
+			metadata = f.Name()
+			args = append(args, "--push", "--metadata-file", metadata)
+		} else {
+			fmt.Fprintf(out, "%s is built for several platforms, it is only kept in the build cache until it is pushed\n", ff.FullName())
+		}
+	}
+	if opts.noCache {
+		args = append(args, "--no-cache")
+	}
+	for _, c := range opts.cacheFrom {
+		if buildx {
+			c = cacheSpec(c)
+		}
+		args = append(args, "--cache-from", c)
+	}
+	for _, c := range opts.cacheTo {
+		args = append(args, "--cache-to", cacheSpec(c))
+	}
+	for _, a := range opts.buildArgs {
+		args = append(args, "--build-arg", a)
+	}
+	cmd := exec.CommandContext(cmdContext(), "docker", append(args, "-")...)
+	cmd.Dir = dir
+	cmd.Stderr = out
+	cmd.Stdout = out
+	tarball, w := io.Pipe()
+	cmd.Stdin = tarball
+	go func() {
+		w.CloseWithError(writeContext(w, dir, epoch))
+	}()
+	err := cmd.Run()
+	tarball.Close()
+	if err != nil {
+		return "", fmt.Errorf("error running docker %s: %v", args[0], err)
+	}
+	if metadata == "" {
+		return "", nil
+	}
+	return readImageDigest(metadata, ff)
+}
+
+// checkCacheExport fails unless the current buildx builder can export caches,
+// which the default one, of the docker driver keeping images in the daemon,
+// rejects.
+func checkCacheExport() error {
+	out, err := exec.CommandContext(cmdContext(), "docker", "buildx", "inspect").Output()
+	if err != nil {
+		return fmt.Errorf("error running docker buildx inspect: %v", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) == 2 && f[0] == "Driver:" && f[1] == "docker" {
+			return usageError("exporting caches needs a buildx builder of the docker-container driver, create one with docker buildx create --use, or build with --builder buildkit")
+		}
+	}
+	return nil
+}
+
+// buildkitBuilder builds with buildctl, against the BuildKit daemon at
+// $BUILDKIT_HOST, local or remote.
+func buildkitBuilder(out io.Writer, dir string, ff *funcfile, epoch int64, opts buildOptions) (string, error) {
+	metadata, err := ioutil.TempFile("", "fn-buildkit")
+	if err != nil {
+		return "", err
+	}
+	metadata.Close()
+	defer os.Remove(metadata.Name())
+
+	args := []string{"build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=" + dir,
+		"--local", "dockerfile=" + dir,
+		"--output", fmt.Sprintf("type=image,name=%s,push=%t", ff.FullName(), opts.push),
+		"--metadata-file", metadata.Name(),
+	}
+	if opts.noCache {
+		args = append(args, "--no-cache")
+	}
+	if len(opts.platforms) > 0 {
+		args = append(args, "--opt", "platform="+strings.Join(opts.platforms, ","))
+	}
+	for _, c := range opts.cacheFrom {
+		args = append(args, "--import-cache", cacheSpec(c))
+	}
+	for _, c := range opts.cacheTo {
+		args = append(args, "--export-cache", cacheSpec(c))
+	}
+	for _, a := range opts.buildArgs {
+		args = append(args, "--opt", "build-arg:"+a)
+	}
+	cmd := exec.CommandContext(cmdContext(), "buildctl", args...)
+	cmd.Stderr = out
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running buildctl build: %v", err)
+	}
+	if !opts.push {
+		return "", nil
+	}
+	return readImageDigest(metadata.Name(), ff)
+}
+
+// readImageDigest reads the digest of the image of the function from the
+// metadata file BuildKit wrote.
+func readImageDigest(metadata string, ff *funcfile) (string, error) {
+	b, err := ioutil.ReadFile(metadata)
+	if err != nil {
+		return "", err
+	}
+	var m struct {
+		Digest string `json:"containerimage.digest"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil || m.Digest == "" {
+		return "", fmt.Errorf("the builder did not tell the digest of %s", ff.FullName())
+	}
+	return m.Digest, nil
+}
+
+// kanikoCacheRepo returns the repository Kaniko caches layers in, the first
+// registry cache of opts, Kaniko having no local caches of layers.
+func kanikoCacheRepo(out io.Writer, opts buildOptions) string {
+	for _, c := range append(opts.cacheTo, opts.cacheFrom...) {
+		spec := cacheSpec(c)
+		if !strings.HasPrefix(spec, "type=registry,") {
+			fmt.Fprintf(out, "kaniko only caches layers in registries, ignoring cache %s\n", c)
+			continue
+		}
+		for _, attr := range strings.Split(spec, ",") {
+			if strings.HasPrefix(attr, "ref=") {
+				return cleanImageName(strings.TrimPrefix(attr, "ref="))
+			}
+		}
+	}
+	return ""
+}
+
+// kanikoBuilder builds with the executor of Kaniko, which runs in an
+// unprivileged container of its own image.
+func kanikoBuilder(out io.Writer, dir string, ff *funcfile, epoch int64, opts buildOptions) (string, error) {
+	if len(opts.platforms) > 1 {
+		return "", usageError("kaniko builds images for one platform at a time, not %s", strings.Join(opts.platforms, ", "))
+	}
+	executor, err := exec.LookPath("executor")
+	if err != nil {
+		executor = "/kaniko/executor"
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	digestFile, err := ioutil.TempFile("", "fn-kaniko")
+	if err != nil {
+		return "", err
+	}
+	digestFile.Close()
+	defer os.Remove(digestFile.Name())
+
+	args := []string{
+		"--context", "dir://" + dir,
+		"--dockerfile", filepath.Join(dir, "Dockerfile"),
+		"--destination", ff.FullName(),
+		"--digest-file", digestFile.Name(),
+		"--reproducible",
+	}
+	if !opts.push {
+		args = append(args, "--no-push")
+	}
+	if len(opts.platforms) == 1 {
+		args = append(args, "--custom-platform", opts.platforms[0])
+	}
+	if !opts.noCache {
+		if repo := kanikoCacheRepo(out, opts); repo != "" {
+			args = append(args, "--cache=true", "--cache-repo", repo)
+		}
+	}
+	for _, a := range opts.buildArgs {
+		args = append(args, "--build-arg", a)
+	}
+	cmd := exec.CommandContext(cmdContext(), executor, args...)
+	cmd.Stderr = out
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running kaniko: %v", err)
+	}
+	if !opts.push {
+		return "", nil
+	}
+
+	b, err := ioutil.ReadFile(digestFile.Name())
+	if err != nil {
+		return "", err
+	}
+	digest := strings.TrimSpace(string(b))
+	if digest == "" {
+		return "", fmt.Errorf("kaniko did not tell the digest of %s", ff.FullName())
+	}
+	return digest, nil
+}
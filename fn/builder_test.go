@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeTool installs a shell script named name in dir, which records its
+// arguments in dir/name.args, one per line, and runs script.
+func fakeTool(t *testing.T, dir, name, script string) {
+	sh := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done > " + filepath.Join(dir, name+".args") + "\n" + script + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(sh), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func toolArgs(t *testing.T, dir, name string) []string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name+".args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestDaemonlessBuilders(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-builders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// the metadata file follows --metadata-file, the digest file --digest-file
+	fakeTool(t, bin, "buildctl", `while [ "$1" != "--metadata-file" ]; do shift; done; echo '{"containerimage.digest": "sha256:b1d"}' > "$2"`)
+	fakeTool(t, bin, "executor", `while [ "$1" != "--digest-file" ]; do shift; done; echo sha256:ca1 > "$2"`)
+
+	ff := &funcfile{Name: "acme/hello", Version: "0.0.2"}
+	opts := buildOptions{buildArgs: []string{"SOURCE_DATE_EPOCH=1500000000", "HTTP_PROXY=http://proxy:3128"}, push: true}
+
+	digest, err := buildkitBuilder(ioutil.Discard, "/src/hello", ff, 1500000000, opts)
+	if err != nil || digest != "sha256:b1d" {
+		t.Errorf("buildkitBuilder() = %q, %v, want sha256:b1d", digest, err)
+	}
+	args := toolArgs(t, bin, "buildctl")
+	want := []string{"build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context=/src/hello",
+		"--local", "dockerfile=/src/hello",
+		"--output", "type=image,name=acme/hello:0.0.2,push=true",
+		"--metadata-file", args[10],
+		"--opt", "build-arg:SOURCE_DATE_EPOCH=1500000000",
+		"--opt", "build-arg:HTTP_PROXY=http://proxy:3128",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("buildctl args = %q, want %q", args, want)
+	}
+
+	digest, err = kanikoBuilder(ioutil.Discard, "/src/hello", ff, 1500000000, opts)
+	if err != nil || digest != "sha256:ca1" {
+		t.Errorf("kanikoBuilder() = %q, %v, want sha256:ca1", digest, err)
+	}
+	args = toolArgs(t, bin, "executor")
+	want = []string{
+		"--context", "dir:///src/hello",
+		"--dockerfile", "/src/hello/Dockerfile",
+		"--destination", "acme/hello:0.0.2",
+		"--digest-file", args[7],
+		"--reproducible",
+		"--build-arg", "SOURCE_DATE_EPOCH=1500000000",
+		"--build-arg", "HTTP_PROXY=http://proxy:3128",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("executor args = %q, want %q", args, want)
+	}
+
+	// images built without pushing have no digest
+	opts.push = false
+	if digest, err := kanikoBuilder(ioutil.Discard, "/src/hello", ff, 1500000000, opts); err != nil || digest != "" {
+		t.Errorf("kanikoBuilder() without pushing = %q, %v, want no digest", digest, err)
+	}
+	if args := toolArgs(t, bin, "executor"); args[len(args)-5] != "--no-push" {
+		t.Errorf("executor args = %q, want --no-push", args)
+	}
+}
+
+func TestBuilderPlatforms(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-builders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	fakeTool(t, bin, "docker", `cat > /dev/null; while [ "$1" != "--metadata-file" ]; do [ $# -eq 0 ] && exit 0; shift; done; echo '{"containerimage.digest": "sha256:a4d"}' > "$2"`)
+
+	ff := &funcfile{Name: "acme/hello", Version: "0.0.2"}
+	cases := []struct {
+		platforms []string
+		push      bool
+		args      string
+		digest    string
+	}{
+		{nil, true, "build -t acme/hello:0.0.2 -", ""},
+		{[]string{"linux/arm64"}, true, "buildx build -t acme/hello:0.0.2 --platform linux/arm64 --load -", ""},
+		{[]string{"linux/amd64", "linux/arm64"}, false, "buildx build -t acme/hello:0.0.2 --platform linux/amd64,linux/arm64 -", ""},
+		{[]string{"linux/amd64", "linux/arm64"}, true, "buildx build -t acme/hello:0.0.2 --platform linux/amd64,linux/arm64 --push --metadata-file METADATA -", "sha256:a4d"},
+	}
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "fn-builders-src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		digest, err := dockerBuilder(ioutil.Discard, dir, ff, 1500000000, buildOptions{platforms: c.platforms, push: c.push})
+		if err != nil || digest != c.digest {
+			t.Errorf("dockerBuilder(%v) = %q, %v, want %q", c.platforms, digest, err, c.digest)
+		}
+		args := toolArgs(t, bin, "docker")
+		for i := range args {
+			if i > 0 && args[i-1] == "--metadata-file" {
+				args[i] = "METADATA"
+			}
+		}
+		if got := strings.Join(args, " "); got != c.args {
+			t.Errorf("dockerBuilder(%v) ran docker %s, want docker %s", c.platforms, got, c.args)
+		}
+	}
+
+	_, err = kanikoBuilder(ioutil.Discard, "/src/hello", ff, 1500000000, buildOptions{platforms: []string{"linux/amd64", "linux/arm64"}})
+	if err == nil {
+		t.Error("kanikoBuilder() for several platforms succeeded, want an error")
+	}
+}
+
+func TestBuilderCaches(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-builders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	driver := filepath.Join(bin, "driver")
+	ioutil.WriteFile(driver, []byte("docker-container"), 0644)
+	fakeTool(t, bin, "docker", `if [ "$1 $2" = "buildx inspect" ]; then echo "Driver: $(cat `+driver+`)"; else cat > /dev/null; fi`)
+
+	ff := &funcfile{Name: "acme/hello", Version: "0.0.2"}
+	cases := []struct {
+		opts buildOptions
+		args string
+	}{
+		{buildOptions{cacheFrom: []string{"acme/hello:0.0.1"}}, "build -t acme/hello:0.0.2 --cache-from acme/hello:0.0.1 -"},
+		{buildOptions{cacheFrom: []string{"acme/cache"}, cacheTo: []string{"type=local,dest=/tmp/cache"}},
+			"buildx build -t acme/hello:0.0.2 --load --cache-from type=registry,ref=acme/cache --cache-to type=local,dest=/tmp/cache -"},
+		{buildOptions{noCache: true}, "build -t acme/hello:0.0.2 --no-cache -"},
+	}
+	for _, c := range cases {
+		if _, err := dockerBuilder(ioutil.Discard, bin, ff, 1500000000, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(toolArgs(t, bin, "docker"), " "); got != c.args {
+			t.Errorf("dockerBuilder(%+v) ran docker %s, want docker %s", c.opts, got, c.args)
+		}
+	}
+
+	// the default builder, of the docker driver, cannot export caches
+	ioutil.WriteFile(driver, []byte("docker"), 0644)
+	if _, err := dockerBuilder(ioutil.Discard, bin, ff, 1500000000, buildOptions{cacheTo: []string{"acme/cache"}}); err == nil {
+		t.Error("dockerBuilder() exported caches with a builder of the docker driver")
+	}
+
+	cacheDir, err := ioutil.TempDir("", "fn-build-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	opts, err := withCacheDir(buildOptions{cacheDir: cacheDir}, ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(cacheDir, "acme_hello")
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		t.Errorf("withCacheDir() did not create %s: %v", dir, err)
+	}
+	if want := []string{"type=local,src=" + dir}; !reflect.DeepEqual(opts.cacheFrom, want) {
+		t.Errorf("withCacheDir() caches from %v, want %v", opts.cacheFrom, want)
+	}
+	if want := []string{"type=local,dest=" + dir + ",mode=max"}; !reflect.DeepEqual(opts.cacheTo, want) {
+		t.Errorf("withCacheDir() caches to %v, want %v", opts.cacheTo, want)
+	}
+
+	var out bytes.Buffer
+	if repo := kanikoCacheRepo(&out, buildOptions{cacheFrom: []string{"type=local,src=/tmp/cache", "acme/cache:latest"}}); repo != "acme/cache" {
+		t.Errorf("kanikoCacheRepo() = %q, want acme/cache", repo)
+	}
+	if !strings.Contains(out.String(), "ignoring cache type=local,src=/tmp/cache") {
+		t.Errorf("kanikoCacheRepo() did not tell it ignores the local cache: %q", out.String())
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// Outcomes of an item of a bulk operation.
+const (
+	bulkSucceeded = "succeeded"
+	bulkFailed    = "failed"
+	bulkSkipped   = "skipped"
+)
+
+// bulkItem is the outcome of an item of a bulk operation.
+type bulkItem struct {
+	Item   string   `json:"item"`
+	Status string   `json:"status"`
+	Reason string   `json:"reason,omitempty"`
+	Error  *fnError `json:"error,omitempty"`
+}
+
+// bulkReport collects the outcome of every item of a bulk operation, so that
+// one failing does not stop the others and all failures are reported at the
+// end. It is safe for concurrent use.
+type bulkReport struct {
+	mu     sync.Mutex
+	action string
+	items  []bulkItem
+	// interrupted counts the items not run, the operation being interrupted.
+	interrupted int
+}
+
+func newBulkReport(action string) *bulkReport {
+	return &bulkReport{action: action}
+}
+
+func (r *bulkReport) add(item bulkItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = append(r.items, item)
+}
+
+func (r *bulkReport) succeed(item string) {
+	r.add(bulkItem{Item: item, Status: bulkSucceeded})
+}
+
+func (r *bulkReport) fail(item string, err error) {
+	r.add(bulkItem{Item: item, Status: bulkFailed, Error: classify(err)})
+}
+
+func (r *bulkReport) skip(item, reason string) {
+	r.add(bulkItem{Item: item, Status: bulkSkipped, Reason: reason})
+}
+
+// interrupt records that item was not run, the operation being interrupted.
+func (r *bulkReport) interrupt(item string) {
+	r.mu.Lock()
+	r.interrupted++
+	r.mu.Unlock()
+	r.skip(item, "interrupted")
+}
+
+// finish records how item went, err being nil when it succeeded. Items cut
+// short by ctx being cancelled are reported as interrupted rather than failed.
+func (r *bulkReport) finish(ctx context.Context, item string, err error) {
+	switch {
+	case err == nil:
+		r.succeed(item)
+	case ctx.Err() != nil:
+		r.interrupt(item)
+	default:
+		r.fail(item, err)
+	}
+}
+
+func (r *bulkReport) count(status string) int {
+	n := 0
+	for _, item := range r.items {
+		if item.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// write writes the report out, as JSON with --output json.
+func (r *bulkReport) write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if globals.output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(struct {
+			Action    string     `json:"action"`
+			Succeeded int        `json:"succeeded"`
+			Failed    int        `json:"failed"`
+			Skipped   int        `json:"skipped"`
+			Items     []bulkItem `json:"items"`
+		}{r.action, r.count(bulkSucceeded), r.count(bulkFailed), r.count(bulkSkipped), r.items})
+	}
+
+	fmt.Fprintf(w, "%s %s, %s failed, %s skipped\n", formatCount(int64(r.count(bulkSucceeded))), r.action,
+		formatCount(int64(r.count(bulkFailed))), formatCount(int64(r.count(bulkSkipped))))
+	for _, item := range r.items {
+		switch item.Status {
+		case bulkFailed:
+			fmt.Fprintf(w, "\tfailed  %s: %s\n", item.Item, item.Error.Message)
+		case bulkSkipped:
+			fmt.Fprintf(w, "\tskipped %s: %s\n", item.Item, item.Reason)
+		}
+	}
+	return nil
+}
+
+// err summarizes the failures. When some items failed and others did not,
+// fn exits with the partial kind; when they all failed, with the kind their
+// errors share if they do.
+func (r *bulkReport) err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := r.count(bulkFailed)
+	if failed == 0 {
+		if r.interrupted > 0 {
+			return &fnError{Kind: kindPartial, Message: fmt.Sprintf("interrupted, %d of %d items were not run", r.interrupted, len(r.items))}
+		}
+		return nil
+	}
+
+	e := &fnError{Kind: kindPartial, Message: fmt.Sprintf("%d of %d items failed", failed, len(r.items)-r.count(bulkSkipped))}
+	if r.count(bulkSucceeded) > 0 {
+		return e
+	}
+	e.Kind = ""
+	for _, item := range r.items {
+		if item.Status != bulkFailed {
+			continue
+		}
+		if e.Kind == "" {
+			e.Kind, e.Status = item.Error.Kind, item.Error.Status
+		} else if e.Kind != item.Error.Kind || e.Status != item.Error.Status {
+			e.Kind, e.Status = kindError, 0
+			break
+		}
+	}
+	return e
+}
+
+// writeTable writes the outcome of every item as a table, followed by the
+// summary, or the report as JSON with --output json.
+func (r *bulkReport) writeTable(w io.Writer) error {
+	if globals.output == "json" {
+		return r.write(w)
+	}
+
+	r.mu.Lock()
+	items := append([]bulkItem{}, r.items...)
+	r.mu.Unlock()
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Item < items[j].Item })
+
+	tw := tabwriter.NewWriter(w, 0, 8, 1, '\t', 0)
+	fmt.Fprint(tw, "item", "\t", "status", "\t", "detail", "\n")
+	for _, item := range items {
+		var detail string
+		switch item.Status {
+		case bulkFailed:
+			detail = item.Error.Message
+		case bulkSkipped:
+			detail = item.Reason
+		}
+		fmt.Fprint(tw, item.Item, "\t", item.Status, "\t", detail, "\n")
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := fmt.Fprintf(w, "%s %s, %s failed, %s skipped\n", formatCount(int64(r.count(bulkSucceeded))), r.action,
+		formatCount(int64(r.count(bulkFailed))), formatCount(int64(r.count(bulkSkipped))))
+	return err
+}
+
+// writeTableAndErr writes the report to stdout as a table and returns its
+// error.
+func (r *bulkReport) writeTableAndErr() error {
+	if err := r.writeTable(os.Stdout); err != nil {
+		return err
+	}
+	return r.err()
+}
+
+// writeAndErr writes the report to stdout and returns its error.
+func (r *bulkReport) writeAndErr() error {
+	if err := r.write(os.Stdout); err != nil {
+		return err
+	}
+	return r.err()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBulkReportErr(t *testing.T) {
+	notFound := newNotFoundError("not found")
+	cases := []struct {
+		outcomes []error
+		kind     string
+		code     int
+	}{
+		{[]error{nil, nil}, "", 0},
+		{[]error{nil, notFound}, kindPartial, 6},
+		{[]error{notFound, notFound}, kindNotFound, 3},
+		{[]error{notFound, errors.New("boom")}, kindError, 1},
+		{[]error{&fnError{Kind: kindFunction, Status: 502}, &fnError{Kind: kindFunction, Status: 502}}, kindFunction, 25},
+	}
+
+	for i, c := range cases {
+		r := newBulkReport("done")
+		r.skip("skipped", "no reason")
+		for _, err := range c.outcomes {
+			if err == nil {
+				r.succeed("ok")
+			} else {
+				r.fail("ko", err)
+			}
+		}
+
+		err := r.err()
+		if c.kind == "" {
+			if err != nil {
+				t.Errorf("case %d: expected no error, got %v", i, err)
+			}
+			continue
+		}
+		e, ok := err.(*fnError)
+		if !ok || e.Kind != c.kind || e.ExitCode() != c.code {
+			t.Errorf("case %d: expected a %s error exiting with %d, got %#v", i, c.kind, c.code, err)
+		}
+	}
+}
+
+func TestBulkReportWriteTable(t *testing.T) {
+	r := newBulkReport("deployed")
+	r.succeed("users/func.yaml")
+	r.fail("orders/func.yaml", errors.New("error running docker build: exit status 1"))
+	r.skip("billing/func.yaml", "unchanged since origin/master")
+
+	var buf bytes.Buffer
+	if err := r.writeTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"item", "status", "detail"},
+		{"billing/func.yaml", "skipped", "unchanged", "since", "origin/master"},
+		{"orders/func.yaml", "failed", "error", "running", "docker", "build:", "exit", "status", "1"},
+		{"users/func.yaml", "succeeded"},
+		{"1", "deployed,", "1", "failed,", "1", "skipped"},
+	}
+	var got [][]string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		got = append(got, strings.Fields(line))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("writeTable() =\n%s", buf.String())
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	bumper "github.com/giantswarm/semver-bump/bump"
 	"github.com/giantswarm/semver-bump/storage"
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
 	"github.com/urfave/cli"
 )
 
@@ -14,6 +16,13 @@ var (
 	initialVersion = "0.0.1"
 )
 
+// Parts of the version to bump.
+const (
+	bumpMajor = "major"
+	bumpMinor = "minor"
+	bumpPatch = "patch"
+)
+
 func bump() cli.Command {
 	cmd := bumpcmd{}
 	flags := append([]cli.Flag{}, cmd.flags()...)
@@ -26,7 +35,13 @@ func bump() cli.Command {
 }
 
 type bumpcmd struct {
-	verbose bool
+	verbose    bool
+	major      bool
+	minor      bool
+	patch      bool
+	gitTag     bool
+	tagPrefix  string
+	allowDirty bool
 }
 
 func (b *bumpcmd) flags() []cli.Flag {
@@ -36,13 +51,70 @@ func (b *bumpcmd) flags() []cli.Flag {
 			Usage:       "verbose mode",
 			Destination: &b.verbose,
 		},
+		cli.BoolFlag{
+			Name:        "major",
+			Usage:       "bump the major version",
+			Destination: &b.major,
+		},
+		cli.BoolFlag{
+			Name:        "minor",
+			Usage:       "bump the minor version",
+			Destination: &b.minor,
+		},
+		cli.BoolFlag{
+			Name:        "patch",
+			Usage:       "bump the patch version, the default",
+			Destination: &b.patch,
+		},
+		cli.BoolFlag{
+			Name:        "git-tag",
+			Usage:       "commit the function file and tag the commit with the new version",
+			Destination: &b.gitTag,
+		},
+		cli.StringFlag{
+			Name:        "tag-prefix",
+			Usage:       "prefix of the git tag, to tell the functions of a repository apart",
+			Value:       "v",
+			Destination: &b.tagPrefix,
+		},
+		allowDirtyFlag(&b.allowDirty),
+	}
+}
+
+func allowDirtyFlag(dest *bool) cli.Flag {
+	return cli.BoolFlag{
+		Name:        "allow-dirty",
+		Usage:       "bump even though the git working tree has uncommitted changes",
+		Destination: dest,
 	}
 }
 
+// part returns the part of the version to bump the flags select.
+func (b *bumpcmd) part() (string, error) {
+	var parts []string
+	for part, set := range map[string]bool{bumpMajor: b.major, bumpMinor: b.minor, bumpPatch: b.patch} {
+		if set {
+			parts = append(parts, part)
+		}
+	}
+	switch len(parts) {
+	case 0:
+		return bumpPatch, nil
+	case 1:
+		return parts[0], nil
+	}
+	return "", usageError("only one of --major, --minor and --patch can be given")
+}
+
 // bump will take the found valid function and bump its version
 func (b *bumpcmd) bump(c *cli.Context) error {
 	verbwriter := verbwriter(b.verbose)
 
+	part, err := b.part()
+	if err != nil {
+		return err
+	}
+
 	path, err := os.Getwd()
 	if err != nil {
 		return err
@@ -52,27 +124,54 @@ func (b *bumpcmd) bump(c *cli.Context) error {
 		return err
 	}
 
-	fmt.Fprintln(verbwriter, "bumping version for", fn)
+	if !b.allowDirty {
+		if err := checkCleanTree(path); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(verbwriter, "bumping", part, "version for", fn)
 
-	funcfile, err := parsefuncfile(fn)
+	funcfile, err := bumpfuncfile(fn, part)
 	if err != nil {
 		return err
 	}
+	fmt.Println("Bumped to version", funcfile.Version)
+
+	if b.gitTag {
+		tag, err := gitTagVersion(fn, funcfile, b.tagPrefix)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Tagged", tag)
+	}
+	return nil
+}
 
-	funcfile, err = bumpversion(*funcfile)
+// bumpfuncfile bumps the part of the version of the function file at fn,
+// storing it back as it is written.
+func bumpfuncfile(fn, part string) (*funcfile, error) {
+	funcfile, err := ffile.Decode(fn)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := storefuncfile(fn, funcfile); err != nil {
-		return err
+	funcfile, err = bumpsemver(*funcfile, part)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Println("Bumped to version", funcfile.Version)
-	return nil
+	if err := ffile.Store(fn, funcfile); err != nil {
+		return nil, err
+	}
+	return funcfile, nil
 }
 
 func bumpversion(funcfile funcfile) (*funcfile, error) {
+	return bumpsemver(funcfile, bumpPatch)
+}
+
+func bumpsemver(funcfile funcfile, part string) (*funcfile, error) {
 	funcfile.Name = cleanImageName(funcfile.Name)
 	if funcfile.Version == "" {
 		funcfile.Version = initialVersion
@@ -85,7 +184,17 @@ func bumpversion(funcfile funcfile) (*funcfile, error) {
 	}
 
 	version := bumper.NewSemverBumper(s, "")
-	newver, err := version.BumpPatchVersion("", "")
+	var newver fmt.Stringer
+	switch part {
+	case bumpMajor:
+		newver, err = version.BumpMajorVersion("", "")
+	case bumpMinor:
+		newver, err = version.BumpMinorVersion("", "")
+	case bumpPatch:
+		newver, err = version.BumpPatchVersion("", "")
+	default:
+		return nil, usageError("cannot bump the %s version, expected one of %s, %s or %s", part, bumpMajor, bumpMinor, bumpPatch)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -94,8 +203,44 @@ func bumpversion(funcfile funcfile) (*funcfile, error) {
 	return &funcfile, nil
 }
 
+// checkCleanTree fails when dir is within a git working tree with uncommitted
+// changes, whose bumped version would not match what is committed.
+func checkCleanTree(dir string) error {
+	if _, err := git(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		// not a git repository
+		return nil
+	}
+	status, err := git(dir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		return usageError("the git working tree has uncommitted changes, commit them or use --allow-dirty")
+	}
+	return nil
+}
+
+// gitTagVersion commits the bumped function file at fn and tags the commit
+// with an annotated tag, prefix followed by the version.
+func gitTagVersion(fn string, ff *funcfile, prefix string) (string, error) {
+	dir, base := filepath.Split(fn)
+	tag := prefix + ff.Version
+	msg := fmt.Sprintf("Bump %s to %s", ff.Name, ff.Version)
+	if _, err := git(dir, "add", "--", base); err != nil {
+		return "", err
+	}
+	if _, err := git(dir, "commit", "-m", msg, "--", base); err != nil {
+		return "", err
+	}
+	if _, err := git(dir, "tag", "-a", tag, "-m", fmt.Sprintf("%s %s", ff.Name, ff.Version)); err != nil {
+		return "", err
+	}
+	return tag, nil
+}
+
 func cleanImageName(name string) string {
-	if i := strings.Index(name, ":"); i != -1 {
+	// the port of the registry is not a tag
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
 		name = name[:i]
 	}
 
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBumpsemver(t *testing.T) {
+	for part, expected := range map[string]string{
+		bumpMajor: "1.0.0",
+		bumpMinor: "0.2.0",
+		bumpPatch: "0.1.4",
+	} {
+		ff, err := bumpsemver(funcfile{Name: "acme/hello:0.1.3", Version: "0.1.3"}, part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ff.Version != expected || ff.Name != "acme/hello" {
+			t.Errorf("expected %s bump to give acme/hello %s, got %s %s", part, expected, ff.Name, ff.Version)
+		}
+	}
+
+	if ff, err := bumpsemver(funcfile{Name: "acme/hello"}, bumpMajor); err != nil || ff.Version != initialVersion {
+		t.Errorf("expected functions without version to start at %s, got %v, %v", initialVersion, ff, err)
+	}
+	if _, err := bumpsemver(funcfile{Version: "0.1.3"}, "micro"); err == nil {
+		t.Error("expected an error for an unknown part")
+	}
+}
+
+func TestBumpGit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-bump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		defer os.Unsetenv(v)
+		os.Setenv(v, "fn@example.org")
+	}
+
+	if err := checkCleanTree(dir); err != nil {
+		t.Errorf("expected directories outside git to be clean, got %v", err)
+	}
+	if _, err := git(dir, "init", "-q"); err != nil {
+		t.Skip(err)
+	}
+
+	fn := filepath.Join(dir, "func.yaml")
+	if err := ioutil.WriteFile(fn, []byte("name: acme/hello\nversion: 0.1.3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCleanTree(dir); err == nil {
+		t.Error("expected an error for a tree with uncommitted changes")
+	}
+
+	ff, err := bumpfuncfile(fn, bumpMinor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := gitTagVersion(fn, ff, "hello-v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "hello-v0.2.0" {
+		t.Errorf("expected tag hello-v0.2.0, got %s", tag)
+	}
+	if out, err := git(dir, "describe", "--tags"); err != nil || out != tag {
+		t.Errorf("expected the commit to be tagged %s, got %q, %v", tag, out, err)
+	}
+	if err := checkCleanTree(dir); err != nil {
+		t.Errorf("expected the function file to be committed, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// With --cache, the lists of apps and routes read from the API are kept in
+// ~/.fn/cache for that long, one directory per context, so that commands run
+// in a row do not read them again. Any change sent to the API drops the
+// cache of the context, whether --cache is given or not.
+
+type cacheableKey struct{}
+
+// cacheable marks the requests made with ctx as ones whose response may be
+// read from the cache.
+func cacheable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheableKey{}, true)
+}
+
+func isCacheable(req *http.Request) bool {
+	ok, _ := req.Context().Value(cacheableKey{}).(bool)
+	return ok && req.Method == "GET" && globals.cacheTTL > 0
+}
+
+type cachedResponse struct {
+	StoredAt time.Time   `json:"stored_at"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+}
+
+func cacheDir() string {
+	return filepath.Join(fnHome(), "cache", url.PathEscape(firstNonEmpty(globals.contextName, "default")))
+}
+
+// cacheFile is where the response to req is kept, per URL and credentials.
+func cacheFile(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Authorization")))
+	return filepath.Join(cacheDir(), hex.EncodeToString(sum[:])+".json")
+}
+
+// lookupCache returns the response to req stored less than --cache ago, if
+// any.
+func lookupCache(req *http.Request) *http.Response {
+	b, err := readState(cacheFile(req))
+	if err != nil {
+		return nil
+	}
+	var c cachedResponse
+	if json.Unmarshal(b, &c) != nil || time.Since(c.StoredAt) >= globals.cacheTTL {
+		return nil
+	}
+	logger.debug("cached response", "url", req.URL.String(), "age", time.Since(c.StoredAt).Round(time.Millisecond))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// storeCache keeps resp, the response to req, when successful, and returns
+// it to be read again. Failing to store it is not an error.
+func storeCache(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	b, err := json.Marshal(cachedResponse{StoredAt: time.Now(), Header: resp.Header, Body: body})
+	if err == nil && os.MkdirAll(cacheDir(), 0700) == nil {
+		// routes may hold secrets, cached encrypted as the rest of the state
+		writeState(cacheFile(req), b)
+	}
+	return resp, nil
+}
+
+// invalidateCache drops what is cached of the API of the context, completions
+// included, once something is changed.
+func invalidateCache() {
+	os.RemoveAll(cacheDir())
+	os.Remove(completionCachePath())
+}
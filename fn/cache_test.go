@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer func(g globalOptions) { globals = g }(globals)
+
+	reads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			reads++
+		}
+		fmt.Fprintf(w, `{"apps":[{"name":"app%d"}]}`, reads)
+	}))
+	defer srv.Close()
+	globals.apiURL = srv.URL
+	globals.cacheTTL = time.Minute
+
+	get := func(ctx context.Context) string {
+		req, _ := http.NewRequest("GET", "/v1/apps", nil)
+		resp, err := (&http.Client{Transport: apiTransport{}}).Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	first := get(cacheable(context.Background()))
+	if again := get(cacheable(context.Background())); again != first || reads != 1 {
+		t.Errorf("expected the apps to be read from the cache, got %s after %s, %d reads", again, first, reads)
+	}
+	if get(context.Background()); reads != 2 {
+		t.Errorf("expected requests not marked cacheable to be sent, got %d reads", reads)
+	}
+
+	// a change drops the cache
+	if err := apiCall("POST", "/v1/apps", strings.NewReader(`{"app":{"name":"other"}}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if get(cacheable(context.Background())); reads != 3 {
+		t.Errorf("expected the apps to be read again once changed, got %d reads", reads)
+	}
+
+	globals.cacheTTL = 0
+	if get(cacheable(context.Background())); reads != 4 {
+		t.Errorf("expected nothing cached without --cache, got %d reads", reads)
+	}
+}
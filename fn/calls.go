@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// Statuses a call ends up with.
+const (
+	callSuccess   = "success"
+	callError     = "error"
+	callTimeout   = "timeout"
+	callCancelled = "cancelled"
+)
+
+// fnCall is a function call, as tracked by the server. Only servers recording
+// calls, which expose them under /v1/apps/:app/calls, know about them.
+type fnCall struct {
+	ID          string    `json:"id"`
+	AppName     string    `json:"app_name"`
+	Path        string    `json:"path"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+func (c *fnCall) done() bool {
+	switch c.Status {
+	case callSuccess, callError, callTimeout, callCancelled:
+		return true
+	}
+	return false
+}
+
+// duration is how long the call ran, empty until it completes.
+func (c *fnCall) duration() string {
+	if c.StartedAt.IsZero() || c.CompletedAt.IsZero() {
+		return ""
+	}
+	return c.CompletedAt.Sub(c.StartedAt).String()
+}
+
+func callPath(appName, id string) string {
+	return path.Join("/v1/apps", url.PathEscape(appName), "calls", url.PathEscape(id))
+}
+
+func getCall(appName, id string) (*fnCall, error) {
+	var w struct {
+		Call *fnCall `json:"call"`
+	}
+	if err := apiCall("GET", callPath(appName, id), nil, &w); err != nil {
+		if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+			e.Message = fmt.Sprintf("call %s not found, the server may not record calls", id)
+		}
+		return nil, err
+	}
+	if w.Call == nil {
+		return nil, newNotFoundError("call " + id + " not found")
+	}
+	return w.Call, nil
+}
+
+// callFilter selects the calls listCalls returns. Zero fields do not filter.
+type callFilter struct {
+	Path   string
+	Status string
+	Since  time.Time
+}
+
+func (f callFilter) match(c *fnCall) bool {
+	return (f.Path == "" || c.Path == f.Path) &&
+		(f.Status == "" || c.Status == f.Status) &&
+		(f.Since.IsZero() || !c.CreatedAt.Before(f.Since))
+}
+
+// listCalls returns the calls of an app matching f, the most recent first.
+// The filter is passed on to the server, and applied again to the calls it
+// returns in case it ignores it.
+func listCalls(appName string, f callFilter) ([]*fnCall, error) {
+	q := url.Values{}
+	if f.Path != "" {
+		q.Set("path", f.Path)
+	}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if !f.Since.IsZero() {
+		q.Set("from", strconv.FormatInt(f.Since.Unix(), 10))
+	}
+	p := path.Join("/v1/apps", url.PathEscape(appName), "calls")
+	if len(q) > 0 {
+		p += "?" + q.Encode()
+	}
+
+	var w struct {
+		Calls []*fnCall `json:"calls"`
+	}
+	if err := apiCall("GET", p, nil, &w); err != nil {
+		if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+			e.Message = fmt.Sprintf("no calls found for %s, the app may not exist or the server may not record calls", appName)
+		}
+		return nil, err
+	}
+
+	var calls []*fnCall
+	for _, c := range w.Calls {
+		if f.match(c) {
+			calls = append(calls, c)
+		}
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].CreatedAt.After(calls[j].CreatedAt) })
+	return calls, nil
+}
+
+// callLog writes the log of a call out.
+func callLog(appName, id string, output io.Writer) error {
+	var w struct {
+		Log struct {
+			Log string `json:"log"`
+		} `json:"log"`
+	}
+	if err := apiCall("GET", callPath(appName, id)+"/log", nil, &w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(output, w.Log.Log)
+	return err
+}
+
+// waitCall polls the server until the call is done, then writes its log out.
+// A call not ending successfully is an error.
+func waitCall(appName, id string, output io.Writer) error {
+	fmt.Fprintln(os.Stderr, "waiting for call", id)
+	delay := 500 * time.Millisecond
+	for {
+		call, err := getCall(appName, id)
+		if err != nil {
+			return err
+		}
+		if call.done() {
+			if err := callLog(appName, id, output); err != nil {
+				fmt.Fprintln(os.Stderr, "could not get the call log:", err)
+			}
+			if call.Status != callSuccess {
+				return &fnError{Kind: kindFunction, Status: 500, Message: fmt.Sprintf("call %s ended with status %s", id, call.Status)}
+			}
+			return nil
+		}
+
+		time.Sleep(delay)
+		if delay < 5*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// asyncCallID tells the ID of the call queued for an async route, read from
+// the response of the server.
+func asyncCallID(body io.Reader) (string, error) {
+	var accepted struct {
+		CallID string `json:"call_id"`
+	}
+	if err := json.NewDecoder(body).Decode(&accepted); err != nil {
+		return "", fmt.Errorf("could not read the call ID: %v", err)
+	}
+	return accepted.CallID, nil
+}
+
+func printCallID(output io.Writer, id string) error {
+	if globals.output == "json" {
+		return json.NewEncoder(output).Encode(map[string]string{"call_id": id})
+	}
+	_, err := fmt.Fprintln(output, id)
+	return err
+}
+
+// Headers in which servers may report how a call was executed.
+const (
+	headerCallID      = "Fn-Call-Id"
+	headerContainerID = "Fn-Container-Id"
+	headerSlot        = "Fn-Slot"
+	headerQueueWait   = "Fn-Queue-Wait"
+)
+
+// callMetadata is what the server tells about the execution of a call, for
+// performance analysis. Servers not reporting it leave it empty.
+type callMetadata struct {
+	CallID      string        `json:"call_id,omitempty"`
+	ContainerID string        `json:"container_id,omitempty"`
+	Slot        string        `json:"slot,omitempty"`
+	QueueWait   time.Duration `json:"queue_wait,omitempty"`
+}
+
+func parseCallMetadata(h http.Header) callMetadata {
+	m := callMetadata{
+		CallID:      h.Get(headerCallID),
+		ContainerID: h.Get(headerContainerID),
+		Slot:        h.Get(headerSlot),
+	}
+	if w := h.Get(headerQueueWait); w != "" {
+		// either a Go duration or milliseconds
+		if d, err := time.ParseDuration(w); err == nil {
+			m.QueueWait = d
+		} else if ms, err := strconv.ParseFloat(w, 64); err == nil {
+			m.QueueWait = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	return m
+}
+
+// callSummary describes how a call went.
+type callSummary struct {
+	Status   int           `json:"status"`
+	Duration time.Duration `json:"duration"`
+	callMetadata
+}
+
+func (s callSummary) String() string {
+	parts := []string{strconv.Itoa(s.Status) + " " + http.StatusText(s.Status), "in " + s.Duration.String()}
+	if s.CallID != "" {
+		parts = append(parts, "call "+s.CallID)
+	}
+	if s.ContainerID != "" {
+		parts = append(parts, "container "+s.ContainerID)
+	}
+	if s.Slot != "" {
+		parts = append(parts, "slot "+s.Slot)
+	}
+	if s.QueueWait > 0 {
+		parts = append(parts, "queued "+s.QueueWait.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+type callsCmd struct{}
+
+func calls() cli.Command {
+	cmd := callsCmd{}
+	return cli.Command{
+		Name:  "calls",
+		Usage: "inspect past function calls, on servers recording them",
+		Subcommands: []cli.Command{
+			{
+				Name:      "list",
+				Aliases:   []string{"l"},
+				Usage:     "list the calls of an app, or of one of its routes",
+				ArgsUsage: "[`app`] [route]",
+				Action:    cmd.list,
+				Flags: []cli.Flag{
+					appFlag,
+					pathFlag,
+					cli.DurationFlag{
+						Name:  "since",
+						Usage: "only list calls made within that duration, eg. 1h",
+					},
+					cli.StringFlag{
+						Name:  "status",
+						Usage: "only list calls with that status: success, error, timeout, cancelled, queued or running",
+					},
+					failOnEmptyFlag,
+				},
+			},
+			{
+				Name:      "get",
+				Usage:     "show the details of a call",
+				ArgsUsage: "`app` `call-id`",
+				Action:    cmd.get,
+			},
+			{
+				Name:      "logs",
+				Usage:     "print the log of a call",
+				ArgsUsage: "`app` `call-id`",
+				Action:    cmd.logs,
+			},
+		},
+	}
+}
+
+func (*callsCmd) list(c *cli.Context) error {
+	args, err := routeArgs(c, "app")
+	if err != nil {
+		return err
+	}
+	appName := args.Get(0)
+	f := callFilter{Status: c.String("status")}
+	if route := args.Get(1); route != "" {
+		f.Path = path.Join("/", route)
+	}
+	if since := c.Duration("since"); since > 0 {
+		f.Since = time.Now().Add(-since)
+	}
+
+	calls, err := listCalls(appName, f)
+	if err != nil {
+		return err
+	}
+	if len(calls) == 0 && c.Bool("fail-on-empty") {
+		return emptyError("calls")
+	}
+
+	if globals.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(calls)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "id", "\t", "path", "\t", "status", "\t", "created", "\t", "duration", "\n")
+	for _, call := range calls {
+		fmt.Fprint(w, call.ID, "\t", call.Path, "\t", call.Status, "\t", call.CreatedAt.Local().Format("2006-01-02 15:04:05"), "\t", call.duration(), "\n")
+	}
+	return w.Flush()
+}
+
+func (*callsCmd) get(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return usageError("calls get takes two arguments: an app name and a call ID")
+	}
+	call, err := getCall(c.Args().Get(0), c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(call)
+}
+
+func (*callsCmd) logs(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return usageError("calls logs takes two arguments: an app name and a call ID")
+	}
+	return callLog(c.Args().Get(0), c.Args().Get(1), os.Stdout)
+}
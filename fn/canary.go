@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	fnclient "github.com/iron-io/functions_go/client"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+// routeCanary sends a share of the calls of a route to another image, on
+// servers splitting traffic. They expose it under
+// /v1/apps/:app/canaries/*route, and list the canaries of an app under
+// /v1/apps/:app/canaries.
+type routeCanary struct {
+	Image  string `json:"image"`
+	Weight int    `json:"weight"`
+}
+
+func canaryPath(appName, route string) string {
+	return path.Join("/v1/apps", url.PathEscape(appName), "canaries", route)
+}
+
+// errNoCanaries is told when the server does not know of canaries, or of the
+// route.
+func errNoCanaries(appName, route string) error {
+	return newNotFoundError(fmt.Sprintf("no canary for %s%s, the route does not exist or the server does not split traffic", appName, route))
+}
+
+// checkCanaries fails unless the server splits the traffic of the app, which
+// servers without canaries, like IronFunctions itself, do not.
+func checkCanaries(appName string) error {
+	err := apiCall("GET", path.Join("/v1/apps", url.PathEscape(appName), "canaries"), nil, nil)
+	e, ok := err.(*fnError)
+	if !ok || e.Kind != kindNotFound {
+		return err
+	}
+	// nor do apps not created yet, whose routes are created as usual
+	if err := apiCall("GET", path.Join("/v1/apps", url.PathEscape(appName)), nil, nil); err != nil {
+		if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+			return nil
+		}
+		return err
+	}
+	return &fnError{Kind: kindValidation, Message: fmt.Sprintf("the server at %s does not split traffic between images, --canary cannot be used with it", host())}
+}
+
+// parseCanaryWeight parses the share of calls, as 10% or 10, canaries get.
+func parseCanaryWeight(s string) (int, error) {
+	w, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if err != nil || w < 1 || w > 99 {
+		return 0, usageError("%s is not a share of calls for the canary, expected a percentage between 1%% and 99%%", s)
+	}
+	return w, nil
+}
+
+func setCanary(appName, route string, c routeCanary) error {
+	b, err := json.Marshal(struct {
+		Canary routeCanary `json:"canary"`
+	}{c})
+	if err != nil {
+		return err
+	}
+	err = apiCall("PUT", canaryPath(appName, route), bytes.NewReader(b), nil)
+	if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+		return errNoCanaries(appName, route)
+	}
+	return err
+}
+
+// getCanary returns the canary of a route, or nil if it has none.
+func getCanary(appName, route string) (*routeCanary, error) {
+	var w struct {
+		Canary *routeCanary `json:"canary"`
+	}
+	if err := apiCall("GET", canaryPath(appName, route), nil, &w); err != nil {
+		if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return w.Canary, nil
+}
+
+func deleteCanary(appName, route string) error {
+	err := apiCall("DELETE", canaryPath(appName, route), nil, nil)
+	if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+		return errNoCanaries(appName, route)
+	}
+	return err
+}
+
+// storeCanary sends the share of the calls of the route given with --canary
+// to its new image. Routes which do not exist yet are created, there being
+// nothing to compare the new image with.
+func (p *deploycmd) storeCanary(ctx context.Context, route fnmodels.Route) error {
+	live, err := liveRoute(p.client, p.appName, route.Path)
+	if err != nil {
+		return err
+	}
+	if live == nil {
+		return p.storeRoute(ctx, route)
+	}
+	if err := setCanary(p.appName, route.Path, routeCanary{route.Image, p.canaryWeight}); err != nil {
+		return err
+	}
+	progressf("%d%% of the calls of %s%s go to %s, promote or abort with fn canary\n", p.canaryWeight, p.appName, route.Path, route.Image)
+	return nil
+}
+
+type canaryCmd struct {
+	client *fnclient.Functions
+}
+
+func canary() cli.Command {
+	c := canaryCmd{client: apiClient()}
+	return cli.Command{
+		Name:  "canary",
+		Usage: "manage the canaries fn deploy --canary sends a share of the calls of routes to",
+		Subcommands: []cli.Command{
+			{
+				Name:      "status",
+				Usage:     "show the canary of a route",
+				ArgsUsage: "`app` `/path`",
+				Action:    c.status,
+			},
+			{
+				Name:      "promote",
+				Usage:     "send every call of a route to its canary",
+				ArgsUsage: "`app` `/path`",
+				Action:    c.promote,
+			},
+			{
+				Name:      "abort",
+				Usage:     "send every call of a route back to its image",
+				ArgsUsage: "`app` `/path`",
+				Action:    c.abort,
+			},
+		},
+	}
+}
+
+func canaryArgs(c *cli.Context) (appName, route string, err error) {
+	if len(c.Args()) < 2 {
+		return "", "", usageError("canary %s takes two arguments: an app name and a path", c.Command.Name)
+	}
+	return c.Args().Get(0), path.Join("/", c.Args().Get(1)), nil
+}
+
+func (cc *canaryCmd) status(c *cli.Context) error {
+	appName, route, err := canaryArgs(c)
+	if err != nil {
+		return err
+	}
+	canary, err := getCanary(appName, route)
+	if err != nil {
+		return err
+	}
+	if canary == nil {
+		return errNoCanaries(appName, route)
+	}
+	fmt.Printf("%d%% of the calls of %s%s go to %s\n", canary.Weight, appName, route, canary.Image)
+	return nil
+}
+
+func (cc *canaryCmd) promote(c *cli.Context) error {
+	appName, route, err := canaryArgs(c)
+	if err != nil {
+		return err
+	}
+	canary, err := getCanary(appName, route)
+	if err != nil {
+		return err
+	}
+	if canary == nil {
+		return errNoCanaries(appName, route)
+	}
+
+	_, err = cc.client.Routes.PatchAppsAppRoutesRoute(&apiroutes.PatchAppsAppRoutesRouteParams{
+		Context: cmdContext(),
+		App:     appName,
+		Route:   route,
+		Body:    &fnmodels.RouteWrapper{Route: &fnmodels.Route{Image: canary.Image}},
+	})
+	if err != nil {
+		return apiError(err)
+	}
+	if err := deleteCanary(appName, route); err != nil {
+		return err
+	}
+	progress(appName, route, "promoted to", canary.Image)
+	return nil
+}
+
+func (cc *canaryCmd) abort(c *cli.Context) error {
+	appName, route, err := canaryArgs(c)
+	if err != nil {
+		return err
+	}
+	if err := deleteCanary(appName, route); err != nil {
+		return err
+	}
+	progress(appName, route, "canary aborted")
+	return nil
+}
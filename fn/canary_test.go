@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseCanaryWeight(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"10%", 10, true},
+		{"25", 25, true},
+		{" 5% ", 5, true},
+		{"0%", 0, false},
+		{"100%", 0, false},
+		{"ten", 0, false},
+	}
+	for _, c := range cases {
+		got, err := parseCanaryWeight(c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("parseCanaryWeight(%q) = %d, %v, want %d, ok %v", c.in, got, err, c.want, c.ok)
+		}
+	}
+}
+
+func TestCanaryAPI(t *testing.T) {
+	canaries := map[string]routeCanary{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/apps/old/canaries/orders" {
+			// servers which do not split traffic
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "PUT":
+			var body struct {
+				Canary routeCanary `json:"canary"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			canaries[r.URL.Path] = body.Canary
+		case "GET":
+			c, ok := canaries[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]routeCanary{"canary": c})
+		case "DELETE":
+			delete(canaries, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+
+	want := routeCanary{Image: "acme/orders:0.0.3", Weight: 10}
+	if err := setCanary("myapp", "/orders", want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getCanary("myapp", "/orders")
+	if err != nil || got == nil || *got != want {
+		t.Fatalf("getCanary() = %v, %v, want %v", got, err, want)
+	}
+	if err := deleteCanary("myapp", "/orders"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := getCanary("myapp", "/orders"); err != nil || got != nil {
+		t.Errorf("getCanary() once deleted = %v, %v, want none", got, err)
+	}
+
+	err = setCanary("old", "/orders", want)
+	if _, ok := err.(*notFoundError); !ok {
+		t.Errorf("setCanary() on a server without canaries = %v, want a not found error", err)
+	}
+}
+
+func TestCheckCanaries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/apps/myapp/canaries":
+			json.NewEncoder(w).Encode(map[string][]routeCanary{"canaries": nil})
+		case "/v1/apps/old":
+			json.NewEncoder(w).Encode(map[string]interface{}{"app": map[string]string{"name": "old"}})
+		default:
+			// servers which do not split traffic, and apps not created yet
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+
+	if err := checkCanaries("myapp"); err != nil {
+		t.Errorf("checkCanaries() on a server splitting traffic = %v", err)
+	}
+	if err := checkCanaries("new"); err != nil {
+		t.Errorf("checkCanaries() of an app not created yet = %v", err)
+	}
+	if e, ok := checkCanaries("old").(*fnError); !ok || e.Kind != kindValidation {
+		t.Errorf("checkCanaries() on a server without canaries = %v, want a validation error", e)
+	}
+}
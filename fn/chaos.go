@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+const defaultChaosImage = "iron/error"
+
+// disruption is what fn needs to put a disabled route back as it was. It is
+// kept on disk while the route is disabled, in case fn does not live long
+// enough to restore it.
+type disruption struct {
+	App   string    `json:"app"`
+	Path  string    `json:"path"`
+	Image string    `json:"image"`
+	Stub  string    `json:"stub"`
+	Until time.Time `json:"until"`
+}
+
+type chaoscmd struct {
+	routesCmd
+}
+
+func chaos() cli.Command {
+	cmd := chaoscmd{routesCmd{client: apiClient()}}
+	return cli.Command{
+		Name:  "chaos",
+		Usage: "inject failures in routes, for game-day drills",
+		Subcommands: []cli.Command{
+			{
+				Name:      "disable",
+				Usage:     "make a route fail for a while, then restore it",
+				ArgsUsage: "`app` /path",
+				Action:    cmd.disable,
+				Flags: []cli.Flag{
+					cli.DurationFlag{
+						Name:  "for",
+						Usage: "how long the route stays disabled",
+						Value: 10 * time.Minute,
+					},
+					cli.StringFlag{
+						Name:  "image",
+						Usage: "image answering instead of the function, it is expected to fail",
+						Value: defaultChaosImage,
+					},
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "restore a route left disabled by an interrupted drill",
+				ArgsUsage: "`app` /path",
+				Action:    cmd.restore,
+			},
+		},
+	}
+}
+
+func (c *chaoscmd) disable(ctx *cli.Context) error {
+	if len(ctx.Args()) < 2 {
+		return usageError("chaos disable takes two arguments: an app name and a path")
+	}
+	appName := ctx.Args().Get(0)
+	route := ctx.Args().Get(1)
+	d := ctx.Duration("for")
+	if d <= 0 {
+		return usageError("--for must be a positive duration")
+	}
+
+	if _, err := readDisruption(appName, route); err == nil {
+		return &fnError{Kind: kindConflict, Message: fmt.Sprintf("%s%s is already disabled, run `fn chaos restore %s %s` first", appName, route, appName, route)}
+	}
+
+	live, err := c.getRoute(appName, route)
+	if err != nil {
+		return err
+	}
+
+	dis := &disruption{
+		App:   appName,
+		Path:  route,
+		Image: live.Image,
+		Stub:  ctx.String("image"),
+		Until: time.Now().Add(d),
+	}
+	if err := writeDisruption(dis); err != nil {
+		return err
+	}
+	if err := c.patchRoute(cmdContext(), appName, route, &fnmodels.Route{Image: dis.Stub}); err != nil {
+		removeDisruption(appName, route)
+		return err
+	}
+	if err := audit("chaos-disable", appName, route, fmt.Sprintf("image %s replaced by %s for %v", dis.Image, dis.Stub, d)); err != nil {
+		fmt.Fprintln(os.Stderr, "could not write the audit log:", err)
+	}
+	fmt.Printf("%s%s disabled until %s, interrupt to restore it earlier\n", appName, route, dis.Until.Format(time.Kitchen))
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	select {
+	case <-time.After(d):
+	case <-sig:
+	}
+
+	return c.restoreRoute(dis)
+}
+
+func (c *chaoscmd) restore(ctx *cli.Context) error {
+	if len(ctx.Args()) < 2 {
+		return usageError("chaos restore takes two arguments: an app name and a path")
+	}
+	appName := ctx.Args().Get(0)
+	route := ctx.Args().Get(1)
+
+	dis, err := readDisruption(appName, route)
+	if err != nil {
+		return err
+	}
+	return c.restoreRoute(dis)
+}
+
+func (c *chaoscmd) restoreRoute(dis *disruption) error {
+	// the route is restored even once fn is interrupted
+	if err := c.patchRoute(detach(cmdContext()), dis.App, dis.Path, &fnmodels.Route{Image: dis.Image}); err != nil {
+		return fmt.Errorf("could not restore %s%s, run `fn chaos restore %s %s`: %v", dis.App, dis.Path, dis.App, dis.Path, err)
+	}
+	if err := audit("chaos-restore", dis.App, dis.Path, "image "+dis.Image+" restored"); err != nil {
+		fmt.Fprintln(os.Stderr, "could not write the audit log:", err)
+	}
+	progress(dis.App+dis.Path, "restored with", dis.Image)
+	return removeDisruption(dis.App, dis.Path)
+}
+
+func (c *chaoscmd) getRoute(appName, route string) (*fnmodels.Route, error) {
+	resp, err := c.client.Routes.GetAppsAppRoutesRoute(&apiroutes.GetAppsAppRoutesRouteParams{
+		Context: cmdContext(),
+		App:     appName,
+		Route:   route,
+	})
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return resp.Payload.Route, nil
+}
+
+func disruptionPath(appName, route string) string {
+	return filepath.Join(fnHome(), "chaos", url.PathEscape(appName+route)+".json")
+}
+
+func readDisruption(appName, route string) (*disruption, error) {
+	b, err := readState(disruptionPath(appName, route))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, newNotFoundError(fmt.Sprintf("no disabled route %s%s", appName, route))
+		}
+		return nil, err
+	}
+	var dis disruption
+	if err := json.Unmarshal(b, &dis); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", disruptionPath(appName, route), err)
+	}
+	return &dis, nil
+}
+
+func writeDisruption(dis *disruption) error {
+	p := disruptionPath(dis.App, dis.Path)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(dis, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeState(p, b)
+}
+
+func removeDisruption(appName, route string) error {
+	return os.Remove(disruptionPath(appName, route))
+}
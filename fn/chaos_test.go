@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+func TestDisruptionState(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+
+	if _, err := readDisruption("myapp", "/hello"); err == nil {
+		t.Error("expected no disruption before one is written")
+	}
+	want := &disruption{App: "myapp", Path: "/hello", Image: "acme/hello:0.0.2", Stub: defaultChaosImage, Until: time.Now().Add(time.Minute).Round(0)}
+	if err := writeDisruption(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readDisruption("myapp", "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.App != want.App || got.Path != want.Path || got.Image != want.Image || got.Stub != want.Stub || !got.Until.Equal(want.Until) {
+		t.Errorf("expected %+v read back, got %+v", want, got)
+	}
+	if _, err := readDisruption("myapp", "/other"); err == nil {
+		t.Error("expected the disruption to be kept per route")
+	}
+}
+
+func TestChaosRestore(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer func(exiter func(int)) { cli.OsExiter = exiter }(cli.OsExiter)
+	cli.OsExiter = func(int) {}
+	defer func(w io.Writer) { cli.ErrWriter = w }(cli.ErrWriter)
+	cli.ErrWriter = ioutil.Discard
+
+	var patched []fnmodels.Route
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/version":
+			// negotiated before patching routes
+			http.NotFound(w, r)
+			return
+		case r.URL.Path != "/v1/apps/myapp/routes/hello":
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		case r.Method == "GET":
+			json.NewEncoder(w).Encode(fnmodels.RouteWrapper{Route: &fnmodels.Route{Path: "/hello", Image: defaultChaosImage}})
+			return
+		}
+		var body fnmodels.RouteWrapper
+		json.NewDecoder(r.Body).Decode(&body)
+		patched = append(patched, *body.Route)
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer srv.Close()
+	defer os.Setenv("API_URL", os.Getenv("API_URL"))
+	os.Setenv("API_URL", srv.URL)
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.apiURL = srv.URL
+
+	if err := newFn().Run([]string{"fn", "chaos", "restore", "myapp", "/hello"}); err == nil {
+		t.Error("expected restoring a route that is not disabled to fail")
+	}
+
+	dis := &disruption{App: "myapp", Path: "/hello", Image: "acme/hello:0.0.2", Stub: defaultChaosImage, Until: time.Now()}
+	if err := writeDisruption(dis); err != nil {
+		t.Fatal(err)
+	}
+	if err := newFn().Run([]string{"fn", "chaos", "restore", "myapp", "/hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(patched) != 1 || patched[0].Image != "acme/hello:0.0.2" {
+		t.Errorf("expected /hello restored with its original image, got %+v", patched)
+	}
+	if _, err := os.Stat(disruptionPath("myapp", "/hello")); !os.IsNotExist(err) {
+		t.Errorf("expected the disruption removed once restored, got %v", err)
+	}
+}
@@ -1,18 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/iron-io/functions/fn/langs"
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	"github.com/urfave/cli"
 )
 
 func verbwriter(verbose bool) io.Writer {
@@ -23,40 +28,57 @@ func verbwriter(verbose bool) io.Writer {
 	return verbwriter
 }
 
-func buildfunc(verbwriter io.Writer, fn string) (*funcfile, error) {
+// buildfunc builds the function of the funcfile fn as opts tell, the output
+// of the builder being written to out. Daemonless builders push the image as
+// they build it, when opts.push is set, the digest of the image pushed being
+// returned.
+func buildfunc(verbwriter, out io.Writer, fn string, opts buildOptions) (*funcfile, string, error) {
 	funcfile, err := parsefuncfile(fn)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if funcfile.Version == "" {
+		// the function file is stored back as it is written
+		if funcfile, err = ffile.Decode(fn); err != nil {
+			return nil, "", err
+		}
 		funcfile, err = bumpversion(*funcfile)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
-		if err := storefuncfile(fn, funcfile); err != nil {
-			return nil, err
+		if err := ffile.Store(fn, funcfile); err != nil {
+			return nil, "", err
 		}
 		funcfile, err = parsefuncfile(fn)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
-	if err := localbuild(verbwriter, fn, funcfile.Build); err != nil {
-		return nil, err
+	if err := runHooks(out, fn, funcfile, "pre_build", hookEnv{app: opts.app}); err != nil {
+		return nil, "", err
 	}
-
-	if err := dockerbuild(verbwriter, fn, funcfile); err != nil {
-		return nil, err
+	start := time.Now()
+	var digest string
+	err = localbuild(verbwriter, fn, funcfile.Build)
+	if err == nil {
+		digest, err = dockerbuild(verbwriter, out, fn, funcfile, opts)
+	}
+	observeBuild(funcfile.Name, err, time.Since(start))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := runHooks(out, fn, funcfile, "post_build", hookEnv{app: opts.app, digest: digest}); err != nil {
+		return nil, "", err
 	}
 
-	return funcfile, nil
+	return funcfile, digest, nil
 }
 
 func localbuild(verbwriter io.Writer, path string, steps []string) error {
 	for _, cmd := range steps {
-		exe := exec.Command("/bin/sh", "-c", cmd)
+		exe := exec.CommandContext(cmdContext(), "/bin/sh", "-c", cmd)
 		exe.Dir = filepath.Dir(path)
 		exe.Stderr = verbwriter
 		exe.Stdout = verbwriter
@@ -68,44 +90,107 @@ func localbuild(verbwriter io.Writer, path string, steps []string) error {
 	return nil
 }
 
-func dockerbuild(verbwriter io.Writer, path string, ff *funcfile) error {
+// dockerbuild builds the image of the function with the Dockerfile of its
+// directory, generating one for its runtime when there is none.
+func dockerbuild(verbwriter, out io.Writer, path string, ff *funcfile, opts buildOptions) (string, error) {
+	b, ok := builders[opts.builder]
+	if !ok {
+		return "", usageError("unknown builder %s, expected one of %s", opts.builder, strings.Join(builderNames(), ", "))
+	}
+
 	dir := filepath.Dir(path)
+	epoch, err := sourceDateEpoch(dir)
+	if err != nil {
+		return "", err
+	}
 
 	var helper langs.LangHelper
-	dockerfile := filepath.Join(dir, "Dockerfile")
-	if !exists(dockerfile) {
-		err := writeTmpDockerfile(dir, ff)
-		defer os.Remove(filepath.Join(dir, "Dockerfile"))
+	switch {
+	case exists(filepath.Join(dir, "Dockerfile")) && !opts.cover:
+	case nativeBuild(ff, opts):
+		ctx, cleanup, err := nativeGoContext(out, dir, ff, opts)
 		if err != nil {
-			return err
+			return "", err
 		}
-		helper, err = langs.GetLangHelper(*ff.Runtime)
+		defer cleanup()
+		dir = ctx
+	default:
+		dockerfile, templated, err := generateDockerfile(verbwriter, ff)
 		if err != nil {
-			return err
+			return "", err
 		}
-		if helper.HasPreBuild() {
-			err := helper.PreBuild()
+		// the templates build functions in the image, other runtimes with
+		// their language helpers
+		if !templated {
+			helper, err = langs.GetLangHelper(*ff.Runtime)
 			if err != nil {
-				return err
+				return "", err
+			}
+			if helper.HasPreBuild() {
+				err := helper.PreBuild()
+				if err != nil {
+					return "", err
+				}
 			}
 		}
+		ctx, cleanup, err := generatedContext(dir, dockerfile)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		fmt.Fprintf(verbwriter, "generated Dockerfile:\n%s", dockerfile)
+		dir = ctx
 	}
 
-	fmt.Printf("Building image %v\n", ff.FullName())
-	cmd := exec.Command("docker", "build", "-t", ff.FullName(), ".")
-	cmd.Dir = dir
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error running docker build: %v", err)
+	fmt.Fprintf(out, "Building image %v with %s\n", ff.FullName(), opts.builder)
+	fmt.Fprintln(verbwriter, "SOURCE_DATE_EPOCH", epoch)
+	// the arguments given last, those of the command line, take precedence
+	opts.buildArgs = append(append([]string{fmt.Sprintf("SOURCE_DATE_EPOCH=%d", epoch)}, funcfileBuildArgs(ff)...), opts.buildArgs...)
+	if len(opts.platforms) == 0 {
+		opts.platforms = ff.Platforms
+	}
+	if opts, err = withCacheDir(opts, ff); err != nil {
+		return "", err
+	}
+	digest, err := b(out, dir, ff, epoch, opts)
+	if err != nil {
+		return "", err
 	}
 	if helper != nil {
 		err := helper.AfterBuild()
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
-	return nil
+	return digest, nil
+}
+
+// funcfileBuildArgs returns the build_args of the function file as
+// KEY=VALUE, sorted for builds to be reproducible.
+func funcfileBuildArgs(ff *funcfile) []string {
+	var keys []string
+	for k := range ff.BuildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, k := range keys {
+		args = append(args, k+"="+ff.BuildArgs[k])
+	}
+	return args
+}
+
+// buildArgFlag sets build-time variables of the Dockerfile, like proxies or
+// tokens of private modules, which differ between environments.
+var buildArgFlag = cli.StringSliceFlag{
+	Name:  "build-arg",
+	Usage: "build-time variable of the Dockerfile, as key=value, overriding those of build_args, can be repeated",
+}
+
+// buildArgs returns the --build-arg flags of c.
+func buildArgs(c *cli.Context) []string {
+	return c.StringSlice("build-arg")
 }
 
 func exists(name string) bool {
@@ -135,81 +220,212 @@ var acceptableFnRuntimes = map[string]string{
 	"dotnet":    "microsoft/dotnet:runtime",
 }
 
-const tplDockerfile = `FROM {{ .BaseImage }}
-WORKDIR /function
-ADD . /function/
-ENTRYPOINT [{{ .Entrypoint }}]
-`
+func extractEnvConfig(configs []string) map[string]string {
+	c := make(map[string]string)
+	for _, v := range configs {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) == 2 {
+			c[kv[0]] = os.ExpandEnv(kv[1])
+		}
+	}
+	return c
+}
+
+// pushBackoff is the time before the first retry of a push, doubled at every
+// retry.
+var pushBackoff = 2 * time.Second
+
+// pushedDigest matches the digest of the manifest docker push tells.
+var pushedDigest = regexp.MustCompile(`digest: (sha256:[0-9a-f]{64})`)
+
+// transientPushErrors are the errors of registries and networks retrying is
+// known to fix, others failing the push at once.
+var transientPushErrors = []string{
+	"timeout",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"unexpected eof",
+	"temporary failure",
+	"too many requests",
+	"toomanyrequests",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"blob upload unknown",
+}
+
+func transientPushError(output string) bool {
+	output = strings.ToLower(output)
+	for _, e := range transientPushErrors {
+		if strings.Contains(output, e) {
+			return true
+		}
+	}
+	return false
+}
 
-func writeTmpDockerfile(dir string, ff *funcfile) error {
-	if ff.Entrypoint == nil || *ff.Entrypoint == "" {
-		return errors.New("entrypoint is missing")
+// dockerpush pushes the image of the function, retrying transient failures of
+// the registry up to retries times, and returns the digest of its manifest
+// once verified. Retries resume where the failed push stopped, docker
+// skipping the layers the registry already has.
+func dockerpush(out io.Writer, ff *funcfile, retries int) (string, error) {
+	image := ff.FullName()
+	backoff := pushBackoff
+	var output bytes.Buffer
+	for attempt := 0; ; attempt++ {
+		output.Reset()
+		cmd := exec.CommandContext(cmdContext(), "docker", "push", image)
+		cmd.Stderr = io.MultiWriter(out, &output)
+		cmd.Stdout = cmd.Stderr
+		err := cmd.Run()
+		if err == nil {
+			break
+		}
+		if attempt >= retries || !transientPushError(output.String()) {
+			return "", fmt.Errorf("error running docker push: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "pushing %s failed, retrying in %v (%d of %d)\n", image, backoff, attempt+1, retries)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxRetryDelay {
+			backoff = maxRetryDelay
+		}
 	}
 
-	runtime, tag := ff.RuntimeTag()
-	rt, ok := acceptableFnRuntimes[runtime]
-	if !ok {
-		return fmt.Errorf("cannot use runtime %s", runtime)
+	m := pushedDigest.FindStringSubmatch(output.String())
+	if m == nil {
+		return "", fmt.Errorf("docker push did not tell the digest of %s", image)
 	}
+	return m[1], verifyDigest(out, image, m[1])
+}
 
-	if tag != "" {
-		rt = fmt.Sprintf("%s:%s", rt, tag)
+// verifyDigest checks the registry serves the image as the digest docker
+// pushed, which it does not when the tag was pushed to since or the push was
+// corrupted. Docker versions without docker manifest are not checked.
+func verifyDigest(out io.Writer, image, digest string) error {
+	b, err := exec.Command("docker", "manifest", "inspect", "--verbose", image).Output()
+	if err != nil {
+		fmt.Fprintf(out, "could not verify the digest of %s: %v\n", image, err)
+		return nil
+	}
+	var m struct {
+		Descriptor struct {
+			Digest string `json:"digest"`
+		}
 	}
+	if err := json.Unmarshal(b, &m); err != nil || m.Descriptor.Digest == "" {
+		fmt.Fprintf(out, "could not verify the digest of %s: docker manifest did not tell it\n", image)
+		return nil
+	}
+	if m.Descriptor.Digest != digest {
+		return fmt.Errorf("the registry serves %s as %s, not as %s which was pushed", image, m.Descriptor.Digest, digest)
+	}
+	return nil
+}
 
-	fd, err := os.Create(filepath.Join(dir, "Dockerfile"))
+// dockerdigest returns the immutable repository@sha256 reference of a pushed
+// image.
+func dockerdigest(image string) (string, error) {
+	out, err := exec.Command("docker", "inspect", "--format", `{{join .RepoDigests "\n"}}`, image).Output()
 	if err != nil {
-		return err
+		return "", fmt.Errorf("error running docker inspect: %v", err)
 	}
 
-	// convert entrypoint string to slice
-	epvals := strings.Fields(*ff.Entrypoint)
-	var buffer bytes.Buffer
-	for i, s := range epvals {
-		if i > 0 {
-			buffer.WriteString(", ")
+	repo := cleanImageName(image)
+	for _, d := range strings.Fields(string(out)) {
+		if strings.HasPrefix(d, repo+"@") {
+			return d, nil
 		}
-		buffer.WriteString("\"")
-		buffer.WriteString(s)
-		buffer.WriteString("\"")
+	}
+	return "", fmt.Errorf("no repository digest found for %s, was the image pushed?", image)
+}
+
+// storeDigest records the digest of the pushed image of the function file at
+// path in its image_digest.
+func storeDigest(path string, ff *funcfile, digest string) error {
+	ff.ImageDigest = digest
+	if globals.values != nil {
+		// templates are not written to
+		return nil
 	}
 
-	t := template.Must(template.New("Dockerfile").Parse(tplDockerfile))
-	err = t.Execute(fd, struct {
-		BaseImage, Entrypoint string
-	}{rt, buffer.String()})
-	fd.Close()
-	return err
+	// the function file is stored back as it is written
+	raw, err := ffile.Decode(path)
+	if err != nil {
+		return err
+	}
+	raw.ImageDigest = ff.ImageDigest
+	return ffile.Store(path, raw)
 }
 
-func extractEnvConfig(configs []string) map[string]string {
-	c := make(map[string]string)
-	for _, v := range configs {
-		kv := strings.SplitN(v, "=", 2)
-		if len(kv) == 2 {
-			c[kv[0]] = os.ExpandEnv(kv[1])
-		}
+// pinDigestFlag sets routes to the digest of their image, which cannot change
+// unlike its tag.
+var pinDigestFlag = cli.BoolFlag{
+	Name:  "pin-digest",
+	Usage: "set the route image by its digest rather than its tag",
+}
+
+// retryFlag sets how many times pushes failing on transient registry errors,
+// like timeouts, are retried.
+func retryFlag(dest *int) cli.Flag {
+	return cli.IntFlag{
+		Name:        "retry",
+		Usage:       "retry pushes failing on transient registry errors `N` times",
+		Value:       3,
+		EnvVar:      "FN_PUSH_RETRY",
+		Destination: dest,
 	}
-	return c
 }
 
-func dockerpush(ff *funcfile) error {
-	cmd := exec.Command("docker", "push", ff.FullName())
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error running docker push: %v", err)
+// failOnEmptyFlag makes list commands fail when they list nothing, for
+// existence checks in scripts.
+var failOnEmptyFlag = cli.BoolFlag{
+	Name:  "fail-on-empty",
+	Usage: "exit with status 2 when nothing is listed",
+}
+
+// envFlag selects the environment of function files.
+var envFlag = cli.StringFlag{
+	Name:        "env",
+	Usage:       "environment of the function file whose settings are used, eg. prod",
+	EnvVar:      "FN_ENV",
+	Destination: &globals.environment,
+}
+
+// registryFlag sets the registry images are pushed to.
+var registryFlag = cli.StringFlag{
+	Name:        "registry",
+	Usage:       "`REGISTRY` the images are pushed to, overriding the registry of the function file, eg. 123456789012.dkr.ecr.us-east-1.amazonaws.com",
+	Destination: &globals.pushRegistry,
+}
+
+// stdinLines is shared by the interactive prompts, so that answers piped in
+// are not lost in the buffer of a previous prompt.
+var stdinLines = bufio.NewReader(os.Stdin)
+
+// confirm asks the user a yes/no question on the terminal, defaulting to no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := stdinLines.ReadString('\n')
+	if err != nil {
+		return false
 	}
-	return nil
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
-func appNamePath(img string) (string, string) {
-	sep := strings.Index(img, "/")
-	if sep < 0 {
-		return "", ""
+// ask prompts the user for a value on the terminal, def being used when the
+// answer is empty.
+func ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
 	}
-	tag := strings.Index(img[sep:], ":")
-	if tag < 0 {
-		tag = len(img[sep:])
+	answer, _ := stdinLines.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
 	}
-	return img[:sep], img[sep : sep+tag]
+	return def
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+// Servers silently drop the route fields they do not know of. Before routes
+// are sent, the version of the server is asked once, and fields it is too
+// old to store are warned about, or refused with --strict-compat.
+
+// defaultRouteTimeout is the timeout of routes on servers not storing any.
+const defaultRouteTimeout = 30
+
+type compatField struct {
+	name string
+	// since is the first version of the server storing the field.
+	since string
+	// set tells whether the field is sent with a value other than the one
+	// servers assume without it.
+	set func(r *fnmodels.Route) bool
+}
+
+var routeCompatFields = []compatField{
+	{"headers", "0.2.0", func(r *fnmodels.Route) bool { return len(r.Headers) > 0 }},
+	{"format", "0.2.0", func(r *fnmodels.Route) bool { return r.Format != "" && r.Format != "default" }},
+	{"max_concurrency", "0.2.0", func(r *fnmodels.Route) bool { return r.MaxConcurrency > 1 }},
+	{"timeout", "0.2.0", func(r *fnmodels.Route) bool {
+		return r.Timeout != nil && *r.Timeout > 0 && *r.Timeout != defaultRouteTimeout
+	}},
+}
+
+var negotiated struct {
+	once    sync.Once
+	version string
+}
+
+// negotiatedVersion is the version of the server, asked once, empty when it
+// could not be.
+func negotiatedVersion() string {
+	negotiated.once.Do(func() {
+		v, err := serverVersion()
+		if err != nil {
+			logger.debug("could not get the version of the server, not checking compatibility", "error", err)
+			return
+		}
+		logger.debug("server version", "version", v)
+		negotiated.version = v
+	})
+	return negotiated.version
+}
+
+// unsupportedFields returns the fields set in routes which servers of version
+// drop, with the versions storing them.
+func unsupportedFields(version string, routes ...*fnmodels.Route) []string {
+	if version == "" {
+		return nil
+	}
+	var fields []string
+	for _, f := range routeCompatFields {
+		if compareVersions(version, f.since) >= 0 {
+			continue
+		}
+		for _, r := range routes {
+			if f.set(r) {
+				fields = append(fields, fmt.Sprintf("%s (since %s)", f.name, f.since))
+				break
+			}
+		}
+	}
+	return fields
+}
+
+// checkRouteCompat warns when the server would drop fields set in routes, or
+// fails with --strict-compat.
+func checkRouteCompat(routes ...*fnmodels.Route) error {
+	version := negotiatedVersion()
+	fields := unsupportedFields(version, routes...)
+	if len(fields) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("the server, version %s, does not support %s and would ignore it", version, strings.Join(fields, ", "))
+	if globals.strictCompat {
+		return &fnError{Kind: kindValidation, Message: msg + ", upgrade it or leave those out"}
+	}
+	logger.warn(msg + ", use --strict-compat to fail instead")
+	return nil
+}
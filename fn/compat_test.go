@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestUnsupportedFields(t *testing.T) {
+	timeout := int64(60)
+	hot := &fnmodels.Route{Path: "/hot", Format: "http", MaxConcurrency: 4, Timeout: &timeout}
+	plain := &fnmodels.Route{Path: "/plain", Format: "default", MaxConcurrency: 1}
+
+	want := []string{"format (since 0.2.0)", "max_concurrency (since 0.2.0)", "timeout (since 0.2.0)"}
+	if got := unsupportedFields("0.1.9", plain, hot); !reflect.DeepEqual(got, want) {
+		t.Errorf("unsupportedFields(0.1.9) = %q, want %q", got, want)
+	}
+	if got := unsupportedFields("0.1.9", plain); got != nil {
+		t.Errorf("expected fields left to their defaults to be supported, got %q", got)
+	}
+	if got := unsupportedFields("0.2.21", hot); got != nil {
+		t.Errorf("expected a recent server to support every field, got %q", got)
+	}
+	if got := unsupportedFields("", hot); got != nil {
+		t.Errorf("expected nothing to be checked for an unknown version, got %q", got)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	apiapps "github.com/iron-io/functions_go/client/apps"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	"github.com/urfave/cli"
+)
+
+// Shells complete fn by running fn __complete with the words typed so far,
+// the last one being the word completed, which prints the candidates one a
+// line: commands, flags, and the apps and routes of the API for the arguments
+// naming them, kept in ~/.fn/completion for a little while so that pressing
+// tab does not query the API every time.
+
+const (
+	completeCommandName = "__complete"
+	// completionTTL is how long the apps and routes of the API are cached.
+	completionTTL = 30 * time.Second
+	// completionTimeout is how long the API is waited for, completion going
+	// without apps and routes after that.
+	completionTimeout = 2 * time.Second
+)
+
+var completionScripts = map[string]string{
+	"bash": `# fn completion for bash, load it with: source <(fn completion bash)
+_fn_complete() {
+    local IFS=$'\n'
+    COMPREPLY=($(fn ` + completeCommandName + ` "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _fn_complete fn
+`,
+	"zsh": `#compdef fn
+# fn completion for zsh, load it with: source <(fn completion zsh)
+_fn() {
+    local -a candidates
+    candidates=(${(f)"$(fn ` + completeCommandName + ` "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    compadd -- $candidates
+}
+compdef _fn fn
+`,
+	"fish": `# fn completion for fish, load it with: fn completion fish | source
+function __fn_complete
+    fn ` + completeCommandName + ` (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c fn -f -a '(__fn_complete)'
+`,
+}
+
+func completion() cli.Command {
+	return cli.Command{
+		Name:      "completion",
+		Usage:     "print the script completing the commands, flags, apps and routes of fn in a shell",
+		ArgsUsage: "bash|zsh|fish",
+		Action: func(c *cli.Context) error {
+			script, ok := completionScripts[c.Args().First()]
+			if !ok {
+				return usageError("completion takes a shell: bash, zsh or fish")
+			}
+			fmt.Print(script)
+			return nil
+		},
+	}
+}
+
+// completeCommand prints the candidates of the word completed.
+func completeCommand() cli.Command {
+	return cli.Command{
+		Name:            completeCommandName,
+		Hidden:          true,
+		SkipFlagParsing: true,
+		Action: func(c *cli.Context) error {
+			for _, s := range complete(c.App.Commands, c.App.Flags, c.Args(), apiCompleter{}) {
+				fmt.Println(s)
+			}
+			return nil
+		},
+	}
+}
+
+// completer lists the apps and routes of the API, nil when they cannot be
+// listed.
+type completer interface {
+	apps() []string
+	routes(app string) []string
+}
+
+// complete returns the candidates of the last of words, the previous ones
+// selecting the command.
+func complete(cmds []cli.Command, flags []cli.Flag, words []string, api completer) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, words := words[len(words)-1], words[:len(words)-1]
+
+	var cmd *cli.Command
+	var args []string
+	takesValue := false
+	for _, w := range words {
+		switch {
+		case takesValue:
+			takesValue = false
+		case strings.HasPrefix(w, "-"):
+			f := findFlag(flags, w)
+			takesValue = f != nil && !strings.Contains(w, "=") && flagTakesValue(f)
+		case len(args) == 0 && findCommand(cmds, w) != nil:
+			cmd = findCommand(cmds, w)
+			cmds, flags = cmd.Subcommands, cmd.Flags
+		default:
+			args = append(args, w)
+		}
+	}
+
+	var candidates []string
+	switch {
+	case takesValue:
+		// values are only known for apps
+		if f := findFlag(flags, words[len(words)-1]); f != nil && flagNames(f)[0] == "--app" {
+			candidates = api.apps()
+		}
+	case strings.HasPrefix(cur, "-"):
+		for _, f := range flags {
+			candidates = append(candidates, flagNames(f)...)
+		}
+	case len(cmds) > 0 && len(args) == 0:
+		for _, c := range cmds {
+			if c.Name != completeCommandName {
+				candidates = append(candidates, c.Names()...)
+			}
+		}
+	case cmd != nil:
+		candidates = completeArgs(cmd.ArgsUsage, args, cur, api)
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, cur) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completeArgs completes the arguments of commands taking an app and a route
+// path, as told by their usage, the app being the default one when a path is
+// given first.
+func completeArgs(usage string, args []string, cur string, api completer) []string {
+	if !strings.Contains(usage, "`app`") {
+		return nil
+	}
+	switch {
+	case len(args) == 0 && strings.HasPrefix(cur, "/") && strings.Contains(usage, "/path"):
+		if app, err := defaultApp(); err == nil && app != "" {
+			return api.routes(app)
+		}
+	case len(args) == 0:
+		return api.apps()
+	case len(args) == 1 && strings.Contains(usage, "/path"):
+		return api.routes(args[0])
+	}
+	return nil
+}
+
+func findCommand(cmds []cli.Command, name string) *cli.Command {
+	for i := range cmds {
+		if cmds[i].HasName(name) {
+			return &cmds[i]
+		}
+	}
+	return nil
+}
+
+func findFlag(flags []cli.Flag, word string) cli.Flag {
+	word = strings.SplitN(word, "=", 2)[0]
+	for _, f := range flags {
+		for _, name := range flagNames(f) {
+			if name == word {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// flagNames are the names of f as typed, like --config and -c.
+func flagNames(f cli.Flag) []string {
+	var names []string
+	for _, name := range strings.Split(f.GetName(), ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 1 {
+			names = append(names, "-"+name)
+		} else if name != "" {
+			names = append(names, "--"+name)
+		}
+	}
+	return names
+}
+
+func flagTakesValue(f cli.Flag) bool {
+	switch f.(type) {
+	case cli.BoolFlag, cli.BoolTFlag:
+		return false
+	}
+	return true
+}
+
+// apiCompleter lists the apps and routes of the API of the context in use,
+// through a cache.
+type apiCompleter struct{}
+
+func (apiCompleter) apps() []string {
+	return cachedCompletion("apps", func(ctx context.Context) ([]string, error) {
+		resp, err := apiClient().Apps.GetApps(&apiapps.GetAppsParams{Context: cacheable(ctx)})
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, app := range resp.Payload.Apps {
+			names = append(names, app.Name)
+		}
+		return names, nil
+	})
+}
+
+func (apiCompleter) routes(app string) []string {
+	return cachedCompletion("routes/"+app, func(ctx context.Context) ([]string, error) {
+		resp, err := apiClient().Routes.GetAppsAppRoutes(&apiroutes.GetAppsAppRoutesParams{Context: cacheable(ctx), App: app})
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for _, r := range resp.Payload.Routes {
+			paths = append(paths, r.Path)
+		}
+		return paths, nil
+	})
+}
+
+type completionEntry struct {
+	At     time.Time `json:"at"`
+	Values []string  `json:"values"`
+}
+
+func completionCachePath() string {
+	return filepath.Join(fnHome(), "completion", url.PathEscape(globals.contextName)+".json")
+}
+
+// cachedCompletion returns the values listed under key less than
+// completionTTL ago, or else lists them again. Errors are not reported,
+// completion is best effort.
+func cachedCompletion(key string, list func(ctx context.Context) ([]string, error)) []string {
+	entries := make(map[string]completionEntry)
+	if b, err := readState(completionCachePath()); err == nil {
+		json.Unmarshal(b, &entries)
+	}
+	if e, ok := entries[key]; ok && time.Since(e.At) < completionTTL {
+		return e.Values
+	}
+
+	ctx, cancel := context.WithTimeout(cmdContext(), completionTimeout)
+	defer cancel()
+	values, err := list(ctx)
+	if err != nil {
+		return nil
+	}
+	entries[key] = completionEntry{At: time.Now(), Values: values}
+	if b, err := json.Marshal(entries); err == nil {
+		if os.MkdirAll(filepath.Dir(completionCachePath()), 0700) == nil {
+			writeState(completionCachePath(), b)
+		}
+	}
+	return values
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type fakeCompleter struct{}
+
+func (fakeCompleter) apps() []string { return []string{"myapp", "other"} }
+
+func (fakeCompleter) routes(app string) []string {
+	if app == "myapp" {
+		return []string{"/hello", "/hi"}
+	}
+	return nil
+}
+
+func TestComplete(t *testing.T) {
+	defer func(app string) { globals.app = app }(globals.app)
+	globals.app = "myapp"
+
+	app := newFn()
+	cases := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{"ro"}, []string{"routes"}},
+		{[]string{"routes", "cr"}, []string{"create"}},
+		{[]string{"routes", "call", ""}, []string{"myapp", "other"}},
+		{[]string{"routes", "call", "myapp", "/h"}, []string{"/hello", "/hi"}},
+		{[]string{"call", "/hel"}, []string{"/hello"}},
+		{[]string{"routes", "call", "--method", "POST", "myapp", "/hi"}, []string{"/hi"}},
+		{[]string{"--context", "prod", "apps", "ins"}, []string{"inspect"}},
+		{[]string{"routes", "list", "--fail"}, []string{"--fail-on-empty"}},
+		{[]string{"support-bundle", "--app", "o"}, []string{"other"}},
+		{[]string{"run", "x"}, nil},
+	}
+	for _, c := range cases {
+		if got := complete(app.Commands, app.Flags, c.words, fakeCompleter{}); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("complete(%q) = %q, want %q", c.words, got, c.want)
+		}
+	}
+}
+
+func TestCachedCompletion(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+
+	calls := 0
+	list := func(ctx context.Context) ([]string, error) {
+		calls++
+		return []string{"myapp"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		if got := cachedCompletion("apps", list); !reflect.DeepEqual(got, []string{"myapp"}) {
+			t.Errorf("cachedCompletion() = %v, want [myapp]", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the API to be listed once, got %d times", calls)
+	}
+
+	failing := func(ctx context.Context) ([]string, error) { return nil, errors.New("unreachable") }
+	if got := cachedCompletion("routes/myapp", failing); got != nil {
+		t.Errorf("expected no routes when the API cannot be reached, got %v", got)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultContextName = "default"
+
+// config is the persistent fn configuration, stored in ~/.fn/config.yaml. It
+// holds a set of named contexts, each describing how to reach one IronFunctions
+// installation, and which of them is currently in use, as well as the user
+// command aliases.
+type config struct {
+	CurrentContext string                `yaml:"current-context,omitempty"`
+	Contexts       map[string]*fnContext `yaml:"contexts,omitempty"`
+	Aliases        map[string]string     `yaml:"alias,omitempty"`
+}
+
+type fnContext struct {
+	APIURL   string `yaml:"api-url,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+	TLSCA    string `yaml:"tls-ca,omitempty"`
+	TLSCert  string `yaml:"tls-cert,omitempty"`
+	TLSKey   string `yaml:"tls-key,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"`
+	Registry string `yaml:"registry,omitempty"`
+	// App is the one commands act on when they are given none.
+	App string `yaml:"app,omitempty"`
+	// CallBudget caps the function calls a minute made through the context.
+	CallBudget int `yaml:"call-budget,omitempty"`
+}
+
+// fnHome is where fn keeps its configuration and state, $FN_HOME or ~/.fn.
+func fnHome() string {
+	if h := os.Getenv("FN_HOME"); h != "" {
+		return h
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(home, ".fn")
+}
+
+func configPath() string {
+	return filepath.Join(fnHome(), "config.yaml")
+}
+
+func loadConfig() (*config, error) {
+	cfg := &config{Contexts: make(map[string]*fnContext)}
+	b, err := readState(configPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("could not read %s: %v", configPath(), err)
+	}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", configPath(), err)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = make(map[string]*fnContext)
+	}
+	return cfg, nil
+}
+
+func storeConfig(cfg *config) error {
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("could not encode configuration: %v", err)
+	}
+	if err := os.MkdirAll(fnHome(), 0700); err != nil {
+		return err
+	}
+	// contexts may carry tokens and key paths, keep it private.
+	return writeState(configPath(), b)
+}
+
+// context returns the named context, or the current one when name is empty.
+// A missing context is not an error, fn works fine without any configuration.
+func (cfg *config) context(name string) (*fnContext, error) {
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		name = defaultContextName
+	}
+	ctx, ok := cfg.Contexts[name]
+	if !ok {
+		if name != defaultContextName && name != cfg.CurrentContext {
+			return nil, fmt.Errorf("context %s not found in %s", name, configPath())
+		}
+		return &fnContext{}, nil
+	}
+	return ctx, nil
+}
+
+type contextCmd struct{}
+
+func contexts() cli.Command {
+	ctx := contextCmd{}
+	return cli.Command{
+		Name:  "context",
+		Usage: "manage the IronFunctions installations fn talks to",
+		Subcommands: []cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"l"},
+				Usage:   "list contexts",
+				Action:  ctx.list,
+			},
+			{
+				Name:      "use",
+				Aliases:   []string{"u"},
+				Usage:     "make `context` the current one",
+				ArgsUsage: "`context`",
+				Action:    ctx.use,
+			},
+			{
+				Name:      "set-app",
+				Usage:     "make `app` the one commands act on when they are given none, in the current context",
+				ArgsUsage: "`app`",
+				Action:    ctx.setApp,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "unset",
+						Usage: "stop acting on an app by default",
+					},
+				},
+			},
+			{
+				Name:      "set",
+				Aliases:   []string{"s"},
+				Usage:     "create or update a `context`",
+				ArgsUsage: "`context`",
+				Action:    ctx.set,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "api-url",
+						Usage: "IronFunctions remote API address",
+					},
+					cli.StringFlag{
+						Name:  "token",
+						Usage: "bearer token sent to the API",
+					},
+					cli.StringFlag{
+						Name:  "tls-ca",
+						Usage: "PEM encoded CA bundle used to verify the server",
+					},
+					cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "PEM encoded client certificate",
+					},
+					cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "PEM encoded client certificate key",
+					},
+					cli.BoolFlag{
+						Name:  "insecure",
+						Usage: "skip server certificate verification",
+					},
+					cli.StringFlag{
+						Name:  "registry",
+						Usage: "Docker Hub user or registry new functions are pushed to",
+					},
+					cli.IntFlag{
+						Name:  "call-budget",
+						Usage: "function calls a minute allowed through the context, 0 for no limit",
+					},
+					cli.StringFlag{
+						Name:  "app",
+						Usage: "app commands act on when they are given none",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (ctx *contextCmd) list(c *cli.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range cfg.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "current", "\t", "name", "\t", "api-url", "\n")
+	for _, name := range names {
+		current := ""
+		if name == cfg.CurrentContext {
+			current = "*"
+		}
+		fmt.Fprint(w, current, "\t", name, "\t", cfg.Contexts[name].APIURL, "\n")
+	}
+	return w.Flush()
+}
+
+func (ctx *contextCmd) use(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return usageError("missing context name")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Contexts[name]; !ok {
+		return &fnError{Kind: kindNotFound, Message: fmt.Sprintf("context %s does not exist", name)}
+	}
+	cfg.CurrentContext = name
+	if err := storeConfig(cfg); err != nil {
+		return err
+	}
+
+	progress("now using context", name)
+	return nil
+}
+
+func (ctx *contextCmd) set(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return usageError("missing context name")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	fctx, ok := cfg.Contexts[name]
+	if !ok {
+		fctx = &fnContext{}
+		cfg.Contexts[name] = fctx
+	}
+	if c.IsSet("api-url") {
+		fctx.APIURL = c.String("api-url")
+	}
+	if c.IsSet("token") {
+		fctx.Token = c.String("token")
+	}
+	if c.IsSet("tls-ca") {
+		fctx.TLSCA = c.String("tls-ca")
+	}
+	if c.IsSet("tls-cert") {
+		fctx.TLSCert = c.String("tls-cert")
+	}
+	if c.IsSet("tls-key") {
+		fctx.TLSKey = c.String("tls-key")
+	}
+	if c.IsSet("insecure") {
+		fctx.Insecure = c.Bool("insecure")
+	}
+	if c.IsSet("registry") {
+		fctx.Registry = c.String("registry")
+	}
+	if c.IsSet("call-budget") {
+		fctx.CallBudget = c.Int("call-budget")
+	}
+	if c.IsSet("app") {
+		fctx.App = c.String("app")
+	}
+	if cfg.CurrentContext == "" {
+		cfg.CurrentContext = name
+	}
+	if err := storeConfig(cfg); err != nil {
+		return err
+	}
+
+	progress("context", name, "updated")
+	return nil
+}
+
+func (ctx *contextCmd) setApp(c *cli.Context) error {
+	app := c.Args().First()
+	if app == "" && !c.Bool("unset") {
+		return usageError("missing app name, or --unset")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := globals.contextName
+	fctx, ok := cfg.Contexts[name]
+	if !ok {
+		fctx = &fnContext{}
+		cfg.Contexts[name] = fctx
+	}
+	fctx.App = app
+	if err := storeConfig(cfg); err != nil {
+		return err
+	}
+
+	if app == "" {
+		progress("context", name, "has no default app anymore")
+	} else {
+		progress("context", name, "now acts on app", app, "by default")
+	}
+	return nil
+}
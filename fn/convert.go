@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	"github.com/urfave/cli"
+)
+
+func convertFuncfile() cli.Command {
+	return cli.Command{
+		Name:      "convert-funcfile",
+		Usage:     "convert a function file to YAML, JSON or TOML",
+		ArgsUsage: "[path]",
+		Action:    convertFuncfileAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "format to convert to - yaml, json or toml",
+			},
+			cli.BoolFlag{
+				Name:  "keep",
+				Usage: "keep the original function file",
+			},
+		},
+	}
+}
+
+func convertFuncfileAction(c *cli.Context) error {
+	var ext string
+	switch c.String("to") {
+	case "yaml":
+		ext = ".yaml"
+	case "json":
+		ext = ".json"
+	case "toml":
+		ext = ".toml"
+	case "":
+		return usageError("the format to convert to is missing, use --to yaml, json or toml")
+	default:
+		return usageError("unknown function file format %s, expected yaml, json or toml", c.String("to"))
+	}
+
+	from, err := funcfileArg(c)
+	if err != nil {
+		return err
+	}
+	to := filepath.Join(filepath.Dir(from), "func"+ext)
+	if filepath.Ext(from) == ext || (ext == ".yaml" && filepath.Ext(from) == ".yml") {
+		return usageError("%s is already in %s", from, c.String("to"))
+	}
+	if exists(to) {
+		return usageError("%s exists already", to)
+	}
+
+	// the function file is converted as it is written
+	ff, err := ffile.Decode(from)
+	if err != nil {
+		return err
+	}
+	if err := ffile.Store(to, ff); err != nil {
+		return err
+	}
+	if !c.Bool("keep") {
+		if err := os.Remove(from); err != nil {
+			return err
+		}
+	}
+
+	progress("Converted", from, "to", to)
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/urfave/cli"
+)
+
+// cosignOptions tell how images are signed with cosign, and how their
+// signatures are verified: with a key, or keylessly with the identity the
+// certificate of the signature was issued to.
+type cosignOptions struct {
+	sign    bool
+	signKey string
+
+	verifyKey string
+	identity  string
+	issuer    string
+}
+
+func signFlags(o *cosignOptions) []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:        "sign",
+			Usage:       "sign pushed images with cosign, with --sign-key or else keylessly",
+			Destination: &o.sign,
+		},
+		cli.StringFlag{
+			Name:        "sign-key",
+			Usage:       "cosign `KEY` images are signed with, a file or KMS URI, its password being read from $COSIGN_PASSWORD",
+			EnvVar:      "FN_COSIGN_KEY",
+			Destination: &o.signKey,
+		},
+	}
+}
+
+func verifyImageFlags(o *cosignOptions) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "verify-key",
+			Usage:       "public `KEY` of cosign signatures, a file or KMS URI",
+			EnvVar:      "FN_COSIGN_VERIFY_KEY",
+			Destination: &o.verifyKey,
+		},
+		cli.StringFlag{
+			Name:        "certificate-identity",
+			Usage:       "`IDENTITY`, like an email, keyless signatures are expected from",
+			Destination: &o.identity,
+		},
+		cli.StringFlag{
+			Name:        "certificate-oidc-issuer",
+			Usage:       "`URL` of the OIDC issuer of keyless signatures",
+			Destination: &o.issuer,
+		},
+	}
+}
+
+// verifies tells whether signatures are to be verified.
+func (o *cosignOptions) verifies() bool {
+	return o.verifyKey != "" || o.identity != "" || o.issuer != ""
+}
+
+func (o *cosignOptions) checkVerify() error {
+	if o.verifyKey == "" && (o.identity == "" || o.issuer == "") {
+		return usageError("verifying signatures needs the --verify-key, or the --certificate-identity and --certificate-oidc-issuer of keyless ones")
+	}
+	return nil
+}
+
+// signImage signs the image pushed as digest, a repository@sha256 reference,
+// signing tags being pointless as they can be moved.
+func signImage(out io.Writer, digest string, o cosignOptions) error {
+	args := []string{"sign", "--yes"}
+	if o.signKey != "" {
+		args = append(args, "--key", o.signKey)
+	}
+	cmd := exec.CommandContext(cmdContext(), "cosign", append(args, digest)...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running cosign sign: %v", err)
+	}
+	fmt.Fprintln(out, "signed", digest)
+	return nil
+}
+
+// verifyImage checks the image has a valid signature, of the key or
+// identity of o.
+func verifyImage(out io.Writer, image string, o cosignOptions) error {
+	args := []string{"verify", "--output", "text"}
+	if o.verifyKey != "" {
+		args = append(args, "--key", o.verifyKey)
+	} else {
+		args = append(args, "--certificate-identity", o.identity, "--certificate-oidc-issuer", o.issuer)
+	}
+	cmd := exec.CommandContext(cmdContext(), "cosign", append(args, image)...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return &fnError{Kind: kindValidation, Message: fmt.Sprintf("%s has no valid signature", image)}
+		}
+		return fmt.Errorf("error running cosign verify: %v", err)
+	}
+	return nil
+}
+
+func verifyImageCmd() cli.Command {
+	var o cosignOptions
+	return cli.Command{
+		Name:      "verify-image",
+		Usage:     "check an image has a valid cosign signature",
+		ArgsUsage: "`image`",
+		Flags:     verifyImageFlags(&o),
+		Action: func(c *cli.Context) error {
+			image := c.Args().First()
+			if image == "" {
+				return usageError("the image is missing")
+			}
+			if err := o.checkVerify(); err != nil {
+				return err
+			}
+			// cosign tells why signatures are not valid
+			if err := verifyImage(os.Stderr, image, o); err != nil {
+				return err
+			}
+			fmt.Println(image, "has a valid signature")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCosign(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-cosign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// signatures of images whose digest is sha256:bad are not valid
+	fakeTool(t, bin, "cosign", `for a; do :; done; case "$a" in *sha256:bad) exit 10;; esac`)
+	digest := "acme/hello@sha256:a4d"
+
+	cases := []struct {
+		opts cosignOptions
+		args string
+	}{
+		{cosignOptions{sign: true}, "sign --yes " + digest},
+		{cosignOptions{sign: true, signKey: "cosign.key"}, "sign --yes --key cosign.key " + digest},
+	}
+	for _, c := range cases {
+		if err := signImage(ioutil.Discard, digest, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(toolArgs(t, bin, "cosign"), " "); got != c.args {
+			t.Errorf("signImage(%+v) ran cosign %s, want cosign %s", c.opts, got, c.args)
+		}
+	}
+
+	keyless := cosignOptions{identity: "ci@acme.com", issuer: "https://token.actions.githubusercontent.com"}
+	if err := verifyImage(ioutil.Discard, digest, keyless); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(toolArgs(t, bin, "cosign"), " "), "verify --output text --certificate-identity ci@acme.com --certificate-oidc-issuer https://token.actions.githubusercontent.com "+digest; got != want {
+		t.Errorf("verifyImage() ran cosign %s, want cosign %s", got, want)
+	}
+	err = verifyImage(ioutil.Discard, "acme/hello@sha256:bad", cosignOptions{verifyKey: "cosign.pub"})
+	if e, ok := err.(*fnError); !ok || e.Kind != kindValidation {
+		t.Errorf("verifyImage() of an image without a valid signature = %v, want a validation error", err)
+	}
+
+	for _, o := range []cosignOptions{{identity: "ci@acme.com"}, {}} {
+		if err := o.checkVerify(); err == nil {
+			t.Errorf("checkVerify() of %+v succeeded, want an error", o)
+		}
+	}
+}
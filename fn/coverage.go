@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// coverageDir is the directory of the container instrumented functions write
+// their coverage counters to.
+const coverageDir = "/fn-coverage"
+
+// coverage collects the coverage of a Go function over the runs of its tests:
+// the function is built with the local toolchain, instrumented, into an image
+// of its own, whose runs all write their counters to the same directory.
+type coverage struct {
+	image string
+	dir   string
+}
+
+// newCoverage builds the instrumented image of the function of path, with go
+// 1.20 or later.
+func newCoverage(out io.Writer, path string, ff *funcfile) (*coverage, error) {
+	if rt, _ := ff.RuntimeTag(); rt != "go" {
+		return nil, usageError("--coverage is only supported by go functions, not %s ones", rt)
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		return nil, usageError("--coverage needs the go toolchain: %v", err)
+	}
+
+	// the image of the function is left as it is
+	covff := *ff
+	covff.Version = strings.TrimPrefix(ff.Version+"-coverage", "-")
+	if _, err := dockerbuild(ioutil.Discard, out, path, &covff, buildOptions{builder: "docker", native: true, cover: true}); err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "fn-coverage")
+	if err != nil {
+		return nil, err
+	}
+	// for functions not running as root
+	if err := os.Chmod(dir, 0777); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &coverage{image: covff.FullName(), dir: dir}, nil
+}
+
+// options are those of runs of the instrumented function.
+func (c *coverage) options(opts runOptions) runOptions {
+	opts.env = append(append([]string(nil), opts.env...), kvEq("GOCOVERDIR", coverageDir))
+	opts.binds = append(append([]string(nil), opts.binds...), c.dir+":"+coverageDir)
+	return opts
+}
+
+// report merges the counters of every run into the coverprofile file, writes
+// it as HTML next to it and prints the coverage of the packages of the
+// function.
+func (c *coverage) report(out io.Writer, profile string) error {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("the function wrote no coverage counters, was it built with go 1.20 or later?")
+	}
+	html := strings.TrimSuffix(profile, filepath.Ext(profile)) + ".html"
+	for _, args := range [][]string{
+		{"tool", "covdata", "textfmt", "-i=" + c.dir, "-o=" + profile},
+		{"tool", "cover", "-html=" + profile, "-o=" + html},
+		{"tool", "covdata", "percent", "-i=" + c.dir},
+	} {
+		cmd := exec.Command("go", args...)
+		cmd.Stdout, cmd.Stderr = out, out
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("error running go tool %s: %v", args[1], err)
+		}
+	}
+	fmt.Fprintf(out, "coverage profile written to %s, report to %s\n", profile, html)
+	return nil
+}
+
+// close removes the counters.
+func (c *coverage) close() {
+	os.RemoveAll(c.dir)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoverageBuildsInstrumented(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-cover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	fakeTool(t, bin, "go", `while [ "$1" != "-o" ]; do shift; done; echo binary > "$2"`)
+
+	str := func(s string) *string { return &s }
+	ff := &funcfile{Name: "acme/hello", Runtime: str("go")}
+	ctx, cleanup, err := nativeGoContext(ioutil.Discard, bin, ff, buildOptions{native: true, cover: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	want := "build -trimpath -ldflags -s -w -buildid= -cover -covermode=atomic -o " + filepath.Join(ctx, "func") + " ."
+	if got := strings.Join(toolArgs(t, bin, "go"), " "); got != want {
+		t.Errorf("expected go %s, got go %s", want, got)
+	}
+
+	if _, err := newCoverage(ioutil.Discard, "func.yaml", &funcfile{Name: "acme/hello", Runtime: str("node")}); err == nil {
+		t.Error("expected coverage of a node function to fail")
+	}
+}
+
+func TestCoverageOptions(t *testing.T) {
+	c := &coverage{image: "acme/hello:0.0.2-coverage", dir: "/tmp/counters"}
+	local := runOptions{env: []string{"ROUTE=/hello"}}
+	opts := c.options(local)
+	if want := []string{"ROUTE=/hello", "GOCOVERDIR=" + coverageDir}; !reflect.DeepEqual(opts.env, want) {
+		t.Errorf("expected env %v, got %v", want, opts.env)
+	}
+	if want := []string{"/tmp/counters:" + coverageDir}; !reflect.DeepEqual(opts.binds, want) {
+		t.Errorf("expected binds %v, got %v", want, opts.binds)
+	}
+	if len(local.env) != 1 {
+		t.Errorf("expected the options given to be left as they are, got %v", local.env)
+	}
+}
+
+func TestCoverageReport(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-cover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	// every go tool run is logged
+	fakeTool(t, bin, "go", `echo "$@" >> `+filepath.Join(bin, "runs"))
+
+	c := &coverage{dir: filepath.Join(bin, "counters")}
+	if err := os.Mkdir(c.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := c.report(&out, "cover.out"); err == nil {
+		t.Error("expected a report without counters to fail")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(c.dir, "covcounters.1"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.report(&out, filepath.Join(bin, "cover.out")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(bin, "runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "tool covdata textfmt -i=" + c.dir + " -o=" + filepath.Join(bin, "cover.out") + "\n" +
+		"tool cover -html=" + filepath.Join(bin, "cover.out") + " -o=" + filepath.Join(bin, "cover.html") + "\n" +
+		"tool covdata percent -i=" + c.dir + "\n"
+	if string(b) != want {
+		t.Errorf("expected go runs:\n%s\ngot:\n%s", want, b)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// curl prints the curl command equivalent to the call, instead of making it.
+// The request is prepared by newCallRequest, like the calls fn makes, while
+// the payload is referenced rather than inlined when it comes from a file or
+// stdin.
+func (a *routesCmd) curl(c *cli.Context, u string, content io.Reader, opts callOptions) error {
+	for _, name := range []string{"sign-key", "input-ndjson", "iterations", "duration", "wait", "base64"} {
+		if c.IsSet(name) {
+			return usageError("--%s cannot be used with --curl", name)
+		}
+	}
+
+	var data []string
+	switch {
+	case c.IsSet("data"):
+		data = []string{"--data-binary", c.String("data")}
+	case c.IsSet("body-file"):
+		data = []string{"--data-binary", "@" + c.String("body-file")}
+	case c.IsSet("form"):
+		for _, field := range c.StringSlice("form") {
+			data = append(data, "-F", field)
+		}
+	case content != nil:
+		// stdin is left for curl to read
+		data = []string{"--data-binary", "@-"}
+		content = strings.NewReader("")
+	}
+
+	req, err := newCallRequest(u, content, opts)
+	if err != nil {
+		return err
+	}
+	if c.IsSet("form") {
+		// curl makes up its own multipart boundary
+		req.Header.Del("Content-Type")
+	}
+
+	fmt.Println(curlCommand(req, data, curlOptions{
+		include: opts.include,
+		stream:  opts.stream,
+		output:  c.String("output-file"),
+	}))
+	return nil
+}
+
+type curlOptions struct {
+	include, stream bool
+	output          string
+}
+
+// curlCommand renders req as a curl command line, data being the arguments
+// passing its payload.
+func curlCommand(req *http.Request, data []string, opts curlOptions) string {
+	args := []string{"curl"}
+	add := func(a ...string) {
+		for _, s := range a {
+			args = append(args, shellQuote(s))
+		}
+	}
+
+	method := "GET"
+	if len(data) > 0 {
+		method = "POST"
+	}
+	if req.Method != method {
+		add("-X", req.Method)
+	}
+	if opts.include {
+		add("-i")
+	}
+	if opts.stream {
+		add("-N")
+	} else if globals.callTimeout > 0 {
+		add("--max-time", fmt.Sprint(globals.callTimeout.Seconds()))
+	}
+	if globals.insecure {
+		add("-k")
+	}
+	if globals.tlsCA != "" {
+		add("--cacert", globals.tlsCA)
+	}
+	if globals.tlsCert != "" {
+		add("--cert", globals.tlsCert, "--key", globals.tlsKey)
+	}
+
+	var names []string
+	for k := range req.Header {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		for _, v := range req.Header[k] {
+			add("-H", k+": "+v)
+		}
+	}
+
+	add(data...)
+	if opts.output != "" {
+		add("-o", opts.output)
+	}
+	add(req.URL.String())
+	return strings.Join(args, " ")
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
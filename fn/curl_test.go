@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCurlCommand(t *testing.T) {
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.token = "secret"
+	globals.callTimeout = 30 * time.Second
+
+	headers := http.Header{"X-Trace": {"it's me"}}
+	req, err := newCallRequest("http://localhost:8080/r/myapp/hello?name=a%20b", strings.NewReader(`{"name": "Johnny"}`), callOptions{headers: headers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := curlCommand(req, []string{"--data-binary", "@payload.json"}, curlOptions{include: true})
+	expected := `curl -i --max-time 30 -H 'Content-Type: application/json' -H 'X-Trace: it'\''s me' --data-binary @payload.json 'http://localhost:8080/r/myapp/hello?name=a%20b'`
+	if cmd != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, cmd)
+	}
+	if strings.Contains(cmd, "secret") {
+		t.Error("expected the token, which calls do not send, to be left out")
+	}
+
+	req, err = newCallRequest("http://localhost:8080/r/myapp/hello", nil, callOptions{method: "DELETE", stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd = curlCommand(req, nil, curlOptions{stream: true, output: "out.txt"})
+	expected = `curl -X DELETE -N -H 'Accept: text/event-stream, */*' -H 'Content-Type: application/json' -o out.txt http://localhost:8080/r/myapp/hello`
+	if cmd != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, cmd)
+	}
+}
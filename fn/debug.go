@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// debugTimeout is the timeout of functions being debugged, which stop at
+// breakpoints for as long as it takes.
+const debugTimeout = 24 * time.Hour
+
+// debugger runs the functions of a runtime under a debugger listening on a
+// port, which waits for an editor to attach before running them.
+type debugger struct {
+	port int
+	// command wraps the entrypoint of the function with the debugger.
+	command func(entrypoint []string, port int) []string
+	// needs tells what the image of the function needs for the debugger.
+	needs string
+	// attach tells how editors attach to the debugger.
+	attach func(port int) string
+}
+
+var debuggers = map[string]debugger{
+	"go": {
+		port: 2345,
+		command: func(entrypoint []string, port int) []string {
+			cmd := []string{"dlv", "exec", "--headless", "--api-version=2", "--accept-multiclient", "--listen=:" + strconv.Itoa(port), entrypoint[0]}
+			if len(entrypoint) > 1 {
+				cmd = append(append(cmd, "--"), entrypoint[1:]...)
+			}
+			return cmd
+		},
+		needs: `dlv on its PATH, and the function built with -gcflags="all=-N -l", eg. with a Dockerfile like:
+    FROM iron/go:dev
+    RUN go get github.com/go-delve/delve/cmd/dlv
+    WORKDIR /go/src/function
+    COPY . .
+    RUN go build -gcflags="all=-N -l" -o func`,
+		attach: func(port int) string {
+			return fmt.Sprintf(`VS Code, in .vscode/launch.json:
+    {"name": "fn debug", "type": "go", "request": "attach", "mode": "remote",
+     "host": "127.0.0.1", "port": %d,
+     "substitutePath": [{"from": "${workspaceFolder}", "to": "/go/src/function"}]}
+GoLand: a Go Remote configuration on localhost:%d
+dlv: dlv connect localhost:%d`, port, port, port)
+		},
+	},
+	"node": {
+		port: 9229,
+		command: func(entrypoint []string, port int) []string {
+			return append([]string{entrypoint[0], "--inspect-brk=0.0.0.0:" + strconv.Itoa(port)}, entrypoint[1:]...)
+		},
+		attach: func(port int) string {
+			return fmt.Sprintf(`VS Code, in .vscode/launch.json:
+    {"name": "fn debug", "type": "node", "request": "attach", "port": %d,
+     "localRoot": "${workspaceFolder}", "remoteRoot": "/function"}
+Chrome: chrome://inspect, with localhost:%d among the targets
+WebStorm: an Attach to Node.js configuration on localhost:%d`, port, port, port)
+		},
+	},
+	"python": {
+		port: 5678,
+		command: func(entrypoint []string, port int) []string {
+			return append([]string{entrypoint[0], "-m", "debugpy", "--listen", "0.0.0.0:" + strconv.Itoa(port), "--wait-for-client"}, entrypoint[1:]...)
+		},
+		needs: "python 3 and debugpy, eg. listed in requirements.txt",
+		attach: func(port int) string {
+			return fmt.Sprintf(`VS Code, in .vscode/launch.json:
+    {"name": "fn debug", "type": "python", "request": "attach",
+     "connect": {"host": "localhost", "port": %d},
+     "pathMappings": [{"localRoot": "${workspaceFolder}", "remoteRoot": "/function"}]}
+other editors: those speaking the Debug Adapter Protocol, on localhost:%d`, port, port)
+		},
+	},
+}
+
+func debuggerNames() []string {
+	var names []string
+	for name := range debuggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func debug() cli.Command {
+	cmd := debugcmd{}
+	return cli.Command{
+		Name:   "debug",
+		Usage:  "run the function locally under the debugger of its runtime, waiting for an editor to attach",
+		Flags:  cmd.flags(),
+		Before: loadValues,
+		Action: cmd.debug,
+	}
+}
+
+type debugcmd struct {
+	port  int
+	build bool
+}
+
+func (d *debugcmd) flags() []cli.Flag {
+	return append([]cli.Flag{
+		cli.IntFlag{
+			Name:        "port",
+			Usage:       "`PORT` the debugger listens on, that of the runtime by default: " + d.defaultPorts(),
+			Destination: &d.port,
+		},
+		cli.BoolFlag{
+			Name:        "b",
+			Usage:       "build before debugging",
+			Destination: &d.build,
+		},
+		envFlag,
+		valuesFlag,
+		setFlag,
+	}, runflags()...)
+}
+
+func (d *debugcmd) defaultPorts() string {
+	var ports []string
+	for _, name := range debuggerNames() {
+		ports = append(ports, fmt.Sprintf("%d for %s", debuggers[name].port, name))
+	}
+	return strings.Join(ports, ", ")
+}
+
+func (d *debugcmd) debug(c *cli.Context) error {
+	if d.build {
+		b := &buildcmd{verbose: true}
+		if err := b.build(c); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+
+	ff, err := loadFuncfile()
+	if err != nil {
+		return err
+	}
+	runtime, _ := ff.RuntimeTag()
+	dbg, ok := debuggers[runtime]
+	if !ok {
+		return usageError("fn debug supports the %s runtimes, not %q", strings.Join(debuggerNames(), ", "), runtime)
+	}
+	entrypoint := debugEntrypoint(ff)
+	if len(entrypoint) == 0 {
+		return usageError("%s has no entrypoint to debug", ff.Name)
+	}
+	port := dbg.port
+	if d.port != 0 {
+		port = d.port
+	}
+
+	route, err := funcfileRoute(ff, c.String("route"))
+	if err != nil {
+		return err
+	}
+	body, contentType, err := payload(c)
+	if err != nil {
+		return err
+	}
+	opts, err := runOptionsFrom(c, route, contentType)
+	if err != nil {
+		return err
+	}
+	opts.entrypoint = dbg.command(entrypoint, port)
+	opts.ports = []int{port}
+	if !c.IsSet("timeout") {
+		opts.timeout = debugTimeout
+	}
+
+	if dbg.needs != "" {
+		fmt.Fprintf(os.Stderr, "the image of the function needs %s\n\n", dbg.needs)
+	}
+	fmt.Fprintf(os.Stderr, "the debugger of %s listens on localhost:%d, the function runs once attached to it with:\n%s\n\n", ff.FullName(), port, dbg.attach(port))
+	return runff(ff.FullName(), body, os.Stdout, os.Stderr, opts)
+}
+
+// debugEntrypoint is the entrypoint of the function as a command, that of
+// its runtime when it sets none.
+func debugEntrypoint(ff *funcfile) []string {
+	if ff.Entrypoint != nil && *ff.Entrypoint != "" {
+		return strings.Fields(*ff.Entrypoint)
+	}
+	runtime, _ := ff.RuntimeTag()
+	return strings.Fields(runtimeTemplates[runtime].entrypoint)
+}
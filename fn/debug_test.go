@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDebuggers(t *testing.T) {
+	for _, c := range []struct {
+		runtime, entrypoint string
+		want                []string
+	}{
+		{"go", "", []string{"dlv", "exec", "--headless", "--api-version=2", "--accept-multiclient", "--listen=:2345", "./func"}},
+		{"go", "./func -v", []string{"dlv", "exec", "--headless", "--api-version=2", "--accept-multiclient", "--listen=:2345", "./func", "--", "-v"}},
+		{"node", "", []string{"node", "--inspect-brk=0.0.0.0:9229", "func.js"}},
+		{"python", "python3 main.py", []string{"python3", "-m", "debugpy", "--listen", "0.0.0.0:5678", "--wait-for-client", "main.py"}},
+	} {
+		runtime := c.runtime
+		ff := &funcfile{Runtime: &runtime}
+		if c.entrypoint != "" {
+			ff.Entrypoint = &c.entrypoint
+		}
+		dbg := debuggers[c.runtime]
+		if got := dbg.command(debugEntrypoint(ff), dbg.port); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s debugger of %q = %v, want %v", c.runtime, c.entrypoint, got, c.want)
+		}
+		if !strings.Contains(dbg.attach(dbg.port), "launch.json") {
+			t.Errorf("%s debugger tells no editor how to attach", c.runtime)
+		}
+	}
+}
+
+func TestRunffEntrypointAndPorts(t *testing.T) {
+	d := &fakeDocker{exited: make(chan int, 1)}
+	defer startFakeDocker(t, d)()
+
+	opts := runOptions{entrypoint: []string{"node", "--inspect-brk=0.0.0.0:9229", "func.js"}, ports: []int{9229}}
+	if err := runff("acme/hello", strings.NewReader("Johnny"), ioutil.Discard, ioutil.Discard, opts); err != nil {
+		t.Fatal(err)
+	}
+	c := d.created
+	if !reflect.DeepEqual(c.Entrypoint, opts.entrypoint) {
+		t.Errorf("runff() set the entrypoint %v, want %v", c.Entrypoint, opts.entrypoint)
+	}
+	if _, ok := c.ExposedPorts["9229/tcp"]; !ok {
+		t.Errorf("runff() exposed %v, want 9229", c.ExposedPorts)
+	}
+	if b := c.HostConfig.PortBindings["9229/tcp"]; len(b) != 1 || b[0].HostIP != "127.0.0.1" || b[0].HostPort != "9229" {
+		t.Errorf("runff() published %v, want 9229 on localhost", c.HostConfig.PortBindings)
+	}
+}
@@ -1,47 +1,83 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
-	functions "github.com/iron-io/functions_go"
+	fnapi "github.com/iron-io/functions/fn/pkg/client"
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	fnclient "github.com/iron-io/functions_go/client"
+	fnmodels "github.com/iron-io/functions_go/models"
 	"github.com/urfave/cli"
 )
 
+// fnignoreName is the file listing, as .dockerignore does, the directories
+// and function files deploy --all skips.
+const fnignoreName = ".fnignore"
+
 func deploy() cli.Command {
 	cmd := deploycmd{
-		RoutesApi: functions.NewRoutesApi(),
+		client: apiClient(),
 	}
 	var flags []cli.Flag
 	flags = append(flags, cmd.flags()...)
 	return cli.Command{
 		Name:      "deploy",
-		ArgsUsage: "`APPNAME`",
+		ArgsUsage: "[`APPNAME`]",
 		Usage:     "scan local directory for functions, build and push all of them to `APPNAME`.",
 		Flags:     flags,
+		Before:    loadValues,
 		Action:    cmd.scan,
 	}
 }
 
 type deploycmd struct {
 	appName string
-	*functions.RoutesApi
+	client  *fnclient.Functions
 
 	wd          string
 	verbose     bool
 	incremental bool
 	skippush    bool
+	since       string
+	frozen      bool
+	bump        string
+	allowDirty  bool
+	pinDigest   bool
+	retries     int
+	buildOpts   buildOptions
+	all         bool
+	parallel    int
+
+	report     string
+	reportFile string
+
+	rollbackOnFailure bool
+	scanOpts          scanOptions
+	sbom              sbomOptions
+	cosign            cosignOptions
+	builder           string
+	canary            string
+	canaryWeight      int
+
+	mu      sync.Mutex
+	locked  []lockedFunc
+	records []*deployRecord
 
 	verbwriter io.Writer
 }
 
 func (p *deploycmd) flags() []cli.Flag {
-	return []cli.Flag{
+	flags := []cli.Flag{
+		appFlag,
 		cli.BoolFlag{
 			Name:        "v",
 			Usage:       "verbose mode",
@@ -59,143 +95,521 @@ func (p *deploycmd) flags() []cli.Flag {
 			Usage:       "uses incremental building",
 			Destination: &p.incremental,
 		},
+		cli.BoolFlag{
+			Name:        "all",
+			Usage:       "deploy the functions of the subdirectories too, but for those " + fnignoreName + " lists",
+			Destination: &p.all,
+		},
+		cli.IntFlag{
+			Name:        "parallel",
+			Usage:       "number of functions to build and deploy at once",
+			Value:       1,
+			Destination: &p.parallel,
+		},
 		cli.BoolFlag{
 			Name:        "skip-push",
 			Usage:       "does not push Docker built images onto Docker Hub - useful for local development.",
 			Destination: &p.skippush,
 		},
+		cli.StringFlag{
+			Name:        "since",
+			Usage:       "only deploy functions whose directory changed since this git `REF` (eg. origin/master)",
+			Destination: &p.since,
+		},
+		cli.BoolFlag{
+			Name:        "frozen-lockfile",
+			Usage:       "skip building and redeploy exactly the state recorded in " + lockfileName,
+			Destination: &p.frozen,
+		},
+		cli.StringFlag{
+			Name:        "bump",
+			Usage:       "bump the `PART` of the version of the functions before building them: major, minor or patch",
+			Destination: &p.bump,
+		},
+		cli.StringFlag{
+			Name:        "report",
+			Usage:       "write a report of the deploy in `FORMAT`, json, to --report-file",
+			Destination: &p.report,
+		},
+		cli.StringFlag{
+			Name:        "report-file",
+			Usage:       "`FILE` the report of the deploy is written to",
+			Value:       "deploy-report.json",
+			Destination: &p.reportFile,
+		},
+		cli.BoolFlag{
+			Name:        "rollback-on-failure",
+			Usage:       "set the routes back to their previous images when updating them or the health check of the function fails",
+			Destination: &p.rollbackOnFailure,
+		},
+		builderFlag(&p.builder),
+		cli.StringFlag{
+			Name:        "scan",
+			Usage:       "scan images for vulnerabilities with `SCANNER` - " + strings.Join(scannerNames(), " or ") + " (at --scanner-url) - before pushing them",
+			Destination: &p.scanOpts.scanner,
+		},
+		cli.StringFlag{
+			Name:        "severity-threshold",
+			Usage:       "fail the deploy of images with vulnerabilities of `SEVERITY` or above - " + strings.Join(severities, ", "),
+			Value:       "HIGH",
+			Destination: &p.scanOpts.threshold,
+		},
+		cli.StringFlag{
+			Name:        "scanner-url",
+			Usage:       "`URL` of the remote scanner",
+			EnvVar:      "FN_SCANNER_URL",
+			Destination: &p.scanOpts.url,
+		},
+		cli.StringFlag{
+			Name:        "canary",
+			Usage:       "send a `PERCENT` of the calls of existing routes to the new image, eg. 10%, until fn canary promotes or aborts it",
+			Destination: &p.canary,
+		},
+		allowDirtyFlag(&p.allowDirty),
+		pinDigestFlag,
+		retryFlag(&p.retries),
+		buildArgFlag,
+		platformFlag,
+		nativeFlag,
+		registryFlag,
+		envFlag,
+		valuesFlag,
+		setFlag,
 	}
+	flags = append(flags, sbomFlags(&p.sbom)...)
+	flags = append(flags, sbomAttachFlag(&p.sbom))
+	flags = append(flags, signFlags(&p.cosign)...)
+	flags = append(flags, verifyImageFlags(&p.cosign)...)
+	return append(flags, cacheFlags...)
 }
 
 func (p *deploycmd) scan(c *cli.Context) error {
-	if c.Args().First() == "" {
+	args, err := appArgs(c)
+	if err != nil {
+		return err
+	}
+	if args.First() == "" {
 		return errors.New("application name is missing")
 	}
-	p.appName = c.Args().First()
+	p.appName = args.First()
 	p.verbwriter = verbwriter(p.verbose)
+	p.pinDigest = c.Bool("pin-digest")
+	p.buildOpts = buildOptionsFrom(c, p.builder)
+	if p.parallel < 1 {
+		return usageError("--parallel must be at least 1")
+	}
+	if globals.offline && (p.rollbackOnFailure || p.canary != "") {
+		return usageError("--rollback-on-failure and --canary read the routes deployed, they cannot be used offline")
+	}
+	if err := p.sbom.check(); err != nil {
+		return err
+	}
+	if p.cosign.sign && p.skippush {
+		return usageError("--sign signs pushed images, it cannot be used with --skip-push")
+	}
+	if p.cosign.verifies() {
+		if err := p.cosign.checkVerify(); err != nil {
+			return err
+		}
+	}
+	if p.sbom.attach && p.skippush {
+		return usageError("--sbom-attach pushes SBOMs along with images, it cannot be used with --skip-push")
+	}
+	if p.sbom.dir == "" {
+		// alongside the report
+		p.sbom.dir = filepath.Dir(p.reportFile)
+	}
+	if p.scanOpts.scanner != "" {
+		if _, ok := scanners[p.scanOpts.scanner]; !ok {
+			return usageError("unknown scanner %s, expected one of %s", p.scanOpts.scanner, strings.Join(scannerNames(), ", "))
+		}
+		if p.scanOpts.scanner == "remote" && p.scanOpts.url == "" {
+			return usageError("--scan remote needs the --scanner-url")
+		}
+		threshold, err := parseSeverity(p.scanOpts.threshold)
+		if err != nil {
+			return err
+		}
+		p.scanOpts.threshold = threshold
+	}
+	switch p.report {
+	case "", "json":
+	default:
+		return usageError("unknown report format %s, expected json", p.report)
+	}
 
-	var walked bool
-
-	err := filepath.Walk(p.wd, func(path string, info os.FileInfo, err error) error {
-		if path != p.wd && info.IsDir() {
-			return filepath.SkipDir
+	if p.canary != "" {
+		w, err := parseCanaryWeight(p.canary)
+		if err != nil {
+			return err
 		}
+		p.canaryWeight = w
+		// before building, for nothing otherwise
+		if err := checkCanaries(p.appName); err != nil {
+			return err
+		}
+	}
 
-		if !isFuncfile(path, info) {
-			return nil
+	if p.frozen {
+		if p.report != "" {
+			return usageError("--report cannot be used with --frozen-lockfile, which builds nothing")
 		}
+		return p.deployLocked()
+	}
 
-		if p.incremental && !isstale(path) {
-			return nil
+	switch p.bump {
+	case "", bumpMajor, bumpMinor, bumpPatch:
+	default:
+		return usageError("cannot bump the %s version, expected one of %s, %s or %s", p.bump, bumpMajor, bumpMinor, bumpPatch)
+	}
+	if p.bump != "" && !p.allowDirty {
+		// checked once, as every bump dirties the tree
+		if err := checkCleanTree(p.wd); err != nil {
+			return err
 		}
+	}
 
-		e := p.deploy(path)
+	var changed []string
+	if p.since != "" {
+		var err error
+		changed, err = gitChangedFiles(p.wd, p.since)
 		if err != nil {
-			fmt.Fprintln(p.verbwriter, path, e)
+			return err
 		}
+	}
 
-		now := time.Now()
-		os.Chtimes(path, now, now)
-		walked = true
-		return e
-	})
+	paths, err := walkFuncfiles(p.wd, p.all)
 	if err != nil {
-		fmt.Fprintf(p.verbwriter, "file walk error: %s\n", err)
+		return fmt.Errorf("file walk error: %s", err)
 	}
-
-	if !walked {
+	if len(paths) == 0 {
 		return errors.New("No function file found.")
 	}
 
+	p.warnQuota(paths)
+	changedFuncs := changedFuncfiles(paths, changed)
+
+	var (
+		started = time.Now()
+		workers = newPool(cmdContext(), p.parallel)
+		report  = newBulkReport("deployed")
+	)
+	skip := func(path, reason string) {
+		report.skip(path, reason)
+		p.addRecord(&deployRecord{Funcfile: p.relpath(path), Status: bulkSkipped, Reason: reason})
+	}
+	for _, path := range paths {
+		if p.incremental && !isstale(path) {
+			skip(path, "unchanged since the last deploy")
+			continue
+		}
+
+		if p.since != "" && !changedFuncs[path] {
+			fmt.Fprintln(p.verbwriter, "skipping", path, "unchanged since", p.since)
+			skip(path, "unchanged since "+p.since)
+			continue
+		}
+
+		path := path
+		ok := workers.run(func(ctx context.Context) {
+			// functions are independent of each other, keep going when
+			// one fails to deploy
+			rec := &deployRecord{Funcfile: p.relpath(path)}
+			start := time.Now()
+			err := p.deploy(ctx, path, rec)
+			rec.finish(start, err)
+			p.addRecord(rec)
+			if err != nil {
+				fmt.Fprintln(p.verbwriter, path, err)
+				report.finish(ctx, path, err)
+				return
+			}
+			report.succeed(path)
+
+			now := time.Now()
+			os.Chtimes(path, now, now)
+		})
+		if !ok {
+			report.interrupt(path)
+			p.addRecord(&deployRecord{Funcfile: p.relpath(path), Status: bulkSkipped, Reason: "interrupted"})
+		}
+	}
+	workers.wait()
+
+	if p.report != "" {
+		if err := p.writeReport(started); err != nil {
+			return err
+		}
+	}
+
+	if err := report.writeTableAndErr(); err != nil {
+		if len(p.locked) > 0 {
+			fmt.Fprintln(os.Stderr, "not updating", lockfileName, "as some functions failed to deploy")
+		}
+		return err
+	}
+
+	if len(p.locked) > 0 && p.canaryWeight == 0 {
+		return p.writeLockfile()
+	}
+
 	return nil
 }
 
+// warnQuota warns upfront when deploying the functions would take the app
+// over its quota, rather than letting the server refuse some of them halfway.
+func (p *deploycmd) warnQuota(paths []string) {
+	var want []fnmodels.Route
+	for _, path := range paths {
+		ff, err := parsefuncfile(path)
+		if err != nil {
+			continue
+		}
+		routes, err := fndeploy.Routes(ff)
+		if err != nil {
+			continue
+		}
+		want = append(want, routes...)
+	}
+	warnQuota(os.Stderr, p.client, p.appName, want)
+}
+
 // deploy will take the found function and check for the presence of a
 // Dockerfile, and run a three step process: parse functions file, build and
 // push the container, and finally it will update function's route. Optionally,
 // the route can be overriden inside the functions file.
-func (p *deploycmd) deploy(path string) error {
+//
+// The progress of every stage is reported, and recorded in rec, the output of
+// docker only being shown in verbose mode or when it fails.
+func (p *deploycmd) deploy(ctx context.Context, path string, rec *deployRecord) (err error) {
+	ctx, span := startSpan(ctx, "deploy "+rec.Funcfile, spanInternal)
+	span.set("fn.app", p.appName)
+	defer func() { span.finish(err) }()
 	fmt.Fprintln(p.verbwriter, "deploying", path)
 
-	funcfile, err := buildfunc(p.verbwriter, path)
+	if p.bump != "" {
+		ff, err := bumpfuncfile(path, p.bump)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(p.verbwriter, "bumped", path, "to version", ff.Version)
+	}
+
+	ff, err := parsefuncfile(path)
 	if err != nil {
 		return err
 	}
-
-	if p.skippush {
-		return nil
+	err = p.hookStage(ctx, path, rec, stagePreDeploy, ff, hookEnv{app: p.appName, routes: routePaths(ff)})
+	if err != nil {
+		return err
 	}
 
-	if err := dockerpush(funcfile); err != nil {
+	var (
+		funcfile *funcfile
+		pushed   string
+	)
+	opts := p.buildOpts
+	opts.app = p.appName
+	opts.push = !p.skippush
+	err = p.stage(ctx, path, rec, stageBuild, func(_ context.Context, out io.Writer) (err error) {
+		funcfile, pushed, err = buildfunc(p.verbwriter, out, path, opts)
+		return err
+	})
+	if err != nil {
 		return err
 	}
+	rec.Image = funcfile.FullName()
+
+	// images are scanned before they are pushed, and those daemonless
+	// builders pushed as they built before their digest is stored
+	if p.scanOpts.scanner != "" {
+		image := funcfile.FullName()
+		if pushed != "" {
+			image = cleanImageName(image) + "@" + pushed
+		}
+		err = p.stage(ctx, path, rec, stageScan, func(_ context.Context, out io.Writer) (err error) {
+			rec.Scan, err = scanImage(out, image, p.scanOpts)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	return p.route(path, funcfile)
-}
+	var digest string
+	switch {
+	case p.skippush:
+	case pushed != "":
+		// daemonless builders push as they build
+		digest = cleanImageName(funcfile.FullName()) + "@" + pushed
+		err = storeDigest(path, funcfile, pushed)
+	default:
+		err = p.stage(ctx, path, rec, stagePush, func(_ context.Context, out io.Writer) error {
+			pushed, err := dockerpush(out, funcfile, p.retries)
+			if err != nil {
+				return err
+			}
+			digest = cleanImageName(funcfile.FullName()) + "@" + pushed
+			return storeDigest(path, funcfile, pushed)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		rec.Digest = funcfile.ImageDigest
+		progressf("%s: image %s\n", rec.Funcfile, digest)
+	}
 
-func (p *deploycmd) route(path string, ff *funcfile) error {
-	if err := resetBasePath(p.Configuration); err != nil {
-		return fmt.Errorf("error setting endpoint: %v", err)
+	if p.cosign.sign {
+		err = p.stage(ctx, path, rec, stageSign, func(_ context.Context, out io.Writer) error {
+			return signImage(out, digest, p.cosign)
+		})
+		if err != nil {
+			return err
+		}
+		rec.Signed = true
 	}
 
-	if ff.path == nil {
-		_, path := appNamePath(ff.FullName())
-		ff.path = &path
+	// the image pushed is described, or else the one built
+	if p.sbom.format != "" {
+		err = p.stage(ctx, path, rec, stageSBOM, func(_ context.Context, out io.Writer) (err error) {
+			if rec.SBOM, err = generateSBOM(out, firstNonEmpty(digest, funcfile.FullName()), funcfile, p.sbom); err != nil {
+				return err
+			}
+			if p.sbom.attach {
+				return attachSBOM(out, digest, rec.SBOM, p.sbom)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if p.skippush {
+		return nil
+	}
+	if p.cosign.verifies() {
+		// the policy of the cluster is checked before routes are updated
+		err = p.stage(ctx, path, rec, stageVerify, func(_ context.Context, out io.Writer) error {
+			return verifyImage(out, digest, p.cosign)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	if ff.Memory == nil {
-		ff.Memory = new(int64)
+	// the images routes are set back to when the deploy fails
+	var previous map[string]string
+	if p.rollbackOnFailure {
+		if previous, err = p.liveImages(funcfile); err != nil {
+			return err
+		}
 	}
-	if ff.Type == nil {
-		ff.Type = new(string)
+
+	err = p.stage(ctx, path, rec, stageRoutes, func(ctx context.Context, _ io.Writer) error {
+		routes, err := p.route(ctx, path, funcfile, digest)
+		rec.Routes = routes
+		return err
+	})
+	if err == nil && funcfile.Healthcheck != nil {
+		err = p.stage(ctx, path, rec, stageHealthcheck, func(context.Context, io.Writer) error {
+			return healthcheck(p.appName, funcfile.Healthcheck, rec.Routes)
+		})
 	}
-	if ff.Format == nil {
-		ff.Format = new(string)
+	if err == nil {
+		// failing hooks do not roll back what is deployed
+		env := hookEnv{app: p.appName, routes: rec.Routes, digest: funcfile.ImageDigest}
+		return p.hookStage(ctx, path, rec, stagePostDeploy, funcfile, env)
 	}
-	if ff.maxConcurrency == nil {
-		ff.maxConcurrency = new(int)
+	if !p.rollbackOnFailure || len(rec.Routes) == 0 {
+		return err
 	}
-	if ff.Timeout == nil {
-		dur := time.Duration(0)
-		ff.Timeout = &dur
+	if rerr := p.rollback(ctx, path, rec, previous); rerr != nil {
+		return fmt.Errorf("%v, and rolling back failed: %v", err, rerr)
 	}
+	return fmt.Errorf("%v, rolled back", err)
+}
 
-	headers := make(map[string][]string)
-	for k, v := range ff.Headers {
-		headers[k] = []string{v}
+// route creates or updates the routes of the function, whose image was pushed
+// as digest, returning the paths of those it updated.
+func (p *deploycmd) route(ctx context.Context, path string, ff *funcfile, digest string) ([]string, error) {
+	routes, err := fndeploy.Routes(ff)
+	if err != nil {
+		return nil, err
 	}
-	body := functions.RouteWrapper{
-		Route: functions.Route{
-			Path:           *ff.path,
-			Image:          ff.FullName(),
-			Memory:         *ff.Memory,
-			Type_:          *ff.Type,
-			Config:         expandEnvConfig(ff.Config),
-			Headers:        headers,
-			Format:         *ff.Format,
-			MaxConcurrency: int32(*ff.maxConcurrency),
-			Timeout:        int32(ff.Timeout.Seconds()),
-		},
+	if p.pinDigest {
+		for i := range routes {
+			routes[i].Image = digest
+		}
+	}
+	var secrets map[string]string
+	if globals.offline {
+		// resolved by fn sync, for their values not to be queued
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+		for key, ref := range ff.Secrets {
+			if _, _, err := splitSecretRef(ref); err != nil {
+				return nil, fmt.Errorf("secret %s: %v", key, err)
+			}
+		}
+		ctx = withSecretRefs(ctx, dir, ff.Secrets)
+	} else if secrets, err = resolveSecrets(filepath.Dir(path), ff); err != nil {
+		return nil, err
 	}
 
-	fmt.Fprintf(p.verbwriter, "updating API with app: %s route: %s name: %s \n", p.appName, *ff.path, ff.Name)
-
-	wrapper, resp, err := p.AppsAppRoutesPost(p.appName, body)
-	if err != nil {
-		return fmt.Errorf("error getting routes: %v", err)
+	var updated []string
+	for _, route := range routes {
+		fmt.Fprintf(p.verbwriter, "updating API with app: %s route: %s name: %s \n", p.appName, route.Path, ff.Name)
+		store := p.storeRoute
+		if p.canaryWeight > 0 {
+			store = p.storeCanary
+		}
+		ctx, span := startSpan(ctx, "route "+route.Path, spanInternal)
+		span.set("fn.app", p.appName)
+		span.set("fn.image", route.Image)
+		err := store(ctx, *withSecrets(&route, secrets))
+		span.finish(err)
+		if err != nil {
+			return updated, err
+		}
+		updated = append(updated, route.Path)
 	}
-	if resp.StatusCode == http.StatusBadRequest {
-		return fmt.Errorf("error storing this route: %s", wrapper.Error_.Message)
+	if p.canaryWeight > 0 {
+		// what is deployed is only recorded once promoted
+		return updated, nil
 	}
 
-	return nil
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, route := range routes {
+		p.locked = append(p.locked, lockedFunc{
+			Funcfile: p.relpath(path),
+			Image:    ff.FullName(),
+			Digest:   digest,
+			Route:    route,
+			Secrets:  secretKeys(ff),
+		})
+	}
+	return updated, nil
+}
+
+// storeRoute creates the route, or updates it in place when it already
+// exists.
+func (p *deploycmd) storeRoute(ctx context.Context, route fnmodels.Route) error {
+	if err := checkRouteCompat(&route); err != nil {
+		return err
+	}
+	return apiError(fnapi.New(p.client).UpsertRoute(withUpsert(ctx), p.appName, route))
 }
 
-func expandEnvConfig(configs map[string]string) map[string]string {
-	for k, v := range configs {
-		configs[k] = os.ExpandEnv(v)
+func (p *deploycmd) relpath(path string) string {
+	if rel, err := filepath.Rel(p.wd, path); err == nil {
+		return filepath.ToSlash(rel)
 	}
-	return configs
+	return path
 }
 
 func isFuncfile(path string, info os.FileInfo) bool {
@@ -204,7 +618,7 @@ func isFuncfile(path string, info os.FileInfo) bool {
 	}
 
 	basefn := filepath.Base(path)
-	for _, fn := range validfn {
+	for _, fn := range ffile.Names {
 		if basefn == fn {
 			return true
 		}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// deployStage is a stage of the deploy of a function, reported as it starts
+// and ends.
+type deployStage struct {
+	name, doing, done string
+}
+
+var (
+	stageBuild       = deployStage{"build", "building", "built"}
+	stagePush        = deployStage{"push", "pushing", "pushed"}
+	stageSign        = deployStage{"sign", "signing", "signed"}
+	stageVerify      = deployStage{"verify", "verifying the signature", "verified the signature"}
+	stageSBOM        = deployStage{"sbom", "generating the SBOM", "generated the SBOM"}
+	stageScan        = deployStage{"scan", "scanning", "scanned"}
+	stageRoutes      = deployStage{"routes", "updating routes", "updated routes"}
+	stageHealthcheck = deployStage{"healthcheck", "checking health", "healthy"}
+	stageRollback    = deployStage{"rollback", "rolling back", "rolled back"}
+	stagePreDeploy   = deployStage{"pre_deploy", "running pre_deploy hooks", "ran pre_deploy hooks"}
+	stagePostDeploy  = deployStage{"post_deploy", "running post_deploy hooks", "ran post_deploy hooks"}
+)
+
+// stageDuration is how long a stage of the deploy of a function took.
+type stageDuration struct {
+	Stage      string `json:"stage"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// deployRecord is what deploying a function did, for the report of the
+// deploy.
+type deployRecord struct {
+	Funcfile   string          `json:"funcfile"`
+	Status     string          `json:"status"`
+	Reason     string          `json:"reason,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Image      string          `json:"image,omitempty"`
+	Digest     string          `json:"digest,omitempty"`
+	Signed     bool            `json:"signed,omitempty"`
+	SBOM       string          `json:"sbom,omitempty"`
+	Scan       *scanResult     `json:"scan,omitempty"`
+	Routes     []string        `json:"routes,omitempty"`
+	Stages     []stageDuration `json:"stages,omitempty"`
+	RolledBack bool            `json:"rolled_back,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+func (r *deployRecord) finish(start time.Time, err error) {
+	r.DurationMS = millis(time.Since(start))
+	r.Status = bulkSucceeded
+	if err != nil {
+		r.Status, r.Error = bulkFailed, err.Error()
+	}
+}
+
+// deployReport is the report --report writes, for CI to archive.
+type deployReport struct {
+	App        string          `json:"app"`
+	StartedAt  time.Time       `json:"started_at"`
+	DurationMS int64           `json:"duration_ms"`
+	Functions  []*deployRecord `json:"functions"`
+}
+
+func millis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func (p *deploycmd) addRecord(rec *deployRecord) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = append(p.records, rec)
+}
+
+// stage runs f, a stage of the deploy of the function at path, reporting its
+// progress and recording how long it took in rec. The output f writes is
+// shown in verbose mode, or else only when f fails. f is given a context
+// carrying the span of the stage.
+func (p *deploycmd) stage(ctx context.Context, path string, rec *deployRecord, s deployStage, f func(ctx context.Context, out io.Writer) error) error {
+	progressf("%s: %s\n", rec.Funcfile, s.doing)
+	ctx, span := startSpan(ctx, s.name, spanInternal)
+	span.set("fn.funcfile", rec.Funcfile)
+
+	var buf bytes.Buffer
+	out := io.Writer(&buf)
+	if p.verbose {
+		out = os.Stderr
+	}
+
+	start := time.Now()
+	err := f(ctx, out)
+	span.finish(err)
+	took := time.Since(start)
+	rec.Stages = append(rec.Stages, stageDuration{s.name, millis(took)})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", rec.Funcfile, colored(colorRed, fmt.Sprintf("%s failed after %v", s.name, took.Round(time.Millisecond))))
+		if buf.Len() > 0 {
+			fmt.Fprintf(os.Stderr, "%s: output of %s:\n%s", rec.Funcfile, s.name, buf.Bytes())
+		}
+		return err
+	}
+	progressf("%s: %s\n", rec.Funcfile, colored(colorGreen, fmt.Sprintf("%s in %v", s.done, took.Round(time.Millisecond))))
+	return nil
+}
+
+// writeReport writes the report of the deploy which started at started.
+func (p *deploycmd) writeReport(started time.Time) error {
+	p.mu.Lock()
+	records := append([]*deployRecord{}, p.records...)
+	p.mu.Unlock()
+	// functions deployed in parallel finish in any order
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Funcfile < records[j].Funcfile })
+
+	b, err := json.MarshalIndent(deployReport{
+		App:        p.appName,
+		StartedAt:  started.UTC(),
+		DurationMS: millis(time.Since(started)),
+		Functions:  records,
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p.reportFile, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write the report: %v", err)
+	}
+	fmt.Fprintln(p.verbwriter, "wrote", p.reportFile)
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeployReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := &deploycmd{appName: "myapp", reportFile: filepath.Join(dir, "report.json"), verbwriter: ioutil.Discard}
+
+	users := &deployRecord{Funcfile: "users/func.yaml"}
+	start := time.Now()
+	err = p.stage(context.Background(), "users/func.yaml", users, stageBuild, func(_ context.Context, out io.Writer) error {
+		fmt.Fprintln(out, "Step 1/3 : FROM iron/go")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.Image, users.Routes = "acme/users:0.0.2", []string{"/users"}
+	users.finish(start, nil)
+
+	orders := &deployRecord{Funcfile: "orders/func.yaml"}
+	boom := errors.New("error running docker push: exit status 1")
+	err = p.stage(context.Background(), "orders/func.yaml", orders, stagePush, func(context.Context, io.Writer) error { return boom })
+	if err != boom {
+		t.Fatalf("stage() = %v, want %v", err, boom)
+	}
+	orders.finish(start, err)
+
+	p.addRecord(users)
+	p.addRecord(orders)
+	p.addRecord(&deployRecord{Funcfile: "billing/func.yaml", Status: bulkSkipped, Reason: "unchanged since the last deploy"})
+	if err := p.writeReport(start); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(p.reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report deployReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.App != "myapp" {
+		t.Errorf("app = %q, want myapp", report.App)
+	}
+
+	var got [][]string
+	for _, f := range report.Functions {
+		var stages []string
+		for _, s := range f.Stages {
+			stages = append(stages, s.Stage)
+		}
+		got = append(got, append([]string{f.Funcfile, f.Status, f.Error}, stages...))
+	}
+	want := [][]string{
+		{"billing/func.yaml", bulkSkipped, ""},
+		{"orders/func.yaml", bulkFailed, boom.Error(), "push"},
+		{"users/func.yaml", bulkSucceeded, "", "build"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("report functions = %v, want %v", got, want)
+	}
+	if u := report.Functions[2]; u.Image != "acme/users:0.0.2" || !reflect.DeepEqual(u.Routes, []string{"/users"}) {
+		t.Errorf("users = %+v, want its image and routes", u)
+	}
+}
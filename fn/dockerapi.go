@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+)
+
+// dockerClient talks to the Engine API of the Docker daemon of $DOCKER_HOST,
+// or of the local one, as the server does to run functions, rather than
+// through the docker CLI.
+type dockerClient struct {
+	dial func() (net.Conn, error)
+	http *http.Client
+	// socket is the path of the socket of the daemon, when local.
+	socket string
+}
+
+func newDockerClient() (*dockerClient, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, usageError("invalid DOCKER_HOST %s: %v", host, err)
+	}
+
+	var (
+		dial   func() (net.Conn, error)
+		socket string
+	)
+	switch u.Scheme {
+	case "unix":
+		dial = func() (net.Conn, error) { return net.Dial("unix", u.Path) }
+		socket = u.Path
+	case "tcp":
+		dial = func() (net.Conn, error) { return net.Dial("tcp", u.Host) }
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			cfg, err := dockerTLSConfig()
+			if err != nil {
+				return nil, err
+			}
+			dial = func() (net.Conn, error) { return tls.Dial("tcp", u.Host, cfg) }
+		}
+	default:
+		return nil, usageError("DOCKER_HOST %s is not supported, expected a unix:// or tcp:// address", host)
+	}
+
+	c := &dockerClient{dial: dial, socket: socket}
+	c.http = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) { return dial() },
+	}}
+	return c, nil
+}
+
+// dockerTLSConfig is that of $DOCKER_CERT_PATH, ~/.docker by default.
+func dockerTLSConfig() (*tls.Config, error) {
+	dir := os.Getenv("DOCKER_CERT_PATH")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load the Docker client certificate: %v", err)
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("could not load the Docker CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool}, nil
+}
+
+// do calls the API, decoding the JSON it answers into v when not nil. The
+// host of URLs does not matter, connections going to the daemon.
+func (c *dockerClient) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, "http://docker"+path, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &fnError{Kind: kindNetwork, Message: fmt.Sprintf("could not reach the Docker daemon: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return dockerError(resp)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// dockerError is the error the daemon answered, as {"message": "..."}.
+func dockerError(resp *http.Response) error {
+	var e struct {
+		Message string `json:"message"`
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if json.Unmarshal(b, &e) != nil || e.Message == "" {
+		e.Message = strings.TrimSpace(string(b))
+	}
+	err := &fnError{Kind: kindError, Message: "docker: " + e.Message, Status: resp.StatusCode}
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		err.Kind = kindNotFound
+	case http.StatusConflict:
+		err.Kind = kindConflict
+	}
+	return err
+}
+
+func isDockerNotFound(err error) bool {
+	fe, ok := err.(*fnError)
+	return ok && fe.Kind == kindNotFound
+}
+
+// dockerContainer is what creating a container takes.
+type dockerContainer struct {
+	// Name is that of the container, chosen by the daemon when empty.
+	Name         string `json:"-"`
+	Image        string
+	Entrypoint   []string `json:",omitempty"`
+	Env          []string
+	Labels       map[string]string   `json:",omitempty"`
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	OpenStdin    bool
+	StdinOnce    bool
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	HostConfig   dockerHostConfig
+}
+
+type dockerHostConfig struct {
+	Memory     int64    `json:",omitempty"`
+	MemorySwap int64    `json:",omitempty"`
+	Links      []string `json:",omitempty"`
+	// Binds are volumes, as HOST:CONTAINER paths.
+	Binds        []string                       `json:",omitempty"`
+	PortBindings map[string][]dockerPortBinding `json:",omitempty"`
+}
+
+type dockerPortBinding struct {
+	HostIP   string `json:"HostIp,omitempty"`
+	HostPort string
+}
+
+// createContainer creates the container, pulling its image when missing.
+func (c *dockerClient) createContainer(ctx context.Context, stderr io.Writer, cfg dockerContainer) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	path := "/containers/create"
+	if cfg.Name != "" {
+		path += "?" + url.Values{"name": {cfg.Name}}.Encode()
+	}
+	err := c.do(ctx, "POST", path, cfg, &created)
+	if isDockerNotFound(err) {
+		if err := c.pull(ctx, stderr, cfg.Image); err != nil {
+			return "", err
+		}
+		err = c.do(ctx, "POST", path, cfg, &created)
+	}
+	return created.ID, err
+}
+
+// pull pulls the image, telling how it goes on w.
+func (c *dockerClient) pull(ctx context.Context, w io.Writer, image string) error {
+	name, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+	q := url.Values{"fromImage": {name}, "tag": {tag}}
+	req, err := http.NewRequest("POST", "http://docker/images/create?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	auth, err := registryAuth(image)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		req.Header.Set("X-Registry-Auth", auth)
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return &fnError{Kind: kindNetwork, Message: fmt.Sprintf("could not reach the Docker daemon: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return dockerError(resp)
+	}
+
+	// progress comes as a stream of JSON messages, errors included
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Status string `json:"status"`
+			ID     string `json:"id"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("error pulling %s: %s", image, msg.Error)
+		}
+		if msg.ID == "" || strings.HasPrefix(msg.Status, "Pull complete") {
+			fmt.Fprintln(w, strings.TrimSpace(msg.ID+" "+msg.Status))
+		}
+	}
+}
+
+// registryAuth returns the X-Registry-Auth header the daemon pulls image with,
+// holding the credentials of its registry the docker CLI would send, empty
+// when there are none.
+func registryAuth(image string) (string, error) {
+	reg := firstNonEmpty(ffile.ImageRegistry(image), dockerHubRegistry)
+	user, secret, err := loadCredentials(reg)
+	if err != nil || user == "" {
+		return "", err
+	}
+	auth := map[string]string{"serveraddress": reg}
+	if user == "<token>" {
+		// what credential helpers return identity tokens as
+		auth["identitytoken"] = secret
+	} else {
+		auth["username"], auth["password"] = user, secret
+	}
+	b, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+// dockerStream is the connection attached to a container: what is written
+// to it goes to the stdin of the container, and what it outputs is read,
+// multiplexed, from it.
+type dockerStream struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// attach attaches to the stdin, stdout and stderr of the container, hijacking
+// the connection of the request.
+func (c *dockerClient) attach(id string) (*dockerStream, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, &fnError{Kind: kindNetwork, Message: fmt.Sprintf("could not reach the Docker daemon: %v", err)}
+	}
+	req, err := http.NewRequest("POST", "http://docker/containers/"+id+"/attach?stream=1&stdin=1&stdout=1&stderr=1", nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, dockerError(resp)
+	}
+	return &dockerStream{conn, br}, nil
+}
+
+// closeStdin tells the container its stdin is over.
+func (s *dockerStream) closeStdin() error {
+	if cw, ok := s.conn.(interface {
+		CloseWrite() error
+	}); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// demux copies the stdout and stderr of the container to theirs, as long as
+// it outputs any.
+func (s *dockerStream) demux(stdout, stderr io.Writer) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(s.br, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, s.br, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *dockerStream) Close() error {
+	return s.conn.Close()
+}
+
+func (c *dockerClient) start(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", "/containers/"+id+"/start", nil, nil)
+}
+
+// wait waits for the container to exit, returning its exit status.
+func (c *dockerClient) wait(ctx context.Context, id string) (int, error) {
+	var res struct {
+		StatusCode int
+	}
+	err := c.do(ctx, "POST", "/containers/"+id+"/wait", nil, &res)
+	return res.StatusCode, err
+}
+
+// kill kills the container. Like remove, it cleans up, thus is not cancelled
+// with the command.
+func (c *dockerClient) kill(id string) error {
+	return c.do(context.Background(), "POST", "/containers/"+id+"/kill", nil, nil)
+}
+
+func (c *dockerClient) remove(id string) error {
+	return c.do(context.Background(), "DELETE", "/containers/"+id+"?force=1", nil, nil)
+}
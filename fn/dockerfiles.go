@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// runtimeTemplate generates the Dockerfile of functions of a runtime which
+// have none. Templates build the function in a stage of their own, on the dev
+// image of the runtime, and copy what it built to a runtime image. Their
+// version is bumped whenever what they generate changes.
+type runtimeTemplate struct {
+	version int
+
+	// image is the repository of the images of the runtime, tag the one used
+	// when the function file sets none. The build stage uses the dev variant
+	// of the tag.
+	image, tag string
+
+	// entrypoint is the one of functions whose file sets none.
+	entrypoint string
+	dockerfile string
+}
+
+var runtimeTemplates = map[string]runtimeTemplate{
+	"go": {1, "iron/go", "", "./func", `FROM {{ .BuildImage }} AS build
+WORKDIR /go/src/function
+COPY . .
+RUN go build -o func
+
+FROM {{ .BaseImage }}
+WORKDIR /function
+COPY --from=build /go/src/function/func /function/func
+ENTRYPOINT {{ .Entrypoint }}
+`},
+	"node": {1, "iron/node", "", "node func.js", `FROM {{ .BuildImage }} AS build
+WORKDIR /function
+COPY . .
+RUN if [ -f package.json ]; then npm install --production; fi
+
+FROM {{ .BaseImage }}
+WORKDIR /function
+COPY --from=build /function /function
+ENTRYPOINT {{ .Entrypoint }}
+`},
+	"python": {1, "iron/python", "2", "python2 func.py", `FROM {{ .BuildImage }} AS build
+WORKDIR /function
+COPY . .
+RUN if [ -f requirements.txt ]; then pip install -t packages -r requirements.txt; fi
+
+FROM {{ .BaseImage }}
+WORKDIR /function
+COPY --from=build /function /function
+ENV PYTHONPATH=/function/packages
+ENTRYPOINT {{ .Entrypoint }}
+`},
+	"ruby": {1, "iron/ruby", "", "ruby func.rb", `FROM {{ .BuildImage }} AS build
+WORKDIR /function
+COPY . .
+RUN if [ -f Gemfile ]; then bundle install --standalone --clean; fi
+
+FROM {{ .BaseImage }}
+WORKDIR /function
+COPY --from=build /function /function
+ENTRYPOINT {{ .Entrypoint }}
+`},
+	"java": {1, "iron/java", "", "", `FROM {{ .BuildImage }} AS build
+WORKDIR /function
+COPY . .
+RUN javac -d classes $(find . -name '*.java')
+
+FROM {{ .BaseImage }}
+WORKDIR /function
+COPY --from=build /function/classes /function
+ENTRYPOINT {{ .Entrypoint }}
+`},
+}
+
+// tplDockerfile is the Dockerfile of the runtimes without a template, whose
+// language helpers build the function before the image.
+const tplDockerfile = `FROM {{ .BaseImage }}
+WORKDIR /function
+ADD . /function/
+ENTRYPOINT {{ .Entrypoint }}
+`
+
+// devTag is the tag of the dev image of a runtime, with its build tools.
+func devTag(tag string) string {
+	if tag == "" {
+		return "dev"
+	}
+	return tag + "-dev"
+}
+
+// generateDockerfile returns the Dockerfile of the function, from the
+// template of its runtime, and whether the runtime has one.
+func generateDockerfile(verbwriter io.Writer, ff *funcfile) ([]byte, bool, error) {
+	runtime, tag := ff.RuntimeTag()
+	data := struct {
+		BuildImage, BaseImage, Entrypoint string
+	}{}
+
+	var entrypoint, text, header string
+	rt, templated := runtimeTemplates[runtime]
+	if templated {
+		if tag == "" {
+			tag = rt.tag
+		}
+		data.BaseImage, data.BuildImage = rt.image, rt.image+":"+devTag(tag)
+		if tag != "" {
+			data.BaseImage += ":" + tag
+		}
+		entrypoint, text = rt.entrypoint, rt.dockerfile
+		header = fmt.Sprintf("# generated by fn from its %s template, version %d\n", runtime, rt.version)
+	} else {
+		image, ok := acceptableFnRuntimes[runtime]
+		if !ok {
+			return nil, false, fmt.Errorf("cannot use runtime %s", runtime)
+		}
+		if tag != "" {
+			image = fmt.Sprintf("%s:%s", image, tag)
+		}
+		data.BaseImage, text = image, tplDockerfile
+		header = "# generated by fn\n"
+	}
+	if ff.Entrypoint != nil && *ff.Entrypoint != "" {
+		entrypoint = *ff.Entrypoint
+	}
+	if entrypoint == "" {
+		return nil, false, errors.New("entrypoint is missing")
+	}
+
+	// the exec form, as JSON, which does not run the entrypoint in a shell
+	ep, err := json.Marshal(strings.Fields(entrypoint))
+	if err != nil {
+		return nil, false, err
+	}
+	data.Entrypoint = string(ep)
+	data.BaseImage = pinImage(verbwriter, data.BaseImage)
+	if data.BuildImage != "" {
+		data.BuildImage = pinImage(verbwriter, data.BuildImage)
+	}
+
+	b := bytes.NewBufferString(header)
+	if err := template.Must(template.New("Dockerfile").Parse(text)).Execute(b, data); err != nil {
+		return nil, false, err
+	}
+	return b.Bytes(), templated, nil
+}
+
+// generatedContext copies the build context of dir to a temporary directory,
+// along with the Dockerfile generated for the function, leaving dir as it
+// is. The directory is removed by calling cleanup.
+func generatedContext(dir string, dockerfile []byte) (ctx string, cleanup func(), err error) {
+	ctx, err = ioutil.TempDir("", "fn-build")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(ctx) }
+
+	err = walkContext(dir, func(path, rel string, info os.FileInfo) error {
+		dst := filepath.Join(ctx, rel)
+		switch {
+		case info.IsDir():
+			return os.Mkdir(dst, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dst)
+		case info.Mode().IsRegular():
+			return copyFile(dst, path, info.Mode().Perm())
+		}
+		return nil
+	})
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(ctx, "Dockerfile"), dockerfile, 0644)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return ctx, cleanup, nil
+}
+
+func copyFile(dst, src string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDockerfile(t *testing.T) {
+	str := func(s string) *string { return &s }
+	cases := []struct {
+		runtime, entrypoint string
+		templated           bool
+		want                []string
+	}{
+		{"go", "", true, []string{
+			"# generated by fn from its go template, version 1\n",
+			"FROM iron/go:dev AS build\n",
+			"FROM iron/go\n",
+			`ENTRYPOINT ["./func"]`,
+		}},
+		{"python", "python2 main.py --verbose", true, []string{
+			"FROM iron/python:2-dev AS build\n",
+			"FROM iron/python:2\n",
+			`ENTRYPOINT ["python2","main.py","--verbose"]`,
+		}},
+		{"node:7", "", true, []string{
+			"FROM iron/node:7-dev AS build\n",
+			"FROM iron/node:7\n",
+		}},
+		{"perl", "perl func.pl", false, []string{
+			"FROM iron/perl\n",
+			"ADD . /function/\n",
+		}},
+	}
+	for _, c := range cases {
+		ff := &funcfile{Name: "acme/hello", Runtime: str(c.runtime), Entrypoint: str(c.entrypoint)}
+		b, templated, err := generateDockerfile(ioutil.Discard, ff)
+		if err != nil {
+			t.Errorf("generateDockerfile(%s) failed: %v", c.runtime, err)
+			continue
+		}
+		if templated != c.templated {
+			t.Errorf("generateDockerfile(%s) templated = %v, want %v", c.runtime, templated, c.templated)
+		}
+		for _, w := range c.want {
+			if !strings.Contains(string(b), w) {
+				t.Errorf("generateDockerfile(%s) = %q, want it to contain %q", c.runtime, b, w)
+			}
+		}
+	}
+
+	for _, runtime := range []string{"java", "cobol"} {
+		ff := &funcfile{Name: "acme/hello", Runtime: str(runtime)}
+		if _, _, err := generateDockerfile(ioutil.Discard, ff); err == nil {
+			t.Errorf("generateDockerfile(%s) without an entrypoint succeeded, want an error", runtime)
+		}
+	}
+}
+
+func TestGeneratedContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-generated-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"func.go":        "package main",
+		"lib/lib.go":     "package lib",
+		".dockerignore":  "secrets\n",
+		"secrets/key":    "hunter2",
+		"vendor/x/x.go":  "package x",
+		"func.yaml":      "name: acme/hello",
+		"lib/testdata/a": "a",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cleanup, err := generatedContext(dir, []byte("FROM iron/go\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	for _, name := range []string{"func.go", "lib/lib.go", "vendor/x/x.go", "lib/testdata/a"} {
+		b, err := ioutil.ReadFile(filepath.Join(ctx, name))
+		if err != nil || string(b) != files[name] {
+			t.Errorf("generatedContext() copied %s as %q, %v, want %q", name, b, err, files[name])
+		}
+	}
+	if exists(filepath.Join(ctx, "secrets")) {
+		t.Error("generatedContext() copied secrets, which .dockerignore ignores")
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(ctx, "Dockerfile")); err != nil || string(b) != "FROM iron/go\n" {
+		t.Errorf("generatedContext() wrote the Dockerfile %q, %v", b, err)
+	}
+	if exists(filepath.Join(dir, "Dockerfile")) {
+		t.Error("generatedContext() wrote a Dockerfile to the directory of the function")
+	}
+
+	cleanup()
+	if exists(ctx) {
+		t.Errorf("cleanup() left %s", ctx)
+	}
+}
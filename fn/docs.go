@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	"github.com/urfave/cli"
+)
+
+// Functions are documented for their consumers with their README and the JSON
+// schema of their payload, which are stored along their route by servers
+// supporting it, under /v1/apps/:app/routes/:route/docs.
+
+// funcDocs is the documentation of a route.
+type funcDocs struct {
+	Image     string          `json:"image,omitempty"`
+	Readme    string          `json:"readme,omitempty"`
+	Schema    json.RawMessage `json:"schema,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at,omitempty"`
+}
+
+func docsPath(appName, route string) string {
+	return path.Join("/v1/apps", url.PathEscape(appName), "routes", route, "docs")
+}
+
+func notSupportingDocs(err error, appName, route string) error {
+	if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+		e.Message = fmt.Sprintf("no documentation found for %s%s, the route may not exist or the server may not store documentation", appName, route)
+	}
+	return err
+}
+
+func putDocs(appName, route string, d *funcDocs) error {
+	b, err := json.Marshal(struct {
+		Docs *funcDocs `json:"docs"`
+	}{d})
+	if err != nil {
+		return err
+	}
+	return notSupportingDocs(apiCall("PUT", docsPath(appName, route), bytes.NewReader(b), nil), appName, route)
+}
+
+func getDocs(appName, route string) (*funcDocs, error) {
+	var w struct {
+		Docs *funcDocs `json:"docs"`
+	}
+	if err := apiCall("GET", docsPath(appName, route), nil, &w); err != nil {
+		return nil, notSupportingDocs(err, appName, route)
+	}
+	if w.Docs == nil {
+		return nil, newNotFoundError(fmt.Sprintf("%s%s is not documented", appName, route))
+	}
+	return w.Docs, nil
+}
+
+func publishDocs() cli.Command {
+	return cli.Command{
+		Name:      "publish-docs",
+		Usage:     "publish the README and payload schema of the function in the current directory",
+		ArgsUsage: "`app` [/path]",
+		Action:    publishDocsAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "readme",
+				Usage: "markdown file documenting the function",
+				Value: "README.md",
+			},
+			cli.StringFlag{
+				Name:  "schema",
+				Usage: "JSON schema of the payload of the function",
+				Value: "schema.json",
+			},
+		},
+	}
+}
+
+// readDocs reads the documentation files. Missing files are only an error
+// when they were asked for explicitly.
+func readDocs(c *cli.Context) (*funcDocs, error) {
+	d := &funcDocs{UpdatedAt: time.Now().UTC()}
+
+	b, err := ioutil.ReadFile(c.String("readme"))
+	if err != nil && (c.IsSet("readme") || !os.IsNotExist(err)) {
+		return nil, err
+	}
+	d.Readme = string(b)
+
+	b, err = ioutil.ReadFile(c.String("schema"))
+	if err != nil && (c.IsSet("schema") || !os.IsNotExist(err)) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if !json.Valid(b) {
+			return nil, usageError("%s is not valid JSON", c.String("schema"))
+		}
+		d.Schema = b
+	}
+
+	if d.Readme == "" && d.Schema == nil {
+		return nil, usageError("nothing to publish, neither %s nor %s found", c.String("readme"), c.String("schema"))
+	}
+	return d, nil
+}
+
+func publishDocsAction(c *cli.Context) error {
+	appName := c.Args().First()
+	if appName == "" {
+		return usageError("publish-docs takes an app name, and optionally a path")
+	}
+	d, err := readDocs(c)
+	if err != nil {
+		return err
+	}
+
+	// the routes default to those of the function file
+	var routes []string
+	if route := c.Args().Get(1); route != "" {
+		routes = append(routes, path.Join("/", route))
+	}
+	if ff, err := loadFuncfile(); err == nil {
+		d.Image = ff.FullName()
+		if len(routes) == 0 {
+			rs, err := fndeploy.Routes(ff)
+			if err != nil {
+				return err
+			}
+			for _, r := range rs {
+				routes = append(routes, r.Path)
+			}
+		}
+	} else if _, ok := err.(*notFoundError); !ok {
+		return err
+	}
+	if len(routes) == 0 {
+		return usageError("route path is missing and no function file found")
+	}
+
+	report := newBulkReport("documented")
+	for _, route := range routes {
+		if err := putDocs(appName, route, d); err != nil {
+			report.fail(route, err)
+			continue
+		}
+		report.succeed(route)
+	}
+	return report.writeAndErr()
+}
+
+func docs() cli.Command {
+	return cli.Command{
+		Name:  "docs",
+		Usage: "read the documentation of functions",
+		Subcommands: []cli.Command{
+			{
+				Name:      "show",
+				Usage:     "show the README and payload schema of a route",
+				ArgsUsage: "`app` /path",
+				Action:    showDocs,
+			},
+		},
+	}
+}
+
+func showDocs(c *cli.Context) error {
+	if len(c.Args()) < 2 {
+		return usageError("docs show takes two arguments: an app name and a path")
+	}
+	appName, route := c.Args().Get(0), path.Join("/", c.Args().Get(1))
+	d, err := getDocs(appName, route)
+	if err != nil {
+		return err
+	}
+
+	if globals.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(d)
+	}
+	printDocs(d, appName, route)
+	return nil
+}
+
+func printDocs(d *funcDocs, appName, route string) {
+	fmt.Printf("%s%s", appName, route)
+	if d.Image != "" {
+		fmt.Printf(" (%s)", d.Image)
+	}
+	if !d.UpdatedAt.IsZero() {
+		fmt.Printf(", documented %s", d.UpdatedAt.Local().Format(time.RFC1123))
+	}
+	fmt.Print("\n\n")
+
+	if d.Readme != "" {
+		fmt.Println(d.Readme)
+	}
+	if d.Schema != nil {
+		var schema bytes.Buffer
+		if json.Indent(&schema, d.Schema, "", "  ") != nil {
+			schema.Write(d.Schema)
+		}
+		fmt.Println("Payload schema:")
+		fmt.Println(schema.String())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDocs(t *testing.T) {
+	stored := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/apps/myapp/routes/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case "PUT":
+			stored[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		case "GET":
+			b, ok := stored[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+
+	d := &funcDocs{Image: "acme/hello:0.0.2", Readme: "# Hello\n", Schema: []byte(`{"type":"object"}`)}
+	if err := putDocs("myapp", "/hello", d); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getDocs("myapp", "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Image != d.Image || got.Readme != d.Readme || string(got.Schema) != string(d.Schema) {
+		t.Errorf("expected %+v, got %+v", d, got)
+	}
+
+	_, err = getDocs("otherapp", "/hello")
+	if e, ok := err.(*fnError); !ok || e.Kind != kindNotFound || !strings.Contains(e.Message, "may not store documentation") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+func emulate() cli.Command {
+	cmd := emulatecmd{}
+	return cli.Command{
+		Name:      "emulate",
+		Usage:     "serve the functions of the current directory and below as APPNAME, running them locally without a server",
+		ArgsUsage: "`APPNAME`",
+		Flags:     cmd.flags(),
+		Before:    loadValues,
+		Action:    cmd.emulate,
+	}
+}
+
+type emulatecmd struct {
+	port    int
+	build   bool
+	verbose bool
+	builder string
+}
+
+func (e *emulatecmd) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:        "port,p",
+			Usage:       "local `PORT` calls are served on",
+			Value:       8080,
+			Destination: &e.port,
+		},
+		cli.StringSliceFlag{
+			Name:  "config,c",
+			Usage: "add `KEY=VALUE` to the config of the app",
+		},
+		cli.BoolFlag{
+			Name:        "build,b",
+			Usage:       "build the functions first",
+			Destination: &e.build,
+		},
+		cli.BoolFlag{
+			Name:        "v",
+			Usage:       "verbose mode",
+			Destination: &e.verbose,
+		},
+		builderFlag(&e.builder),
+		buildArgFlag,
+		registryFlag,
+		envFlag,
+		valuesFlag,
+		setFlag,
+		metricsAddrFlag,
+	}
+}
+
+func (e *emulatecmd) emulate(c *cli.Context) error {
+	app := c.Args().First()
+	if app == "" {
+		return usageError("application name is missing")
+	}
+
+	paths, err := walkFuncfiles(".", true)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return newNotFoundError("no function file found")
+	}
+
+	em := newEmulator(app, extractEnvConfig(c.StringSlice("config")), os.Stderr)
+	defer em.close()
+	for _, p := range paths {
+		if e.build {
+			if _, _, err := buildfunc(verbwriter(e.verbose), os.Stdout, p, buildOptionsFrom(c, e.builder)); err != nil {
+				return err
+			}
+		}
+		ff, err := parsefuncfile(p)
+		if err != nil {
+			return err
+		}
+		if err := em.add(filepath.Dir(p), ff); err != nil {
+			return err
+		}
+	}
+
+	l, err := net.Listen("tcp", "localhost:"+strconv.Itoa(e.port))
+	if err != nil {
+		return err
+	}
+	for _, r := range em.routes {
+		fmt.Fprintf(os.Stderr, "%s http://%s/r/%s%s\n", r.route.Image, l.Addr(), app, r.route.Path)
+	}
+	fmt.Fprintln(os.Stderr, "serving the routes above, ^C to stop")
+	stopMetrics, err := serveMetrics(c.String("metrics-addr"))
+	if err != nil {
+		l.Close()
+		return err
+	}
+	defer stopMetrics()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	stopped := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stopped)
+		l.Close()
+	}()
+	err = http.Serve(l, em)
+	select {
+	case <-stopped:
+		return nil
+	default:
+		return err
+	}
+}
+
+// emulator serves the routes of an app as the server does, running their
+// functions with the Docker daemon: a container a call for those of the
+// default format, and a container kept running between calls for those of the
+// http format, which are called one at a time.
+type emulator struct {
+	app    string
+	config map[string]string
+	stderr io.Writer
+
+	routes []*emulatedRoute
+}
+
+type emulatedRoute struct {
+	route fnmodels.Route
+
+	mu  sync.Mutex
+	hot *hotFunction
+}
+
+func newEmulator(app string, config map[string]string, stderr io.Writer) *emulator {
+	return &emulator{app: app, config: config, stderr: stderr}
+}
+
+// add adds the routes of the function file of dir, with their secrets
+// resolved.
+func (e *emulator) add(dir string, ff *funcfile) error {
+	routes, err := fndeploy.Routes(ff)
+	if err != nil {
+		return err
+	}
+	secrets, err := resolveSecrets(dir, ff)
+	if err != nil {
+		return err
+	}
+	for _, r := range routes {
+		for _, er := range e.routes {
+			if er.route.Path == r.Path {
+				return usageError("route %s is declared by both %s and %s", r.Path, er.route.Image, r.Image)
+			}
+		}
+		e.routes = append(e.routes, &emulatedRoute{route: *withSecrets(&r, secrets)})
+	}
+	// static routes take precedence over those with parameters
+	sort.SliceStable(e.routes, func(i, j int) bool {
+		return !strings.ContainsAny(e.routes[i].route.Path, ":*") && strings.ContainsAny(e.routes[j].route.Path, ":*")
+	})
+	return nil
+}
+
+// close removes the containers kept running.
+func (e *emulator) close() {
+	for _, r := range e.routes {
+		r.mu.Lock()
+		if r.hot != nil {
+			r.hot.c.remove()
+		}
+		r.mu.Unlock()
+	}
+}
+
+// match returns the route matching path, with the values of its parameters.
+func (e *emulator) match(p string) (*emulatedRoute, map[string]string) {
+	for _, r := range e.routes {
+		if params, ok := matchRoutePath(r.route.Path, p); ok {
+			return r, params
+		}
+	}
+	return nil, nil
+}
+
+// matchRoutePath tells whether path matches the route, whose :name segments
+// match any segment and *name ones what is left of path, returning their
+// values.
+func matchRoutePath(route, p string) (map[string]string, bool) {
+	rs := strings.Split(strings.Trim(route, "/"), "/")
+	ps := strings.Split(strings.Trim(p, "/"), "/")
+	params := make(map[string]string)
+	for i, seg := range rs {
+		if strings.HasPrefix(seg, "*") {
+			params[seg[1:]] = "/" + strings.Join(ps[i:], "/")
+			return params, true
+		}
+		if i >= len(ps) {
+			return nil, false
+		}
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			if ps[i] == "" {
+				return nil, false
+			}
+			params[seg[1:]] = ps[i]
+		case seg != ps[i]:
+			return nil, false
+		}
+	}
+	return params, len(rs) == len(ps)
+}
+
+func (e *emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/r/" + e.app
+	p := path.Clean(r.URL.Path)
+	if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+		if strings.HasPrefix(p, "/r/") {
+			emulatorError(w, http.StatusNotFound, "App not found")
+		} else {
+			emulatorError(w, http.StatusNotFound, "Not found, routes are at "+prefix)
+		}
+		return
+	}
+	route, params := e.match(strings.TrimPrefix(p, prefix))
+	if route == nil {
+		emulatorError(w, http.StatusNotFound, "Route not found")
+		return
+	}
+	start := time.Now()
+
+	// as on the server, GET calls send the payload query parameter
+	var payload io.Reader = r.Body
+	if r.Method == "GET" {
+		payload = strings.NewReader(r.URL.Query().Get("payload"))
+	}
+	body, err := ioutil.ReadAll(payload)
+	if err != nil {
+		emulatorError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	config := make(map[string]string)
+	for k, v := range e.config {
+		config[k] = v
+	}
+	for k, v := range route.route.Config {
+		config[k] = v
+	}
+	rt := route.route
+	rt.Config = config
+	opts := routeRunOptions(rt, nil)
+	opts.method = r.Method
+
+	env := []string{kvEq("REQUEST_URL", r.URL.String())}
+	var names []string
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		env = append(env, kvEq(toEnvName("PARAM", k), params[k]))
+	}
+	for k, v := range r.Header {
+		env = append(env, kvEq(toEnvName("HEADER", k), strings.Join(v, " ")))
+	}
+	callID := taskID()
+
+	var out bytes.Buffer
+	if rt.Type == "async" {
+		opts.env = append(opts.env, env...)
+		go func() {
+			if err := runff(rt.Image, bytes.NewReader(body), ioutil.Discard, e.stderr, opts); err != nil {
+				fmt.Fprintf(e.stderr, "%s %s: call %s: %v\n", r.Method, p, callID, err)
+			}
+		}()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"call_id": callID})
+		observeCall(e.app, rt.Path, http.StatusAccepted, time.Since(start))
+		return
+	}
+
+	if opts.format == "http" {
+		// the environment of hot functions is sent along with calls
+		env = append([]string{kvEq("METHOD", r.Method)}, env...)
+		err = route.call(bytes.NewReader(body), env, &out, opts, e.stderr)
+	} else {
+		opts.env = append(opts.env, env...)
+		err = runff(rt.Image, bytes.NewReader(body), &out, e.stderr, opts)
+	}
+	observeCall(e.app, rt.Path, emulatedStatus(err), time.Since(start))
+	fmt.Fprintf(e.stderr, "%s %s: %d\n", r.Method, p, emulatedStatus(err))
+	if err != nil {
+		status, msg := http.StatusInternalServerError, err.Error()
+		if fe, ok := err.(*fnError); ok {
+			msg = fe.Message
+			if fe.Kind == kindFunction {
+				status = fe.Status
+			}
+		}
+		emulatorError(w, status, msg)
+		return
+	}
+	for k, v := range rt.Headers {
+		w.Header().Set(k, v[0])
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(out.Bytes())
+}
+
+// call calls the hot function of the route, starting its container on the
+// first call, and again after it failed.
+func (r *emulatedRoute) call(body io.Reader, env []string, stdout io.Writer, opts runOptions, stderr io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hot == nil {
+		c, err := startContainer(r.route.Image, nil, stderr, opts)
+		if err != nil {
+			return err
+		}
+		r.hot = newHotFunction(c, stderr)
+	}
+	if _, err := r.hot.roundTrip(body, env, stdout, r.hot.c.timeout); err != nil {
+		// the function is in an unknown state
+		r.hot.c.remove()
+		r.hot = nil
+		return err
+	}
+	return nil
+}
+
+// emulatedStatus is the status of a call run locally which returned err.
+func emulatedStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if fe, ok := err.(*fnError); ok && fe.Kind == kindFunction {
+		return fe.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// emulatorError answers the error as the server does.
+func emulatorError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": msg},
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestMatchRoutePath(t *testing.T) {
+	for _, c := range []struct {
+		route, path string
+		params      map[string]string
+	}{
+		{"/hello", "/hello", map[string]string{}},
+		{"/hello", "/hello/", map[string]string{}},
+		{"/hello", "/hello/world", nil},
+		{"/hello", "/", nil},
+		{"/pets/:id", "/pets/42", map[string]string{"id": "42"}},
+		{"/pets/:id", "/pets", nil},
+		{"/pets/:id/toys/:toy", "/pets/42/toys/ball", map[string]string{"id": "42", "toy": "ball"}},
+		{"/files/*path", "/files/a/b.txt", map[string]string{"path": "/a/b.txt"}},
+	} {
+		params, ok := matchRoutePath(c.route, c.path)
+		if ok != (c.params != nil) || ok && !reflect.DeepEqual(params, c.params) {
+			t.Errorf("matchRoutePath(%s, %s) = %v, %v, want %v", c.route, c.path, params, ok, c.params)
+		}
+	}
+}
+
+func TestEmulator(t *testing.T) {
+	d := &fakeDocker{exited: make(chan int, 1)}
+	defer startFakeDocker(t, d)()
+
+	em := newEmulator("myapp", map[string]string{"LEVEL": "debug"}, ioutil.Discard)
+	defer em.close()
+	em.routes = []*emulatedRoute{
+		{route: fnmodels.Route{Path: "/hello", Image: "acme/hello", Headers: map[string][]string{"X-Greeting": {"yes"}}}},
+		{route: fnmodels.Route{Path: "/pets/:id", Image: "acme/pets", Config: map[string]string{"LEVEL": "info"}}},
+		{route: fnmodels.Route{Path: "/hot", Image: "acme/hot", Format: "http"}},
+	}
+
+	w := httptest.NewRecorder()
+	em.ServeHTTP(w, httptest.NewRequest("POST", "/r/myapp/hello", strings.NewReader("Johnny")))
+	if w.Code != 200 || w.Body.String() != "Hello Johnny" || w.Header().Get("X-Greeting") != "yes" {
+		t.Errorf("POST /r/myapp/hello = %d %q %v, want the greeting and the headers of the route", w.Code, w.Body.String(), w.Header())
+	}
+
+	// GET calls send the payload query parameter, and the function fails
+	// with odd ones
+	w = httptest.NewRecorder()
+	em.ServeHTTP(w, httptest.NewRequest("GET", "/r/myapp/pets/42?payload=Joe", nil))
+	var res struct{ Error struct{ Message string } }
+	if json.Unmarshal(w.Body.Bytes(), &res); w.Code != 500 || res.Error.Message == "" {
+		t.Errorf("GET /r/myapp/pets/42 = %d %s, want a 500", w.Code, w.Body.String())
+	}
+	env := strings.Join(d.created.Env, " ")
+	for _, e := range []string{"METHOD=GET", "ROUTE=/pets/:id", "PARAM_ID=42", "_LEVEL=info", "REQUEST_URL=/r/myapp/pets/42?payload=Joe"} {
+		if !strings.Contains(env, e) {
+			t.Errorf("call set %v, missing %s", d.created.Env, e)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		em.ServeHTTP(w, httptest.NewRequest("POST", "/r/myapp/hot", strings.NewReader("Joe")))
+		if w.Code != 200 || w.Body.String() != "Hello Joe from /hot" {
+			t.Errorf("POST /r/myapp/hot = %d %q, want the hot function to answer", w.Code, w.Body.String())
+		}
+	}
+
+	for _, p := range []string{"/r/myapp/nope", "/r/other/hello", "/"} {
+		w = httptest.NewRecorder()
+		em.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if w.Code != 404 {
+			t.Errorf("GET %s = %d, want 404", p, w.Code)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli"
+)
+
+// The state fn keeps in ~/.fn (contexts with their tokens, the audit log,
+// deleted routes...) can be encrypted at rest. Encrypted files start with
+// encryptedMagic, followed by the source of the key, the salt it was derived
+// with, the nonce and the AES-GCM sealed content. They are decrypted
+// transparently when read, and files written while the configuration is
+// encrypted are encrypted too.
+const encryptedMagic = "fn-encrypted-v1\n"
+
+// Sources of the key encrypting the state.
+const (
+	keyFromPassphrase = 'p'
+	keyFromKeychain   = 'k'
+)
+
+const (
+	saltSize         = 16
+	pbkdf2Iterations = 100000
+	keychainService  = "fn-config"
+)
+
+var stateKeys = struct {
+	sync.Mutex
+	passphrase []byte
+	keychain   []byte
+	derived    map[string][]byte
+
+	// encryption of the files written, 0 when they are not
+	source byte
+	salt   []byte
+	probed bool
+}{derived: make(map[string][]byte)}
+
+func isEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(encryptedMagic))
+}
+
+// stateEncryption tells how new state files are to be encrypted, following
+// the configuration file.
+func stateEncryption() (source byte, salt []byte) {
+	stateKeys.Lock()
+	defer stateKeys.Unlock()
+	if !stateKeys.probed {
+		stateKeys.probed = true
+		if b, err := ioutil.ReadFile(configPath()); err == nil && isEncrypted(b) && len(b) > len(encryptedMagic)+1+saltSize {
+			stateKeys.source = b[len(encryptedMagic)]
+			stateKeys.salt = b[len(encryptedMagic)+1 : len(encryptedMagic)+1+saltSize]
+		}
+	}
+	return stateKeys.source, stateKeys.salt
+}
+
+func setStateEncryption(source byte, salt []byte) {
+	stateKeys.Lock()
+	defer stateKeys.Unlock()
+	stateKeys.probed = true
+	stateKeys.source, stateKeys.salt = source, salt
+}
+
+// stateKey returns the AES key for the given source and salt, asking for the
+// passphrase or reading the keychain once per run.
+func stateKey(source byte, salt []byte) ([]byte, error) {
+	stateKeys.Lock()
+	defer stateKeys.Unlock()
+
+	switch source {
+	case keyFromPassphrase:
+		id := string(salt)
+		if k, ok := stateKeys.derived[id]; ok {
+			return k, nil
+		}
+		if stateKeys.passphrase == nil {
+			p, err := passphrase(false)
+			if err != nil {
+				return nil, err
+			}
+			stateKeys.passphrase = p
+		}
+		k := pbkdf2SHA256(stateKeys.passphrase, salt, pbkdf2Iterations, 32)
+		stateKeys.derived[id] = k
+		return k, nil
+	case keyFromKeychain:
+		if stateKeys.keychain == nil {
+			k, err := keychainKey(false)
+			if err != nil {
+				return nil, err
+			}
+			stateKeys.keychain = k
+		}
+		return stateKeys.keychain, nil
+	}
+	return nil, fmt.Errorf("unknown encryption key source %q", source)
+}
+
+func encryptState(plain []byte, source byte, salt []byte) ([]byte, error) {
+	key, err := stateKey(source, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(encryptedMagic), source)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plain, nil), nil
+}
+
+func decryptState(b []byte) ([]byte, error) {
+	b = b[len(encryptedMagic):]
+	if len(b) < 1+saltSize {
+		return nil, errors.New("truncated encrypted file")
+	}
+	source, salt := b[0], b[1:1+saltSize]
+	key, err := stateKey(source, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	b = b[1+saltSize:]
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New("truncated encrypted file")
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("could not decrypt, wrong passphrase or corrupted file")
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readState reads a state file, decrypting it if need be.
+func readState(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil || !isEncrypted(b) {
+		return b, err
+	}
+	plain, err := decryptState(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return plain, nil
+}
+
+// writeState writes a state file, encrypting it if the state is.
+func writeState(path string, b []byte) error {
+	if source, salt := stateEncryption(); source != 0 {
+		var err error
+		if b, err = encryptState(b, source, salt); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, b, os.FileMode(0600))
+}
+
+// pbkdf2SHA256 derives a key from a password as per RFC 2898.
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var dk []byte
+	for block := uint32(1); len(dk) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], block)
+		prf.Write(n[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		dk = append(dk, t...)
+	}
+	return dk[:keyLen]
+}
+
+// passphrase reads the passphrase from $FN_PASSPHRASE, or asks for it without
+// echoing it, twice when it is a new one.
+func passphrase(confirm bool) ([]byte, error) {
+	if p := os.Getenv("FN_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+	p, err := readSecret("passphrase for the fn configuration: ")
+	if err != nil {
+		return nil, err
+	}
+	if p == "" {
+		return nil, usageError("the passphrase cannot be empty")
+	}
+	if confirm {
+		again, err := readSecret("passphrase again: ")
+		if err != nil {
+			return nil, err
+		}
+		if again != p {
+			return nil, usageError("the passphrases do not match")
+		}
+	}
+	return []byte(p), nil
+}
+
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	restore := disableEcho()
+	s, err := stdinLines.ReadString('\n')
+	restore()
+	fmt.Fprintln(os.Stderr)
+	if err != nil && s == "" {
+		return "", fmt.Errorf("could not read the passphrase: %v", err)
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
+
+// keychainKey reads the key from the keystore of the operating system, the
+// macOS keychain or the Secret Service on Linux through secret-tool. With
+// create, a missing key is generated and stored there.
+func keychainKey(create bool) ([]byte, error) {
+	var lookup *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		lookup = exec.Command("security", "find-generic-password", "-s", keychainService, "-w")
+	case "linux":
+		lookup = exec.Command("secret-tool", "lookup", "service", keychainService)
+	default:
+		return nil, fmt.Errorf("no supported keystore on %s, use a passphrase instead", runtime.GOOS)
+	}
+	if out, err := lookup.Output(); err == nil && len(bytes.TrimSpace(out)) > 0 {
+		return hex.DecodeString(string(bytes.TrimSpace(out)))
+	}
+	if !create {
+		return nil, newNotFoundError("the key of the fn configuration was not found in the keystore")
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	var store *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		store = exec.Command("security", "add-generic-password", "-U", "-a", firstNonEmpty(os.Getenv("USER"), "fn"), "-s", keychainService, "-w", hex.EncodeToString(key))
+	} else {
+		store = exec.Command("secret-tool", "store", "--label=fn configuration key", "service", keychainService)
+		store.Stdin = strings.NewReader(hex.EncodeToString(key))
+	}
+	if out, err := store.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("could not store the key in the keystore: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return key, nil
+}
+
+// stateFiles lists the files fn keeps its state in.
+func stateFiles() ([]string, error) {
+	files := []string{configPath(), auditPath()}
+	for _, pattern := range []string{filepath.Join(trashDir(), "*.json"), filepath.Join(fnHome(), "chaos", "*.json"), filepath.Join(fnHome(), "budget", "*.json"), filepath.Join(fnHome(), "queue", "*.jsonl"), filepath.Join(fnHome(), "cache", "*", "*.json"), filepath.Join(fnHome(), "completion", "*.json")} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	return existing, nil
+}
+
+func configCommand() cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "manage the local fn configuration and state",
+		Subcommands: []cli.Command{
+			{
+				Name:   "encrypt",
+				Usage:  "encrypt the configuration, audit log and deleted routes with a passphrase or a key in the OS keystore",
+				Action: encryptConfig,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "keychain",
+						Usage: "use a key kept in the macOS keychain or the Secret Service instead of a passphrase",
+					},
+				},
+			},
+			{
+				Name:   "decrypt",
+				Usage:  "store the configuration and state in clear again",
+				Action: decryptConfig,
+			},
+		},
+	}
+}
+
+func encryptConfig(c *cli.Context) error {
+	if c.Bool("keychain") {
+		return encryptStateFiles(keyFromKeychain)
+	}
+	return encryptStateFiles(keyFromPassphrase)
+}
+
+func encryptStateFiles(source byte) error {
+	if current, _ := stateEncryption(); current != 0 {
+		return usageError("the configuration is already encrypted")
+	}
+	files, err := stateFiles()
+	if err != nil {
+		return err
+	}
+
+	if source == keyFromKeychain {
+		k, err := keychainKey(true)
+		if err != nil {
+			return err
+		}
+		stateKeys.Lock()
+		stateKeys.keychain = k
+		stateKeys.Unlock()
+	} else {
+		p, err := passphrase(true)
+		if err != nil {
+			return err
+		}
+		stateKeys.Lock()
+		stateKeys.passphrase = p
+		stateKeys.Unlock()
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	if _, err := stateKey(source, salt); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(configPath()); os.IsNotExist(err) {
+		// the configuration tells the other files are encrypted
+		if err := storeConfig(&config{}); err != nil {
+			return err
+		}
+		files = append([]string{configPath()}, files...)
+	}
+
+	setStateEncryption(source, salt)
+	for _, f := range files {
+		b, err := readState(f)
+		if err != nil {
+			return err
+		}
+		if err := writeState(f, b); err != nil {
+			return err
+		}
+	}
+	fmt.Println(len(files), "files encrypted in", fnHome())
+	return nil
+}
+
+func decryptConfig(c *cli.Context) error {
+	return decryptStateFiles()
+}
+
+func decryptStateFiles() error {
+	if source, _ := stateEncryption(); source == 0 {
+		return usageError("the configuration is not encrypted")
+	}
+	files, err := stateFiles()
+	if err != nil {
+		return err
+	}
+
+	// decrypt everything before writing anything, not to end up half done
+	// on a wrong passphrase
+	plain := make([][]byte, len(files))
+	for i, f := range files {
+		if plain[i], err = readState(f); err != nil {
+			return err
+		}
+	}
+	setStateEncryption(0, nil)
+	for i, f := range files {
+		if err := writeState(f, plain[i]); err != nil {
+			return err
+		}
+	}
+	fmt.Println(len(files), "files decrypted in", fnHome())
+	return nil
+}
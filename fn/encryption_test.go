@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	k := pbkdf2SHA256([]byte("password"), []byte("salt"), 1, 32)
+	if hex.EncodeToString(k) != "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b" {
+		t.Errorf("unexpected key %x", k)
+	}
+}
+
+func TestEncryptConfig(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer os.Setenv("FN_PASSPHRASE", os.Getenv("FN_PASSPHRASE"))
+	os.Setenv("FN_PASSPHRASE", "secret")
+	defer setStateEncryption(0, nil)
+	setStateEncryption(0, nil)
+
+	cfg := &config{CurrentContext: "prod", Contexts: map[string]*fnContext{"prod": {Token: "t0ken"}}}
+	if err := storeConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// the rest of the state is encrypted along
+	req, _ := http.NewRequest("GET", "http://localhost:8080/v1/apps/myapp/routes", nil)
+	state := []string{queuePath(), cacheFile(req), completionCachePath()}
+	for _, p := range state {
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("t0ken\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encryptStateFiles(keyFromPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range state {
+		if b, err := ioutil.ReadFile(p); err != nil || !isEncrypted(b) {
+			t.Errorf("expected %s to be encrypted, got %q (%v)", p, b, err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(configPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(b) || bytes.Contains(b, []byte("t0ken")) {
+		t.Fatalf("expected the configuration to be encrypted, got %q", b)
+	}
+	loaded, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Contexts["prod"] == nil || loaded.Contexts["prod"].Token != "t0ken" {
+		t.Errorf("expected the configuration to be decrypted transparently, got %+v", loaded)
+	}
+
+	if err := decryptStateFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = ioutil.ReadFile(configPath()); !bytes.Contains(b, []byte("t0ken")) {
+		t.Errorf("expected the configuration in clear, got %q", b)
+	}
+}
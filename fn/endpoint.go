@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	"github.com/urfave/cli"
+)
+
+// routeURL is the URL functions are called at, under the API URL of the
+// context, prefix included.
+func routeURL(appName, route string) *url.URL {
+	u := apiURL()
+	u.Path = path.Join(u.Path, "r", appName, route)
+	return u
+}
+
+func (a *routesCmd) endpoint(c *cli.Context) error {
+	names := []string{"app", "path"}
+	if c.Bool("all") {
+		names = names[:1]
+	}
+	args, err := routeArgs(c, names...)
+	if err != nil {
+		return err
+	}
+	appName := args.Get(0)
+	if !c.Bool("all") {
+		fmt.Println(routeURL(appName, args.Get(1)))
+		return nil
+	}
+
+	resp, err := a.client.Routes.GetAppsAppRoutes(&apiroutes.GetAppsAppRoutesParams{
+		Context: cacheable(cmdContext()),
+		App:     appName,
+	})
+	if err != nil {
+		return apiError(err)
+	}
+	var paths []string
+	for _, route := range resp.Payload.Routes {
+		paths = append(paths, route.Path)
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 && c.Bool("fail-on-empty") {
+		return emptyError("routes")
+	}
+
+	if globals.output == "json" {
+		endpoints := make(map[string]string, len(paths))
+		for _, p := range paths {
+			endpoints[p] = routeURL(appName, p).String()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(endpoints)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	for _, p := range paths {
+		fmt.Fprint(w, p, "\t", routeURL(appName, p), "\n")
+	}
+	return w.Flush()
+}
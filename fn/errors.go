@@ -1,5 +1,18 @@
 package main
 
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/go-openapi/runtime"
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
 type notFoundError struct {
 	S string
 }
@@ -11,3 +24,166 @@ func (e *notFoundError) Error() string {
 func newNotFoundError(s string) *notFoundError {
 	return &notFoundError{S: s}
 }
+
+// Kinds of failure, each exiting fn with its own status, so scripts can tell
+// them apart.
+const (
+	kindError       = "error"
+	kindNotFound    = "not_found"
+	kindConflict    = "conflict"
+	kindValidation  = "validation"
+	kindServer      = "server"
+	kindNetwork     = "network"
+	kindFunction    = "function"
+	kindPartial     = "partial"
+	kindEmpty       = "empty"
+	kindInterrupted = "interrupted"
+)
+
+var exitCodes = map[string]int{
+	kindError:      1,
+	kindEmpty:      2,
+	kindNotFound:   3,
+	kindConflict:   4,
+	kindValidation: 5,
+	kindPartial:    6,
+	kindServer:     10,
+	kindNetwork:    11,
+	// as shells report commands killed by SIGINT
+	kindInterrupted: 130,
+}
+
+// fnError is an error classified by kind, reported as such by fn on exit.
+type fnError struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Status  int    `json:"status,omitempty"`
+
+	// localized is the message in the language of the user, when
+	// translated. Message stays in English for machines.
+	localized string
+}
+
+func (e *fnError) Error() string {
+	return T("error: ") + firstNonEmpty(e.localized, e.Message)
+}
+
+// ExitCode tells the exit status of fn for this error. A function answering a
+// call with an error status exits with 20 plus the status class, eg. 25 for a
+// 5xx.
+func (e *fnError) ExitCode() int {
+	if e.Kind == kindFunction {
+		return 20 + e.Status/100
+	}
+	return exitCodes[e.Kind]
+}
+
+// exitStatus ends fn with the status a program it ran exited with, the
+// program having told what went wrong.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// emptyError reports a list command listing nothing with --fail-on-empty.
+func emptyError(what string) error {
+	return &fnError{Kind: kindEmpty, Message: "no " + what + " found", localized: fmt.Sprintf(T("no %s found"), T(what))}
+}
+
+// usageError reports invalid arguments or flags.
+func usageError(format string, a ...interface{}) error {
+	return &fnError{Kind: kindValidation, Message: fmt.Sprintf(format, a...), localized: fmt.Sprintf(T(format), a...)}
+}
+
+func kindFromStatus(status int) string {
+	switch {
+	case status == 404:
+		return kindNotFound
+	case status == 409:
+		return kindConflict
+	case status == 400 || status == 422:
+		return kindValidation
+	case status >= 500:
+		return kindServer
+	}
+	return kindError
+}
+
+// apiError turns an error returned by the swagger client into a fnError. The
+// generated client has one error type per operation and response, all named
+// after the response (PostAppsConflict, GetAppsAppNotFound...) and carrying
+// the error message sent by the server in their Payload.
+func apiError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*runtime.APIError); ok {
+		return &fnError{Kind: kindFromStatus(e.Code), Message: fmt.Sprintf("unexpected response to %s", e.OperationName), Status: e.Code}
+	}
+
+	v := reflect.ValueOf(err)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return classify(err)
+	}
+	field := v.Elem().FieldByName("Payload")
+	if !field.IsValid() || !field.CanInterface() {
+		return classify(err)
+	}
+	payload, ok := field.Interface().(*fnmodels.Error)
+	if !ok {
+		return classify(err)
+	}
+
+	e := &fnError{Message: err.Error()}
+	if payload != nil && payload.Error != nil {
+		e.Message = payload.Error.Message
+	}
+	name := v.Elem().Type().Name()
+	switch {
+	case strings.HasSuffix(name, "NotFound"):
+		e.Status = 404
+	case strings.HasSuffix(name, "Conflict"):
+		e.Status = 409
+	case strings.HasSuffix(name, "BadRequest"):
+		e.Status = 400
+	default:
+		if c, ok := err.(interface {
+			Code() int
+		}); ok {
+			e.Status = c.Code()
+		}
+	}
+	e.Kind = kindFromStatus(e.Status)
+	return e
+}
+
+// classify tells the kind of any error returned by a command.
+func classify(err error) *fnError {
+	switch e := err.(type) {
+	case *fnError:
+		return e
+	case *notFoundError:
+		return &fnError{Kind: kindNotFound, Message: e.Error()}
+	case *url.Error, net.Error:
+		return &fnError{Kind: kindNetwork, Message: e.Error()}
+	}
+	return &fnError{Kind: kindError, Message: strings.TrimPrefix(err.Error(), "error: ")}
+}
+
+// isBrokenPipe tells whether err comes from writing to an output closed by
+// its reader.
+func isBrokenPipe(err error) bool {
+	for {
+		switch e := err.(type) {
+		case *os.PathError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return isBrokenPipeErrno(e)
+		default:
+			return false
+		}
+	}
+}
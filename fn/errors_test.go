@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	apiapps "github.com/iron-io/functions_go/client/apps"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestAPIError(t *testing.T) {
+	payload := &fnmodels.Error{Error: &fnmodels.ErrorBody{Message: "boom"}}
+
+	cases := []struct {
+		err  error
+		kind string
+		code int
+	}{
+		{&apiroutes.GetAppsAppRoutesRouteNotFound{Payload: payload}, kindNotFound, 3},
+		{&apiapps.PostAppsConflict{Payload: payload}, kindConflict, 4},
+		{&apiapps.PostAppsBadRequest{Payload: payload}, kindValidation, 5},
+		{&url.Error{Op: "Get", URL: "http://localhost:8080", Err: errors.New("connection refused")}, kindNetwork, 11},
+		{errors.New("error: something"), kindError, 1},
+	}
+
+	for i, c := range cases {
+		e := classify(apiError(c.err))
+		if e.Kind != c.kind || e.ExitCode() != c.code {
+			t.Errorf("case %d: expected %s (%d), got %s (%d)", i, c.kind, c.code, e.Kind, e.ExitCode())
+		}
+	}
+
+	if e := classify(apiError(cases[0].err)); e.Message != "boom" {
+		t.Errorf("expected the server message, got %q", e.Message)
+	}
+}
+
+func TestIsBrokenPipe(t *testing.T) {
+	if !isBrokenPipe(&os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.EPIPE}) {
+		t.Error("expected EPIPE to be a broken pipe")
+	}
+	if isBrokenPipe(&os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.ENOSPC}) {
+		t.Error("expected ENOSPC not to be a broken pipe")
+	}
+}
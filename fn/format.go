@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Numbers shown to humans go through these helpers, so that every command
+// renders them the same way: with units and grouped digits following the
+// locale, unless --raw asks for plain integers.
+
+type numberFormat struct {
+	thousands string
+	decimal   string
+}
+
+// localeFormats lists the languages not grouping digits with commas.
+var localeFormats = map[string]numberFormat{
+	"da": {".", ","}, "de": {".", ","}, "es": {".", ","}, "id": {".", ","},
+	"it": {".", ","}, "nl": {".", ","}, "pt": {".", ","}, "tr": {".", ","},
+	"cs": {" ", ","}, "fi": {" ", ","}, "fr": {" ", ","}, "nb": {" ", ","},
+	"pl": {" ", ","}, "ru": {" ", ","}, "sv": {" ", ","}, "uk": {" ", ","},
+}
+
+func localeNumberFormat() numberFormat {
+	if f, ok := localeFormats[localeLang("LC_ALL", "LC_NUMERIC", "LANG")]; ok {
+		return f
+	}
+	return numberFormat{",", "."}
+}
+
+// formatCount renders n with its digits grouped, eg. 12,345.
+func formatCount(n int64) string {
+	if globals.raw {
+		return strconv.FormatInt(n, 10)
+	}
+	return groupDigits(n, localeNumberFormat())
+}
+
+// formatMemory renders a route memory, given in MB, eg. 128 MB or 1.5 GB.
+func formatMemory(mb int64) string {
+	if globals.raw {
+		return strconv.FormatInt(mb, 10)
+	}
+	return formatUnits(mb, []string{"MB", "GB", "TB"})
+}
+
+// formatSize renders a size in bytes, eg. 12.3 MB.
+func formatSize(b int64) string {
+	if globals.raw {
+		return strconv.FormatInt(b, 10)
+	}
+	return formatUnits(b, []string{"B", "kB", "MB", "GB", "TB"})
+}
+
+func formatUnits(n int64, units []string) string {
+	f := localeNumberFormat()
+	if n < 1024 && n > -1024 {
+		return groupDigits(n, f) + " " + units[0]
+	}
+
+	v := float64(n)
+	u := 0
+	for (v >= 1024 || v <= -1024) && u < len(units)-1 {
+		v /= 1024
+		u++
+	}
+	s := strconv.FormatFloat(v, 'f', 1, 64)
+	s = strings.TrimSuffix(s, ".0")
+	return strings.Replace(s, ".", f.decimal, 1) + " " + units[u]
+}
+
+func groupDigits(n int64, f numberFormat) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var out []string
+	for len(s) > 3 {
+		out = append([]string{s[len(s)-3:]}, out...)
+		s = s[:len(s)-3]
+	}
+	out = append([]string{s}, out...)
+	return sign + strings.Join(out, f.thousands)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	defer func(lang string) { os.Setenv("LANG", lang) }(os.Getenv("LANG"))
+	os.Unsetenv("LC_ALL")
+	os.Unsetenv("LC_NUMERIC")
+
+	cases := []struct {
+		lang string
+		raw  bool
+		got  func() string
+		want string
+	}{
+		{"en_US.UTF-8", false, func() string { return formatCount(1234567) }, "1,234,567"},
+		{"de_DE.UTF-8", false, func() string { return formatCount(1234567) }, "1.234.567"},
+		{"en_US.UTF-8", true, func() string { return formatCount(1234567) }, "1234567"},
+		{"en_US.UTF-8", false, func() string { return formatMemory(128) }, "128 MB"},
+		{"en_US.UTF-8", false, func() string { return formatMemory(1536) }, "1.5 GB"},
+		{"fr_FR.UTF-8", false, func() string { return formatMemory(1536) }, "1,5 GB"},
+		{"en_US.UTF-8", false, func() string { return formatMemory(2048) }, "2 GB"},
+		{"en_US.UTF-8", true, func() string { return formatMemory(2048) }, "2048"},
+		{"C", false, func() string { return formatSize(5 << 20) }, "5 MB"},
+	}
+
+	for i, c := range cases {
+		os.Setenv("LANG", c.lang)
+		globals.raw = c.raw
+		if got := c.got(); got != c.want {
+			t.Errorf("case %d: expected %q, got %q", i, c.want, got)
+		}
+	}
+	globals.raw = false
+}
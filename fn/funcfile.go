@@ -1,84 +1,36 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
 
-	yaml "gopkg.in/yaml.v2"
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
 )
 
-var (
-	validfn = [...]string{
-		"func.yaml",
-		"func.yml",
-		"func.json",
-	}
-
-	errUnexpectedFileFormat = errors.New("unexpected file format for function file")
+// Function files are read and written by the funcfile package, fn applying
+// its flags and environment to them as they are loaded.
+type (
+	funcfile      = ffile.Funcfile
+	fftest        = ffile.Test
+	ffroute       = ffile.Route
+	ffenv         = ffile.Environment
+	ffhooks       = ffile.Hooks
+	ffhealthcheck = ffile.Healthcheck
 )
 
-type fftest struct {
-	Name string            `yaml:"name,omitempty",json:"name,omitempty"`
-	In   *string           `yaml:"in,omitempty",json:"in,omitempty"`
-	Out  *string           `yaml:"out,omitempty",json:"out,omitempty"`
-	Err  *string           `yaml:"err,omitempty",json:"err,omitempty"`
-	Env  map[string]string `yaml:"env,omitempty",json:"env,omitempty"`
-}
-
-type funcfile struct {
-	Name       string            `yaml:"name,omitempty",json:"name,omitempty"`
-	Version    string            `yaml:"version,omitempty",json:"version,omitempty"`
-	Runtime    *string           `yaml:"runtime,omitempty",json:"runtime,omitempty"`
-	Entrypoint *string           `yaml:"entrypoint,omitempty",json:"entrypoint,omitempty"`
-	Type       *string           `yaml:"type,omitempty",json:"type,omitempty"`
-	Memory     *int64            `yaml:"memory,omitempty",json:"memory,omitempty"`
-	Format     *string           `yaml:"format,omitempty",json:"format,omitempty"`
-	Timeout    *time.Duration    `yaml:"timeout,omitempty",json:"timeout,omitempty"`
-	Headers    map[string]string `yaml:"headers,omitempty",json:"headers,omitempty"`
-	Config     map[string]string `yaml:"config,omitempty",json:"config,omitempty"`
-	Build      []string          `yaml:"build,omitempty",json:"build,omitempty"`
-	Tests      []fftest          `yaml:"tests,omitempty",json:"tests,omitempty"`
-
-	path           *string `yaml:"path,omitempty",json:"path,omitempty"`
-	maxConcurrency *int    `yaml:"max_concurrency,omitempty",json:"max_concurrency,omitempty"`
-}
-
-func (ff *funcfile) FullName() string {
-	fname := ff.Name
-	if ff.Version != "" {
-		fname = fmt.Sprintf("%s:%s", fname, ff.Version)
+// pinnedFuncImage returns the image of the function by its digest.
+func pinnedFuncImage(ff *funcfile) (string, error) {
+	if ff.ImageDigest == "" {
+		return "", usageError("%s has no image_digest to pin the route to, push the function first", ff.Name)
 	}
-	return fname
-}
-
-func (ff *funcfile) RuntimeTag() (runtime, tag string) {
-	if ff.Runtime == nil {
-		return "", ""
-	}
-
-	rt := *ff.Runtime
-	tagpos := strings.Index(rt, ":")
-	if tagpos == -1 {
-		return rt, ""
-	}
-
-	return rt[:tagpos], rt[tagpos+1:]
+	return cleanImageName(ff.FullName()) + "@" + ff.ImageDigest, nil
 }
 
 func findFuncfile(path string) (string, error) {
-	for _, fn := range validfn {
-		fullfn := filepath.Join(path, fn)
-		if exists(fullfn) {
-			return fullfn, nil
-		}
+	fn, err := ffile.Find(path)
+	if err == ffile.ErrNotFound {
+		return "", newNotFoundError(err.Error())
 	}
-	return "", newNotFoundError("could not find function file")
+	return fn, err
 }
 
 func loadFuncfile() (*funcfile, error) {
@@ -89,60 +41,31 @@ func loadFuncfile() (*funcfile, error) {
 	return parsefuncfile(fn)
 }
 
+// parsefuncfile reads the function file at path, expanding the environment
+// variables it refers to unless --no-expand is given, with the settings of
+// the selected environment.
 func parsefuncfile(path string) (*funcfile, error) {
-	ext := filepath.Ext(path)
-	switch ext {
-	case ".json":
-		return decodeFuncfileJSON(path)
-	case ".yaml", ".yml":
-		return decodeFuncfileYAML(path)
-	}
-	return nil, errUnexpectedFileFormat
-}
-
-func storefuncfile(path string, ff *funcfile) error {
-	ext := filepath.Ext(path)
-	switch ext {
-	case ".json":
-		return encodeFuncfileJSON(path, ff)
-	case ".yaml", ".yml":
-		return encodeFuncfileYAML(path, ff)
+	var ff *funcfile
+	var err error
+	if globals.values != nil {
+		var b []byte
+		if b, err = renderFuncfile(path, globals.values); err == nil {
+			ff, err = ffile.DecodeData(path, b)
+		}
+	} else {
+		ff, err = ffile.Decode(path)
 	}
-	return errUnexpectedFileFormat
-}
-
-func decodeFuncfileJSON(path string) (*funcfile, error) {
-	f, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("could not open %s for parsing. Error: %v", path, err)
+		return nil, err
 	}
-	ff := new(funcfile)
-	err = json.NewDecoder(f).Decode(ff)
-	return ff, err
-}
-
-func decodeFuncfileYAML(path string) (*funcfile, error) {
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not open %s for parsing. Error: %v", path, err)
+	if !globals.noExpand {
+		ff.Interpolate()
 	}
-	ff := new(funcfile)
-	err = yaml.Unmarshal(b, ff)
-	return ff, err
-}
-
-func encodeFuncfileJSON(path string, ff *funcfile) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("could not open %s for encoding. Error: %v", path, err)
+	if err := ff.SelectEnvironment(globals.environment, !globals.noExpand); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
-	return json.NewEncoder(f).Encode(ff)
-}
-
-func encodeFuncfileYAML(path string, ff *funcfile) error {
-	b, err := yaml.Marshal(ff)
-	if err != nil {
-		return fmt.Errorf("could not encode function file. Error: %v", err)
+	if globals.pushRegistry != "" {
+		ff.Registry = globals.pushRegistry
 	}
-	return ioutil.WriteFile(path, b, os.FileMode(0644))
+	return ff, nil
 }
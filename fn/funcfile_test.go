@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+)
+
+func TestParsefuncfileInterpolation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-funcfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("FN_TEST_ENV")
+	os.Setenv("FN_TEST_ENV", "prod")
+	defer func(g globalOptions) { globals = g }(globals)
+
+	path := filepath.Join(dir, "func.yaml")
+	err = ioutil.WriteFile(path, []byte(`name: acme/hello-${FN_TEST_ENV}
+config:
+  DB_URL: postgres://db.${FN_TEST_ENV:-staging}.local
+paths:
+- /${FN_TEST_ENV}/hello
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ff, err := parsefuncfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Name != "acme/hello-prod" || ff.Config["DB_URL"] != "postgres://db.prod.local" || ff.Paths[0] != "/prod/hello" {
+		t.Errorf("expected the variables to be expanded, got %+v", ff)
+	}
+
+	globals.noExpand = true
+	if ff, err = parsefuncfile(path); err != nil {
+		t.Fatal(err)
+	}
+	if ff.Name != "acme/hello-${FN_TEST_ENV}" {
+		t.Errorf("expected the variables to be left alone with --no-expand, got %s", ff.Name)
+	}
+	if r := fndeploy.Route(ff); r.Config["DB_URL"] != "postgres://db.${FN_TEST_ENV:-staging}.local" {
+		t.Errorf("expected the config deployed to be left alone with --no-expand, got %s", r.Config["DB_URL"])
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func git(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running git %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitChangedFiles lists, as absolute paths, every file that differs between
+// ref and the working tree of the repository containing dir. Untracked files
+// are included so that brand new functions are picked up too, and renamed
+// files are listed under both names, as both directories changed.
+func gitChangedFiles(dir, ref string) ([]string, error) {
+	root, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := git(dir, "diff", "--name-only", "--no-renames", ref)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard", "--full-name")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	scanner := bufio.NewScanner(strings.NewReader(diff + "\n" + untracked))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(line)))
+		}
+	}
+	return files, scanner.Err()
+}
+
+// changedFuncfiles returns which of the function files found at paths
+// changed: those of the deepest function directory holding each of the
+// changed files, so that a change to a nested function is not one of the
+// function around it.
+func changedFuncfiles(paths, changed []string) map[string]bool {
+	result := make(map[string]bool)
+	dirs := make(map[string][]string, len(paths))
+	for _, path := range paths {
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			result[path] = true
+			continue
+		}
+		// git reports paths with symlinks resolved; do the same on our side.
+		if d, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = d
+		}
+		dirs[dir] = append(dirs[dir], path)
+	}
+
+	for _, f := range changed {
+		for dir := filepath.Dir(f); ; dir = filepath.Dir(dir) {
+			if ps, ok := dirs[dir]; ok {
+				for _, p := range ps {
+					result[p] = true
+				}
+				break
+			}
+			if parent := filepath.Dir(dir); parent == dir {
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestChangedFuncfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		defer os.Unsetenv(v)
+		os.Setenv(v, "fn@example.org")
+	}
+	if _, err := git(dir, "init", "-q"); err != nil {
+		t.Skip(err)
+	}
+
+	write := func(name, content string) {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// api holds the nested function api/users
+	for _, fn := range []string{"api", "api/users", "web"} {
+		write(fn+"/func.yaml", "name: acme/"+filepath.Base(fn)+"\nversion: 0.0.1\n")
+		write(fn+"/func.go", "package main\n")
+	}
+	write("api/lib/util.go", "package lib\n")
+	if _, err := git(dir, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(dir, "commit", "-q", "-m", "functions"); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{
+		filepath.Join(dir, "api", "func.yaml"),
+		filepath.Join(dir, "api", "users", "func.yaml"),
+		filepath.Join(dir, "web", "func.yaml"),
+	}
+
+	changed := func() string {
+		files, err := gitChangedFiles(dir, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fns []string
+		for p := range changedFuncfiles(paths, files) {
+			rel, _ := filepath.Rel(dir, filepath.Dir(p))
+			fns = append(fns, filepath.ToSlash(rel))
+		}
+		sort.Strings(fns)
+		return strings.Join(fns, " ")
+	}
+	if got := changed(); got != "" {
+		t.Errorf("expected no function changed, got %s", got)
+	}
+
+	// a change to the nested function is not one of the function around it
+	write("api/users/func.go", "package main\n\nfunc main() {}\n")
+	if got := changed(); got != "api/users" {
+		t.Errorf("expected api/users changed, got %q", got)
+	}
+	git(dir, "checkout", "--", ".")
+
+	// files below a function which are not another function are its own
+	write("api/lib/new.go", "package lib\n")
+	if got := changed(); got != "api" {
+		t.Errorf("expected api changed by an untracked file, got %q", got)
+	}
+	os.Remove(filepath.Join(dir, "api", "lib", "new.go"))
+
+	// a file moved from a function to another changes both
+	if _, err := git(dir, "mv", "api/lib/util.go", "web/util.go"); err != nil {
+		t.Fatal(err)
+	}
+	if got := changed(); got != "api web" {
+		t.Errorf("expected api and web changed by a rename, got %q", got)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const defaultAPIURL = "http://localhost:8080"
+
+// globalOptions are the settings shared by every command. They are resolved
+// once, before any command runs, from the global flags, the environment and
+// the active context - in this order of precedence.
+type globalOptions struct {
+	context  string
+	apiURL   string
+	token    string
+	registry string
+	// app is the one commands act on when they are given none, from $FN_APP
+	// or the context.
+	app string
+
+	// contextName is the context in use, the current one when none is given.
+	contextName string
+
+	tlsCA    string
+	tlsCert  string
+	tlsKey   string
+	insecure bool
+
+	apiTimeout  time.Duration
+	callTimeout time.Duration
+
+	// maxConnsPerHost and maxIdleConnsPerHost size the pool of connections
+	// requests go through, 0 for no limit on connections.
+	maxConnsPerHost     int
+	maxIdleConnsPerHost int
+	// noHTTP2 keeps to HTTP/1.1, even with servers speaking HTTP/2.
+	noHTTP2 bool
+
+	retries      int
+	retryBackoff time.Duration
+
+	// callBudget is how many function calls a minute the context allows,
+	// 0 for no limit.
+	callBudget int
+
+	verbose int
+	output  string
+	raw     bool
+	// quiet silences progress, leaving data and errors.
+	quiet bool
+	// noColor leaves what is written to terminals uncolored.
+	noColor bool
+	// offline queues the changes to apps and routes until fn sync, instead
+	// of sending them.
+	offline bool
+	// cacheTTL is how long the lists of apps and routes are cached, 0 not
+	// to cache them.
+	cacheTTL time.Duration
+	// strictCompat refuses to send routes with fields the server would
+	// drop, instead of warning about them.
+	strictCompat bool
+
+	// noExpand leaves the environment variables of function files as they
+	// are written.
+	noExpand bool
+	// environment is the environment of function files in use, from $FN_ENV
+	// or the --env of the commands deploying functions.
+	environment string
+	// values are those function files are rendered with as templates, nil
+	// unless --values or --set are given.
+	values map[string]interface{}
+	// pushRegistry is the one images are pushed to, from the --registry of
+	// the commands building functions, overriding that of function files.
+	pushRegistry string
+}
+
+var globals globalOptions
+
+func globalFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "verbose,v",
+			Usage: "log every HTTP request made, with its status and latency",
+		},
+		cli.BoolFlag{
+			Name:  "vv",
+			Usage: "like --verbose, also dumping requests and responses",
+		},
+		cli.StringFlag{
+			Name:   "output",
+			Usage:  "output format of errors - text or json",
+			EnvVar: "FN_OUTPUT",
+			Value:  "text",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "format of the logs written to stderr - text or json",
+			EnvVar: "FN_LOG_FORMAT",
+			Value:  "text",
+		},
+		cli.StringFlag{
+			Name:   "log-level",
+			Usage:  "least severe logs written - debug, info, warn or error, debug with --verbose and info otherwise",
+			EnvVar: "FN_LOG_LEVEL",
+		},
+		cli.StringFlag{
+			Name:   "lang",
+			Usage:  "language of the messages, eg. fr, taken from the locale by default",
+			EnvVar: "FN_LANG",
+		},
+		cli.BoolFlag{
+			Name:   "quiet,q",
+			Usage:  "do not print progress, only data, warnings and errors",
+			EnvVar: "FN_QUIET",
+		},
+		cli.BoolFlag{
+			Name:  "no-color",
+			Usage: "do not color the output, like setting NO_COLOR",
+		},
+		cli.BoolFlag{
+			Name:   "offline",
+			Usage:  "queue the changes to apps and routes until fn sync instead of sending them",
+			EnvVar: "FN_OFFLINE",
+		},
+		cli.DurationFlag{
+			Name:   "cache",
+			Usage:  "keep the lists of apps and routes read from the API for that long, eg. 30s",
+			EnvVar: "FN_CACHE",
+		},
+		cli.BoolFlag{
+			Name:   "strict-compat",
+			Usage:  "fail instead of warning when the server is too old for route fields sent",
+			EnvVar: "FN_STRICT_COMPAT",
+		},
+		cli.BoolFlag{
+			Name:   "raw",
+			Usage:  "print numbers as plain integers, without units or digit grouping",
+			EnvVar: "FN_RAW",
+		},
+		cli.BoolFlag{
+			Name:   "no-expand",
+			Usage:  "do not expand ${VAR} and ${VAR:-default} in function files",
+			EnvVar: "FN_NO_EXPAND",
+		},
+		cli.StringFlag{
+			Name:   "context",
+			Usage:  "use the named context from the fn configuration",
+			EnvVar: "FN_CONTEXT",
+		},
+		cli.StringFlag{
+			Name:   "tls-ca",
+			Usage:  "PEM encoded CA bundle used to verify the server",
+			EnvVar: "FN_TLS_CA",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert",
+			Usage:  "PEM encoded client certificate, for mutual TLS",
+			EnvVar: "FN_TLS_CERT",
+		},
+		cli.StringFlag{
+			Name:   "tls-key",
+			Usage:  "PEM encoded client certificate key, for mutual TLS",
+			EnvVar: "FN_TLS_KEY",
+		},
+		cli.BoolFlag{
+			Name:   "insecure",
+			Usage:  "skip server certificate verification",
+			EnvVar: "FN_INSECURE",
+		},
+		cli.DurationFlag{
+			Name:   "api-timeout",
+			Usage:  "timeout for calls to the API, 0 disables it",
+			EnvVar: "FN_API_TIMEOUT",
+			Value:  30 * time.Second,
+		},
+		cli.DurationFlag{
+			Name:   "call-timeout",
+			Usage:  "timeout for function calls, 0 disables it",
+			EnvVar: "FN_CALL_TIMEOUT",
+			Value:  2 * time.Minute,
+		},
+		cli.IntFlag{
+			Name:   "max-conns-per-host",
+			Usage:  "most connections open to a host at once, requests waiting for one beyond, 0 for no limit",
+			EnvVar: "FN_MAX_CONNS_PER_HOST",
+		},
+		cli.IntFlag{
+			Name:   "max-idle-conns-per-host",
+			Usage:  "most connections to a host kept open between requests, to be reused",
+			EnvVar: "FN_MAX_IDLE_CONNS_PER_HOST",
+			Value:  100,
+		},
+		cli.BoolFlag{
+			Name:   "no-http2",
+			Usage:  "speak HTTP/1.1 only, even to servers supporting HTTP/2",
+			EnvVar: "FN_NO_HTTP2",
+		},
+		cli.IntFlag{
+			Name:   "retries",
+			Usage:  "number of times failed requests are retried, on connection and server errors",
+			EnvVar: "FN_RETRIES",
+			Value:  2,
+		},
+		cli.DurationFlag{
+			Name:   "retry-backoff",
+			Usage:  "delay before the first retry, doubling on each attempt",
+			EnvVar: "FN_RETRY_BACKOFF",
+			Value:  500 * time.Millisecond,
+		},
+	}
+}
+
+func setupGlobals(c *cli.Context) error {
+	globals.output = c.String("output")
+	globals.raw = c.Bool("raw")
+	globals.quiet = c.Bool("quiet")
+	globals.strictCompat = c.Bool("strict-compat")
+	globals.offline = c.Bool("offline")
+	globals.cacheTTL = c.Duration("cache")
+	// any value of NO_COLOR disables colors, see no-color.org
+	globals.noColor = c.Bool("no-color") || os.Getenv("NO_COLOR") != ""
+	globals.noExpand = c.Bool("no-expand")
+	globals.environment = os.Getenv("FN_ENV")
+	if globals.output != "text" && globals.output != "json" {
+		return usageError("unknown output format %s", globals.output)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ctx, err := cfg.context(c.String("context"))
+	if err != nil {
+		return err
+	}
+
+	globals.context = c.String("context")
+	globals.contextName = firstNonEmpty(globals.context, cfg.CurrentContext, defaultContextName)
+	globals.callBudget = ctx.CallBudget
+	globals.apiURL = firstNonEmpty(os.Getenv("API_URL"), ctx.APIURL, defaultAPIURL)
+	globals.token = firstNonEmpty(os.Getenv("IRON_TOKEN"), ctx.Token)
+	globals.registry = firstNonEmpty(os.Getenv("FN_REGISTRY"), ctx.Registry)
+	globals.app = firstNonEmpty(os.Getenv("FN_APP"), ctx.App)
+	globals.tlsCA = firstNonEmpty(c.String("tls-ca"), ctx.TLSCA)
+	globals.tlsCert = firstNonEmpty(c.String("tls-cert"), ctx.TLSCert)
+	globals.tlsKey = firstNonEmpty(c.String("tls-key"), ctx.TLSKey)
+	globals.insecure = c.Bool("insecure") || ctx.Insecure
+	globals.apiTimeout = c.Duration("api-timeout")
+	globals.callTimeout = c.Duration("call-timeout")
+	globals.maxConnsPerHost = c.Int("max-conns-per-host")
+	globals.maxIdleConnsPerHost = c.Int("max-idle-conns-per-host")
+	globals.noHTTP2 = c.Bool("no-http2")
+	globals.retries = c.Int("retries")
+	globals.retryBackoff = c.Duration("retry-backoff")
+	switch {
+	case c.Bool("vv"):
+		globals.verbose = 2
+	case c.Bool("verbose"):
+		globals.verbose = 1
+	}
+	if err := setupLogger(c.String("log-format"), c.String("log-level")); err != nil {
+		return err
+	}
+	if err := setupTracing(); err != nil {
+		return err
+	}
+	startCommandSpan(c)
+
+	return setupTransport()
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func setupLogger(format, level string) error {
+	switch format {
+	case "text", "json":
+		logger.json = format == "json"
+	default:
+		return usageError("unknown log format %s", format)
+	}
+	switch {
+	case level != "":
+		l, err := parseLogLevel(level)
+		if err != nil {
+			return err
+		}
+		logger.level = l
+	case globals.verbose > 0:
+		logger.level = levelDebug
+	default:
+		logger.level = levelInfo
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// nativeFlag builds Go functions with the local toolchain rather than in a
+// container, for builds taking seconds and images of a few megabytes.
+var nativeFlag = cli.BoolFlag{
+	Name:   "native",
+	Usage:  "build go functions without a Dockerfile with the local go toolchain, as static binaries in scratch images, other functions as usual",
+	EnvVar: "FN_NATIVE",
+}
+
+// nativeDockerfile is the Dockerfile of Go functions built natively, which
+// only copies the binary.
+const nativeDockerfile = `# generated by fn for native go builds, version 1
+FROM scratch
+WORKDIR /function
+COPY func /function/func
+ENTRYPOINT %s
+`
+
+// nativeBuild tells whether the function is built with the local toolchain,
+// other functions than Go ones being built as usual.
+func nativeBuild(ff *funcfile, opts buildOptions) bool {
+	rt, _ := ff.RuntimeTag()
+	return opts.native && rt == "go"
+}
+
+// goPlatformEnv returns the environment cross-compiling for a platform, as
+// os/arch or os/arch/variant.
+func goPlatformEnv(platform string) ([]string, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, usageError("%s is not a platform, expected os/arch", platform)
+	}
+	env := []string{"GOOS=" + parts[0], "GOARCH=" + parts[1]}
+	if len(parts) == 3 {
+		switch parts[1] {
+		case "arm":
+			env = append(env, "GOARM="+strings.TrimPrefix(parts[2], "v"))
+		case "amd64":
+			env = append(env, "GOAMD64="+parts[2])
+		}
+	}
+	return env, nil
+}
+
+// nativeGoContext compiles the Go function of dir with the local toolchain,
+// static and stripped, into a temporary build context whose Dockerfile copies
+// it to a scratch image. The directory is removed by calling cleanup.
+func nativeGoContext(out io.Writer, dir string, ff *funcfile, opts buildOptions) (ctx string, cleanup func(), err error) {
+	// that of the builder by default, as for other builds
+	platform := "linux/" + runtime.GOARCH
+	switch len(opts.platforms) {
+	case 0:
+	case 1:
+		platform = opts.platforms[0]
+	default:
+		return "", nil, usageError("--native builds images for one platform at a time, not %s", strings.Join(opts.platforms, ", "))
+	}
+	env, err := goPlatformEnv(platform)
+	if err != nil {
+		return "", nil, err
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		return "", nil, usageError("--native needs the go toolchain: %v", err)
+	}
+
+	entrypoint := "./func"
+	if ff.Entrypoint != nil && *ff.Entrypoint != "" {
+		entrypoint = *ff.Entrypoint
+	}
+	ep, err := json.Marshal(strings.Fields(entrypoint))
+	if err != nil {
+		return "", nil, err
+	}
+
+	ctx, err = ioutil.TempDir("", "fn-build")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(ctx) }
+
+	fmt.Fprintf(out, "Compiling %s for %s\n", ff.FullName(), platform)
+	args := []string{"build", "-trimpath", "-ldflags", "-s -w -buildid="}
+	if opts.cover {
+		args = append(args, "-cover", "-covermode=atomic")
+	}
+	cmd := exec.CommandContext(cmdContext(), gobin, append(args, "-o", filepath.Join(ctx, "func"), ".")...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "CGO_ENABLED=0"), env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf("error running go build: %v", err)
+	} else {
+		err = ioutil.WriteFile(filepath.Join(ctx, "Dockerfile"), []byte(fmt.Sprintf(nativeDockerfile, ep)), 0644)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return ctx, cleanup, nil
+}
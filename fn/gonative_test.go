@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoPlatformEnv(t *testing.T) {
+	cases := []struct {
+		platform string
+		env      []string
+	}{
+		{"linux/amd64", []string{"GOOS=linux", "GOARCH=amd64"}},
+		{"linux/arm/v7", []string{"GOOS=linux", "GOARCH=arm", "GOARM=7"}},
+		{"linux/arm64/v8", []string{"GOOS=linux", "GOARCH=arm64"}},
+	}
+	for _, c := range cases {
+		env, err := goPlatformEnv(c.platform)
+		if err != nil || !reflect.DeepEqual(env, c.env) {
+			t.Errorf("goPlatformEnv(%s) = %v, %v, want %v", c.platform, env, err, c.env)
+		}
+	}
+	if _, err := goPlatformEnv("amd64"); err == nil {
+		t.Error("goPlatformEnv(amd64) succeeded, want an error")
+	}
+}
+
+func TestNativeGoContext(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// the binary follows -o
+	fakeTool(t, bin, "go", `env | grep -E '^(CGO_ENABLED|GOOS|GOARCH|GOARM)=' | sort > `+filepath.Join(bin, "go.env")+`
+while [ "$1" != "-o" ]; do shift; done; echo binary > "$2"`)
+
+	str := func(s string) *string { return &s }
+	ff := &funcfile{Name: "acme/hello", Runtime: str("go"), Entrypoint: str("./func -v")}
+	opts := buildOptions{native: true, platforms: []string{"linux/arm/v7"}}
+	if !nativeBuild(ff, opts) {
+		t.Error("nativeBuild() of a go function = false, want true")
+	}
+	if nativeBuild(&funcfile{Runtime: str("node")}, opts) {
+		t.Error("nativeBuild() of a node function = true, want false")
+	}
+
+	ctx, cleanup, err := nativeGoContext(ioutil.Discard, bin, ff, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if got, want := strings.Join(toolArgs(t, bin, "go"), " "), "build -trimpath -ldflags -s -w -buildid= -o "+filepath.Join(ctx, "func")+" ."; got != want {
+		t.Errorf("nativeGoContext() ran go %s, want go %s", got, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(bin, "go.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "CGO_ENABLED=0\nGOARCH=arm\nGOARM=7\nGOOS=linux\n"; got != want {
+		t.Errorf("nativeGoContext() ran go with %q, want %q", got, want)
+	}
+	if !exists(filepath.Join(ctx, "func")) {
+		t.Error("nativeGoContext() did not put the binary in the build context")
+	}
+	b, err = ioutil.ReadFile(filepath.Join(ctx, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"FROM scratch\n", `ENTRYPOINT ["./func","-v"]`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("nativeGoContext() wrote the Dockerfile %q, want it to contain %q", b, want)
+		}
+	}
+
+	opts.platforms = []string{"linux/amd64", "linux/arm64"}
+	if _, _, err := nativeGoContext(ioutil.Discard, bin, ff, opts); err == nil {
+		t.Error("nativeGoContext() for several platforms succeeded, want an error")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Functions exposed over gRPC are called through grpcurl, which takes care of
+// encoding the JSON payload with the proto definitions, given or discovered
+// through the reflection service of the server.
+
+// grpcCall describes a gRPC call of a function.
+type grpcCall struct {
+	// addr is host:port of the gRPC endpoint.
+	addr      string
+	plaintext bool
+
+	// method is the fully qualified method, pkg.Service/Method. Without
+	// it, the services of the server are described instead.
+	method string
+	proto  string
+
+	app, route string
+	headers    http.Header
+}
+
+// grpcAddr tells the gRPC endpoint from its address, or from the API URL.
+func grpcAddr(addr string, api *url.URL) (string, bool) {
+	if addr != "" {
+		return addr, false
+	}
+	host := api.Host
+	if api.Port() == "" {
+		if api.Scheme == "https" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+	return host, api.Scheme != "https"
+}
+
+func (g *grpcCall) args() []string {
+	var args []string
+	if g.plaintext {
+		args = append(args, "-plaintext")
+	}
+	if globals.insecure {
+		args = append(args, "-insecure")
+	}
+	if globals.tlsCA != "" {
+		args = append(args, "-cacert", globals.tlsCA)
+	}
+	if globals.tlsCert != "" {
+		args = append(args, "-cert", globals.tlsCert, "-key", globals.tlsKey)
+	}
+	if g.proto != "" {
+		args = append(args, "-import-path", filepath.Dir(g.proto), "-proto", filepath.Base(g.proto))
+	}
+
+	// the app and route tell the gateway which function to call
+	headers := []string{"fn-app: " + g.app, "fn-path: " + g.route}
+	if globals.token != "" && g.headers.Get("Authorization") == "" {
+		headers = append(headers, "authorization: Bearer "+globals.token)
+	}
+	var names []string
+	for k := range g.headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		for _, v := range g.headers[k] {
+			headers = append(headers, strings.ToLower(k)+": "+v)
+		}
+	}
+	for _, h := range headers {
+		args = append(args, "-H", h)
+	}
+
+	if g.method == "" {
+		return append(args, g.addr, "describe")
+	}
+	return append(args, "-d", "@", g.addr, g.method)
+}
+
+// grpcHTTPStatus maps gRPC status codes to the HTTP status conveying them, as
+// function errors are classified by HTTP status.
+var grpcHTTPStatus = map[int]int{
+	1:  499, // cancelled
+	2:  500, // unknown
+	3:  400, // invalid argument
+	4:  504, // deadline exceeded
+	5:  404, // not found
+	6:  409, // already exists
+	7:  403, // permission denied
+	8:  429, // resource exhausted
+	9:  400, // failed precondition
+	10: 409, // aborted
+	11: 400, // out of range
+	12: 501, // unimplemented
+	13: 500, // internal
+	14: 503, // unavailable
+	15: 500, // data loss
+	16: 401, // unauthenticated
+}
+
+// run calls the function with the JSON payload read from in, writing its JSON
+// response out.
+func (g *grpcCall) run(in io.Reader, out io.Writer) error {
+	if _, err := exec.LookPath("grpcurl"); err != nil {
+		return usageError("calling functions over gRPC requires grpcurl, see https://github.com/fullstorydev/grpcurl")
+	}
+	if in == nil {
+		in = strings.NewReader("{}")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("grpcurl", g.args()...)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = io.MultiWriter(&stderr, verbwriter(globals.verbose > 0))
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	msg := strings.TrimSpace(stderr.String())
+	if msg == "" {
+		msg = err.Error()
+	}
+	if ee, ok := err.(*exec.ExitError); ok {
+		// grpcurl exits with 64 plus the gRPC status of failed calls
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok {
+			if status, ok := grpcHTTPStatus[ws.ExitStatus()-64]; ok {
+				return &fnError{Kind: kindFunction, Status: status, Message: fmt.Sprintf("%s %s: %s", g.method, g.route, msg)}
+			}
+		}
+	}
+	return fmt.Errorf("grpcurl: %s", msg)
+}
+
+// grpc calls the function over gRPC, with the payload read from in.
+func (a *routesCmd) grpc(appName, route string, in io.Reader, headers http.Header, method, proto, addr string) error {
+	g := &grpcCall{
+		method:  method,
+		proto:   proto,
+		app:     appName,
+		route:   route,
+		headers: headers,
+	}
+	g.addr, g.plaintext = grpcAddr(addr, apiURL())
+	if g.method == "" {
+		fmt.Fprintln(os.Stderr, "no --method given, describing the services of", g.addr)
+	}
+	return g.run(in, os.Stdout)
+}
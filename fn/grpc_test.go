@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGRPCAddr(t *testing.T) {
+	cases := []struct {
+		addr, api string
+		want      string
+		plaintext bool
+	}{
+		{"", "http://localhost:8080", "localhost:8080", true},
+		{"", "https://functions.example.org", "functions.example.org:443", false},
+		{"grpc.example.org:9000", "http://localhost:8080", "grpc.example.org:9000", false},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse(c.api)
+		addr, plaintext := grpcAddr(c.addr, u)
+		if addr != c.want || plaintext != c.plaintext {
+			t.Errorf("%s %s: expected %s (plaintext %v), got %s (%v)", c.addr, c.api, c.want, c.plaintext, addr, plaintext)
+		}
+	}
+}
+
+func TestGRPCArgs(t *testing.T) {
+	g := &grpcCall{
+		addr:      "localhost:8080",
+		plaintext: true,
+		method:    "pkg.Svc/Do",
+		proto:     "protos/service.proto",
+		app:       "myapp",
+		route:     "/hello",
+		headers:   http.Header{"X-Request-Id": {"42"}},
+	}
+	want := []string{
+		"-plaintext",
+		"-import-path", "protos", "-proto", "service.proto",
+		"-H", "fn-app: myapp", "-H", "fn-path: /hello", "-H", "x-request-id: 42",
+		"-d", "@", "localhost:8080", "pkg.Svc/Do",
+	}
+	if args := g.args(); !reflect.DeepEqual(args, want) {
+		t.Errorf("expected %q, got %q", want, args)
+	}
+
+	g.method, g.proto = "", ""
+	args := g.args()
+	if args[len(args)-1] != "describe" {
+		t.Errorf("expected the services to be described without a method, got %q", args)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+// healthcheckBackoff is the time between the attempts of a health check.
+var healthcheckBackoff = 2 * time.Second
+
+// healthcheck calls the function of app as hc tells, its path defaulting to
+// the first of routes, and fails unless it answers as expected.
+func healthcheck(appName string, hc *ffhealthcheck, routes []string) error {
+	route := hc.Path
+	if route == "" {
+		if len(routes) == 0 {
+			return usageError("the health check has no route to call")
+		}
+		route = routes[0]
+	}
+
+	var err error
+	for attempt := 0; attempt <= hc.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(healthcheckBackoff)
+		}
+		if err = checkHealth(routeURL(appName, route).String(), hc); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("health check of %s failed: %v", route, err)
+}
+
+func checkHealth(u string, hc *ffhealthcheck) error {
+	var content io.Reader
+	if hc.Body != "" {
+		content = strings.NewReader(hc.Body)
+	}
+	headers := make(http.Header)
+	for k, v := range hc.Headers {
+		headers.Set(k, v)
+	}
+	req, err := newCallRequest(u, content, callOptions{method: hc.Method, headers: headers})
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp.Body)
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case hc.Status != 0 && resp.StatusCode != hc.Status:
+		return fmt.Errorf("got %s, want %d", resp.Status, hc.Status)
+	case hc.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 300):
+		return fmt.Errorf("got %s", resp.Status)
+	case hc.Contains != "" && !strings.Contains(string(body), hc.Contains):
+		return fmt.Errorf("the response does not contain %q", hc.Contains)
+	}
+	return nil
+}
+
+// liveImages returns the images the routes of the function are set to in the
+// server, by path, those which do not exist yet being left out.
+func (p *deploycmd) liveImages(ff *funcfile) (map[string]string, error) {
+	routes, err := fndeploy.Routes(ff)
+	if err != nil {
+		return nil, err
+	}
+	images := make(map[string]string)
+	for _, r := range routes {
+		live, err := liveRoute(p.client, p.appName, r.Path)
+		if err != nil {
+			return nil, err
+		}
+		if live != nil {
+			images[r.Path] = live.Image
+		}
+	}
+	return images, nil
+}
+
+// rollback sets the routes deploying the function at path updated back to
+// their previous images, or aborts their canaries. Routes it created are left
+// alone.
+func (p *deploycmd) rollback(ctx context.Context, path string, rec *deployRecord, previous map[string]string) error {
+	return p.stage(ctx, path, rec, stageRollback, func(ctx context.Context, out io.Writer) error {
+		for _, r := range rec.Routes {
+			image, ok := previous[r]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "%s: %s did not exist before, it is left as is\n", rec.Funcfile, r)
+				continue
+			}
+			if p.canaryWeight > 0 {
+				if err := deleteCanary(p.appName, r); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "%s canary aborted\n", r)
+				continue
+			}
+			// routes are set back even once fn is interrupted
+			_, err := p.client.Routes.PatchAppsAppRoutesRoute(&apiroutes.PatchAppsAppRoutesRouteParams{
+				Context: detach(ctx),
+				App:     p.appName,
+				Route:   r,
+				Body:    &fnmodels.RouteWrapper{Route: &fnmodels.Route{Image: image}},
+			})
+			if err != nil {
+				return apiError(err)
+			}
+			fmt.Fprintf(out, "%s set back to %s\n", r, image)
+		}
+		rec.RolledBack = true
+		return nil
+	})
+}
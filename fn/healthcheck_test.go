@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthcheck(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/r/myapp/cold" && calls == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/r/myapp/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Header.Get("X-Probe") != "1":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			fmt.Fprintf(w, `{"status": "ok", "echo": %q}`, body)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+	defer func(d time.Duration) { healthcheckBackoff = d }(healthcheckBackoff)
+	healthcheckBackoff = 0
+
+	headers := map[string]string{"X-Probe": "1"}
+	cases := []struct {
+		hc     ffhealthcheck
+		routes []string
+		err    string
+	}{
+		{ffhealthcheck{Headers: headers}, []string{"/orders", "/users"}, ""},
+		{ffhealthcheck{Path: "/orders", Body: "ping", Headers: headers, Contains: `"echo": "ping"`}, nil, ""},
+		{ffhealthcheck{Headers: headers, Contains: "pong"}, []string{"/orders"}, `health check of /orders failed: the response does not contain "pong"`},
+		{ffhealthcheck{Headers: headers, Status: 201}, []string{"/orders"}, "health check of /orders failed: got 200 OK, want 201"},
+		{ffhealthcheck{}, []string{"/orders"}, "health check of /orders failed: got 400 Bad Request"},
+		{ffhealthcheck{Path: "/broken", Retries: 2}, nil, "health check of /broken failed: got 500 Internal Server Error"},
+		{ffhealthcheck{}, nil, "the health check has no route to call"},
+	}
+	for i, c := range cases {
+		err := healthcheck("myapp", &c.hc, c.routes)
+		if c.err == "" && err != nil {
+			t.Errorf("%d: healthcheck() = %v", i, err)
+		} else if c.err != "" && (err == nil || !strings.HasSuffix(err.Error(), c.err)) {
+			t.Errorf("%d: healthcheck() = %v, want %s", i, err, c.err)
+		}
+	}
+
+	calls = 0
+	if err := healthcheck("myapp", &ffhealthcheck{Path: "/cold", Headers: headers, Retries: 1}, nil); err != nil {
+		t.Errorf("healthcheck() of a cold function = %v, want it to pass once retried", err)
+	}
+	if calls != 2 {
+		t.Errorf("cold function called %d times, want 2", calls)
+	}
+}
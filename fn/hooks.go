@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+)
+
+type hook struct {
+	name string
+	cmds []string
+}
+
+// allHooks lists the hooks of h by name.
+func allHooks(h *ffhooks) []hook {
+	return []hook{
+		{"pre_build", h.PreBuild},
+		{"post_build", h.PostBuild},
+		{"pre_deploy", h.PreDeploy},
+		{"post_deploy", h.PostDeploy},
+	}
+}
+
+// hookEnv is what hooks are told of the function, as environment variables.
+// What is not known yet, like the app of builds, is left empty.
+type hookEnv struct {
+	app    string
+	routes []string
+	digest string
+}
+
+func (e hookEnv) environ(ff *funcfile) []string {
+	var route string
+	if len(e.routes) > 0 {
+		route = e.routes[0]
+	}
+	return append(os.Environ(),
+		"IMAGE="+ff.FullName(),
+		"VERSION="+ff.Version,
+		"APP="+e.app,
+		"ROUTE="+route,
+		"ROUTES="+strings.Join(e.routes, " "),
+		"DIGEST="+e.digest,
+	)
+}
+
+// funcHooks returns the commands of the hooks of ff named name.
+func funcHooks(ff *funcfile, name string) []string {
+	if ff.Hooks == nil {
+		return nil
+	}
+	for _, h := range allHooks(ff.Hooks) {
+		if h.name == name {
+			return h.cmds
+		}
+	}
+	return nil
+}
+
+// runHooks runs the hooks named name of the function file at path, in its
+// directory, stopping at the first failing.
+func runHooks(out io.Writer, path string, ff *funcfile, name string, env hookEnv) error {
+	for _, cmd := range funcHooks(ff, name) {
+		fmt.Fprintf(out, "running %s hook: %s\n", name, cmd)
+		exe := exec.CommandContext(cmdContext(), "/bin/sh", "-c", cmd)
+		exe.Dir = filepath.Dir(path)
+		exe.Env = env.environ(ff)
+		exe.Stdout = out
+		exe.Stderr = out
+		if err := exe.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed: %v", name, cmd, err)
+		}
+	}
+	return nil
+}
+
+// routePaths returns the paths of the routes of the function, for hooks.
+func routePaths(ff *funcfile) []string {
+	routes, err := fndeploy.Routes(ff)
+	if err != nil {
+		return nil
+	}
+	paths := make([]string, len(routes))
+	for i, r := range routes {
+		paths[i] = r.Path
+	}
+	return paths
+}
+
+// hookStage runs the hooks of the deploy stage s, whose name is theirs, if the
+// function has any.
+func (p *deploycmd) hookStage(ctx context.Context, path string, rec *deployRecord, s deployStage, ff *funcfile, env hookEnv) error {
+	if len(funcHooks(ff, s.name)) == 0 {
+		return nil
+	}
+	return p.stage(ctx, path, rec, s, func(_ context.Context, out io.Writer) error {
+		return runHooks(out, path, ff, s.name, env)
+	})
+}
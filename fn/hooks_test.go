@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ff := &funcfile{
+		Name:    "acme/hello",
+		Version: "0.0.2",
+		Hooks: &ffhooks{
+			PreBuild: []string{
+				`echo "$IMAGE $VERSION $APP $ROUTE $ROUTES $DIGEST" > env`,
+				`pwd > cwd`,
+			},
+			PostDeploy: []string{`exit 3`, `touch ran`},
+		},
+	}
+	path := filepath.Join(dir, "func.yaml")
+
+	env := hookEnv{app: "myapp", routes: []string{"/hello", "/hi"}, digest: "sha256:a4d"}
+	var out bytes.Buffer
+	if err := runHooks(&out, path, ff, "pre_build", env); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "acme/hello:0.0.2 0.0.2 myapp /hello /hello /hi sha256:a4d\n"; got != want {
+		t.Errorf("pre_build hooks were told %q, want %q", got, want)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "cwd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := filepath.EvalSymlinks(strings.TrimSpace(string(b))); got != mustEvalSymlinks(t, dir) {
+		t.Errorf("pre_build hooks ran in %s, want %s", got, dir)
+	}
+	if !strings.Contains(out.String(), "running pre_build hook: pwd > cwd") {
+		t.Errorf("runHooks() did not tell the hooks it ran: %q", out.String())
+	}
+
+	if err := runHooks(ioutil.Discard, path, ff, "post_deploy", env); err == nil || !strings.Contains(err.Error(), `post_deploy hook "exit 3" failed`) {
+		t.Errorf("runHooks() of a failing hook = %v, want it to fail", err)
+	}
+	if exists(filepath.Join(dir, "ran")) {
+		t.Error("runHooks() ran the hooks after the failing one")
+	}
+	if err := runHooks(ioutil.Discard, path, ff, "pre_deploy", env); err != nil {
+		t.Errorf("runHooks() without hooks = %v, want nil", err)
+	}
+	if err := runHooks(ioutil.Discard, path, &funcfile{Name: "acme/hello"}, "pre_build", env); err != nil {
+		t.Errorf("runHooks() of a function file without hooks = %v, want nil", err)
+	}
+}
+
+func mustEvalSymlinks(t *testing.T, path string) string {
+	p, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// maxHotPayload is the size of the longest payload fn run --hot reads.
+const maxHotPayload = 16 << 20
+
+var hotFlag = cli.BoolFlag{
+	Name:  "hot",
+	Usage: "keep the function running, calling it with each line of the payload, or of what is typed, as a hot function of the http format",
+}
+
+// runHot runs a hot function of the http format once and calls it with each
+// line of calls, a payload per line, until they are over, as a server
+// streams calls to the container of a hot function. prompt asks for the
+// payloads, typed interactively.
+func runHot(image string, calls io.Reader, prompt bool, stdout, stderr io.Writer, opts runOptions) error {
+	if opts.method == "" {
+		opts.method = "POST"
+	}
+	c, err := startContainer(image, calls, stderr, opts)
+	if err != nil {
+		return err
+	}
+	defer c.remove()
+	h := newHotFunction(c, stderr)
+
+	scanner := bufio.NewScanner(calls)
+	scanner.Buffer(make([]byte, 64<<10), maxHotPayload)
+	for n := 1; ; n++ {
+		if prompt {
+			fmt.Fprint(stderr, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		var out bytes.Buffer
+		start := time.Now()
+		res, err := h.roundTrip(strings.NewReader(scanner.Text()), nil, &out, c.timeout)
+		if err != nil {
+			return err
+		}
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		stdout.Write(out.Bytes())
+		fmt.Fprintf(stderr, "call %d: %s in %s\n", n, res.Status, time.Since(start)/time.Millisecond*time.Millisecond)
+	}
+	if prompt {
+		fmt.Fprintln(stderr)
+	}
+	return scanner.Err()
+}
+
+// hotCalls are the calls of fn run --hot: the payload given, or else what is
+// typed, prompted for.
+func hotCalls(body io.Reader) (calls io.Reader, prompt bool) {
+	if body != nil {
+		return body, false
+	}
+	return os.Stdin, true
+}
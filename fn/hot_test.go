@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestRunHot(t *testing.T) {
+	d := &fakeDocker{exited: make(chan int)}
+	defer startFakeDocker(t, d)()
+
+	opts := routeRunOptions(fnmodels.Route{Path: "/hello", Format: "http"}, nil)
+	var stdout, stderr bytes.Buffer
+	if err := runHot("acme/hot", strings.NewReader("Johnny\nJoe\n"), false, &stdout, &stderr, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello Johnny from /hello\nHello Joe from /hello\n"; stdout.String() != want {
+		t.Errorf("runHot() wrote %q, want %q", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "call 1: 200 OK") || !strings.Contains(stderr.String(), "call 2: 200 OK") {
+		t.Errorf("runHot() told %q, want the status of both calls", stderr.String())
+	}
+	if !d.removed {
+		t.Error("runHot() left the container behind")
+	}
+	if d.created.Env[0] != "METHOD=POST" {
+		t.Errorf("runHot() set %v, want calls to be POSTs", d.created.Env)
+	}
+}
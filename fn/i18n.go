@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Messages shown to humans, help and errors, are written in English and go
+// through T, which translates them with the catalog of the language of the
+// user, if there is one. A catalog maps English messages, format strings
+// included, to their translation; messages it lacks stay in English.
+// Catalogs are plugged in as ~/.fn/locales/<lang>.yaml files, on top of the
+// ones built in. Machine-readable output, like JSON, is never translated.
+type catalog map[string]string
+
+// builtinCatalogs are the translations shipped with fn. English, the
+// language of the messages in the code, needs none.
+var builtinCatalogs = map[string]catalog{
+	"en": {},
+}
+
+// messages is the catalog of the language in use, nil for English.
+var messages catalog
+
+// T translates a message.
+func T(s string) string {
+	if t, ok := messages[s]; ok && t != "" {
+		return t
+	}
+	return s
+}
+
+// localeLang tells the language of the first locale set among the given
+// environment variables, eg. fr for fr_FR.UTF-8.
+func localeLang(vars ...string) string {
+	var locale string
+	for _, v := range vars {
+		if locale = os.Getenv(v); locale != "" {
+			break
+		}
+	}
+	lang := strings.ToLower(strings.SplitN(strings.SplitN(locale, ".", 2)[0], "_", 2)[0])
+	if lang == "c" || lang == "posix" {
+		return "en"
+	}
+	return lang
+}
+
+// language tells the language of the messages, from --lang when given on the
+// command line, which is read before it is parsed to translate the help, or
+// else the environment.
+func language(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--lang" || arg == "-lang" {
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		} else if strings.HasPrefix(arg, "--lang=") || strings.HasPrefix(arg, "-lang=") {
+			return arg[strings.Index(arg, "=")+1:]
+		}
+	}
+	if lang := os.Getenv("FN_LANG"); lang != "" {
+		return lang
+	}
+	return localeLang("LC_ALL", "LC_MESSAGES", "LANG")
+}
+
+func localesDir() string {
+	return filepath.Join(fnHome(), "locales")
+}
+
+// loadCatalog returns the catalog of lang, the built-in one completed by the
+// user's, or nil when there is none.
+func loadCatalog(lang string) (catalog, error) {
+	lang = strings.ToLower(lang)
+	if lang == "" || lang == "en" {
+		return nil, nil
+	}
+
+	cat := make(catalog)
+	for k, v := range builtinCatalogs[lang] {
+		cat[k] = v
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(localesDir(), lang+".yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var user catalog
+	if err := yaml.Unmarshal(b, &user); err != nil {
+		return nil, fmt.Errorf("could not parse the %s catalog: %v", lang, err)
+	}
+	for k, v := range user {
+		cat[k] = v
+	}
+
+	if len(cat) == 0 {
+		return nil, nil
+	}
+	return cat, nil
+}
+
+// setLanguage translates the messages, and the help of app, to lang. A
+// language without a catalog leaves everything in English.
+func setLanguage(app *cli.App, lang string) error {
+	cat, err := loadCatalog(lang)
+	if err != nil {
+		return err
+	}
+	messages = cat
+	if messages == nil {
+		return nil
+	}
+
+	app.Usage = T(app.Usage)
+	app.Flags = localizeFlags(app.Flags)
+	localizeCommands(app.Commands)
+	return nil
+}
+
+func localizeCommands(cmds []cli.Command) {
+	for i := range cmds {
+		cmds[i].Usage = T(cmds[i].Usage)
+		cmds[i].Description = T(cmds[i].Description)
+		cmds[i].Flags = localizeFlags(cmds[i].Flags)
+		localizeCommands(cmds[i].Subcommands)
+	}
+}
+
+// localizeFlags translates the usage of flags, which every kind of flag has
+// but no interface exposes.
+func localizeFlags(flags []cli.Flag) []cli.Flag {
+	localized := make([]cli.Flag, len(flags))
+	for i, f := range flags {
+		localized[i] = f
+		v := reflect.New(reflect.TypeOf(f)).Elem()
+		v.Set(reflect.ValueOf(f))
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		usage := v.FieldByName("Usage")
+		if !usage.IsValid() || usage.Kind() != reflect.String {
+			continue
+		}
+		usage.SetString(T(usage.String()))
+		if lf, ok := v.Interface().(cli.Flag); ok {
+			localized[i] = lf
+		}
+	}
+	return localized
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestLanguage(t *testing.T) {
+	defer os.Setenv("LANG", os.Getenv("LANG"))
+	defer os.Setenv("LC_ALL", os.Getenv("LC_ALL"))
+	defer os.Setenv("FN_LANG", os.Getenv("FN_LANG"))
+	os.Unsetenv("LC_ALL")
+	os.Unsetenv("FN_LANG")
+	os.Setenv("LANG", "pt_BR.UTF-8")
+
+	cases := []struct {
+		args []string
+		lang string
+	}{
+		{[]string{"fn", "apps", "list"}, "pt"},
+		{[]string{"fn", "--lang", "fr", "apps", "list"}, "fr"},
+		{[]string{"fn", "--lang=de", "apps", "list"}, "de"},
+		{[]string{"fn", "run", "--", "--lang", "fr"}, "pt"},
+	}
+	for _, c := range cases {
+		if lang := language(c.args); lang != c.lang {
+			t.Errorf("%v: expected %s, got %s", c.args, c.lang, lang)
+		}
+	}
+}
+
+func TestSetLanguage(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer func() { messages = nil }()
+
+	os.MkdirAll(localesDir(), 0700)
+	fr := `"manage applications": "gérer les applications"
+"error: ": "erreur : "
+"missing app name after %s": "nom d'application manquant après %s"
+`
+	if err := ioutil.WriteFile(filepath.Join(localesDir(), "fr.yaml"), []byte(fr), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newFn()
+	if err := setLanguage(app, "fr"); err != nil {
+		t.Fatal(err)
+	}
+	var apps cli.Command
+	for _, c := range app.Commands {
+		if c.Name == "apps" {
+			apps = c
+		}
+	}
+	if apps.Usage != "gérer les applications" {
+		t.Errorf("expected the help to be translated, got %q", apps.Usage)
+	}
+
+	err = usageError("missing app name after %s", "create")
+	if err.Error() != "erreur : nom d'application manquant après create" {
+		t.Errorf("expected the error to be translated, got %q", err)
+	}
+	if e := err.(*fnError); e.Message != "missing app name after create" {
+		t.Errorf("expected the machine-readable message in English, got %q", e.Message)
+	}
+}
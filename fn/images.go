@@ -22,6 +22,9 @@ func images() cli.Command {
 			push(),
 			run(),
 			testfn(),
+			watch(),
+			debug(),
+			shell(),
 		},
 	}
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// severities are those of vulnerabilities, from the least to the most severe.
+var severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func severityRank(s string) int {
+	for i, sev := range severities {
+		if strings.EqualFold(s, sev) {
+			return i
+		}
+	}
+	return 0
+}
+
+func parseSeverity(s string) (string, error) {
+	for _, sev := range severities {
+		if strings.EqualFold(s, sev) {
+			return sev, nil
+		}
+	}
+	return "", usageError("unknown severity %s, expected one of %s", s, strings.Join(severities, ", "))
+}
+
+// vulnerability is one scanners found in an image. Remote scanners answer
+// with them as JSON.
+type vulnerability struct {
+	ID           string `json:"id"`
+	Package      string `json:"package,omitempty"`
+	Version      string `json:"version,omitempty"`
+	FixedVersion string `json:"fixed_version,omitempty"`
+	Severity     string `json:"severity"`
+	Title        string `json:"title,omitempty"`
+}
+
+// scanResult is what scanning the image of a function found, for the report
+// of the deploy: the number of vulnerabilities by severity, and those at or
+// above the threshold.
+type scanResult struct {
+	Scanner   string          `json:"scanner"`
+	Threshold string          `json:"threshold"`
+	Counts    map[string]int  `json:"counts"`
+	Blocking  []vulnerability `json:"blocking,omitempty"`
+}
+
+// scanner scans an image, by tag or digest, for vulnerabilities.
+type scanner func(out io.Writer, image string, opts scanOptions) ([]vulnerability, error)
+
+type scanOptions struct {
+	scanner   string
+	threshold string
+	url       string
+}
+
+var scanners = map[string]scanner{
+	"trivy":  trivyScanner,
+	"remote": remoteScanner,
+}
+
+func scannerNames() []string {
+	var names []string
+	for name := range scanners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scanImage scans the image, failing when vulnerabilities at or above the
+// threshold are found.
+func scanImage(out io.Writer, image string, opts scanOptions) (*scanResult, error) {
+	vulns, err := scanners[opts.scanner](out, image, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &scanResult{Scanner: opts.scanner, Threshold: opts.threshold, Counts: make(map[string]int)}
+	min := severityRank(opts.threshold)
+	for _, v := range vulns {
+		sev := severities[severityRank(v.Severity)]
+		res.Counts[sev]++
+		if severityRank(sev) >= min {
+			res.Blocking = append(res.Blocking, v)
+		}
+	}
+	// the most severe first
+	sort.SliceStable(res.Blocking, func(i, j int) bool {
+		return severityRank(res.Blocking[i].Severity) > severityRank(res.Blocking[j].Severity)
+	})
+
+	var counts []string
+	for i := len(severities) - 1; i >= 0; i-- {
+		if n := res.Counts[severities[i]]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, severities[i]))
+		}
+	}
+	if len(counts) == 0 {
+		fmt.Fprintf(out, "%s has no known vulnerabilities\n", image)
+	} else {
+		fmt.Fprintf(out, "%s has %d vulnerabilities: %s\n", image, len(vulns), strings.Join(counts, ", "))
+	}
+	for _, v := range res.Blocking {
+		fmt.Fprintf(out, "%s\t%s\t%s %s\t%s\n", v.Severity, v.ID, v.Package, v.Version, v.Title)
+	}
+
+	if n := len(res.Blocking); n > 0 {
+		var ids []string
+		for i, v := range res.Blocking {
+			if i == 5 {
+				ids = append(ids, "...")
+				break
+			}
+			ids = append(ids, v.ID)
+		}
+		return res, fmt.Errorf("%s has %d vulnerabilities of severity %s or above: %s", image, n, opts.threshold, strings.Join(ids, ", "))
+	}
+	return res, nil
+}
+
+// trivyScanner scans with the trivy binary, pulling images which are not in
+// the Docker daemon.
+func trivyScanner(out io.Writer, image string, opts scanOptions) ([]vulnerability, error) {
+	cmd := exec.CommandContext(cmdContext(), "trivy", "image", "--quiet", "--format", "json", image)
+	cmd.Stderr = out
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running trivy: %v", err)
+	}
+
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string
+				PkgName          string
+				InstalledVersion string
+				FixedVersion     string
+				Severity         string
+				Title            string
+			}
+		}
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, fmt.Errorf("could not read the report of trivy: %v", err)
+	}
+	var vulns []vulnerability
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			vulns = append(vulns, vulnerability{
+				ID:           v.VulnerabilityID,
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+				Severity:     v.Severity,
+				Title:        v.Title,
+			})
+		}
+	}
+	return vulns, nil
+}
+
+// remoteScanner asks the scanner at opts.url to scan the image, posting
+// {"image": image} and reading {"vulnerabilities": [...]} back. The image
+// has to be pushed for the scanner to pull it.
+func remoteScanner(out io.Writer, image string, opts scanOptions) ([]vulnerability, error) {
+	body, err := json.Marshal(map[string]string{"image": image})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", opts.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// scans take longer than calls
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling the scanner: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, fmt.Errorf("the scanner answered %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+
+	var res struct {
+		Vulnerabilities []vulnerability `json:"vulnerabilities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("could not read the answer of the scanner: %v", err)
+	}
+	return res.Vulnerabilities, nil
+}
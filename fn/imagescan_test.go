@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanImage(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	fakeTool(t, bin, "trivy", `cat <<'EOF'
+{"Results": [
+  {"Target": "alpine", "Vulnerabilities": [
+    {"VulnerabilityID": "CVE-1", "PkgName": "openssl", "InstalledVersion": "1.1", "Severity": "HIGH"},
+    {"VulnerabilityID": "CVE-2", "PkgName": "musl", "InstalledVersion": "1.2", "Severity": "LOW"}
+  ]},
+  {"Target": "app", "Vulnerabilities": [
+    {"VulnerabilityID": "CVE-3", "PkgName": "lodash", "InstalledVersion": "4.0", "Severity": "CRITICAL"}
+  ]}
+]}
+EOF`)
+
+	var out bytes.Buffer
+	res, err := scanImage(&out, "acme/hello:0.0.2", scanOptions{scanner: "trivy", threshold: "HIGH"})
+	if err == nil || !strings.HasSuffix(err.Error(), "has 2 vulnerabilities of severity HIGH or above: CVE-3, CVE-1") {
+		t.Errorf("scanImage() = %v, want it to fail on CVE-3 and CVE-1", err)
+	}
+	if got := strings.Join(toolArgs(t, bin, "trivy"), " "); got != "image --quiet --format json acme/hello:0.0.2" {
+		t.Errorf("scanImage() ran trivy %s", got)
+	}
+	if want := map[string]int{"CRITICAL": 1, "HIGH": 1, "LOW": 1}; res == nil || !reflect.DeepEqual(res.Counts, want) {
+		t.Errorf("scanImage() counted %+v, want %v", res, want)
+	}
+	if !strings.Contains(out.String(), "acme/hello:0.0.2 has 3 vulnerabilities: 1 CRITICAL, 1 HIGH, 1 LOW") {
+		t.Errorf("scanImage() wrote %q", out.String())
+	}
+
+	res, err = scanImage(ioutil.Discard, "acme/hello:0.0.2", scanOptions{scanner: "trivy", threshold: "CRITICAL"})
+	if err == nil || len(res.Blocking) != 1 {
+		t.Errorf("scanImage() with a CRITICAL threshold = %+v, %v, want CVE-3 only to block", res, err)
+	}
+}
+
+func TestRemoteScanner(t *testing.T) {
+	var image string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Image string }
+		json.NewDecoder(r.Body).Decode(&req)
+		image = req.Image
+		w.Write([]byte(`{"vulnerabilities": [{"id": "CVE-4", "package": "zlib", "severity": "medium"}]}`))
+	}))
+	defer srv.Close()
+
+	opts := scanOptions{scanner: "remote", threshold: "HIGH", url: srv.URL}
+	res, err := scanImage(ioutil.Discard, "acme/hello@sha256:a4d", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image != "acme/hello@sha256:a4d" {
+		t.Errorf("the scanner was asked to scan %q", image)
+	}
+	if want := map[string]int{"MEDIUM": 1}; !reflect.DeepEqual(res.Counts, want) || len(res.Blocking) != 0 {
+		t.Errorf("scanImage() = %+v, want one MEDIUM vulnerability not blocking", res)
+	}
+
+	if _, err := parseSeverity("severe"); err == nil {
+		t.Error("parseSeverity(severe) succeeded, want an error")
+	}
+	if s, err := parseSeverity("critical"); err != nil || s != "CRITICAL" {
+		t.Errorf("parseSeverity(critical) = %q, %v, want CRITICAL", s, err)
+	}
+}
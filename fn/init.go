@@ -6,18 +6,23 @@ usage: fn init <name>
 If there's a Dockerfile found, this will generate the basic file with just the image name. exit
 It will then try to decipher the runtime based on the files in the current directory, if it can't figure it out, it will ask.
 It will then take a best guess for what the entrypoint will be based on the language, it it can't guess, it will ask.
+If the runtime is given and its handler is missing, it scaffolds the function: a hello world handler, its tests and a .gitignore.
+With --template, the function is generated from a template directory, of a git repository or local, first.
+With --from-openapi, a function is generated by path of an OpenAPI document, or one for all of them with --single.
 
 */
 
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-
+	"sort"
 	"strings"
 
 	"github.com/iron-io/functions/fn/langs"
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
 	"github.com/urfave/cli"
 )
 
@@ -36,9 +41,23 @@ var (
 )
 
 func init() {
-	for rt := range fileExtToRuntime {
+	seen := make(map[string]bool)
+	for _, rt := range fileExtToRuntime {
+		seen[rt] = true
+	}
+	for rt := range scaffolds {
+		seen[rt] = true
+	}
+	for rt := range seen {
 		fnInitRuntimes = append(fnInitRuntimes, rt)
 	}
+	sort.Strings(fnInitRuntimes)
+}
+
+// triggers are what calls functions, by the type of their route.
+var triggers = map[string]string{
+	"http":  "sync",
+	"async": "async",
 }
 
 type initFnCmd struct {
@@ -48,6 +67,15 @@ type initFnCmd struct {
 	entrypoint     string
 	format         string
 	maxConcurrency int
+
+	trigger     string
+	dockerfile  bool
+	templateDir string
+	scaffold    bool
+	template    string
+
+	fromOpenAPI string
+	single      bool
 }
 
 func initFn() cli.Command {
@@ -87,11 +115,46 @@ func initFn() cli.Command {
 				Destination: &a.maxConcurrency,
 				Value:       1,
 			},
+			cli.StringFlag{
+				Name:        "trigger",
+				Usage:       "what calls the function - http, answering the call, or async, queuing it",
+				Destination: &a.trigger,
+			},
+			cli.BoolFlag{
+				Name:        "dockerfile",
+				Usage:       "also write the Dockerfile fn would generate, to customize it",
+				Destination: &a.dockerfile,
+			},
+			cli.StringFlag{
+				Name:        "template-dir",
+				Usage:       "`DIR` of scaffold templates by runtime, on top of the built-in ones",
+				EnvVar:      "FN_TEMPLATE_DIR",
+				Value:       templateDir(),
+				Destination: &a.templateDir,
+			},
+			cli.StringFlag{
+				Name:        "template",
+				Usage:       "generate the function from the `TEMPLATE` - host/owner/repository[/directory][@ref], a git URL or a directory",
+				Destination: &a.template,
+			},
+			cli.StringFlag{
+				Name:        "from-openapi",
+				Usage:       "generate the functions of the operations of an OpenAPI or Swagger `FILE`, in a directory by path",
+				Destination: &a.fromOpenAPI,
+			},
+			cli.BoolFlag{
+				Name:        "single",
+				Usage:       "with --from-openapi, generate one function serving every path in the current directory",
+				Destination: &a.single,
+			},
 		},
 	}
 }
 
 func (a *initFnCmd) init(c *cli.Context) error {
+	if a.fromOpenAPI != "" {
+		return a.initFromOpenAPI(c)
+	}
 	if !a.force {
 		ff, err := loadFuncfile()
 		if _, ok := err.(*notFoundError); !ok && err != nil {
@@ -102,33 +165,86 @@ func (a *initFnCmd) init(c *cli.Context) error {
 		}
 	}
 
+	if a.template != "" {
+		if err := a.parseName(c); err != nil {
+			return err
+		}
+		written, err := writeTemplate(os.Stderr, ".", a.template, a.name)
+		for _, name := range written {
+			fmt.Println(name, "created.")
+		}
+		if err != nil {
+			return err
+		}
+		// templates may come with their function file
+		for _, name := range written {
+			if name == "func.yaml" || name == "func.yml" || name == "func.json" {
+				return nil
+			}
+		}
+	}
+
 	err := a.buildFuncFile(c)
 	if err != nil {
 		return err
 	}
 
-	var ffmt *string
+	var ffmt, ftype *string
 	if a.format != "" {
 		ffmt = &a.format
 	}
+	if a.trigger != "" {
+		t, ok := triggers[a.trigger]
+		if !ok {
+			return usageError("unknown trigger %s, expected http or async", a.trigger)
+		}
+		ftype = &t
+	}
 
 	ff := &funcfile{
 		Name:           a.name,
 		Runtime:        &a.runtime,
 		Version:        initialVersion,
 		Entrypoint:     &a.entrypoint,
+		Type:           ftype,
 		Format:         ffmt,
-		maxConcurrency: &a.maxConcurrency,
+		MaxConcurrency: &a.maxConcurrency,
 	}
 
-	_, path := appNamePath(ff.FullName())
-	ff.path = &path
+	_, path := ffile.AppNamePath(ff.FullName())
+	ff.RoutePath = &path
 
-	if err := encodeFuncfileYAML("func.yaml", ff); err != nil {
+	if err := ffile.EncodeYAML("func.yaml", ff); err != nil {
 		return err
 	}
 
 	fmt.Println("func.yaml created.")
+
+	if a.scaffold {
+		written, err := writeScaffold(".", a.runtime, a.templateDir, scaffoldData{
+			Name:       ff.Name,
+			Runtime:    a.runtime,
+			Entrypoint: a.entrypoint,
+			Package:    templatePackage(ff.Name),
+			Author:     templateAuthor(),
+		})
+		for _, name := range written {
+			fmt.Println(name, "created.")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if a.dockerfile && !exists("Dockerfile") && a.runtime != "" {
+		dockerfile, _, err := generateDockerfile(ioutil.Discard, ff)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile("Dockerfile", dockerfile, 0644); err != nil {
+			return err
+		}
+		fmt.Println("Dockerfile created.")
+	}
 	return nil
 }
 
@@ -138,9 +254,8 @@ func (a *initFnCmd) buildFuncFile(c *cli.Context) error {
 		return fmt.Errorf("error detecting current working directory: %s\n", err)
 	}
 
-	a.name = c.Args().First()
-	if a.name == "" || strings.Contains(a.name, ":") {
-		return errors.New("Please specify a name for your function in the following format <DOCKERHUB_USERNAME>/<FUNCTION_NAME>.\nTry: fn init <DOCKERHUB_USERNAME>/<FUNCTION_NAME>")
+	if err := a.parseName(c); err != nil {
+		return err
 	}
 
 	if exists("Dockerfile") {
@@ -148,6 +263,14 @@ func (a *initFnCmd) buildFuncFile(c *cli.Context) error {
 		return nil
 	}
 
+	// functions without code yet are scaffolded, those of templates having theirs
+	if s, ok := scaffolds[a.runtime]; ok && a.template == "" && !exists(filepath.Join(pwd, s.handler)) {
+		a.scaffold = true
+		if a.entrypoint == "" {
+			a.entrypoint = s.entrypoint
+		}
+	}
+
 	var rt string
 	if a.runtime == "" {
 		rt, err = detectRuntime(pwd)
@@ -172,6 +295,17 @@ func (a *initFnCmd) buildFuncFile(c *cli.Context) error {
 	return nil
 }
 
+func (a *initFnCmd) parseName(c *cli.Context) error {
+	a.name = c.Args().First()
+	if a.name != "" && !strings.Contains(a.name, "/") && globals.registry != "" {
+		a.name = globals.registry + "/" + a.name
+	}
+	if a.name == "" || strings.Contains(a.name, ":") {
+		return errors.New("Please specify a name for your function in the following format <DOCKERHUB_USERNAME>/<FUNCTION_NAME>.\nTry: fn init <DOCKERHUB_USERNAME>/<FUNCTION_NAME>")
+	}
+	return nil
+}
+
 func detectRuntime(path string) (runtime string, err error) {
 	for ext, runtime := range fileExtToRuntime {
 		fn := filepath.Join(path, fmt.Sprintf("func%s", ext))
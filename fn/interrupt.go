@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// rootContext is the context of the command run, cancelled once fn is asked
+// to stop. Requests, builds and the other programs fn runs are given it, or
+// a context derived from it, so that they stop too. Cleanups, which must
+// happen even then, are not.
+var rootContext = context.Background()
+
+// cmdContext returns the context of the command run.
+func cmdContext() context.Context {
+	return rootContext
+}
+
+// detach returns a context with the values of ctx, its span included, which
+// is never cancelled, for cleanups to happen even once fn is interrupted.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// handleInterrupts cancels the context of the command on the first Ctrl-C or
+// SIGTERM, for it to stop what it is doing, clean up and return. A second
+// one stops fn right away, as usual. The returned function stops handling
+// them.
+func handleInterrupts() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	rootContext = ctx
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			signal.Stop(sig)
+			progress("interrupted, cleaning up, Ctrl-C again to stop now")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
+// interrupted turns err, returned by a command cancelled by handleInterrupts,
+// into an error telling so. Bulk commands tell which items were interrupted
+// themselves.
+func interrupted(err error) error {
+	if err == nil || cmdContext().Err() == nil {
+		return err
+	}
+	if e, ok := err.(*fnError); ok && e.Kind == kindPartial {
+		return err
+	}
+	return &fnError{Kind: kindInterrupted, Message: "interrupted"}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleInterrupts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on Windows")
+	}
+	defer func(ctx context.Context) { rootContext = ctx }(rootContext)
+
+	stop := handleInterrupts()
+	defer stop()
+	if cmdContext().Err() != nil {
+		t.Fatal("the command is cancelled before being interrupted")
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Signal(syscall.SIGTERM)
+	select {
+	case <-cmdContext().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command is not cancelled on SIGTERM")
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	defer func(ctx context.Context) { rootContext = ctx }(rootContext)
+
+	// requests are made with the context of the command
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.apiURL = srv.URL
+
+	err := apiCall("GET", "/v1/apps", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted(err) != nil || interrupted(errors.New("boom")).Error() != "boom" {
+		t.Error("errors of commands not interrupted are changed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rootContext = ctx
+	err = apiCall("GET", "/v1/apps", nil, nil)
+	if err == nil {
+		t.Fatal("a request was made once interrupted")
+	}
+	if e := classify(interrupted(err)); e.Kind != kindInterrupted || e.ExitCode() != 130 {
+		t.Errorf("expected fn to exit as interrupted, got %s (%d)", e.Kind, e.ExitCode())
+	}
+	partial := &fnError{Kind: kindPartial, Message: "3 deleted, 2 interrupted"}
+	if interrupted(partial) != partial {
+		t.Error("the report of a bulk command interrupted is not kept")
+	}
+
+	report := newBulkReport("deleted")
+	report.finish(ctx, "myapp /hello", err)
+	report.finish(context.Background(), "myapp /bye", nil)
+	if report.count(bulkSkipped) != 1 || report.count(bulkSucceeded) != 1 {
+		t.Errorf("expected an item interrupted and one succeeded, got %+v", report.items)
+	}
+}
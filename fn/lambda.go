@@ -278,9 +278,9 @@ func createFunctionYaml(opts createImageOptions) error {
 	strs := strings.Split(opts.Name, "/")
 	path := fmt.Sprintf("/%s", strs[1])
 	funcDesc := &funcfile{
-		Name:   opts.Name,
-		path:   &path,
-		Config: opts.Config,
+		Name:      opts.Name,
+		RoutePath: &path,
+		Config:    opts.Config,
 	}
 
 	out, err := yaml.Marshal(funcDesc)
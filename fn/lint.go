@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+// lintRule is a check of the settings of functions which are valid, but
+// likely to be mistakes.
+type lintRule struct {
+	ID          string
+	Description string
+}
+
+var (
+	ruleSyncTimeout    = lintRule{"sync-timeout", "sync route with a timeout longer than clients usually wait"}
+	ruleHotConcurrency = lintRule{"hot-concurrency", "hot function handling a single call at a time"}
+	ruleRuntimeMemory  = lintRule{"runtime-memory", "memory below what the runtime needs to start"}
+	ruleReservedConfig = lintRule{"reserved-config", "config key colliding with another environment variable"}
+	ruleMissingPath    = lintRule{"missing-path", "route path derived from the image name"}
+
+	lintRules = []lintRule{ruleSyncTimeout, ruleHotConcurrency, ruleRuntimeMemory, ruleReservedConfig, ruleMissingPath}
+)
+
+const (
+	// syncTimeoutLimit is longer than most HTTP clients and load balancers
+	// wait for a response.
+	syncTimeoutLimit = time.Minute
+
+	// The server defaults of routes.
+	defaultMemory  = 128
+	defaultTimeout = 30 * time.Second
+)
+
+// runtimeMinMemory is the memory, in MB, below which functions of the runtime
+// hardly start.
+var runtimeMinMemory = map[string]int64{
+	"java":      256,
+	"scala":     256,
+	"leiningen": 256,
+	"dotnet":    128,
+	"mono":      128,
+	"elixir":    64,
+	"erlang":    64,
+	"node":      64,
+	"php":       64,
+	"python":    64,
+	"ruby":      64,
+}
+
+// reservedEnv are the environment variables set for every call, or by the
+// container, which config keys would collide with.
+var reservedEnv = []string{"METHOD", "ROUTE", "REQUEST_URL", "APP_NAME", "PATH", "HOME", "HOSTNAME"}
+
+// reservedEnvPrefixes are those of the environment variables of the route
+// parameters and request headers.
+var reservedEnvPrefixes = []string{"PARAM_", "HEADER_"}
+
+// lintIssue is a setting of a function a rule flags.
+type lintIssue struct {
+	Rule    string `json:"rule"`
+	Route   string `json:"route,omitempty"`
+	Message string `json:"message"`
+}
+
+// lintFuncfile checks the function file against the rules.
+func lintFuncfile(ff *funcfile) ([]lintIssue, error) {
+	var issues []lintIssue
+	flag := func(rule lintRule, route, format string, a ...interface{}) {
+		issues = append(issues, lintIssue{rule.ID, route, fmt.Sprintf(format, a...)})
+	}
+
+	explicitPaths := len(ff.Paths)+len(ff.Routes) > 0
+	routes, err := fndeploy.Routes(ff)
+	if err != nil {
+		return nil, err
+	}
+	if !explicitPaths {
+		flag(ruleMissingPath, routes[0].Path, "no paths or routes declared, the path is derived from the image name and changes with it")
+	}
+
+	rt, _ := ff.RuntimeTag()
+	for _, r := range routes {
+		memory := r.Memory
+		if memory == 0 {
+			memory = defaultMemory
+		}
+		if min := runtimeMinMemory[rt]; memory < min {
+			flag(ruleRuntimeMemory, r.Path, "%d MB of memory, %s functions need at least %d MB", memory, rt, min)
+		}
+
+		timeout := defaultTimeout
+		if r.Timeout != nil && *r.Timeout > 0 {
+			timeout = time.Duration(*r.Timeout) * time.Second
+		}
+		if r.Type != "async" && timeout > syncTimeoutLimit {
+			flag(ruleSyncTimeout, r.Path, "sync route with a %v timeout, clients waiting for the response may give up first, consider an async route", timeout)
+		}
+
+		if r.Format == "http" && r.MaxConcurrency <= 1 {
+			flag(ruleHotConcurrency, r.Path, "hot function with a max_concurrency of 1, calls are handled one at a time per node")
+		}
+
+		lintConfig(r, func(format string, a ...interface{}) {
+			flag(ruleReservedConfig, r.Path, format, a...)
+		})
+	}
+	return issues, nil
+}
+
+// lintConfig flags the config keys of the route whose environment variable,
+// as the server names them, collide.
+func lintConfig(r fnmodels.Route, flag func(format string, a ...interface{})) {
+	var keys []string
+	for k := range r.Config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	seen := make(map[string]string)
+	for _, k := range keys {
+		name := strings.ToUpper(strings.Replace(k, "-", "_", -1))
+		if other, ok := seen[name]; ok {
+			flag("config keys %s and %s are both set as %s", other, k, name)
+			continue
+		}
+		seen[name] = k
+
+		if oneOf(name, reservedEnv) {
+			flag("config key %s collides with the %s environment variable", k, name)
+			continue
+		}
+		for _, prefix := range reservedEnvPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				flag("config key %s collides with the %s* environment variables", k, prefix)
+			}
+		}
+	}
+}
+
+func lint() cli.Command {
+	return cli.Command{
+		Name:      "lint",
+		Usage:     "flag suspicious settings of a function file",
+		ArgsUsage: "[path]",
+		Action:    lintAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Usage: "output format - text, json or sarif, text unless -o json is given",
+			},
+		},
+	}
+}
+
+// funcfileArg returns the function file the argument of c points to, itself
+// or the one of the directory, the current one by default.
+func funcfileArg(c *cli.Context) (string, error) {
+	p := c.Args().First()
+	if p == "" {
+		p = "."
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return findFuncfile(p)
+	}
+	return p, nil
+}
+
+func lintAction(c *cli.Context) error {
+	format := c.String("format")
+	if format == "" {
+		format = globals.output
+	}
+	if format != "text" && format != "json" && format != "sarif" {
+		return usageError("unknown lint output format %s, expected text, json or sarif", format)
+	}
+
+	p, err := funcfileArg(c)
+	if err != nil {
+		return err
+	}
+	ff, err := parsefuncfile(p)
+	if err != nil {
+		return err
+	}
+	issues, err := lintFuncfile(ff)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(struct {
+			Funcfile string      `json:"funcfile"`
+			Issues   []lintIssue `json:"issues"`
+		}{p, append([]lintIssue{}, issues...)})
+	case "sarif":
+		err = writeSARIF(os.Stdout, p, issues)
+	default:
+		for _, i := range issues {
+			if i.Route != "" {
+				fmt.Printf("%s: %s: %s (%s)\n", p, i.Route, i.Message, i.Rule)
+			} else {
+				fmt.Printf("%s: %s (%s)\n", p, i.Message, i.Rule)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(issues) > 0 {
+		return &fnError{Kind: kindValidation, Message: fmt.Sprintf("%s: %d issues", p, len(issues))}
+	}
+	return nil
+}
+
+// writeSARIF writes the issues as a SARIF log, which CI systems turn into
+// annotations.
+func writeSARIF(w io.Writer, path string, issues []lintIssue) error {
+	type text struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string `json:"id"`
+		ShortDescription text   `json:"shortDescription"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   text       `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type driver struct {
+		Name           string `json:"name"`
+		InformationURI string `json:"informationUri"`
+		Rules          []rule `json:"rules"`
+	}
+	type run struct {
+		Tool struct {
+			Driver driver `json:"driver"`
+		} `json:"tool"`
+		Results []result `json:"results"`
+	}
+
+	var loc location
+	loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(path)
+	rules := make([]rule, 0, len(lintRules))
+	for _, r := range lintRules {
+		rules = append(rules, rule{r.ID, text{r.Description}})
+	}
+	results := make([]result, 0, len(issues))
+	for _, i := range issues {
+		msg := i.Message
+		if i.Route != "" {
+			msg = i.Route + ": " + msg
+		}
+		results = append(results, result{i.Rule, findingWarning, text{msg}, []location{loc}})
+	}
+
+	var r run
+	r.Tool.Driver = driver{"fn lint", "https://github.com/iron-io/functions", rules}
+	r.Results = results
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []run  `json:"runs"`
+	}{"https://json.schemastore.org/sarif-2.1.0.json", "2.1.0", []run{r}})
+}
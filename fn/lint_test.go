@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestLintFuncfile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		content  string
+		expected []lintIssue
+	}{
+		{"clean", `name: acme/hello
+runtime: go
+paths:
+- /hello
+`, nil},
+		{"derived path", `name: acme/hello
+runtime: go
+`, []lintIssue{
+			{"missing-path", "/hello", "no paths or routes declared, the path is derived from the image name and changes with it"},
+		}},
+		{"suspicious routes", `name: acme/hello
+runtime: java
+memory: 512
+config:
+  PATH: /opt/bin
+  db-url: postgres://db
+  DB_URL: postgres://db2
+  header_x: "1"
+routes:
+- path: /report
+  timeout: 300000000000
+- path: /async-report
+  type: async
+  timeout: 300000000000
+- path: /hot
+  format: http
+  memory: 128
+`, []lintIssue{
+			{"sync-timeout", "/report", "sync route with a 5m0s timeout, clients waiting for the response may give up first, consider an async route"},
+			{"reserved-config", "/report", "config key PATH collides with the PATH environment variable"},
+			{"reserved-config", "/report", "config keys DB_URL and db-url are both set as DB_URL"},
+			{"reserved-config", "/report", "config key header_x collides with the HEADER_* environment variables"},
+			{"reserved-config", "/async-report", "config key PATH collides with the PATH environment variable"},
+			{"reserved-config", "/async-report", "config keys DB_URL and db-url are both set as DB_URL"},
+			{"reserved-config", "/async-report", "config key header_x collides with the HEADER_* environment variables"},
+			{"runtime-memory", "/hot", "128 MB of memory, java functions need at least 256 MB"},
+			{"hot-concurrency", "/hot", "hot function with a max_concurrency of 1, calls are handled one at a time per node"},
+			{"reserved-config", "/hot", "config key PATH collides with the PATH environment variable"},
+			{"reserved-config", "/hot", "config keys DB_URL and db-url are both set as DB_URL"},
+			{"reserved-config", "/hot", "config key header_x collides with the HEADER_* environment variables"},
+		}},
+	} {
+		var ff funcfile
+		if err := yaml.Unmarshal([]byte(tc.content), &ff); err != nil {
+			t.Fatal(err)
+		}
+		issues, err := lintFuncfile(&ff)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(issues) != len(tc.expected) {
+			t.Errorf("%s: expected %d issues, got %v", tc.name, len(tc.expected), issues)
+			continue
+		}
+		for i, issue := range issues {
+			if issue != tc.expected[i] {
+				t.Errorf("%s: expected %v, got %v", tc.name, tc.expected[i], issue)
+			}
+		}
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeSARIF(&buf, "hello/func.yaml", []lintIssue{{"missing-path", "/hello", "derived"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID  string `json:"ruleId"`
+				Message struct {
+					Text string `json:"text"`
+				} `json:"message"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(lintRules) {
+		t.Fatalf("expected a SARIF 2.1.0 log of one run with every rule, got %s", buf.String())
+	}
+	res := log.Runs[0].Results
+	if len(res) != 1 || res[0].RuleID != "missing-path" || res[0].Message.Text != "/hello: derived" || res[0].Locations[0].PhysicalLocation.ArtifactLocation.URI != "hello/func.yaml" {
+		t.Errorf("expected the issue as a result located in the function file, got %s", buf.String())
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loadOptions tells how hard a load test calls a function: with that many
+// concurrent callers, until the given number of calls is made or the
+// duration is over, whichever comes first.
+type loadOptions struct {
+	concurrency int
+	iterations  int
+	duration    time.Duration
+}
+
+// loadReport is the outcome of a load test.
+type loadReport struct {
+	Calls      int                      `json:"calls"`
+	Errors     map[string]int           `json:"errors"`
+	Duration   time.Duration            `json:"duration"`
+	Throughput float64                  `json:"throughput"`
+	Latency    map[string]time.Duration `json:"latency"`
+
+	// Containers is how many hot containers served the calls, and QueueWait
+	// how long calls waited for one, for servers reporting it.
+	Containers int                      `json:"containers,omitempty"`
+	QueueWait  map[string]time.Duration `json:"queue_wait,omitempty"`
+
+	// Stopped tells why the test ended early, like a spent call budget.
+	Stopped string `json:"stopped,omitempty"`
+}
+
+func (r *loadReport) failed() int {
+	n := 0
+	for _, count := range r.Errors {
+		n += count
+	}
+	return n
+}
+
+func (r *loadReport) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s calls in %s, %.1f calls/s\n", formatCount(int64(r.Calls)), r.Duration, r.Throughput)
+
+	if n := r.failed(); n > 0 {
+		var causes []string
+		for cause, count := range r.Errors {
+			causes = append(causes, cause+": "+formatCount(int64(count)))
+		}
+		sort.Strings(causes)
+		fmt.Fprintf(&b, "errors: %s (%s)\n", formatCount(int64(n)), strings.Join(causes, ", "))
+	} else {
+		fmt.Fprintln(&b, "errors: none")
+	}
+
+	if len(r.Latency) > 0 {
+		fmt.Fprintln(&b, "latency:", percentilesString(r.Latency))
+	}
+	if r.Containers > 0 {
+		fmt.Fprintln(&b, "containers:", r.Containers)
+	}
+	if len(r.QueueWait) > 0 {
+		fmt.Fprintln(&b, "queue wait:", percentilesString(r.QueueWait))
+	}
+	if r.Stopped != "" {
+		fmt.Fprintln(&b, "stopped:", r.Stopped)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (r *loadReport) MarshalJSON() ([]byte, error) {
+	type report loadReport
+	return json.Marshal(struct {
+		*report
+		Duration  string            `json:"duration"`
+		Latency   map[string]string `json:"latency"`
+		QueueWait map[string]string `json:"queue_wait,omitempty"`
+	}{(*report)(r), r.Duration.String(), durationsMap(r.Latency), durationsMap(r.QueueWait)})
+}
+
+func durationsMap(m map[string]time.Duration) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	s := make(map[string]string, len(m))
+	for k, d := range m {
+		s[k] = d.String()
+	}
+	return s
+}
+
+var reportedPercentiles = []struct {
+	name string
+	q    float64
+}{{"min", 0}, {"p50", .5}, {"p95", .95}, {"p99", .99}, {"max", 1}}
+
+func percentilesString(m map[string]time.Duration) string {
+	var parts []string
+	for _, p := range reportedPercentiles {
+		parts = append(parts, p.name+" "+m[p.name].String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// percentiles returns the reported percentiles of durations, which it sorts.
+func percentiles(durations []time.Duration) map[string]time.Duration {
+	if len(durations) == 0 {
+		return nil
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	m := make(map[string]time.Duration, len(reportedPercentiles))
+	for _, p := range reportedPercentiles {
+		// nearest rank
+		i := int(math.Ceil(p.q*float64(len(durations)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		m[p.name] = durations[i]
+	}
+	return m
+}
+
+// loadTest calls the function at u concurrently, sending it body every time,
+// and reports how it coped. Connections are reused across calls.
+func loadTest(u string, body []byte, opts callOptions, lo loadOptions) *loadReport {
+	if lo.concurrency < 1 {
+		lo.concurrency = 1
+	}
+	opts.include, opts.textOnly, opts.wait = false, false, false
+	// the budget is taken before each call, to stop once it is spent
+	budget := opts.budget
+	opts.budget = nil
+
+	var (
+		mu         sync.Mutex
+		calls      int
+		stopped    string
+		errs       = make(map[string]int)
+		latencies  []time.Duration
+		waits      []time.Duration
+		containers = make(map[string]bool)
+	)
+	var deadline time.Time
+	if lo.duration > 0 {
+		deadline = time.Now().Add(lo.duration)
+	}
+	next := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped != "" || (lo.iterations > 0 && calls >= lo.iterations) || (!deadline.IsZero() && time.Now().After(deadline)) {
+			return false
+		}
+		if err := budget.take(); err != nil {
+			stopped = classify(err).Message
+			return false
+		}
+		calls++
+		return true
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < lo.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := opts
+			o.summary = func(s callSummary) {
+				mu.Lock()
+				defer mu.Unlock()
+				latencies = append(latencies, s.Duration)
+				if s.ContainerID != "" {
+					containers[s.ContainerID] = true
+				}
+				if s.QueueWait > 0 {
+					waits = append(waits, s.QueueWait)
+				}
+			}
+
+			for next() {
+				var content io.Reader
+				if body != nil {
+					content = bytes.NewReader(body)
+				}
+				err := callfn(u, content, ioutil.Discard, o)
+				if err == nil {
+					continue
+				}
+				e := classify(err)
+				cause := e.Kind
+				if e.Kind == kindFunction {
+					cause = strconv.Itoa(e.Status)
+				}
+				mu.Lock()
+				errs[cause]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	return &loadReport{
+		Calls:      calls,
+		Errors:     errs,
+		Duration:   elapsed,
+		Throughput: float64(calls) / elapsed.Seconds(),
+		Latency:    percentiles(latencies),
+		Containers: len(containers),
+		QueueWait:  percentiles(waits),
+		Stopped:    stopped,
+	}
+}
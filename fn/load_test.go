@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPercentiles(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	p := percentiles(durations)
+	expected := map[string]time.Duration{
+		"min": time.Millisecond,
+		"p50": 50 * time.Millisecond,
+		"p95": 95 * time.Millisecond,
+		"p99": 99 * time.Millisecond,
+		"max": 100 * time.Millisecond,
+	}
+	for name, d := range expected {
+		if p[name] != d {
+			t.Errorf("expected %s to be %s, got %s", name, d, p[name])
+		}
+	}
+}
+
+func TestLoadTest(t *testing.T) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&n, 1)
+		w.Header().Set(headerContainerID, fmt.Sprint(i%3))
+		if i%10 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	report := loadTest(srv.URL, []byte("{}"), callOptions{}, loadOptions{concurrency: 5, iterations: 50})
+	if report.Calls != 50 || n != 50 {
+		t.Errorf("expected 50 calls, made %d and reported %d", n, report.Calls)
+	}
+	if report.Errors["500"] != 5 || report.failed() != 5 {
+		t.Errorf("expected 5 errors with status 500, got %v", report.Errors)
+	}
+	if report.Containers != 3 {
+		t.Errorf("expected 3 containers, got %d", report.Containers)
+	}
+	if report.Latency["p99"] == 0 {
+		t.Error("expected latencies to be reported")
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"p50":"`) {
+		t.Errorf("expected readable latencies in JSON, got %s", b)
+	}
+}
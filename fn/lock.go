@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	fnapi "github.com/iron-io/functions/fn/pkg/client"
+	fnclient "github.com/iron-io/functions_go/client"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+const lockfileName = "fn.lock"
+
+// lockfile captures the exact state left behind by a deploy: which images,
+// resolved to immutable digests, serve which routes and with which settings.
+type lockfile struct {
+	App           string       `json:"app"`
+	ServerVersion string       `json:"server_version,omitempty"`
+	DeployedAt    time.Time    `json:"deployed_at"`
+	Functions     []lockedFunc `json:"functions"`
+}
+
+type lockedFunc struct {
+	Funcfile string         `json:"funcfile"`
+	Image    string         `json:"image"`
+	Digest   string         `json:"digest,omitempty"`
+	Route    fnmodels.Route `json:"route"`
+	// Secrets are the config keys holding secrets, which are not locked.
+	Secrets []string `json:"secrets,omitempty"`
+}
+
+func readLockfile(dir string) (*lockfile, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, lockfileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, newNotFoundError("could not find " + lockfileName)
+		}
+		return nil, err
+	}
+	lf := new(lockfile)
+	if err := json.Unmarshal(b, lf); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", lockfileName, err)
+	}
+	return lf, nil
+}
+
+func writeLockfile(dir string, lf *lockfile) error {
+	b, err := json.MarshalIndent(lf, "", "\t")
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %v", lockfileName, err)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, lockfileName), append(b, '\n'), os.FileMode(0644))
+}
+
+func (p *deploycmd) writeLockfile() error {
+	sv, err := serverVersion()
+	if err != nil {
+		fmt.Fprintln(p.verbwriter, "could not read server version:", err)
+	}
+
+	// functions deployed in parallel finish in any order
+	sort.SliceStable(p.locked, func(i, j int) bool { return p.locked[i].Funcfile < p.locked[j].Funcfile })
+	lf := &lockfile{
+		App:           p.appName,
+		ServerVersion: sv,
+		DeployedAt:    time.Now().UTC(),
+		Functions:     p.locked,
+	}
+	if err := writeLockfile(p.wd, lf); err != nil {
+		return err
+	}
+	fmt.Fprintln(p.verbwriter, "wrote", filepath.Join(p.wd, lockfileName))
+	return nil
+}
+
+// deployLocked skips building and pushing altogether, and points every route
+// recorded in the lockfile back to the image digest it was deployed with.
+func (p *deploycmd) deployLocked() error {
+	lf, err := readLockfile(p.wd)
+	if err != nil {
+		return err
+	}
+	if lf.App != p.appName {
+		return fmt.Errorf("%s was recorded for app %s, not %s", lockfileName, lf.App, p.appName)
+	}
+
+	report := newBulkReport("restored")
+	for _, l := range lf.Functions {
+		route := l.Route
+		if l.Digest != "" {
+			route.Image = l.Digest
+		}
+		fmt.Fprintf(p.verbwriter, "restoring route %s to %s\n", route.Path, route.Image)
+		if err := p.storeRoute(cmdContext(), route); err != nil {
+			report.fail(l.Funcfile, err)
+			continue
+		}
+		report.succeed(l.Funcfile)
+	}
+	return report.writeAndErr()
+}
+
+func verify() cli.Command {
+	cmd := verifycmd{client: apiClient()}
+	return cli.Command{
+		Name:   "verify",
+		Usage:  "check that the live server still matches " + lockfileName,
+		Action: cmd.verify,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "d",
+				Usage:       "working directory",
+				Destination: &cmd.wd,
+				EnvVar:      "WORK_DIR",
+				Value:       "./",
+			},
+		},
+	}
+}
+
+type verifycmd struct {
+	client *fnclient.Functions
+	wd     string
+}
+
+func (v *verifycmd) verify(c *cli.Context) error {
+	lf, err := readLockfile(v.wd)
+	if err != nil {
+		return err
+	}
+
+	var drifted int
+	for _, l := range lf.Functions {
+		resp, err := v.client.Routes.GetAppsAppRoutesRoute(&apiroutes.GetAppsAppRoutesRouteParams{
+			Context: cmdContext(),
+			App:     lf.App,
+			Route:   l.Route.Path,
+		})
+		if err != nil {
+			if _, ok := err.(*apiroutes.GetAppsAppRoutesRouteNotFound); ok {
+				fmt.Println(l.Route.Path, "missing")
+				drifted++
+				continue
+			}
+			return apiError(err)
+		}
+
+		diffs := lockDiff(l, resp.Payload.Route)
+		if len(diffs) == 0 {
+			fmt.Println(l.Route.Path, "ok")
+			continue
+		}
+		drifted++
+		fmt.Println(l.Route.Path, "drifted")
+		for _, d := range diffs {
+			fmt.Println("\t", d)
+		}
+	}
+
+	if drifted > 0 {
+		return fmt.Errorf("error: %d route(s) in app %s no longer match %s", drifted, lf.App, lockfileName)
+	}
+	return nil
+}
+
+func lockDiff(l lockedFunc, live *fnmodels.Route) []string {
+	want := *fnapi.CopyRoute(&l.Route)
+	if live.Image == l.Digest {
+		want.Image = live.Image
+	}
+	maskSecrets(&want, live, l.Secrets)
+
+	var diffs []string
+	for _, ch := range routeDiff(&want, live) {
+		if ch.Field == "config" || ch.Field == "headers" {
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: locked %v, live %v", ch.Field, ch.After, ch.Before))
+	}
+	// unlike deploys, which merge them, the lock holds the whole config and
+	// headers, keys set on the route since drifting too
+	if len(want.Config)+len(live.Config) > 0 && !reflect.DeepEqual(want.Config, live.Config) {
+		diffs = append(diffs, fmt.Sprintf("config: locked %v, live %v", want.Config, live.Config))
+	}
+	if len(want.Headers)+len(live.Headers) > 0 && !reflect.DeepEqual(want.Headers, live.Headers) {
+		diffs = append(diffs, fmt.Sprintf("headers: locked %v, live %v", want.Headers, live.Headers))
+	}
+	return diffs
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+const lockedDigest = "acme/hello@sha256:4fd0cbdf0d8d2ef5d5ac4e8c8de8e08e07aaa1b4e2b7c2a1e1b5c1bd3c3e2b8e"
+
+func lockedHello() lockedFunc {
+	to := int64(30)
+	return lockedFunc{
+		Funcfile: "hello/func.yaml",
+		Image:    "acme/hello:0.0.2",
+		Digest:   lockedDigest,
+		Route: fnmodels.Route{
+			Path:    "/hello",
+			Image:   "acme/hello:0.0.2",
+			Memory:  128,
+			Type:    "sync",
+			Timeout: &to,
+			Config:  map[string]string{"DB": "postgres", "DB_PASS": redacted},
+		},
+		Secrets: []string{"DB_PASS"},
+	}
+}
+
+func TestLockDiff(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(live *fnmodels.Route)
+		fields []string
+	}{
+		{"as deployed", func(*fnmodels.Route) {}, nil},
+		{"pinned by tag", func(live *fnmodels.Route) { live.Image = "acme/hello:0.0.2" }, nil},
+		{"secret rotated", func(live *fnmodels.Route) { live.Config["DB_PASS"] = "rotated" }, nil},
+		{"image changed", func(live *fnmodels.Route) { live.Image = "acme/hello:0.0.3" }, []string{"image"}},
+		{"memory changed", func(live *fnmodels.Route) { live.Memory = 256 }, []string{"memory"}},
+		{"config key added", func(live *fnmodels.Route) { live.Config["DEBUG"] = "1" }, []string{"config"}},
+		{"config key removed", func(live *fnmodels.Route) { delete(live.Config, "DB") }, []string{"config"}},
+		{"headers added", func(live *fnmodels.Route) { live.Headers = map[string][]string{"X-Debug": {"1"}} }, []string{"headers"}},
+	}
+	for _, c := range cases {
+		l := lockedHello()
+		to := int64(30)
+		live := &fnmodels.Route{
+			Path:    "/hello",
+			Image:   lockedDigest,
+			Memory:  128,
+			Type:    "sync",
+			Timeout: &to,
+			Config:  map[string]string{"DB": "postgres", "DB_PASS": "s3cret"},
+		}
+		c.change(live)
+
+		diffs := lockDiff(l, live)
+		if len(diffs) != len(c.fields) {
+			t.Errorf("%s: expected drift on %v, got %v", c.name, c.fields, diffs)
+			continue
+		}
+		for i, d := range diffs {
+			if !strings.HasPrefix(d, c.fields[i]+":") {
+				t.Errorf("%s: expected drift on %s, got %s", c.name, c.fields[i], d)
+			}
+		}
+	}
+}
+
+func TestVerifyMissingRoute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gone := lockedHello()
+	gone.Funcfile, gone.Route.Path = "gone/func.yaml", "/gone"
+	if err := writeLockfile(dir, &lockfile{App: "myapp", Functions: []lockedFunc{lockedHello(), gone}}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/apps/myapp/routes/hello" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "Route not found"}})
+			return
+		}
+		live := lockedHello().Route
+		live.Image = lockedDigest
+		live.Config["DB_PASS"] = "s3cret"
+		json.NewEncoder(w).Encode(fnmodels.RouteWrapper{Route: &live})
+	}))
+	defer srv.Close()
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.apiURL = srv.URL
+
+	v := &verifycmd{client: apiClient(), wd: dir}
+	err = v.verify(nil)
+	if err == nil || !strings.Contains(err.Error(), "1 route(s) in app myapp") {
+		t.Errorf("expected the route missing from the server to be reported, got %v", err)
+	}
+}
+
+func TestDeployFrozenLockfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var stored []fnmodels.Route
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			// negotiated before storing routes
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != "POST" || r.URL.Path != "/v1/apps/myapp/routes" {
+			t.Errorf("unexpected %s %s, frozen deploys only restore routes", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		var body fnmodels.RouteWrapper
+		json.NewDecoder(r.Body).Decode(&body)
+		stored = append(stored, *body.Route)
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer srv.Close()
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.apiURL = srv.URL
+
+	p := &deploycmd{appName: "other", client: apiClient(), wd: dir, frozen: true, verbwriter: ioutil.Discard}
+	if err := p.deployLocked(); err == nil {
+		t.Error("expected a frozen deploy without lockfile to fail")
+	}
+	if err := writeLockfile(dir, &lockfile{App: "myapp", Functions: []lockedFunc{lockedHello()}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.deployLocked(); err == nil || !strings.Contains(err.Error(), "not other") {
+		t.Errorf("expected a lockfile of another app to be refused, got %v", err)
+	}
+
+	p.appName = "myapp"
+	if err := p.deployLocked(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Path != "/hello" || stored[0].Image != lockedDigest || stored[0].Memory != 128 {
+		t.Errorf("expected /hello restored to its locked digest, got %+v", stored)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What fn does internally, like the requests it makes, and its warnings are
+// logged to stderr by a single logger, as text for people or, with
+// --log-format json, as a JSON object a line for CI systems to ingest.
+// --log-level leaves out the less severe entries, requests being logged at
+// the debug level which --verbose turns on.
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string { return logLevelNames[l] }
+
+func parseLogLevel(s string) (logLevel, error) {
+	for i, name := range logLevelNames {
+		if s == name {
+			return logLevel(i), nil
+		}
+	}
+	return 0, usageError("unknown log level %s, expected one of %s", s, strings.Join(logLevelNames, ", "))
+}
+
+type cliLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level logLevel
+	json  bool
+	now   func() time.Time
+}
+
+var logger = &cliLogger{out: os.Stderr, level: levelInfo, now: time.Now}
+
+func (l *cliLogger) debug(msg string, kv ...interface{}) { l.log(levelDebug, msg, kv...) }
+func (l *cliLogger) info(msg string, kv ...interface{})  { l.log(levelInfo, msg, kv...) }
+func (l *cliLogger) warn(msg string, kv ...interface{})  { l.log(levelWarn, msg, kv...) }
+func (l *cliLogger) error(msg string, kv ...interface{}) { l.log(levelError, msg, kv...) }
+
+// enabled tells whether entries of level are logged, to skip building costly
+// ones otherwise.
+func (l *cliLogger) enabled(level logLevel) bool {
+	return level >= l.level
+}
+
+// log writes an entry with msg and the fields given as key and value pairs.
+func (l *cliLogger) log(level logLevel, msg string, kv ...interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+
+	var line []byte
+	if l.json {
+		line = l.jsonEntry(level, msg, kv)
+	} else {
+		line = textEntry(level, msg, kv)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+func (l *cliLogger) jsonEntry(level logLevel, msg string, kv []interface{}) []byte {
+	var b strings.Builder
+	b.WriteString(`{"time":`)
+	writeJSON(&b, l.now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSON(&b, level.String())
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, msg)
+	for i := 0; i < len(kv); i += 2 {
+		b.WriteByte(',')
+		writeJSON(&b, fmt.Sprint(kv[i]))
+		b.WriteByte(':')
+		writeJSON(&b, fieldValue(kv, i+1))
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// writeJSON writes v out, as a string when it cannot be encoded.
+func writeJSON(b *strings.Builder, v interface{}) {
+	switch x := v.(type) {
+	case error:
+		v = x.Error()
+	case time.Duration:
+		v = x.String()
+	case fmt.Stringer:
+		v = x.String()
+	}
+	enc, err := json.Marshal(v)
+	if err != nil {
+		enc, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(enc)
+}
+
+// textEntry is msg followed by the fields as key=value, prefixed with the
+// level but for info. Multi-line values, like dumps, follow the line as they
+// are.
+func textEntry(level logLevel, msg string, kv []interface{}) []byte {
+	var b, tail strings.Builder
+	switch level {
+	case levelWarn:
+		b.WriteString("warning: ")
+	case levelError, levelDebug:
+		b.WriteString(level.String() + ": ")
+	}
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		v := fmt.Sprint(fieldValue(kv, i+1))
+		if strings.Contains(v, "\n") {
+			tail.WriteString(strings.TrimSuffix(v, "\n") + "\n")
+			continue
+		}
+		if v == "" || strings.ContainsAny(v, " \"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %v=%s", kv[i], v)
+	}
+	b.WriteString("\n")
+	b.WriteString(tail.String())
+	return []byte(b.String())
+}
+
+func fieldValue(kv []interface{}, i int) interface{} {
+	if i < len(kv) {
+		return kv[i]
+	}
+	return "<missing>"
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	l := &cliLogger{out: &out, level: levelInfo, now: func() time.Time { return time.Unix(0, 0) }}
+
+	l.debug("request", "method", "GET")
+	l.warn("func file not found", "path", "my func", "error", errors.New("boom"))
+	if want := "warning: func file not found path=\"my func\" error=boom\n"; out.String() != want {
+		t.Errorf("expected %q logged as text, got %q", want, out.String())
+	}
+
+	out.Reset()
+	l.json = true
+	l.level = levelDebug
+	l.debug("request", "status", 200, "latency", 12*time.Millisecond)
+	if want := `{"time":"1970-01-01T00:00:00Z","level":"debug","msg":"request","status":200,"latency":"12ms"}` + "\n"; out.String() != want {
+		t.Errorf("expected %q logged as JSON, got %q", want, out.String())
+	}
+}
+
+func TestLoggerMultilineValues(t *testing.T) {
+	var out bytes.Buffer
+	l := &cliLogger{out: &out, level: levelDebug, now: time.Now}
+	l.debug("response", "dump", "< HTTP/1.1 200 OK\n< \n")
+	if want := "debug: response\n< HTTP/1.1 200 OK\n< \n"; out.String() != want {
+		t.Errorf("expected the dump to follow the line, got %q", out.String())
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	if l, err := parseLogLevel("warn"); err != nil || l != levelWarn {
+		t.Errorf("parseLogLevel(warn) = %v, %v", l, err)
+	}
+	if _, err := parseLogLevel("loud"); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// logLine is a line written by a function, as kept by servers collecting the
+// logs of the functions under /v1/apps/:app/logs.
+type logLine struct {
+	Time   time.Time `json:"time"`
+	CallID string    `json:"call_id"`
+	Path   string    `json:"path"`
+	Line   string    `json:"line"`
+}
+
+func (l *logLine) key() string {
+	return l.CallID + "\x00" + l.Line
+}
+
+// logQuery selects the lines fetchLogs returns. Zero fields do not filter.
+type logQuery struct {
+	Path  string
+	Since time.Time
+	Tail  int
+}
+
+func fetchLogs(appName string, q logQuery) ([]*logLine, error) {
+	v := url.Values{}
+	if q.Path != "" {
+		v.Set("path", q.Path)
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if q.Tail > 0 {
+		v.Set("tail", strconv.Itoa(q.Tail))
+	}
+	p := path.Join("/v1/apps", url.PathEscape(appName), "logs")
+	if len(v) > 0 {
+		p += "?" + v.Encode()
+	}
+
+	var w struct {
+		Logs []*logLine `json:"logs"`
+	}
+	if err := apiCall("GET", p, nil, &w); err != nil {
+		if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+			e.Message = fmt.Sprintf("no logs found for %s, the app may not exist or the server may not collect logs", appName)
+		}
+		return nil, err
+	}
+	return w.Logs, nil
+}
+
+// logTail prints log lines once, skipping those already printed when
+// following: the server is asked for the lines since the last one printed,
+// which comes back along with its siblings of the same instant.
+type logTail struct {
+	out  io.Writer
+	last time.Time
+	seen map[string]bool
+}
+
+func (t *logTail) print(lines []*logLine) error {
+	for _, l := range lines {
+		if l.Time.Before(t.last) || (l.Time.Equal(t.last) && t.seen[l.key()]) {
+			continue
+		}
+		if l.Time.After(t.last) {
+			t.last = l.Time
+			t.seen = make(map[string]bool)
+		}
+		t.seen[l.key()] = true
+
+		var err error
+		if globals.output == "json" {
+			err = json.NewEncoder(t.out).Encode(l)
+		} else {
+			_, err = fmt.Fprintln(t.out, l.Time.Local().Format("2006-01-02 15:04:05.000"), l.CallID, l.Line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logs() cli.Command {
+	return cli.Command{
+		Name:      "logs",
+		Usage:     "print the logs of the functions of an app, on servers collecting them",
+		ArgsUsage: "[`app`] [route]",
+		Action:    printLogs,
+		Flags: []cli.Flag{
+			appFlag,
+			pathFlag,
+			cli.StringFlag{
+				Name:  "call",
+				Usage: "only print the log of that call",
+			},
+			cli.BoolFlag{
+				Name:  "follow,f",
+				Usage: "keep printing new lines as they are logged",
+			},
+			cli.DurationFlag{
+				Name:  "since",
+				Usage: "only print lines logged within that duration, eg. 10m",
+			},
+			cli.IntFlag{
+				Name:  "tail",
+				Usage: "only print that many of the last lines",
+			},
+			cli.DurationFlag{
+				Name:  "interval",
+				Usage: "how often new lines are fetched when following",
+				Value: 2 * time.Second,
+			},
+		},
+	}
+}
+
+func printLogs(c *cli.Context) error {
+	args, err := routeArgs(c, "app")
+	if err != nil {
+		return err
+	}
+	appName := args.Get(0)
+	if id := c.String("call"); id != "" {
+		if c.Bool("follow") {
+			return usageError("--follow cannot be used with --call, use fn call --wait instead")
+		}
+		return callLog(appName, id, os.Stdout)
+	}
+
+	q := logQuery{Tail: c.Int("tail")}
+	if route := args.Get(1); route != "" {
+		q.Path = path.Join("/", route)
+	}
+	if since := c.Duration("since"); since > 0 {
+		q.Since = time.Now().Add(-since)
+	}
+
+	t := &logTail{out: os.Stdout}
+	for {
+		lines, err := fetchLogs(appName, q)
+		if err != nil {
+			return err
+		}
+		if err := t.print(lines); err != nil {
+			return err
+		}
+		if !c.Bool("follow") {
+			return nil
+		}
+
+		time.Sleep(c.Duration("interval"))
+		q.Tail = 0
+		if !t.last.IsZero() {
+			q.Since = t.last
+		}
+	}
+}
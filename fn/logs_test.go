@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLogTail(t *testing.T) {
+	defer func(o string) { globals.output = o }(globals.output)
+	globals.output = "json"
+
+	t0 := time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+	tail := &logTail{out: &out}
+
+	first := []*logLine{
+		{Time: t0, CallID: "1", Line: "a"},
+		{Time: t0.Add(time.Second), CallID: "1", Line: "b"},
+	}
+	if err := tail.print(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// polling again since the last line returns it again, along with a new
+	// line logged at the same instant and a later one
+	next := []*logLine{
+		{Time: t0.Add(time.Second), CallID: "1", Line: "b"},
+		{Time: t0.Add(time.Second), CallID: "2", Line: "b"},
+		{Time: t0.Add(2 * time.Second), CallID: "2", Line: "c"},
+	}
+	if err := tail.print(next); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := bytes.Count(out.Bytes(), []byte("\n")); n != 4 {
+		t.Errorf("expected 4 lines printed, got %d:\n%s", n, out.String())
+	}
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"net/url"
+	"io/ioutil"
 	"os"
 
 	vers "github.com/iron-io/functions/api/version"
-	functions "github.com/iron-io/functions_go"
 	"github.com/urfave/cli"
 )
 
@@ -17,6 +17,9 @@ var aliases = map[string]cli.Command{
 	"push":   push(),
 	"run":    run(),
 	"call":   call(),
+	"watch":  watch(),
+	"debug":  debug(),
+	"shell":  shell(),
 }
 
 func aliasesFn() []cli.Command {
@@ -45,7 +48,11 @@ USAGE:
    {{if .UsageText}}{{.UsageText}}{{else}}{{.HelpName}} {{if .VisibleFlags}}[global options]{{end}}{{if .Commands}} command [command options]{{end}} {{if .ArgsUsage}}{{.ArgsUsage}}{{else}}[arguments...]{{end}}{{end}}
 
 ENVIRONMENT VARIABLES:
-   API_URL - IronFunctions remote API address{{if .VisibleCommands}}
+   API_URL - IronFunctions remote API address, overrides the context
+   IRON_TOKEN - bearer token sent to the API, overrides the context
+   FN_CONTEXT - name of the context to use
+   FN_OTEL_ENDPOINT - OTLP/HTTP endpoint traces of fn are sent to
+   NO_COLOR - disables colors, whatever its value{{if .VisibleCommands}}
 
 COMMANDS:{{range .VisibleCategories}}{{if .Name}}
    {{.Name}}:{{end}}{{range .VisibleCommands}}
@@ -58,15 +65,25 @@ ALIASES:
      run      (images run)
      call     (routes call)
      push     (images push)
+     watch    (images watch)
+     debug    (images debug)
+     shell    (images shell)
 
 GLOBAL OPTIONS:
    {{range $index, $option := .VisibleFlags}}{{if $index}}
    {{end}}{{$option}}{{end}}{{end}}
 `
 
+	// -v is taken by --verbose
+	cli.VersionFlag = cli.BoolFlag{Name: "version", Usage: "print the version"}
+
+	app.Flags = globalFlags()
+	app.Before = setupGlobals
+
 	app.CommandNotFound = func(c *cli.Context, cmd string) {
 		fmt.Fprintf(os.Stderr, "command not found: %v\n", cmd)
 	}
+	app.Action = runUnknownCommand
 	app.Commands = []cli.Command{
 		initFn(),
 		apps(),
@@ -74,28 +91,82 @@ GLOBAL OPTIONS:
 		images(),
 		lambda(),
 		version(),
+		update(),
+		syncCommand(),
+		verify(),
+		planfn(),
+		contexts(),
+		chaos(),
+		aliasesCmd(),
+		setup(),
+		trash(),
+		calls(),
+		logs(),
+		configCommand(),
+		verifySignatureCmd(),
+		publishDocs(),
+		docs(),
+		supportBundle(),
+		validateCmd(),
+		lint(),
+		convertFuncfile(),
+		canary(),
+		registry(),
+		verifyImageCmd(),
+		start(),
+		emulate(),
+		completion(),
+		completeCommand(),
+		ui(),
+		pluginCmd(),
 	}
 	app.Commands = append(app.Commands, aliasesFn()...)
 	return app
 }
 
 func main() {
+	// errors are reported, and their exit code chosen, below.
+	cli.ErrWriter = ioutil.Discard
+	cli.OsExiter = func(int) {}
+	handleBrokenPipe()
+
 	app := newFn()
-	app.Run(os.Args)
+	args := os.Args
+	if cfg, err := loadConfig(); err == nil {
+		args = expandAliases(app, args, cfg.Aliases)
+	}
+	if err := setLanguage(app, language(args)); err != nil {
+		logger.warn(err.Error())
+	}
+	stop := handleInterrupts()
+	err := interrupted(app.Run(args))
+	stop()
+	commandSpan.finish(err)
+	exportSpans()
+	if err != nil {
+		os.Exit(reportError(err))
+	}
 }
 
-func resetBasePath(c *functions.Configuration) error {
-	apiURL := os.Getenv("API_URL")
-	if apiURL == "" {
-		apiURL = "http://localhost:8080"
+// reportError writes err out in the requested format, and tells the exit code
+// matching its kind.
+func reportError(err error) int {
+	if isBrokenPipe(err) {
+		return 0
 	}
-
-	u, err := url.Parse(apiURL)
-	if err != nil {
-		return err
+	if code, ok := err.(exitStatus); ok {
+		return int(code)
 	}
-	u.Path = "/v1"
-	c.BasePath = u.String()
 
-	return nil
+	e := classify(err)
+	if globals.output == "json" {
+		json.NewEncoder(os.Stderr).Encode(struct {
+			Error *fnError `json:"error"`
+		}{e})
+	} else if _, ok := err.(*fnError); ok {
+		fmt.Fprintln(os.Stderr, colored(colorRed, err.Error()))
+	} else {
+		fmt.Fprintln(os.Stderr, colored(colorRed, T(err.Error())))
+	}
+	return e.ExitCode()
 }
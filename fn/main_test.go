@@ -2,11 +2,15 @@ package main
 
 import (
 	"bytes"
+	"flag"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
 	"testing"
+
+	"github.com/urfave/cli"
 )
 
 func TestMainCommands(t *testing.T) {
@@ -17,11 +21,40 @@ func TestMainCommands(t *testing.T) {
 		"images",
 		"lambda",
 		"version",
+		"update",
+		"sync",
+		"verify",
+		"plan",
+		"chaos",
+		"alias",
+		"setup",
+		"trash",
+		"calls",
+		"logs",
+		"config",
+		"verify-signature",
+		"publish-docs",
+		"docs",
+		"support-bundle",
+		"validate",
+		"lint",
+		"convert-funcfile",
+		"canary",
+		"registry",
+		"verify-image",
 		"build",
 		"bump",
 		"deploy",
 		"run",
 		"push",
+		"watch",
+		"start",
+		"emulate",
+		"debug",
+		"shell",
+		"completion",
+		"ui",
+		"plugin",
 	}
 
 	fnTestBin := path.Join(os.TempDir(), "fn-test")
@@ -37,3 +70,27 @@ func TestMainCommands(t *testing.T) {
 
 	os.Remove(fnTestBin)
 }
+
+func TestCommandFlags(t *testing.T) {
+	var check func(prefix string, cmds []cli.Command)
+	check = func(prefix string, cmds []cli.Command) {
+		for _, cmd := range cmds {
+			name := strings.TrimSpace(prefix + " " + cmd.Name)
+			set := flag.NewFlagSet(name, flag.ContinueOnError)
+			set.SetOutput(ioutil.Discard)
+			for _, f := range cmd.Flags {
+				func() {
+					// flags defined twice panic as the command is run
+					defer func() {
+						if r := recover(); r != nil {
+							t.Errorf("fn %s: %v", name, r)
+						}
+					}()
+					f.Apply(set)
+				}()
+			}
+			check(name, cmd.Subcommands)
+		}
+	}
+	check("", newFn().Commands)
+}
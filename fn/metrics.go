@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// The modes of fn running for long, fn watch, fn emulate, fn ui and the load
+// tests of fn call, serve their metrics with --metrics-addr, in the text
+// format of Prometheus, for local runs to be graphed as production is: the
+// calls of functions by status, their latency, and how long builds take.
+
+var metricsAddrFlag = cli.StringFlag{
+	Name:  "metrics-addr",
+	Usage: "serve metrics in the Prometheus format at http://`addr`/metrics, eg. localhost:9091",
+}
+
+var (
+	latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+	buildBuckets   = []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600}
+)
+
+type histogram struct {
+	// counts are per bucket, not cumulative, the last one being +Inf
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets)+1)
+	}
+	i := sort.SearchFloat64s(buckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// metricsRegistry holds the metrics of the run, keyed by their label values.
+type metricsRegistry struct {
+	mu          sync.Mutex
+	invocations map[[3]string]uint64     // app, route, status
+	latencies   map[[2]string]*histogram // app, route
+	builds      map[[2]string]*histogram // function, result
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		invocations: make(map[[3]string]uint64),
+		latencies:   make(map[[2]string]*histogram),
+		builds:      make(map[[2]string]*histogram),
+	}
+}
+
+// fnMetrics are the metrics of the run, recorded whether they are served or
+// not.
+var fnMetrics = newMetricsRegistry()
+
+// observeCall records a call of the route of app which got status, 0 when it
+// got no response, after d.
+func observeCall(app, route string, status int, d time.Duration) {
+	s := "error"
+	if status > 0 {
+		s = strconv.Itoa(status)
+	}
+	m := fnMetrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invocations[[3]string{app, route, s}]++
+	h := m.latencies[[2]string{app, route}]
+	if h == nil {
+		h = &histogram{}
+		m.latencies[[2]string{app, route}] = h
+	}
+	h.observe(latencyBuckets, d.Seconds())
+}
+
+// observeBuild records a build of function which took d, failed when err is
+// not nil.
+func observeBuild(function string, err error, d time.Duration) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m := fnMetrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.builds[[2]string{function, result}]
+	if h == nil {
+		h = &histogram{}
+		m.builds[[2]string{function, result}] = h
+	}
+	h.observe(buildBuckets, d.Seconds())
+}
+
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write writes the metrics out in the Prometheus text format, sorted.
+func (m *metricsRegistry) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP fn_invocations_total Calls of functions, by app, route and status.")
+	fmt.Fprintln(w, "# TYPE fn_invocations_total counter")
+	keys := make([][3]string, 0, len(m.invocations))
+	for k := range m.invocations {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return strings.Join(keys[i][:], "\x00") < strings.Join(keys[j][:], "\x00") })
+	for _, k := range keys {
+		fmt.Fprintf(w, "fn_invocations_total%s %d\n", metricLabels("app", k[0], "route", k[1], "status", k[2]), m.invocations[k])
+	}
+
+	writeHistograms(w, "fn_invocation_duration_seconds", "Latency of the calls of functions, by app and route.", "app", "route", latencyBuckets, m.latencies)
+	writeHistograms(w, "fn_build_duration_seconds", "Duration of the builds of functions, by function and result.", "function", "result", buildBuckets, m.builds)
+}
+
+func writeHistograms(w io.Writer, name, help, label1, label2 string, buckets []float64, hs map[[2]string]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	keys := make([][2]string, 0, len(hs))
+	for k := range hs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		h := hs[k]
+		var cumulative uint64
+		for i, b := range buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, metricLabels(label1, k[0], label2, k[1], "le", formatFloat(b)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, metricLabels(label1, k[0], label2, k[1], "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, metricLabels(label1, k[0], label2, k[1]), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, metricLabels(label1, k[0], label2, k[1]), h.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabels formats pairs of label names and values.
+func metricLabels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, kv[i]+`="`+labelEscaper.Replace(kv[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// serveMetrics serves the metrics at http://addr/metrics, if addr is not
+// empty, until the returned function is called.
+func serveMetrics(addr string) (func(), error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", fnMetrics)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	progress("metrics served at http://" + l.Addr().String() + "/metrics")
+	return func() { srv.Close() }, nil
+}
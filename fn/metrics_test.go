@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	defer func(m *metricsRegistry) { fnMetrics = m }(fnMetrics)
+	fnMetrics = newMetricsRegistry()
+
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/r/myapp/fail" {
+			http.Error(w, "boom", http.StatusBadGateway)
+		}
+	}))
+	defer function.Close()
+	for i := 0; i < 2; i++ {
+		if err := callfn(function.URL+"/r/myapp/hello", nil, ioutil.Discard, callOptions{app: "myapp", route: "/hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	callfn(function.URL+"/r/myapp/fail", nil, ioutil.Discard, callOptions{app: "myapp", route: "/fail"})
+	observeCall("myapp", `/a"b`, 0, 20*time.Millisecond)
+	observeBuild("user/hello", nil, 3*time.Second)
+	observeBuild("user/hello", errors.New("boom"), 700*time.Second)
+
+	srv := httptest.NewServer(fnMetrics)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	exposed := string(b)
+	for _, line := range []string{
+		"# TYPE fn_invocations_total counter",
+		`fn_invocations_total{app="myapp",route="/hello",status="200"} 2`,
+		`fn_invocations_total{app="myapp",route="/fail",status="502"} 1`,
+		`fn_invocations_total{app="myapp",route="/a\"b",status="error"} 1`,
+		"# TYPE fn_invocation_duration_seconds histogram",
+		`fn_invocation_duration_seconds_bucket{app="myapp",route="/a\"b",le="0.01"} 0`,
+		`fn_invocation_duration_seconds_bucket{app="myapp",route="/a\"b",le="0.025"} 1`,
+		`fn_invocation_duration_seconds_bucket{app="myapp",route="/hello",le="+Inf"} 2`,
+		`fn_invocation_duration_seconds_count{app="myapp",route="/hello"} 2`,
+		`fn_build_duration_seconds_bucket{function="user/hello",result="success",le="2.5"} 0`,
+		`fn_build_duration_seconds_bucket{function="user/hello",result="success",le="5"} 1`,
+		`fn_build_duration_seconds_bucket{function="user/hello",result="failure",le="600"} 0`,
+		`fn_build_duration_seconds_bucket{function="user/hello",result="failure",le="+Inf"} 1`,
+		`fn_build_duration_seconds_sum{function="user/hello",result="failure"} 700`,
+	} {
+		if !strings.Contains(exposed, line+"\n") {
+			t.Errorf("%s not exposed in\n%s", line, exposed)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	stop, err := serveMetrics("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if _, err := serveMetrics("localhost:-1"); err == nil {
+		t.Error("metrics served at an invalid address")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonReader reads newline delimited JSON a line at a time, each Read
+// returning at most one line, so that every line is sent off as soon as it
+// is read instead of waiting for more input. Blank lines are skipped.
+type ndjsonReader struct {
+	r       *bufio.Reader
+	closer  io.Closer
+	pending []byte
+	err     error
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	n := &ndjsonReader{r: bufio.NewReader(r)}
+	if c, ok := r.(io.Closer); ok {
+		n.closer = c
+	}
+	return n
+}
+
+func (n *ndjsonReader) Read(p []byte) (int, error) {
+	for len(n.pending) == 0 {
+		if n.err != nil {
+			return 0, n.err
+		}
+		line, err := n.r.ReadBytes('\n')
+		n.err = err
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if line[len(line)-1] != '\n' {
+			line = append(line, '\n')
+		}
+		n.pending = line
+	}
+	k := copy(p, n.pending)
+	n.pending = n.pending[k:]
+	return k, nil
+}
+
+func (n *ndjsonReader) Close() error {
+	if n.closer == nil {
+		return nil
+	}
+	return n.closer.Close()
+}
+
+// copyLines writes what is read from r out a whole line at a time, as soon as
+// each line is read, so that consumers of streamed output never get partial
+// lines.
+func copyLines(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, werr := w.Write(line); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iron-io/functions_go"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+// With --offline, the requests changing apps and routes are not sent but
+// queued in ~/.fn/queue, one file per context, and answered as if the API
+// had accepted them. fn sync replays them later in order, through the same
+// code as the commands that queued them: updates are merged into the routes
+// as they are then, and reported as conflicts when they cannot be.
+
+var errOffline = errors.New("fn is offline, nothing can be read from the API until fn sync is run online")
+
+type queuedRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Query  string          `json:"query,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// Upsert is set for routes created, or updated when they exist.
+	Upsert bool `json:"upsert,omitempty"`
+	// Secrets are the references of the secrets of the route, by config key,
+	// resolved by fn sync so that their values are never queued. SecretsDir
+	// is the directory of the function file, which file references are
+	// relative to.
+	Secrets    map[string]string `json:"secrets,omitempty"`
+	SecretsDir string            `json:"secrets_dir,omitempty"`
+	QueuedAt   time.Time         `json:"queued_at"`
+}
+
+func (q *queuedRequest) String() string {
+	return q.Method + " " + q.Path
+}
+
+// target returns the app and the route path q is about, if any.
+func (q *queuedRequest) target() (app, route string) {
+	p := strings.TrimPrefix(q.Path, "/v1/apps/")
+	if p == q.Path {
+		return "", ""
+	}
+	parts := strings.SplitN(p, "/", 2)
+	if len(parts) == 2 && strings.HasPrefix(parts[1], "routes/") {
+		route = "/" + strings.TrimLeft(strings.TrimPrefix(parts[1], "routes/"), "/")
+	} else if len(parts) == 2 {
+		// other resources of the app, like its routes or canaries
+		route = "-"
+	}
+	return parts[0], route
+}
+
+// route returns the route q creates, with its secrets resolved.
+func (q *queuedRequest) route() (*fnmodels.Route, error) {
+	var w fnmodels.RouteWrapper
+	if err := json.Unmarshal(q.Body, &w); err != nil || w.Route == nil {
+		return nil, fmt.Errorf("%s has no route: %v", q, err)
+	}
+	if len(q.Secrets) == 0 {
+		return w.Route, nil
+	}
+	secrets, err := resolveSecretRefs(q.SecretsDir, q.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	return withSecrets(w.Route, secrets), nil
+}
+
+type upsertKey struct{}
+
+// withUpsert marks the creation of a route made with ctx as one updating the
+// route when it exists, should it be queued.
+func withUpsert(ctx context.Context) context.Context {
+	return context.WithValue(ctx, upsertKey{}, true)
+}
+
+type secretRefsKey struct{}
+
+type secretRefs struct {
+	dir  string
+	refs map[string]string
+}
+
+// withSecretRefs tells that the route created with ctx, should it be queued,
+// is to have the secrets refs of the function file at dir resolved when
+// synced, its config lacking them.
+func withSecretRefs(ctx context.Context, dir string, refs map[string]string) context.Context {
+	return context.WithValue(ctx, secretRefsKey{}, secretRefs{dir, refs})
+}
+
+var queueMu sync.Mutex
+
+func queuePath() string {
+	return filepath.Join(fnHome(), "queue", url.PathEscape(firstNonEmpty(globals.contextName, "default"))+".jsonl")
+}
+
+// offlineRoundTrip queues req when it changes something, and fails
+// otherwise.
+func offlineRoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "GET" || req.Method == "HEAD" {
+		return nil, errOffline
+	}
+
+	q := queuedRequest{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Query:    req.URL.RawQuery,
+		QueuedAt: time.Now().UTC(),
+	}
+	q.Upsert, _ = req.Context().Value(upsertKey{}).(bool)
+	if s, ok := req.Context().Value(secretRefsKey{}).(secretRefs); ok && len(s.refs) > 0 {
+		q.Secrets, q.SecretsDir = s.refs, s.dir
+	}
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			if !json.Valid(b) {
+				return nil, fmt.Errorf("%s cannot be queued, its body is not JSON", &q)
+			}
+			q.Body = b
+		}
+	}
+	if err := appendQueue(q); err != nil {
+		return nil, err
+	}
+	logger.info("queued until fn sync", "method", q.Method, "path", q.Path)
+
+	// the request is answered with its own body, which is what the API
+	// answers for apps and routes.
+	body := []byte(q.Body)
+	if body == nil {
+		body = []byte(`{"message":"queued until fn sync"}`)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func appendQueue(q queuedRequest) error {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	b, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(queuePath()), 0700); err != nil {
+		return err
+	}
+	// the queue is rewritten whole, encrypted as the rest of the state
+	queue, err := readState(queuePath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeState(queuePath(), append(append(queue, b...), '\n'))
+}
+
+func readQueue() ([]queuedRequest, error) {
+	b, err := readState(queuePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var queue []queuedRequest
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var q queuedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &q); err != nil {
+			return nil, fmt.Errorf("%s is corrupted: %v", queuePath(), err)
+		}
+		queue = append(queue, q)
+	}
+	return queue, scanner.Err()
+}
+
+// writeQueue replaces the queue with queue, removing it when empty.
+func writeQueue(queue []queuedRequest) error {
+	if len(queue) == 0 {
+		err := os.Remove(queuePath())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, q := range queue {
+		b, err := json.Marshal(q)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(b, '\n'))
+	}
+	tmp := queuePath() + ".tmp"
+	if err := writeState(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, queuePath())
+}
+
+func syncCommand() cli.Command {
+	return cli.Command{
+		Name:  "sync",
+		Usage: "send the changes queued with --offline to the API, in order",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "list",
+				Usage: "list the queued changes instead of sending them",
+			},
+			cli.BoolFlag{
+				Name:  "discard",
+				Usage: "drop the queued changes without sending them",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if globals.offline {
+				return usageError("sync sends the queued changes to the API, it cannot be run offline")
+			}
+
+			queueMu.Lock()
+			defer queueMu.Unlock()
+			queue, err := readQueue()
+			if err != nil {
+				return err
+			}
+			switch {
+			case c.Bool("list"):
+				for _, q := range queue {
+					fmt.Println(q.QueuedAt.Local().Format(time.RFC3339), &q)
+				}
+				return nil
+			case c.Bool("discard"):
+				if err := writeQueue(nil); err != nil {
+					return err
+				}
+				progress(formatCount(int64(len(queue))), "queued changes discarded")
+				return nil
+			case len(queue) == 0:
+				progress("nothing queued")
+				return nil
+			}
+
+			s := queueSyncer{routes: routesCmd{client: apiClient()}, apps: appsCmd{client: apiClient()}}
+			report, left := s.replay(queue)
+			if err := writeQueue(left); err != nil {
+				return err
+			}
+			return report.writeAndErr()
+		},
+	}
+}
+
+type queueSyncer struct {
+	routes routesCmd
+	apps   appsCmd
+}
+
+// replay sends queue to the API in order, returning the report and the
+// requests which failed, kept for the next sync.
+func (s *queueSyncer) replay(queue []queuedRequest) (*bulkReport, []queuedRequest) {
+	report := newBulkReport("synced")
+	var left []queuedRequest
+	for _, q := range queue {
+		if err := s.send(q); err != nil {
+			report.fail(q.String(), err)
+			left = append(left, q)
+			continue
+		}
+		report.succeed(q.String())
+	}
+	return report, left
+}
+
+func (s *queueSyncer) send(q queuedRequest) error {
+	app, route := q.target()
+	switch {
+	case q.Upsert && app != "":
+		route, err := q.route()
+		if err != nil {
+			return err
+		}
+		p := deploycmd{appName: app, client: s.routes.client}
+		return p.storeRoute(cmdContext(), *route)
+	case q.Method == "PATCH" && route != "" && route != "-":
+		var w fnmodels.RouteWrapper
+		if err := json.Unmarshal(q.Body, &w); err != nil || w.Route == nil {
+			return fmt.Errorf("%s has no route: %v", &q, err)
+		}
+		return s.routes.patchRoute(cmdContext(), app, route, w.Route)
+	case q.Method == "PATCH" && app != "" && route == "":
+		var w struct {
+			App *functions.App `json:"app"`
+		}
+		if err := json.Unmarshal(q.Body, &w); err != nil {
+			return fmt.Errorf("%s has no app: %v", &q, err)
+		}
+		return s.apps.patchApp(app, w.App)
+	case q.Method == "DELETE" && route != "" && route != "-":
+		return s.routes.deleteRoute(cmdContext(), app, route)
+	}
+
+	p := q.Path
+	if q.Query != "" {
+		p += "?" + q.Query
+	}
+	var body io.Reader
+	if q.Body != nil {
+		body = bytes.NewReader(q.Body)
+	}
+	return apiCall(q.Method, p, body, nil)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOfflineQueue(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer func(offline bool) { globals.offline = offline }(globals.offline)
+	globals.offline = true
+
+	var created struct {
+		App struct {
+			Name string `json:"name"`
+		} `json:"app"`
+	}
+	if err := apiCall("POST", "/v1/apps", strings.NewReader(`{"app":{"name":"myapp"}}`), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.App.Name != "myapp" {
+		t.Errorf("expected the request to be answered with its body, got %+v", created)
+	}
+	if err := apiCall("DELETE", "/v1/apps/myapp/canaries/hello", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := apiCall("GET", "/v1/apps", nil, nil); err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Errorf("expected reads to fail offline, got %v", err)
+	}
+
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		sent = append(sent, r.Method+" "+r.URL.Path+" "+string(body))
+		if r.Method == "DELETE" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+	globals.offline = false
+
+	queue, err := readQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := queueSyncer{}
+	report, left := s.replay(queue)
+	want := []string{`POST /v1/apps {"app":{"name":"myapp"}}`, "DELETE /v1/apps/myapp/canaries/hello "}
+	if strings.Join(sent, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected the queue replayed in order, got %q", sent)
+	}
+	if report.count(bulkSucceeded) != 1 || len(left) != 1 || left[0].Method != "DELETE" {
+		t.Errorf("expected the conflicting request to be left queued, got %+v", left)
+	}
+}
+
+func TestQueuedTarget(t *testing.T) {
+	cases := []struct{ path, app, route string }{
+		{"/v1/apps", "", ""},
+		{"/v1/apps/myapp", "myapp", ""},
+		{"/v1/apps/myapp/routes", "myapp", "-"},
+		{"/v1/apps/myapp/routes/hello/world", "myapp", "/hello/world"},
+		{"/v1/apps/myapp/canaries/hello", "myapp", "-"},
+	}
+	for _, c := range cases {
+		q := queuedRequest{Path: c.path}
+		if app, route := q.target(); app != c.app || route != c.route {
+			t.Errorf("target(%s) = %s, %s, want %s, %s", c.path, app, route, c.app, c.route)
+		}
+	}
+}
+
+func TestOfflineSecrets(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer os.Unsetenv("FN_TEST_SECRET")
+	os.Setenv("FN_TEST_SECRET", "s3cr3t")
+	defer func(offline bool) { globals.offline = offline }(globals.offline)
+	globals.offline = true
+	defer func(ctx context.Context) { rootContext = ctx }(rootContext)
+
+	// as fn deploy queues the routes of functions with secrets
+	rootContext = withUpsert(withSecretRefs(context.Background(), home, map[string]string{"DB_PASSWORD": "env:FN_TEST_SECRET"}))
+	if err := apiCall("POST", "/v1/apps/myapp/routes", strings.NewReader(`{"route":{"path":"/hello","image":"user/hello"}}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(queuePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cr3t") || !strings.Contains(string(b), "env:FN_TEST_SECRET") {
+		t.Errorf("expected the secret queued as its reference, got %s", b)
+	}
+
+	queue, err := readQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || !queue[0].Upsert {
+		t.Fatalf("expected the route queued, got %+v", queue)
+	}
+	route, err := queue[0].route()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.Path != "/hello" || route.Config["DB_PASSWORD"] != "s3cr3t" {
+		t.Errorf("expected the secret resolved when synced, got %+v", route)
+	}
+}
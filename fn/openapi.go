@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// openapiSpec is what fn init --from-openapi reads of OpenAPI 3 and Swagger 2
+// documents, in YAML or JSON.
+type openapiSpec struct {
+	Swagger  string `yaml:"swagger"`
+	OpenAPI  string `yaml:"openapi"`
+	BasePath string `yaml:"basePath"`
+	Servers  []struct {
+		URL string `yaml:"url"`
+	} `yaml:"servers"`
+	Paths       map[string]openapiPathItem `yaml:"paths"`
+	Definitions map[string]*openapiSchema  `yaml:"definitions"`
+	Components  struct {
+		Schemas map[string]*openapiSchema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type openapiPathItem struct {
+	Get     *openapiOperation `yaml:"get"`
+	Put     *openapiOperation `yaml:"put"`
+	Post    *openapiOperation `yaml:"post"`
+	Delete  *openapiOperation `yaml:"delete"`
+	Options *openapiOperation `yaml:"options"`
+	Head    *openapiOperation `yaml:"head"`
+	Patch   *openapiOperation `yaml:"patch"`
+}
+
+type openapiOperation struct {
+	OperationID string `yaml:"operationId"`
+	// Parameters carry the body of Swagger 2 operations, RequestBody that of
+	// OpenAPI 3 ones.
+	Parameters []struct {
+		In     string         `yaml:"in"`
+		Schema *openapiSchema `yaml:"schema"`
+	} `yaml:"parameters"`
+	RequestBody *struct {
+		Content map[string]openapiMedia `yaml:"content"`
+	} `yaml:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]openapiMedia `yaml:"content"`
+		Schema  *openapiSchema          `yaml:"schema"`
+	} `yaml:"responses"`
+}
+
+type openapiMedia struct {
+	Schema *openapiSchema `yaml:"schema"`
+}
+
+type openapiSchema struct {
+	Ref         string                    `yaml:"$ref"`
+	Type        string                    `yaml:"type"`
+	Format      string                    `yaml:"format"`
+	Description string                    `yaml:"description"`
+	Properties  map[string]*openapiSchema `yaml:"properties"`
+	Items       *openapiSchema            `yaml:"items"`
+	Required    []string                  `yaml:"required"`
+}
+
+// openapiOp is an operation of the spec, with its method and path.
+type openapiOp struct {
+	method, path string
+	*openapiOperation
+}
+
+// openapiModel is a named schema of the requests and responses of operations.
+type openapiModel struct {
+	name   string
+	schema *openapiSchema
+}
+
+func loadOpenAPI(path string) (*openapiSpec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON documents are YAML ones too
+	var spec openapiSpec
+	if err := yaml.Unmarshal(b, &spec); err != nil {
+		return nil, fmt.Errorf("could not read the OpenAPI document %s: %v", path, err)
+	}
+	if spec.Swagger == "" && spec.OpenAPI == "" {
+		return nil, usageError("%s is not an OpenAPI or Swagger document", path)
+	}
+	if len(spec.Paths) == 0 {
+		return nil, usageError("%s has no paths", path)
+	}
+	return &spec, nil
+}
+
+// basePath is the path the paths of the spec are relative to.
+func (s *openapiSpec) basePath() string {
+	base := s.BasePath
+	if len(s.Servers) > 0 {
+		if u, err := url.Parse(s.Servers[0].URL); err == nil {
+			base = u.Path
+		}
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+// operations are those of the spec, by path then method.
+func (s *openapiSpec) operations() []openapiOp {
+	var paths []string
+	for p := range s.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var ops []openapiOp
+	for _, p := range paths {
+		item := s.Paths[p]
+		for _, m := range []struct {
+			method string
+			op     *openapiOperation
+		}{
+			{"GET", item.Get}, {"PUT", item.Put}, {"POST", item.Post}, {"DELETE", item.Delete},
+			{"OPTIONS", item.Options}, {"HEAD", item.Head}, {"PATCH", item.Patch},
+		} {
+			if m.op != nil {
+				ops = append(ops, openapiOp{m.method, p, m.op})
+			}
+		}
+	}
+	return ops
+}
+
+var openapiParam = regexp.MustCompile(`\{([^}/]+)\}`)
+
+// routePath is the route of an OpenAPI path, whose {parameters} are :params
+// the function is told as $PARAM_<NAME>.
+func routePath(base, path string) string {
+	return base + openapiParam.ReplaceAllString(path, ":$1")
+}
+
+// pathSlug names the function of a path, like users-id for /users/{id}.
+func pathSlug(path string) string {
+	slug := strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(path), "-"), "-")
+	if slug == "" {
+		return "root"
+	}
+	return slug
+}
+
+// exportName turns words separated by anything else than letters and digits
+// into a CamelCase name.
+func exportName(s string) string {
+	var b bytes.Buffer
+	for _, w := range regexp.MustCompile(`[^A-Za-z0-9]+`).Split(s, -1) {
+		if w != "" {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+func (op openapiOp) id() string {
+	if op.OperationID != "" {
+		return op.OperationID
+	}
+	return strings.ToLower(op.method) + " " + op.path
+}
+
+func (op openapiOp) requestSchema() *openapiSchema {
+	if op.RequestBody != nil {
+		return mediaSchema(op.RequestBody.Content)
+	}
+	for _, p := range op.Parameters {
+		if p.In == "body" {
+			return p.Schema
+		}
+	}
+	return nil
+}
+
+// responseSchema is that of the first successful response.
+func (op openapiOp) responseSchema() *openapiSchema {
+	var codes []string
+	for code := range op.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		r := op.Responses[code]
+		if r.Schema != nil {
+			return r.Schema
+		}
+		if s := mediaSchema(r.Content); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// mediaSchema is the schema of JSON content, or else of the first one.
+func mediaSchema(content map[string]openapiMedia) *openapiSchema {
+	if m, ok := content["application/json"]; ok {
+		return m.Schema
+	}
+	var types []string
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if content[t].Schema != nil {
+			return content[t].Schema
+		}
+	}
+	return nil
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// models are the schemas of the requests and responses of the operations:
+// those they refer to, directly or not, and inline objects, named after
+// their operation.
+func (s *openapiSpec) models(ops []openapiOp) []openapiModel {
+	defs := s.Components.Schemas
+	if len(defs) == 0 {
+		defs = s.Definitions
+	}
+
+	var models []openapiModel
+	seen := make(map[string]bool)
+	var walk func(sch *openapiSchema)
+	add := func(name string, sch *openapiSchema) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		models = append(models, openapiModel{name, sch})
+		var props []string
+		for p := range sch.Properties {
+			props = append(props, p)
+		}
+		sort.Strings(props)
+		for _, p := range props {
+			walk(sch.Properties[p])
+		}
+	}
+	walk = func(sch *openapiSchema) {
+		switch {
+		case sch == nil:
+		case sch.Ref != "":
+			if def, ok := defs[refName(sch.Ref)]; ok && def != nil {
+				add(exportName(refName(sch.Ref)), def)
+			}
+		case sch.Items != nil:
+			walk(sch.Items)
+		}
+	}
+
+	for _, op := range ops {
+		for suffix, sch := range map[string]*openapiSchema{"Request": op.requestSchema(), "Response": op.responseSchema()} {
+			if sch != nil && sch.Ref == "" && len(sch.Properties) > 0 {
+				add(exportName(op.id())+suffix, sch)
+			} else {
+				walk(sch)
+			}
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].name < models[j].name })
+	return models
+}
+
+// modelStub writes the models of a function in its runtime.
+type modelStub struct {
+	file  string
+	write func(models []openapiModel) ([]byte, error)
+}
+
+var modelStubs = map[string]modelStub{
+	"go":     {"models.go", goModels},
+	"node":   {"models.js", nodeModels},
+	"python": {"models.py", pythonModels},
+}
+
+func schemaProps(sch *openapiSchema) (props []string, required map[string]bool) {
+	for p := range sch.Properties {
+		props = append(props, p)
+	}
+	sort.Strings(props)
+	required = make(map[string]bool)
+	for _, r := range sch.Required {
+		required[r] = true
+	}
+	return props, required
+}
+
+func goType(s *openapiSchema) string {
+	if s == nil {
+		return "interface{}"
+	}
+	if s.Ref != "" {
+		return exportName(refName(s.Ref))
+	}
+	switch s.Type {
+	case "string":
+		return "string"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + goType(s.Items)
+	case "object":
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+func goModels(models []openapiModel) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("package main\n\n// Models of the requests and responses of the function, generated by fn\n// init --from-openapi.\n")
+	for _, m := range models {
+		b.WriteString("\n")
+		if m.schema.Description != "" {
+			fmt.Fprintf(&b, "// %s is %s\n", m.name, m.schema.Description)
+		}
+		fmt.Fprintf(&b, "type %s struct {\n", m.name)
+		props, required := schemaProps(m.schema)
+		for _, p := range props {
+			tag := p
+			if !required[p] {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "%s %s `json:%q`\n", exportName(p), goType(m.schema.Properties[p]), tag)
+		}
+		b.WriteString("}\n")
+	}
+	return format.Source(b.Bytes())
+}
+
+func jsType(s *openapiSchema) string {
+	if s == nil {
+		return "*"
+	}
+	if s.Ref != "" {
+		return exportName(refName(s.Ref))
+	}
+	switch s.Type {
+	case "string", "boolean":
+		return s.Type
+	case "integer", "number":
+		return "number"
+	case "array":
+		return "Array<" + jsType(s.Items) + ">"
+	case "object":
+		return "Object"
+	}
+	return "*"
+}
+
+func nodeModels(models []openapiModel) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("// Models of the requests and responses of the function, generated by fn\n// init --from-openapi.\n")
+	for _, m := range models {
+		fmt.Fprintf(&b, "\n/**\n")
+		if m.schema.Description != "" {
+			fmt.Fprintf(&b, " * %s\n", m.schema.Description)
+		}
+		fmt.Fprintf(&b, " * @typedef {Object} %s\n", m.name)
+		props, required := schemaProps(m.schema)
+		for _, p := range props {
+			name := p
+			if !required[p] {
+				name = "[" + p + "]"
+			}
+			fmt.Fprintf(&b, " * @property {%s} %s\n", jsType(m.schema.Properties[p]), name)
+		}
+		b.WriteString(" */\n")
+	}
+	b.WriteString("\nmodule.exports = {};\n")
+	return b.Bytes(), nil
+}
+
+func pythonModels(models []openapiModel) ([]byte, error) {
+	ident := regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	var b bytes.Buffer
+	b.WriteString("\"\"\"Models of the requests and responses of the function, generated by fn\ninit --from-openapi.\"\"\"\n")
+	for _, m := range models {
+		fmt.Fprintf(&b, "\n\nclass %s(object):\n", m.name)
+		if m.schema.Description != "" {
+			fmt.Fprintf(&b, "    \"\"\"%s\"\"\"\n\n", m.schema.Description)
+		}
+		props, _ := schemaProps(m.schema)
+		var params []string
+		for _, p := range props {
+			params = append(params, ident.ReplaceAllString(p, "_")+"=None")
+		}
+		fmt.Fprintf(&b, "    def __init__(self%s):\n", strings.Join(append([]string{""}, params...), ", "))
+		if len(props) == 0 {
+			b.WriteString("        pass\n")
+		}
+		for _, p := range props {
+			p = ident.ReplaceAllString(p, "_")
+			fmt.Fprintf(&b, "        self.%s = %s\n", p, p)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// openapiFunction is a function fn init --from-openapi generates, serving
+// the operations of its routes.
+type openapiFunction struct {
+	dir    string
+	name   string
+	routes []string
+	ops    []openapiOp
+}
+
+// openapiFunctions are the functions of the spec: one by path, its
+// operations being served by the same route as routes are matched whatever
+// the method, or a single one serving them all in dir.
+func openapiFunctions(spec *openapiSpec, dir, name string, single bool) []openapiFunction {
+	base := spec.basePath()
+	var fns []openapiFunction
+	for _, op := range spec.operations() {
+		route := routePath(base, op.path)
+		if single {
+			if len(fns) == 0 {
+				fns = append(fns, openapiFunction{dir: dir, name: name})
+			}
+		} else if len(fns) == 0 || fns[len(fns)-1].routes[0] != route {
+			slug := pathSlug(op.path)
+			fns = append(fns, openapiFunction{dir: filepath.Join(dir, slug), name: name + "-" + slug})
+		}
+		fn := &fns[len(fns)-1]
+		if len(fn.routes) == 0 || fn.routes[len(fn.routes)-1] != route {
+			fn.routes = append(fn.routes, route)
+		}
+		fn.ops = append(fn.ops, op)
+	}
+	return fns
+}
+
+// writeOpenAPIFunction writes the function file, scaffold and model stubs of
+// the function, leaving the files which exist already as they are, and
+// returns the paths of those it wrote.
+func (a *initFnCmd) writeOpenAPIFunction(spec *openapiSpec, fn openapiFunction) ([]string, error) {
+	if err := os.MkdirAll(fn.dir, 0755); err != nil {
+		return nil, err
+	}
+	var written []string
+	ffPath := filepath.Join(fn.dir, "func.yaml")
+	if a.force || !exists(ffPath) {
+		ff := &funcfile{
+			Name:       fn.name,
+			Runtime:    &a.runtime,
+			Version:    initialVersion,
+			Entrypoint: &a.entrypoint,
+			Paths:      fn.routes,
+		}
+		if a.format != "" {
+			ff.Format = &a.format
+		}
+		if err := ffile.EncodeYAML(ffPath, ff); err != nil {
+			return nil, err
+		}
+		written = append(written, ffPath)
+	}
+
+	names, err := writeScaffold(fn.dir, a.runtime, a.templateDir, scaffoldData{
+		Name:       fn.name,
+		Runtime:    a.runtime,
+		Entrypoint: a.entrypoint,
+		Package:    templatePackage(fn.name),
+		Author:     templateAuthor(),
+	})
+	for _, name := range names {
+		written = append(written, filepath.Join(fn.dir, name))
+	}
+	if err != nil {
+		return written, err
+	}
+
+	stub, ok := modelStubs[a.runtime]
+	models := spec.models(fn.ops)
+	if !ok || len(models) == 0 || exists(filepath.Join(fn.dir, stub.file)) {
+		return written, nil
+	}
+	b, err := stub.write(models)
+	if err != nil {
+		return written, err
+	}
+	path := filepath.Join(fn.dir, stub.file)
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return written, err
+	}
+	return append(written, path), nil
+}
+
+// initFromOpenAPI generates the functions of the operations of an OpenAPI
+// document, their routes being those of their function files.
+func (a *initFnCmd) initFromOpenAPI(c *cli.Context) error {
+	if err := a.parseName(c); err != nil {
+		return err
+	}
+	s, ok := scaffolds[a.runtime]
+	if !ok {
+		var names []string
+		for rt := range scaffolds {
+			names = append(names, rt)
+		}
+		sort.Strings(names)
+		return usageError("--from-openapi needs the --runtime of the functions, one of %s", strings.Join(names, ", "))
+	}
+	if a.entrypoint == "" {
+		a.entrypoint = s.entrypoint
+	}
+
+	spec, err := loadOpenAPI(a.fromOpenAPI)
+	if err != nil {
+		return err
+	}
+	fns := openapiFunctions(spec, ".", a.name, a.single)
+	for _, fn := range fns {
+		written, err := a.writeOpenAPIFunction(spec, fn)
+		for _, path := range written {
+			fmt.Println(path, "created.")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d functions serving %d operations, create their routes with `fn deploy --all <app>`.\n", len(fns), len(spec.operations()))
+	return nil
+}
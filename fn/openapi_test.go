@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+)
+
+const petstoreSwagger = `swagger: "2.0"
+basePath: /v1
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        200:
+          schema:
+            type: array
+            items:
+              $ref: "#/definitions/Pet"
+    post:
+      operationId: createPet
+      parameters:
+      - in: body
+        name: pet
+        schema:
+          type: object
+          required: [name]
+          properties:
+            name:
+              type: string
+            tag:
+              type: string
+  /pets/{petId}:
+    parameters:
+    - name: petId
+      in: path
+    get:
+      operationId: showPetById
+      responses:
+        "200":
+          schema:
+            $ref: "#/definitions/Pet"
+definitions:
+  Pet:
+    type: object
+    required: [id, name]
+    properties:
+      id:
+        type: integer
+        format: int64
+      name:
+        type: string
+      owner:
+        $ref: "#/definitions/Owner"
+  Owner:
+    type: object
+    properties:
+      email:
+        type: string
+`
+
+const petstoreOpenAPI = `{
+  "openapi": "3.0.0",
+  "servers": [{"url": "https://api.acme.com/v2"}],
+  "paths": {
+    "/pets/{petId}": {
+      "delete": {"operationId": "deletePet", "responses": {"204": {}}},
+      "get": {
+        "operationId": "showPetById",
+        "responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Pet": {"type": "object", "properties": {"id": {"type": "integer"}, "tags": {"type": "array", "items": {"type": "string"}}}}
+    }
+  }
+}`
+
+func writeSpec(t *testing.T, dir, name, spec string) *openapiSpec {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadOpenAPI(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOpenAPIFunctions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	swagger := writeSpec(t, dir, "swagger.yaml", petstoreSwagger)
+	fns := openapiFunctions(swagger, "api", "acme/pets", false)
+	if len(fns) != 2 {
+		t.Fatalf("openapiFunctions() = %+v, want a function by path", fns)
+	}
+	for i, want := range []openapiFunction{
+		{dir: filepath.Join("api", "pets"), name: "acme/pets-pets", routes: []string{"/v1/pets"}},
+		{dir: filepath.Join("api", "pets-petid"), name: "acme/pets-pets-petid", routes: []string{"/v1/pets/:petId"}},
+	} {
+		got := fns[i]
+		got.ops = nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("function %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if len(fns[0].ops) != 2 || fns[0].ops[0].method != "GET" || fns[0].ops[1].method != "POST" {
+		t.Errorf("operations of /pets = %+v, want GET and POST", fns[0].ops)
+	}
+
+	var names []string
+	for _, m := range swagger.models(fns[0].ops) {
+		names = append(names, m.name)
+	}
+	if want := []string{"CreatePetRequest", "Owner", "Pet"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("models() = %v, want %v", names, want)
+	}
+
+	single := openapiFunctions(swagger, ".", "acme/pets", true)
+	if len(single) != 1 || !reflect.DeepEqual(single[0].routes, []string{"/v1/pets", "/v1/pets/:petId"}) || len(single[0].ops) != 3 {
+		t.Errorf("openapiFunctions() of a single function = %+v", single)
+	}
+
+	openapi := writeSpec(t, dir, "openapi.json", petstoreOpenAPI)
+	fns = openapiFunctions(openapi, ".", "acme/pets", false)
+	if len(fns) != 1 || !reflect.DeepEqual(fns[0].routes, []string{"/v2/pets/:petId"}) || len(fns[0].ops) != 2 {
+		t.Errorf("openapiFunctions() of OpenAPI 3 = %+v", fns)
+	}
+}
+
+func TestOpenAPIModelStubs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec := writeSpec(t, dir, "swagger.yaml", petstoreSwagger)
+	models := spec.models(spec.operations())
+
+	b, err := goModels(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"type Pet struct {\n\tId    int64  `json:\"id\"`\n\tName  string `json:\"name\"`\n\tOwner Owner  `json:\"owner,omitempty\"`\n}",
+		"type CreatePetRequest struct {",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("goModels() = %s, want it to contain %q", b, want)
+		}
+	}
+
+	b, err = nodeModels(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " * @typedef {Object} Pet\n * @property {number} id\n * @property {string} name\n * @property {Owner} [owner]\n"; !strings.Contains(string(b), want) {
+		t.Errorf("nodeModels() = %s, want it to contain %q", b, want)
+	}
+
+	b, err = pythonModels(models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "class Pet(object):\n    def __init__(self, id=None, name=None, owner=None):\n        self.id = id\n"; !strings.Contains(string(b), want) {
+		t.Errorf("pythonModels() = %s, want it to contain %q", b, want)
+	}
+}
+
+func TestWriteOpenAPIFunction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec := writeSpec(t, dir, "swagger.yaml", petstoreSwagger)
+	a := &initFnCmd{runtime: "go", entrypoint: "./func", templateDir: filepath.Join(dir, "none")}
+	fn := openapiFunctions(spec, dir, "acme/pets", false)[1]
+	written, err := a.writeOpenAPIFunction(spec, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"func.yaml", "func.go", "models.go"} {
+		found := false
+		for _, path := range written {
+			found = found || path == filepath.Join(fn.dir, name)
+		}
+		if !found {
+			t.Errorf("writeOpenAPIFunction() wrote %v, want %s", written, name)
+		}
+	}
+
+	ff, err := ffile.Decode(filepath.Join(fn.dir, "func.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Name != "acme/pets-pets-petid" || !reflect.DeepEqual(ff.Paths, []string{"/v1/pets/:petId"}) {
+		t.Errorf("func.yaml = %+v, want the name and route of the path", ff)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	vers "github.com/iron-io/functions/api/version"
+	"github.com/urfave/cli"
+)
+
+// With FN_OTEL_ENDPOINT set, fn traces what it does with OpenTelemetry: a
+// span for the command run, with child spans for the requests it makes, the
+// functions deploys go through, their stages and the routes they update. The
+// spans are sent to the OTLP/HTTP endpoint, in JSON, once the command is
+// over. Requests carry the W3C traceparent header, for the spans of the
+// server, and of functions called with fn call, to join the trace; fn joins
+// the trace given in TRACEPARENT itself, eg. by the CI running it.
+
+const exportTimeout = 5 * time.Second
+
+// Kinds and status codes of spans, as OTLP numbers them.
+const (
+	spanInternal = 1
+	spanClient   = 3
+
+	statusOK    = 1
+	statusError = 2
+)
+
+type span struct {
+	traceID [16]byte
+	id      [8]byte
+	parent  [8]byte
+	name    string
+	kind    int
+	start   time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs map[string]interface{}
+	err   string
+}
+
+type spanTracer struct {
+	endpoint string
+	headers  http.Header
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// tracer collects the spans of the command, nil when tracing is off.
+var tracer *spanTracer
+
+// commandSpan is the span of the command run.
+var commandSpan *span
+
+func setupTracing() error {
+	endpoint := os.Getenv("FN_OTEL_ENDPOINT")
+	if endpoint == "" {
+		return nil
+	}
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+	headers := make(http.Header)
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return usageError("invalid OTEL_EXPORTER_OTLP_HEADERS %q, expected key=value pairs separated by commas", kv)
+		}
+		headers.Set(strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:]))
+	}
+	tracer = &spanTracer{endpoint: endpoint, headers: headers}
+	return nil
+}
+
+type spanKey struct{}
+
+// startSpan starts a span named name, child of the span of ctx if any, and
+// returns a context carrying it. When tracing is off, the span is nil, which
+// is fine to use.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	s := &span{name: name, kind: kind, start: time.Now(), attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parent = parent.traceID, parent.id
+	} else if traceID, parentID, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		s.traceID, s.parent = traceID, parentID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.id[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// startCommandSpan starts the span of the command c runs, for the work it
+// does to be traced within.
+func startCommandSpan(c *cli.Context) {
+	name := c.App.Name
+	cmds := c.App.Commands
+	for _, arg := range c.Args() {
+		cmd := findCommand(cmds, arg)
+		if cmd == nil {
+			break
+		}
+		name += " " + cmd.Name
+		cmds = cmd.Subcommands
+	}
+	rootContext, commandSpan = startSpan(rootContext, name, spanInternal)
+	if globals.contextName != "" {
+		commandSpan.set("fn.context", globals.contextName)
+	}
+}
+
+func (s *span) set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// finish ends the span, failed when err is not nil.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	tracer.spans = append(tracer.spans, s)
+}
+
+// traceparent is the W3C header telling the span s to those it calls.
+func (s *span) traceparent() string {
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.id[:]) + "-01"
+}
+
+func parseTraceparent(h string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return traceID, spanID, false
+	}
+	return traceID, spanID, traceID != [16]byte{} && spanID != [8]byte{}
+}
+
+// spanTransport traces the requests going through it, telling the server
+// the span they are made in.
+type spanTransport struct {
+	next http.RoundTripper
+}
+
+func (t spanTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, s := startSpan(req.Context(), req.Method+" "+req.URL.Path, spanClient)
+	if s == nil {
+		return t.next.RoundTrip(req)
+	}
+	s.set("http.method", req.Method)
+	s.set("http.url", req.URL.String())
+	r := req.WithContext(ctx)
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Traceparent", s.traceparent())
+
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		s.finish(err)
+		return nil, err
+	}
+	s.set("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		s.finish(fmt.Errorf("%s", resp.Status))
+	} else {
+		s.finish(nil)
+	}
+	return resp, nil
+}
+
+// exportSpans sends the spans collected to the endpoint. Failing to is not
+// an error of the command, but is logged.
+func exportSpans() {
+	if tracer == nil {
+		return
+	}
+	tracer.mu.Lock()
+	spans := tracer.spans
+	tracer.spans = nil
+	tracer.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		logger.warn("could not encode the spans", "error", err)
+		return
+	}
+	req, err := http.NewRequest("POST", tracer.endpoint, bytes.NewReader(body))
+	if err != nil {
+		logger.warn("could not send the spans", "error", err)
+		return
+	}
+	for k, v := range tracer.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// the context of the command may be cancelled already
+	resp, err := (&http.Client{Timeout: exportTimeout}).Do(req)
+	if err != nil {
+		logger.warn("could not send the spans", "endpoint", tracer.endpoint, "error", err)
+		return
+	}
+	defer drainBody(resp.Body)
+	if resp.StatusCode >= 300 {
+		logger.warn("could not send the spans", "endpoint", tracer.endpoint, "status", resp.Status)
+		return
+	}
+	logger.debug("spans sent", "endpoint", tracer.endpoint, "count", len(spans))
+}
+
+// otlpRequest encodes spans as an OTLP/HTTP JSON export request.
+func otlpRequest(spans []*span) interface{} {
+	type m = map[string]interface{}
+	encoded := make([]m, len(spans))
+	for i, s := range spans {
+		e := m{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.id[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            m{"code": statusOK},
+		}
+		if s.parent != [8]byte{} {
+			e["parentSpanId"] = hex.EncodeToString(s.parent[:])
+		}
+		if s.err != "" {
+			e["status"] = m{"code": statusError, "message": s.err}
+		}
+		encoded[i] = e
+	}
+	return m{"resourceSpans": []m{{
+		"resource": m{"attributes": otlpAttributes(map[string]interface{}{
+			"service.name":    "fn",
+			"service.version": vers.Version,
+		})},
+		"scopeSpans": []m{{
+			"scope": m{"name": "fn", "version": vers.Version},
+			"spans": encoded,
+		}},
+	}}}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	encoded := make([]interface{}, 0, len(attrs))
+	for _, k := range keys {
+		var value interface{}
+		switch v := attrs[k].(type) {
+		case int:
+			// 64 bit integers are strings in OTLP JSON
+			value = map[string]string{"intValue": strconv.Itoa(v)}
+		case bool:
+			value = map[string]bool{"boolValue": v}
+		default:
+			value = map[string]string{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": k, "value": value})
+	}
+	return encoded
+}
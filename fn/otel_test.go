@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	ctx, s := startSpan(context.Background(), "fn", spanInternal)
+	if s != nil || ctx.Value(spanKey{}) != nil {
+		t.Fatal("a span was started with tracing off")
+	}
+
+	h := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID, spanID, ok := parseTraceparent(h)
+	if !ok {
+		t.Fatalf("%s not parsed", h)
+	}
+	s = &span{traceID: traceID, id: spanID}
+	if s.traceparent() != h {
+		t.Errorf("got %s, want %s", s.traceparent(), h)
+	}
+	for _, h := range []string{"", "00-abc-def-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		if _, _, ok := parseTraceparent(h); ok {
+			t.Errorf("%q parsed", h)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	type otlpSpan struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Status       struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	var (
+		exported []otlpSpan
+		auth     string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("spans sent to %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				exported = append(exported, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	var traceparent string
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		io.WriteString(w, "Hello World!")
+	}))
+	defer function.Close()
+
+	defer os.Setenv("FN_OTEL_ENDPOINT", os.Getenv("FN_OTEL_ENDPOINT"))
+	defer os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	os.Setenv("FN_OTEL_ENDPOINT", collector.URL)
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer secret")
+	defer func() { tracer, commandSpan = nil, nil }()
+	defer func(ctx context.Context) { rootContext = ctx }(rootContext)
+	defer func(t http.RoundTripper) { transport = t }(transport)
+	if err := setupTracing(); err != nil {
+		t.Fatal(err)
+	}
+	transport = spanTransport{next: http.DefaultTransport}
+
+	rootContext, commandSpan = startSpan(context.Background(), "fn deploy", spanInternal)
+	p := &deploycmd{verbwriter: ioutil.Discard}
+	err := p.stage(cmdContext(), "hello/func.yaml", &deployRecord{Funcfile: "hello/func.yaml"}, stageHealthcheck, func(ctx context.Context, _ io.Writer) error {
+		req, err := newCallRequest(function.URL, nil, callOptions{})
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient().Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		return drainBody(resp.Body)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commandSpan.finish(nil)
+	exportSpans()
+
+	if len(exported) != 3 {
+		t.Fatalf("expected the spans of the command, the stage and the call, got %+v", exported)
+	}
+	call, stage, command := exported[0], exported[1], exported[2]
+	if command.Name != "fn deploy" || stage.Name != "healthcheck" || !strings.HasPrefix(call.Name, "GET ") {
+		t.Errorf("unexpected spans %+v", exported)
+	}
+	if command.ParentSpanID != "" || stage.ParentSpanID != command.SpanID || call.ParentSpanID != stage.SpanID {
+		t.Errorf("spans not nested: %+v", exported)
+	}
+	if call.TraceID != command.TraceID || stage.TraceID != command.TraceID || call.Status.Code != statusOK {
+		t.Errorf("spans not of the same trace: %+v", exported)
+	}
+	if want := "00-" + call.TraceID + "-" + call.SpanID + "-01"; traceparent != want {
+		t.Errorf("the function got traceparent %q, want %q", traceparent, want)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("the headers of OTEL_EXPORTER_OTLP_HEADERS were not sent, got %q", auth)
+	}
+}
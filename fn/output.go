@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// What commands print is either data, written to stdout for scripts to read,
+// or commentary on what they do, written to stderr: progress, which --quiet
+// silences, warnings and errors. Commentary is colored on terminals, unless
+// --no-color or $NO_COLOR say otherwise.
+
+const (
+	colorRed   = "31"
+	colorGreen = "32"
+)
+
+// progress writes a line telling what a command does or did, unless --quiet.
+func progress(a ...interface{}) {
+	if !globals.quiet {
+		fmt.Fprintln(os.Stderr, a...)
+	}
+}
+
+func progressf(format string, a ...interface{}) {
+	if !globals.quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+// colorStderr tells whether what is written to stderr is colored.
+func colorStderr() bool {
+	return !globals.noColor && os.Getenv("TERM") != "dumb" && isTerminal(int(os.Stderr.Fd()))
+}
+
+// colored returns s in color when stderr is colored, as it is otherwise.
+func colored(color, s string) string {
+	if !colorStderr() {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
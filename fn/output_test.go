@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	defer func(quiet bool) { globals.quiet = quiet }(globals.quiet)
+	defer func(stderr *os.File) { os.Stderr = stderr }(os.Stderr)
+	f, err := ioutil.TempFile("", "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	os.Stderr = f
+
+	progress("myapp", "/hello", "created")
+	globals.quiet = true
+	progressf("%s %s deleted\n", "myapp", "/hello")
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "myapp /hello created\n" {
+		t.Errorf("expected the progress written to stderr unless quiet, got %q", b)
+	}
+}
+
+func TestColored(t *testing.T) {
+	// stderr is not a terminal when testing
+	if got := colored(colorRed, "error: boom"); got != "error: boom" {
+		t.Errorf("colored() = %q, want the text uncolored", got)
+	}
+}
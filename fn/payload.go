@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// requestFlags are the flags shaping the request sent to a function, be it
+// run locally or called remotely.
+func requestFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "header,H",
+			Usage: "add a header to the request, eg. 'X-Foo: bar'",
+		},
+		cli.StringSliceFlag{
+			Name:  "query,q",
+			Usage: "add a `key=value` query parameter to the request",
+		},
+		cli.StringFlag{
+			Name:  "data,d",
+			Usage: "send `string` as the payload",
+		},
+		cli.StringFlag{
+			Name:  "body-file",
+			Usage: "send the content of `file` as the payload, - for stdin",
+		},
+		cli.StringSliceFlag{
+			Name:  "form,F",
+			Usage: "send a multipart form with this `field=value` - a value starting with @ is a file to upload, eg. image=@photo.png",
+		},
+	}
+}
+
+func headersAndQuery(c *cli.Context) (http.Header, url.Values, error) {
+	headers := make(http.Header)
+	for _, h := range c.StringSlice("header") {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, nil, usageError("invalid header %q, expected 'Name: value'", h)
+		}
+		headers.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	query := make(url.Values)
+	for _, q := range c.StringSlice("query") {
+		kv := strings.SplitN(q, "=", 2)
+		if kv[0] == "" {
+			return nil, nil, usageError("invalid query parameter %q, expected key=value", q)
+		}
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		query.Add(kv[0], kv[1])
+	}
+	return headers, query, nil
+}
+
+// payload returns the body to send to a function, along with its content
+// type when known, from the payload flags or else stdin. Payloads are streamed
+// rather than loaded in memory: files are sent with their size, pipes and
+// forms chunked.
+func payload(c *cli.Context) (io.Reader, string, error) {
+	set := 0
+	for _, name := range []string{"data", "body-file", "form"} {
+		if c.IsSet(name) {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, "", usageError("only one of --data, --body-file and --form can be used")
+	}
+
+	switch {
+	case c.IsSet("data"):
+		return strings.NewReader(c.String("data")), "", nil
+	case c.IsSet("body-file"):
+		if c.String("body-file") == "-" {
+			return os.Stdin, "", nil
+		}
+		f, err := os.Open(c.String("body-file"))
+		if err != nil {
+			return nil, "", err
+		}
+		return f, "", nil
+	case c.IsSet("form"):
+		return multipartForm(c.StringSlice("form"))
+	}
+	return stdin(), "", nil
+}
+
+// bodySize returns the size of what is left to read of r when it is in
+// memory or a regular file, eg. stdin redirected from one, 0 otherwise.
+func bodySize(r io.Reader) int64 {
+	if l, ok := r.(interface{ Len() int }); ok {
+		return int64(l.Len())
+	}
+	f, ok := r.(*os.File)
+	if !ok {
+		return 0
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil || offset > info.Size() {
+		return 0
+	}
+	return info.Size() - offset
+}
+
+func multipartForm(fields []string) (io.Reader, string, error) {
+	type part struct{ name, value, file string }
+	var parts []part
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, "", usageError("invalid form field %q, expected field=value or field=@file", field)
+		}
+		p := part{name: kv[0], value: kv[1]}
+		if strings.HasPrefix(p.value, "@") {
+			p.file = p.value[1:]
+			if _, err := os.Stat(p.file); err != nil {
+				return nil, "", err
+			}
+		}
+		parts = append(parts, p)
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		for _, p := range parts {
+			if p.file == "" {
+				if err := mw.WriteField(p.name, p.value); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				continue
+			}
+
+			w, err := mw.CreateFormFile(p.name, filepath.Base(p.file))
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			f, err := os.Open(p.file)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(w, f)
+			f.Close()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+	return pr, mw.FormDataContentType(), nil
+}
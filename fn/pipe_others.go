@@ -0,0 +1,25 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleBrokenPipe keeps the runtime from killing fn with SIGPIPE when its
+// output is closed early, eg. piped into head. Writes then fail with EPIPE
+// instead, which fn treats as the reader being done with it.
+func handleBrokenPipe() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGPIPE)
+	go func() {
+		for range c {
+		}
+	}()
+}
+
+func isBrokenPipeErrno(errno syscall.Errno) bool {
+	return errno == syscall.EPIPE
+}
@@ -0,0 +1,14 @@
+// +build windows
+
+package main
+
+import "syscall"
+
+func handleBrokenPipe() {}
+
+// ERROR_NO_DATA, "the pipe is being closed"
+const errorNoData syscall.Errno = 232
+
+func isBrokenPipeErrno(errno syscall.Errno) bool {
+	return errno == syscall.ERROR_BROKEN_PIPE || errno == errorNoData || errno == syscall.EPIPE
+}
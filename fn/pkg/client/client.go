@@ -0,0 +1,254 @@
+// Package client manages the routes of an IronFunctions server the way fn
+// does: updates are patches merged into the route as it is on the server,
+// and changes made by someone else meanwhile to the same fields are reported
+// as conflicts rather than overwritten.
+//
+// Errors of the API are returned as the swagger client of functions_go
+// returns them, but for conflicts, which are a *ConflictError.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	fnclient "github.com/iron-io/functions_go/client"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	"github.com/iron-io/functions_go/models"
+)
+
+// Client manages routes through api.
+type Client struct {
+	api *fnclient.Functions
+}
+
+// New returns a client managing routes through api.
+func New(api *fnclient.Functions) *Client {
+	return &Client{api: api}
+}
+
+// Route returns the route of app at path.
+func (c *Client) Route(ctx context.Context, app, path string) (*models.Route, error) {
+	resp, err := c.api.Routes.GetAppsAppRoutesRoute(&apiroutes.GetAppsAppRoutesRouteParams{
+		Context: ctx,
+		App:     app,
+		Route:   path,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload.Route, nil
+}
+
+// CreateRoute creates r in app, returning the route as stored.
+func (c *Client) CreateRoute(ctx context.Context, app string, r *models.Route) (*models.Route, error) {
+	resp, err := c.api.Routes.PostAppsAppRoutes(&apiroutes.PostAppsAppRoutesParams{
+		Context: ctx,
+		App:     app,
+		Body:    &models.RouteWrapper{Route: r},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload.Route, nil
+}
+
+// UpsertRoute creates r in app, or updates it in place when it exists.
+func (c *Client) UpsertRoute(ctx context.Context, app string, r models.Route) error {
+	_, err := c.CreateRoute(ctx, app, &r)
+	if _, ok := err.(*apiroutes.PostAppsAppRoutesConflict); !ok {
+		return err
+	}
+
+	path := r.Path
+	r.Path = ""
+	_, err = c.api.Routes.PatchAppsAppRoutesRoute(&apiroutes.PatchAppsAppRoutesRouteParams{
+		Context: ctx,
+		App:     app,
+		Route:   path,
+		Body:    &models.RouteWrapper{Route: &r},
+	})
+	return err
+}
+
+// PatchRoute applies patch to the route of app at path, as ApplyPatch does.
+// The whole route is sent back to the server, thus changes someone else made
+// in the meantime would be lost: they are detected, and merged when they do
+// not touch the same fields as patch, returned as a *ConflictError otherwise.
+func (c *Client) PatchRoute(ctx context.Context, app, path string, patch *models.Route) error {
+	base, err := c.Route(ctx, app, path)
+	if err != nil {
+		return err
+	}
+	want := ApplyPatch(CopyRoute(base), patch)
+
+	// the API has no conditional updates, make the window for lost updates
+	// as small as possible.
+	current, err := c.Route(ctx, app, path)
+	if err != nil {
+		return err
+	}
+	if conflicts := Conflicts(base, current, want); len(conflicts) > 0 {
+		return &ConflictError{App: app, Path: path, Conflicts: conflicts}
+	}
+	want = ApplyPatch(CopyRoute(current), patch)
+	want.Path = ""
+
+	_, err = c.api.Routes.PatchAppsAppRoutesRoute(&apiroutes.PatchAppsAppRoutesRouteParams{
+		Context: ctx,
+		App:     app,
+		Route:   path,
+		Body:    &models.RouteWrapper{Route: want},
+	})
+	if err != nil {
+		if after, gerr := c.Route(ctx, app, path); gerr == nil {
+			if conflicts := Conflicts(current, after, want); len(conflicts) > 0 {
+				return &ConflictError{App: app, Path: path, Conflicts: conflicts}
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteRoute deletes the route of app at path.
+func (c *Client) DeleteRoute(ctx context.Context, app, path string) error {
+	_, err := c.api.Routes.DeleteAppsAppRoutesRoute(&apiroutes.DeleteAppsAppRoutesRouteParams{
+		Context: ctx,
+		App:     app,
+		Route:   path,
+	})
+	return err
+}
+
+// ApplyPatch applies the changes in patch onto route, and returns it. Config
+// and headers keys prefixed with - are removed, other fields are set when
+// patch sets them.
+func ApplyPatch(route, patch *models.Route) *models.Route {
+	if route.Config == nil {
+		route.Config = map[string]string{}
+	}
+	if route.Headers == nil {
+		route.Headers = map[string][]string{}
+	}
+	if patch == nil {
+		return route
+	}
+
+	for k, v := range patch.Config {
+		if strings.HasPrefix(k, "-") {
+			delete(route.Config, k[1:])
+			continue
+		}
+		route.Config[k] = v
+	}
+	for k, v := range patch.Headers {
+		if strings.HasPrefix(k, "-") {
+			delete(route.Headers, k[1:])
+			continue
+		}
+		route.Headers[k] = v
+	}
+	if patch.Image != "" {
+		route.Image = patch.Image
+	}
+	if patch.Format != "" {
+		route.Format = patch.Format
+	}
+	if patch.Type != "" {
+		route.Type = patch.Type
+	}
+	if patch.MaxConcurrency > 0 {
+		route.MaxConcurrency = patch.MaxConcurrency
+	}
+	if patch.Memory > 0 {
+		route.Memory = patch.Memory
+	}
+	if patch.Timeout != nil {
+		route.Timeout = patch.Timeout
+	}
+	return route
+}
+
+// CopyRoute returns a deep copy of r.
+func CopyRoute(r *models.Route) *models.Route {
+	var c models.Route
+	b, _ := json.Marshal(r)
+	json.Unmarshal(b, &c)
+	return &c
+}
+
+// FieldConflict is a route field changed both by us and by someone else, to
+// different values, since we last read it.
+type FieldConflict struct {
+	Field  string      `json:"field"`
+	Base   interface{} `json:"base"`
+	Theirs interface{} `json:"theirs"`
+	Yours  interface{} `json:"yours"`
+}
+
+// ConflictError tells that the route of App at Path could not be updated,
+// someone else having changed the same fields meanwhile.
+type ConflictError struct {
+	App       string
+	Path      string
+	Conflicts []FieldConflict
+}
+
+func (e *ConflictError) Error() string {
+	fields := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		fields[i] = c.Field
+	}
+	return fmt.Sprintf("route %s%s was changed by someone else meanwhile, conflicting on %s", e.App, e.Path, strings.Join(fields, ", "))
+}
+
+// Conflicts compares the route as it was read (base), as it is now on the
+// server (theirs) and as we want it (yours), field by field. Config and
+// headers keys are fields of their own, eg. config.DB_URL.
+func Conflicts(base, theirs, yours *models.Route) []FieldConflict {
+	b, t, y := flattenRoute(base), flattenRoute(theirs), flattenRoute(yours)
+
+	keys := make(map[string]bool)
+	for _, m := range []map[string]interface{}{b, t, y} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+
+	var conflicts []FieldConflict
+	for k := range keys {
+		theyChanged := !reflect.DeepEqual(b[k], t[k])
+		weChanged := !reflect.DeepEqual(b[k], y[k])
+		if theyChanged && weChanged && !reflect.DeepEqual(t[k], y[k]) {
+			conflicts = append(conflicts, FieldConflict{Field: k, Base: b[k], Theirs: t[k], Yours: y[k]})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Field < conflicts[j].Field })
+	return conflicts
+}
+
+func flattenRoute(r *models.Route) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if r == nil {
+		return fields
+	}
+	b, _ := json.Marshal(r)
+	json.Unmarshal(b, &fields)
+	delete(fields, "path")
+
+	for _, nested := range []string{"config", "headers"} {
+		m, ok := fields[nested].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		delete(fields, nested)
+		for k, v := range m {
+			fields[nested+"."+k] = v
+		}
+	}
+	return fields
+}
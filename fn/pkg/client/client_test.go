@@ -0,0 +1,77 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/iron-io/functions_go/models"
+)
+
+func TestConflicts(t *testing.T) {
+	base := &models.Route{Image: "iron/hello:1", Memory: 128, Config: map[string]string{"A": "1"}}
+
+	cases := []struct {
+		theirs, yours *models.Route
+		fields        []string
+	}{
+		// nobody else changed it
+		{base, &models.Route{Image: "iron/hello:2", Memory: 128, Config: map[string]string{"A": "1"}}, nil},
+		// different fields changed, they can be merged
+		{
+			&models.Route{Image: "iron/hello:1", Memory: 256, Config: map[string]string{"A": "1"}},
+			&models.Route{Image: "iron/hello:2", Memory: 128, Config: map[string]string{"A": "1", "B": "2"}},
+			nil,
+		},
+		// same change on both sides
+		{
+			&models.Route{Image: "iron/hello:2", Memory: 128, Config: map[string]string{"A": "1"}},
+			&models.Route{Image: "iron/hello:2", Memory: 128, Config: map[string]string{"A": "1"}},
+			nil,
+		},
+		{
+			&models.Route{Image: "iron/hello:3", Memory: 128, Config: map[string]string{"A": "3"}},
+			&models.Route{Image: "iron/hello:2", Memory: 128, Config: map[string]string{"A": "2"}},
+			[]string{"config.A", "image"},
+		},
+	}
+
+	for i, c := range cases {
+		conflicts := Conflicts(base, c.theirs, c.yours)
+		if len(conflicts) != len(c.fields) {
+			t.Errorf("case %d: expected conflicts on %v, got %v", i, c.fields, conflicts)
+			continue
+		}
+		for j, f := range c.fields {
+			if conflicts[j].Field != f {
+				t.Errorf("case %d: expected conflict on %s, got %s", i, f, conflicts[j].Field)
+			}
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	route := &models.Route{
+		Image:   "iron/hello:1",
+		Memory:  128,
+		Config:  map[string]string{"A": "1", "B": "2"},
+		Headers: map[string][]string{"X-A": {"1"}},
+	}
+	patch := &models.Route{
+		Image:   "iron/hello:2",
+		Config:  map[string]string{"-A": "", "C": "3"},
+		Headers: map[string][]string{"-X-A": nil},
+	}
+
+	got := ApplyPatch(CopyRoute(route), patch)
+	if got.Image != "iron/hello:2" || got.Memory != 128 {
+		t.Errorf("expected the image patched and the memory kept, got %+v", got)
+	}
+	if _, ok := got.Config["A"]; ok || got.Config["B"] != "2" || got.Config["C"] != "3" {
+		t.Errorf("expected A removed, B kept and C added, got %v", got.Config)
+	}
+	if len(got.Headers) != 0 {
+		t.Errorf("expected X-A removed, got %v", got.Headers)
+	}
+	if route.Image != "iron/hello:1" || route.Config["A"] != "1" {
+		t.Errorf("expected the copied route to be left alone, got %+v", route)
+	}
+}
@@ -0,0 +1,161 @@
+// Package deploy computes the routes function files describe, and deploys
+// them to an IronFunctions server. Building and pushing the images of the
+// functions is left to the caller: fn does it with Docker, tools embedding
+// this package may do it as they see fit. So is expanding the environment
+// variables of function files, with Funcfile.Interpolate, values being
+// deployed as they are.
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/iron-io/functions/fn/pkg/client"
+	"github.com/iron-io/functions/fn/pkg/funcfile"
+	"github.com/iron-io/functions_go/models"
+)
+
+// Deploy creates in app the routes ff describes, or updates those existing,
+// in order. It stops at the first route which could not be stored, returning
+// the routes stored until then.
+func Deploy(ctx context.Context, c *client.Client, app string, ff *funcfile.Funcfile) ([]models.Route, error) {
+	routes, err := Routes(ff)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range routes {
+		if err := c.UpsertRoute(ctx, app, r); err != nil {
+			return routes[:i], fmt.Errorf("could not deploy %s%s: %w", app, r.Path, err)
+		}
+	}
+	return routes, nil
+}
+
+// Route computes the route a function file describes. The path defaults to
+// the one derived from the name of the function, and unset settings of ff to
+// their zero value.
+func Route(ff *funcfile.Funcfile) models.Route {
+	if ff.RoutePath == nil {
+		// the registry is not part of the path
+		_, path := funcfile.AppNamePath(ff.Name)
+		ff.RoutePath = &path
+	}
+
+	if ff.Memory == nil {
+		ff.Memory = new(int64)
+	}
+	if ff.Type == nil {
+		ff.Type = new(string)
+	}
+	if ff.Format == nil {
+		ff.Format = new(string)
+	}
+	if ff.MaxConcurrency == nil {
+		ff.MaxConcurrency = new(int)
+	}
+	if ff.Timeout == nil {
+		dur := time.Duration(0)
+		ff.Timeout = &dur
+	}
+
+	headers := make(map[string][]string)
+	for k, v := range ff.Headers {
+		headers[k] = []string{v}
+	}
+	to := int64(ff.Timeout.Seconds())
+	return models.Route{
+		Path:           *ff.RoutePath,
+		Image:          ff.FullName(),
+		Memory:         *ff.Memory,
+		Type:           *ff.Type,
+		Config:         copyConfig(ff.Config),
+		Headers:        headers,
+		Format:         *ff.Format,
+		MaxConcurrency: int32(*ff.MaxConcurrency),
+		Timeout:        &to,
+	}
+}
+
+// Routes computes the routes a function file describes: the one of Route, or
+// one for each of its paths and routes, which inherit the settings of the
+// function. Their config and headers are merged with the function's.
+func Routes(ff *funcfile.Funcfile) ([]models.Route, error) {
+	base := Route(ff)
+	if len(ff.Paths) == 0 && len(ff.Routes) == 0 {
+		return []models.Route{base}, nil
+	}
+
+	var routes []models.Route
+	seen := make(map[string]bool)
+	add := func(r *models.Route) error {
+		if r.Path == "" {
+			return fmt.Errorf("%s declares a route without a path", ff.Name)
+		}
+		r.Path = path.Join("/", r.Path)
+		if seen[r.Path] {
+			return fmt.Errorf("%s declares route %s twice", ff.Name, r.Path)
+		}
+		seen[r.Path] = true
+		routes = append(routes, *r)
+		return nil
+	}
+
+	for _, p := range ff.Paths {
+		r := client.CopyRoute(&base)
+		r.Path = p
+		if err := add(r); err != nil {
+			return nil, err
+		}
+	}
+	for _, fr := range ff.Routes {
+		r := client.CopyRoute(&base)
+		r.Path = fr.Path
+		if fr.Type != nil {
+			r.Type = *fr.Type
+		}
+		if fr.Memory != nil {
+			r.Memory = *fr.Memory
+		}
+		if fr.Format != nil {
+			r.Format = *fr.Format
+		}
+		if fr.Timeout != nil {
+			to := int64(fr.Timeout.Seconds())
+			r.Timeout = &to
+		}
+		if fr.MaxConcurrency != nil {
+			r.MaxConcurrency = int32(*fr.MaxConcurrency)
+		}
+		if len(fr.Config) > 0 && r.Config == nil {
+			r.Config = make(map[string]string)
+		}
+		for k, v := range fr.Config {
+			r.Config[k] = v
+		}
+		if len(fr.Headers) > 0 && r.Headers == nil {
+			r.Headers = make(map[string][]string)
+		}
+		for k, v := range fr.Headers {
+			r.Headers[k] = []string{v}
+		}
+		if err := add(r); err != nil {
+			return nil, err
+		}
+	}
+	return routes, nil
+}
+
+// copyConfig copies config, for routes not to share the map of the function
+// file.
+func copyConfig(config map[string]string) map[string]string {
+	if config == nil {
+		return nil
+	}
+	c := make(map[string]string, len(config))
+	for k, v := range config {
+		c[k] = v
+	}
+	return c
+}
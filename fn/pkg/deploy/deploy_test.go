@@ -0,0 +1,69 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/iron-io/functions/fn/pkg/funcfile"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestRoutes(t *testing.T) {
+	var ff funcfile.Funcfile
+	err := yaml.Unmarshal([]byte(`
+name: acme/api
+version: 0.0.3
+memory: 128
+config:
+  DB: postgres
+  DSN: $DB_USER@${DB_HOST}
+paths:
+  - /users
+routes:
+  - path: orders
+    memory: 256
+    type: async
+    config:
+      QUEUE: orders
+`), &ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := Routes(&ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+	users, orders := routes[0], routes[1]
+	if users.Path != "/users" || users.Memory != 128 || users.Image != "acme/api:0.0.3" || users.Config["DB"] != "postgres" {
+		t.Errorf("expected /users to inherit the settings of the function, got %+v", users)
+	}
+	if orders.Path != "/orders" || orders.Memory != 256 || orders.Type != "async" {
+		t.Errorf("expected /orders to override the settings of the function, got %+v", orders)
+	}
+	if orders.Config["DB"] != "postgres" || orders.Config["QUEUE"] != "orders" {
+		t.Errorf("expected the config of /orders to be merged with the function's, got %v", orders.Config)
+	}
+	if _, ok := users.Config["QUEUE"]; ok {
+		t.Error("expected the config of /orders not to leak into /users")
+	}
+	if users.Config["DSN"] != "$DB_USER@${DB_HOST}" {
+		t.Errorf("expected the config to be deployed as it is, interpolating being left to the caller, got %s", users.Config["DSN"])
+	}
+	Route(&ff).Config["DB"] = "mysql"
+	if ff.Config["DB"] != "postgres" {
+		t.Error("expected the route not to share the config of the function file")
+	}
+
+	ff.Paths = append(ff.Paths, "/orders")
+	if _, err := Routes(&ff); err == nil {
+		t.Error("expected a path declared twice to be an error")
+	}
+
+	single, err := Routes(&funcfile.Funcfile{Name: "acme/hello"})
+	if err != nil || len(single) != 1 || single[0].Path != "/hello" {
+		t.Errorf("expected the route derived from the name, got %+v %v", single, err)
+	}
+}
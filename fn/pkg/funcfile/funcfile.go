@@ -0,0 +1,482 @@
+// Package funcfile reads and writes function files, func.yaml or its JSON and
+// TOML forms, which describe how functions are built, tested and deployed.
+package funcfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// Names are those of function files, in the order they are looked for.
+	Names = [...]string{
+		"func.yaml",
+		"func.yml",
+		"func.json",
+		"func.toml",
+	}
+
+	ErrUnexpectedFormat = errors.New("unexpected file format for function file")
+	ErrNotFound         = errors.New("could not find function file")
+)
+
+// Test is a test of the function, run by fn test.
+type Test struct {
+	Name string            `yaml:"name,omitempty" json:"name,omitempty"`
+	In   *string           `yaml:"in,omitempty" json:"in,omitempty"`
+	Out  *string           `yaml:"out,omitempty" json:"out,omitempty"`
+	Err  *string           `yaml:"err,omitempty" json:"err,omitempty"`
+	Env  map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+
+	// Path is the route called by remote tests, the first of the function by
+	// default.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Status is the status expected, locally that of a failure when 400 or
+	// above and of a success otherwise.
+	Status int `yaml:"status,omitempty" json:"status,omitempty"`
+	// Contains is text the output is expected to contain.
+	Contains string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	// JSON are the values expected of the output, by JSONPath.
+	JSON map[string]string `yaml:"json,omitempty" json:"json,omitempty"`
+}
+
+// Route is one of the routes of a function file exposing its function at
+// several paths, with settings overriding those of the function.
+type Route struct {
+	Path           string            `yaml:"path" json:"path"`
+	Type           *string           `yaml:"type,omitempty" json:"type,omitempty"`
+	Memory         *int64            `yaml:"memory,omitempty" json:"memory,omitempty"`
+	Format         *string           `yaml:"format,omitempty" json:"format,omitempty"`
+	Timeout        *time.Duration    `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	MaxConcurrency *int              `yaml:"max_concurrency,omitempty" json:"max_concurrency,omitempty"`
+	Headers        map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Config         map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+// Environment is an environment of a function file, like staging or prod, with
+// settings overriding those of the function when it is selected.
+type Environment struct {
+	// Tag replaces the version as the tag of the image.
+	Tag     string            `yaml:"tag,omitempty" json:"tag,omitempty"`
+	Memory  *int64            `yaml:"memory,omitempty" json:"memory,omitempty"`
+	Timeout *time.Duration    `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Config  map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+// Hooks are shell commands run around the build and deploy of a function,
+// in its directory.
+type Hooks struct {
+	PreBuild   []string `yaml:"pre_build,omitempty" json:"pre_build,omitempty"`
+	PostBuild  []string `yaml:"post_build,omitempty" json:"post_build,omitempty"`
+	PreDeploy  []string `yaml:"pre_deploy,omitempty" json:"pre_deploy,omitempty"`
+	PostDeploy []string `yaml:"post_deploy,omitempty" json:"post_deploy,omitempty"`
+}
+
+// Healthcheck is the smoke test deploy calls a function with once its
+// routes are updated.
+type Healthcheck struct {
+	// Path is the route called, the first of the function by default.
+	Path    string            `yaml:"path,omitempty" json:"path,omitempty"`
+	Method  string            `yaml:"method,omitempty" json:"method,omitempty"`
+	Body    string            `yaml:"body,omitempty" json:"body,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// Status is the status expected, any 2xx one by default.
+	Status int `yaml:"status,omitempty" json:"status,omitempty"`
+	// Contains is text the response body is expected to contain.
+	Contains string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	// Retries are the attempts made after the first one fails, for cold
+	// starts.
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty"`
+}
+
+// Funcfile describes how a function is built, tested and deployed.
+type Funcfile struct {
+	Name       string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Version    string            `yaml:"version,omitempty" json:"version,omitempty"`
+	Runtime    *string           `yaml:"runtime,omitempty" json:"runtime,omitempty"`
+	Entrypoint *string           `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`
+	Type       *string           `yaml:"type,omitempty" json:"type,omitempty"`
+	Memory     *int64            `yaml:"memory,omitempty" json:"memory,omitempty"`
+	Format     *string           `yaml:"format,omitempty" json:"format,omitempty"`
+	Timeout    *time.Duration    `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Config     map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+	Build      []string          `yaml:"build,omitempty" json:"build,omitempty"`
+	BuildArgs  map[string]string `yaml:"build_args,omitempty" json:"build_args,omitempty"`
+	Platforms  []string          `yaml:"platforms,omitempty" json:"platforms,omitempty"`
+	Tests      []Test            `yaml:"tests,omitempty" json:"tests,omitempty"`
+
+	// Paths and Routes expose the function at several paths, the latter
+	// with their own settings, instead of the one derived from its name.
+	Paths  []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+	Routes []Route  `yaml:"routes,omitempty" json:"routes,omitempty"`
+
+	// App is the one commands act on when they are given none.
+	App string `yaml:"app,omitempty" json:"app,omitempty"`
+
+	// Registry is the one the image is pushed to, its name being prefixed
+	// with it unless it names a registry already.
+	Registry string `yaml:"registry,omitempty" json:"registry,omitempty"`
+
+	// ImageDigest is the digest of the image last pushed, which routes are
+	// set to with --pin-digest.
+	ImageDigest string `yaml:"image_digest,omitempty" json:"image_digest,omitempty"`
+
+	// Secrets are references to the secrets set in the config of the routes,
+	// by config key, resolved when deploying.
+	Secrets map[string]string `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+
+	// Healthcheck is the smoke test of the function once deployed.
+	Healthcheck *Healthcheck `yaml:"healthcheck,omitempty" json:"healthcheck,omitempty"`
+
+	// Hooks are not interpolated, the shell expanding the variables they
+	// refer to.
+	Hooks *Hooks `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+
+	// Environments are selected with --env or $FN_ENV.
+	Environments map[string]Environment `yaml:"environments,omitempty" json:"environments,omitempty"`
+
+	// RoutePath and MaxConcurrency are set by the commands creating
+	// functions, they are not read from function files.
+	RoutePath      *string `yaml:"-" json:"-"`
+	MaxConcurrency *int    `yaml:"-" json:"-"`
+}
+
+// FullName is the image of the function, with its registry and version.
+func (ff *Funcfile) FullName() string {
+	fname := ff.Name
+	if ff.Registry != "" && ImageRegistry(fname) == "" {
+		fname = strings.TrimSuffix(ff.Registry, "/") + "/" + fname
+	}
+	if ff.Version != "" {
+		fname = fmt.Sprintf("%s:%s", fname, ff.Version)
+	}
+	return fname
+}
+
+// ImageRegistry returns the registry the image names, if any: the first
+// component of its name when it is a host name.
+func ImageRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return ""
+	}
+	if host := image[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+		return host
+	}
+	return ""
+}
+
+// AppNamePath splits the image name img, like acme/hello:0.0.1, into the
+// first component of its name and the path of its route, /hello.
+func AppNamePath(img string) (string, string) {
+	sep := strings.Index(img, "/")
+	if sep < 0 {
+		return "", ""
+	}
+	tag := strings.Index(img[sep:], ":")
+	if tag < 0 {
+		tag = len(img[sep:])
+	}
+	return img[:sep], img[sep : sep+tag]
+}
+
+// RuntimeTag splits the runtime of the function, like go:1.8, from its tag.
+func (ff *Funcfile) RuntimeTag() (runtime, tag string) {
+	if ff.Runtime == nil {
+		return "", ""
+	}
+
+	rt := *ff.Runtime
+	tagpos := strings.Index(rt, ":")
+	if tagpos == -1 {
+		return rt, ""
+	}
+
+	return rt[:tagpos], rt[tagpos+1:]
+}
+
+// SelectEnvironment applies the settings of the named environment, whose
+// config is merged with the function's, expanding the environment variables
+// it refers to when expand is set. Function files without environments are
+// the same in all of them.
+func (ff *Funcfile) SelectEnvironment(name string, expand bool) error {
+	if name == "" || len(ff.Environments) == 0 {
+		return nil
+	}
+	env, ok := ff.Environments[name]
+	if !ok {
+		var names []string
+		for n := range ff.Environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown environment %s, expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	if env.Tag != "" {
+		ff.Version = env.Tag
+	}
+	if env.Memory != nil {
+		ff.Memory = env.Memory
+	}
+	if env.Timeout != nil {
+		ff.Timeout = env.Timeout
+	}
+	if len(env.Config) > 0 && ff.Config == nil {
+		ff.Config = make(map[string]string)
+	}
+	for k, v := range env.Config {
+		if expand {
+			v = Interpolate(v)
+		}
+		ff.Config[k] = v
+	}
+	return nil
+}
+
+// Find returns the function file in dir.
+func Find(dir string) (string, error) {
+	for _, name := range Names {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Decode reads the function file at path as it is written, for it to be
+// stored back.
+func Decode(path string) (*Funcfile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s for parsing. Error: %v", path, err)
+	}
+	return DecodeData(path, b)
+}
+
+// DecodeData decodes b, the content of the function file at path.
+func DecodeData(path string, b []byte) (*Funcfile, error) {
+	switch filepath.Ext(path) {
+	case ".json", ".toml":
+		tree, err := ParseTree(path, b)
+		if err != nil {
+			return nil, err
+		}
+		return FromTree(tree)
+	case ".yaml", ".yml":
+		ff := new(Funcfile)
+		err := yaml.Unmarshal(b, ff)
+		return ff, err
+	}
+	return nil, ErrUnexpectedFormat
+}
+
+// Store writes ff to path, in the format its extension tells.
+func Store(path string, ff *Funcfile) error {
+	ext := filepath.Ext(path)
+	switch ext {
+	case ".json":
+		return encodeJSON(path, ff)
+	case ".toml":
+		return encodeTOML(path, ff)
+	case ".yaml", ".yml":
+		return EncodeYAML(path, ff)
+	}
+	return ErrUnexpectedFormat
+}
+
+// Function files in JSON and TOML are decoded as the same document in YAML
+// would be, for the keys, durations and the rest to be the same in all of
+// them.
+
+// ReadTree reads the function file at path as a generic document.
+func ReadTree(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s for parsing. Error: %v", path, err)
+	}
+	return ParseTree(path, b)
+}
+
+// ParseTree parses b, the content of the function file at path, as a generic
+// document.
+func ParseTree(path string, b []byte) (map[string]interface{}, error) {
+	var tree map[string]interface{}
+	switch filepath.Ext(path) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		tree, _ = NormalizeTree(v).(map[string]interface{})
+	case ".toml":
+		if _, err := toml.Decode(string(b), &tree); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	case ".yaml", ".yml":
+		var v interface{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		tree, _ = NormalizeTree(v).(map[string]interface{})
+	default:
+		return nil, ErrUnexpectedFormat
+	}
+	if tree == nil {
+		return nil, fmt.Errorf("%s: expected a document of keys and values", path)
+	}
+	return tree, nil
+}
+
+// NormalizeTree turns the maps of a decoded document into
+// map[string]interface{}, and its JSON numbers into int64 or float64.
+func NormalizeTree(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = NormalizeTree(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = NormalizeTree(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = NormalizeTree(e)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// FromTree decodes the function file from a generic document.
+func FromTree(tree map[string]interface{}) (*Funcfile, error) {
+	b, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	ff := new(Funcfile)
+	err = yaml.Unmarshal(b, ff)
+	return ff, err
+}
+
+// Tree returns the function file as a generic document, with the keys of its
+// YAML form.
+func Tree(ff *Funcfile) (map[string]interface{}, error) {
+	b, err := yaml.Marshal(ff)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode function file. Error: %v", err)
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	tree, _ := NormalizeTree(v).(map[string]interface{})
+	return tree, nil
+}
+
+func encodeJSON(path string, ff *Funcfile) error {
+	tree, err := Tree(ff)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode function file. Error: %v", err)
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), os.FileMode(0644))
+}
+
+func encodeTOML(path string, ff *Funcfile) error {
+	tree, err := Tree(ff)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tree); err != nil {
+		return fmt.Errorf("could not encode function file. Error: %v", err)
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), os.FileMode(0644))
+}
+
+// EncodeYAML writes ff to path as YAML.
+func EncodeYAML(path string, ff *Funcfile) error {
+	b, err := yaml.Marshal(ff)
+	if err != nil {
+		return fmt.Errorf("could not encode function file. Error: %v", err)
+	}
+	return ioutil.WriteFile(path, b, os.FileMode(0644))
+}
+
+var interpolation = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Interpolate expands ${VAR} and ${VAR:-default} in s, the default being used
+// when VAR is unset or empty. Other uses of $ are left alone, for the shell
+// commands of function files.
+func Interpolate(s string) string {
+	return interpolation.ReplaceAllStringFunc(s, func(m string) string {
+		sub := interpolation.FindStringSubmatch(m)
+		if v := os.Getenv(sub[1]); v != "" {
+			return v
+		}
+		return sub[3]
+	})
+}
+
+func interpolateMap(m map[string]string) {
+	for k, v := range m {
+		m[k] = Interpolate(v)
+	}
+}
+
+// Interpolate expands the environment variables the image, registry, paths,
+// config, headers, build arguments and health check of the function file refer
+// to, so that one function file can be deployed to several environments.
+func (ff *Funcfile) Interpolate() {
+	ff.Name = Interpolate(ff.Name)
+	ff.Registry = Interpolate(ff.Registry)
+	ff.Version = Interpolate(ff.Version)
+	interpolateMap(ff.Config)
+	interpolateMap(ff.Headers)
+	interpolateMap(ff.Secrets)
+	interpolateMap(ff.BuildArgs)
+	if hc := ff.Healthcheck; hc != nil {
+		hc.Path = Interpolate(hc.Path)
+		hc.Body = Interpolate(hc.Body)
+		interpolateMap(hc.Headers)
+	}
+	for i := range ff.Paths {
+		ff.Paths[i] = Interpolate(ff.Paths[i])
+	}
+	for i := range ff.Routes {
+		r := &ff.Routes[i]
+		r.Path = Interpolate(r.Path)
+		interpolateMap(r.Config)
+		interpolateMap(r.Headers)
+	}
+}
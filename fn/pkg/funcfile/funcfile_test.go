@@ -0,0 +1,139 @@
+package funcfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestInterpolate(t *testing.T) {
+	defer os.Unsetenv("FN_TEST_ENV")
+	os.Setenv("FN_TEST_ENV", "prod")
+	os.Unsetenv("FN_TEST_UNSET")
+
+	for in, expected := range map[string]string{
+		"acme/hello-${FN_TEST_ENV}":        "acme/hello-prod",
+		"${FN_TEST_UNSET:-staging}":        "staging",
+		"${FN_TEST_ENV:-staging}":          "prod",
+		"${FN_TEST_UNSET}":                 "",
+		"$FN_TEST_ENV stays for the shell": "$FN_TEST_ENV stays for the shell",
+	} {
+		if out := Interpolate(in); out != expected {
+			t.Errorf("expected %q for %q, got %q", expected, in, out)
+		}
+	}
+}
+
+func TestSelectEnvironment(t *testing.T) {
+	var ff Funcfile
+	err := yaml.Unmarshal([]byte(`
+name: acme/hello
+version: 0.0.3
+memory: 128
+config:
+  LOG: debug
+  DB: staging
+environments:
+  prod:
+    tag: stable
+    memory: 512
+    timeout: 30s
+    config:
+      DB: prod
+`), &ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ff.SelectEnvironment("qa", true); err == nil || !strings.Contains(err.Error(), "expected one of prod") {
+		t.Errorf("expected an unknown environment to be an error, got %v", err)
+	}
+	if err := ff.SelectEnvironment("prod", true); err != nil {
+		t.Fatal(err)
+	}
+	if ff.FullName() != "acme/hello:stable" || *ff.Memory != 512 || ff.Timeout.Seconds() != 30 {
+		t.Errorf("expected the settings of prod, got %s %d %v", ff.FullName(), *ff.Memory, *ff.Timeout)
+	}
+	if ff.Config["DB"] != "prod" || ff.Config["LOG"] != "debug" {
+		t.Errorf("expected the config of prod merged with the function's, got %v", ff.Config)
+	}
+}
+
+func TestFuncfileFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-funcfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"func.yaml": `name: acme/hello
+version: 0.0.3
+memory: 256
+timeout: 30s
+config:
+  DB: postgres
+routes:
+- path: /orders
+  max_concurrency: 4
+`,
+		"func.json": `{
+	"name": "acme/hello",
+	"version": "0.0.3",
+	"memory": 256,
+	"timeout": "30s",
+	"config": {"DB": "postgres"},
+	"routes": [{"path": "/orders", "max_concurrency": 4}]
+}`,
+		"func.toml": `name = "acme/hello"
+version = "0.0.3"
+memory = 256
+timeout = "30s"
+
+[config]
+DB = "postgres"
+
+[[routes]]
+path = "/orders"
+max_concurrency = 4
+`,
+	}
+
+	var want *Funcfile
+	for _, name := range []string{"func.yaml", "func.json", "func.toml"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(files[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ff, err := Decode(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if *ff.Memory != 256 || ff.Timeout.Seconds() != 30 || ff.Config["DB"] != "postgres" || *ff.Routes[0].MaxConcurrency != 4 {
+			t.Errorf("%s: unexpected function file %+v", name, ff)
+		}
+
+		// stored back, the file reads the same
+		if err := Store(path, ff); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		again, err := Decode(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(ff, again) {
+			t.Errorf("%s: expected %+v once stored back, got %+v", name, ff, again)
+		}
+		if want == nil {
+			want = ff
+		} else if !reflect.DeepEqual(want, ff) {
+			t.Errorf("%s: expected the same function file as func.yaml, got %+v", name, ff)
+		}
+		os.Remove(path)
+	}
+}
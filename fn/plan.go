@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	fnclient "github.com/iron-io/functions_go/client"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+const (
+	planCreate = "create"
+	planUpdate = "update"
+	planNoop   = "noop"
+)
+
+// plan is the set of changes a deploy would apply to the routes of an app.
+type plan struct {
+	App     string       `json:"app"`
+	Actions []planAction `json:"actions"`
+}
+
+type planAction struct {
+	Action   string        `json:"action"`
+	Path     string        `json:"path"`
+	Funcfile string        `json:"funcfile"`
+	Changes  []fieldChange `json:"changes,omitempty"`
+}
+
+type fieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// routeDiff lists the fields of live that applying want would change. Unset
+// fields in want are left alone by the API, thus they are not changes, and the
+// keys of config and headers are merged into those of live, others staying.
+func routeDiff(want, live *fnmodels.Route) []fieldChange {
+	var changes []fieldChange
+	add := func(field string, before, after interface{}) {
+		changes = append(changes, fieldChange{Field: field, Before: before, After: after})
+	}
+
+	if want.Image != live.Image {
+		add("image", live.Image, want.Image)
+	}
+	if want.Memory != 0 && want.Memory != live.Memory {
+		add("memory", live.Memory, want.Memory)
+	}
+	if want.Type != "" && want.Type != live.Type {
+		add("type", live.Type, want.Type)
+	}
+	if want.Format != "" && want.Format != live.Format {
+		add("format", live.Format, want.Format)
+	}
+	if want.MaxConcurrency != 0 && want.MaxConcurrency != live.MaxConcurrency {
+		add("max_concurrency", live.MaxConcurrency, want.MaxConcurrency)
+	}
+	if want.Timeout != nil && *want.Timeout != 0 && (live.Timeout == nil || *live.Timeout != *want.Timeout) {
+		var before interface{}
+		if live.Timeout != nil {
+			before = *live.Timeout
+		}
+		add("timeout", before, *want.Timeout)
+	}
+	for k, v := range want.Config {
+		if lv, ok := live.Config[k]; !ok || lv != v {
+			add("config", live.Config, want.Config)
+			break
+		}
+	}
+	for k, v := range want.Headers {
+		if lv, ok := live.Headers[k]; !ok || !reflect.DeepEqual(lv, v) {
+			add("headers", live.Headers, want.Headers)
+			break
+		}
+	}
+	return changes
+}
+
+func planfn() cli.Command {
+	cmd := plancmd{client: apiClient()}
+	return cli.Command{
+		Name:      "plan",
+		Usage:     "show what deploying the local functions to `APPNAME` would change",
+		ArgsUsage: "`APPNAME`",
+		Before:    loadValues,
+		Action:    cmd.plan,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "d",
+				Usage:       "working directory",
+				Destination: &cmd.wd,
+				EnvVar:      "WORK_DIR",
+				Value:       "./",
+			},
+			cli.StringFlag{
+				Name:        "output,o",
+				Usage:       "output format - text or json",
+				Destination: &cmd.output,
+				Value:       "text",
+			},
+			envFlag,
+			valuesFlag,
+			setFlag,
+		},
+	}
+}
+
+type plancmd struct {
+	client *fnclient.Functions
+	wd     string
+	output string
+}
+
+func (p *plancmd) plan(c *cli.Context) error {
+	appName := c.Args().First()
+	if appName == "" {
+		return usageError("application name is missing")
+	}
+	if p.output != "text" && p.output != "json" {
+		return usageError("unknown output format %s", p.output)
+	}
+	globals.output = p.output
+
+	paths, err := walkFuncfiles(p.wd, false)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return errors.New("No function file found.")
+	}
+
+	pl := plan{App: appName, Actions: []planAction{}}
+	for _, path := range paths {
+		ff, err := parsefuncfile(path)
+		if err != nil {
+			return err
+		}
+		routes, err := fndeploy.Routes(ff)
+		if err != nil {
+			return err
+		}
+
+		for _, want := range routes {
+			want := want
+			action := planAction{Path: want.Path, Funcfile: path}
+			live, err := liveRoute(p.client, appName, want.Path)
+			if err != nil {
+				return err
+			}
+			// secrets are not resolved, thus not compared
+			maskSecrets(&want, live, secretKeys(ff))
+			if live == nil {
+				action.Action = planCreate
+				action.Changes = routeDiff(&want, &fnmodels.Route{})
+			} else if action.Changes = routeDiff(&want, live); len(action.Changes) > 0 {
+				action.Action = planUpdate
+			} else {
+				action.Action = planNoop
+			}
+			pl.Actions = append(pl.Actions, action)
+		}
+	}
+
+	if p.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(pl)
+	}
+
+	for _, a := range pl.Actions {
+		switch a.Action {
+		case planCreate:
+			fmt.Println("+", a.Path, "will be created")
+		case planUpdate:
+			fmt.Println("~", a.Path, "will be updated")
+		default:
+			fmt.Println("=", a.Path, "is up to date")
+		}
+		for _, ch := range a.Changes {
+			before, after := ch.Before, ch.After
+			if ch.Field == "memory" {
+				before, after = formatMemory(before.(int64)), formatMemory(after.(int64))
+			}
+			fmt.Printf("\t%s: %v => %v\n", ch.Field, before, after)
+		}
+	}
+	return nil
+}
+
+// liveRoute returns the route currently stored in the server, or nil if
+// there is none.
+func liveRoute(client *fnclient.Functions, appName, route string) (*fnmodels.Route, error) {
+	resp, err := client.Routes.GetAppsAppRoutesRoute(&apiroutes.GetAppsAppRoutesRouteParams{
+		Context: cmdContext(),
+		App:     appName,
+		Route:   route,
+	})
+	if err != nil {
+		if _, ok := err.(*apiroutes.GetAppsAppRoutesRouteNotFound); ok {
+			return nil, nil
+		}
+		return nil, apiError(err)
+	}
+	return resp.Payload.Route, nil
+}
+
+// walkFuncfiles finds the function files deploy would pick up in dir, those
+// of its subdirectories too when all is set, but for the hidden ones and those
+// the .fnignore file of dir matches.
+func walkFuncfiles(dir string, all bool) ([]string, error) {
+	patterns, err := readIgnoreFile(filepath.Join(dir, fnignoreName))
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.IsDir() && (!all || strings.HasPrefix(info.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if ignored(rel, patterns) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isFuncfile(path, info) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestRouteDiff(t *testing.T) {
+	to := int64(30)
+	live := &fnmodels.Route{
+		Path:    "/hello",
+		Image:   "iron/hello:0.0.1",
+		Memory:  128,
+		Type:    "sync",
+		Timeout: &to,
+		Config:  map[string]string{"k": "v"},
+		Headers: map[string][]string{"Cache-Control": {"no-cache"}},
+	}
+
+	cases := []struct {
+		want   fnmodels.Route
+		fields []string
+	}{
+		{fnmodels.Route{Image: "iron/hello:0.0.1", Config: map[string]string{"k": "v"}}, nil},
+		{fnmodels.Route{Image: "iron/hello:0.0.2", Config: map[string]string{"k": "v"}}, []string{"image"}},
+		{fnmodels.Route{Image: "iron/hello:0.0.1", Memory: 256, Type: "async"}, []string{"memory", "type"}},
+		// config and headers not set are left alone, and those set merged
+		{fnmodels.Route{Image: "iron/hello:0.0.1", Config: map[string]string{"k2": "v2"}}, []string{"config"}},
+		{fnmodels.Route{Image: "iron/hello:0.0.1", Config: map[string]string{"k": "v2"}}, []string{"config"}},
+		{fnmodels.Route{Image: "iron/hello:0.0.1", Headers: map[string][]string{"Cache-Control": {"no-cache"}}}, nil},
+		{fnmodels.Route{Image: "iron/hello:0.0.1", Headers: map[string][]string{"Cache-Control": {"no-store"}}}, []string{"headers"}},
+	}
+
+	for i, c := range cases {
+		changes := routeDiff(&c.want, live)
+		if len(changes) != len(c.fields) {
+			t.Errorf("case %d: expected %d changes, got %v", i, len(c.fields), changes)
+			continue
+		}
+		for j, ch := range changes {
+			if ch.Field != c.fields[j] {
+				t.Errorf("case %d: expected change on %s, got %s", i, c.fields[j], ch.Field)
+			}
+		}
+	}
+}
+
+func TestWalkFuncfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"func.yaml":                   "name: acme/root\n",
+		"api/orders/func.yaml":        "name: acme/orders\n",
+		"api/users/func.json":         `{"name": "acme/users"}`,
+		"legacy/old/func.yaml":        "name: acme/old\n",
+		"examples/func.yaml":          "name: acme/example\n",
+		".git/func.yaml":              "name: acme/git\n",
+		"api/orders/testdata/foo.txt": "foo",
+		fnignoreName:                  "# not deployed\nlegacy\nexamples/func.yaml\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		all  bool
+		want []string
+	}{
+		{false, []string{"func.yaml"}},
+		{true, []string{"api/orders/func.yaml", "api/users/func.json", "func.yaml"}},
+	}
+	for _, c := range cases {
+		paths, err := walkFuncfiles(dir, c.all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range paths {
+			rel, _ := filepath.Rel(dir, p)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("walkFuncfiles(all=%v) = %v, want %v", c.all, got, c.want)
+		}
+	}
+}
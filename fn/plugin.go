@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// Plugins are executables named fn-<name>, installed in ~/.fn/plugins or
+// found on PATH, which fn runs as fn <name> with the arguments following the
+// name. They are told where the API is and how to authenticate through the
+// same environment variables fn reads, so that they can call it, or fn.
+
+const pluginPrefix = "fn-"
+
+type plugin struct {
+	name string
+	path string
+}
+
+func pluginsDir() string {
+	return filepath.Join(fnHome(), "plugins")
+}
+
+// findPlugins returns the plugins installed and on PATH, in this order, the
+// first found of each name only.
+func findPlugins() []plugin {
+	dirs := append([]string{pluginsDir()}, filepath.SplitList(os.Getenv("PATH"))...)
+	seen := make(map[string]bool)
+	var plugins []plugin
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			name, ok := pluginName(f)
+			if !ok || seen[name] {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, plugin{name: name, path: filepath.Join(dir, f.Name())})
+		}
+	}
+	return plugins
+}
+
+// pluginName tells the name of the plugin f is, if it is one.
+func pluginName(f os.FileInfo) (string, bool) {
+	name := f.Name()
+	if !strings.HasPrefix(name, pluginPrefix) || f.IsDir() {
+		return "", false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+			return "", false
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	} else if f.Mode()&0111 == 0 {
+		return "", false
+	}
+	name = strings.TrimPrefix(name, pluginPrefix)
+	return name, name != ""
+}
+
+// lookupPlugin finds the plugin name, installed or else on PATH. Plugins are
+// only looked up for the commands fn does not know, which they thus cannot
+// replace, rather than found as fn starts.
+func lookupPlugin(name string) (plugin, bool) {
+	if checkPluginName(name) != nil {
+		return plugin{}, false
+	}
+	files, _ := filepath.Glob(filepath.Join(pluginsDir(), pluginPrefix+name+"*"))
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			if n, ok := pluginName(info); ok && n == name {
+				return plugin{name: name, path: f}, true
+			}
+		}
+	}
+	if path, err := exec.LookPath(pluginPrefix + name); err == nil {
+		return plugin{name: name, path: path}, true
+	}
+	return plugin{}, false
+}
+
+// runUnknownCommand runs the plugin named like the command fn is given, or
+// else shows the help as fn does by default.
+func runUnknownCommand(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return cli.ShowAppHelp(c)
+	}
+	if p, ok := lookupPlugin(name); ok {
+		return runPlugin(p, c.Args().Tail())
+	}
+	return cli.ShowCommandHelp(c, name)
+}
+
+func runPlugin(p plugin, args []string) error {
+	env, err := pluginEnv()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(p.path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Run(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			// the plugin told what went wrong
+			if code := ee.ExitCode(); code > 0 {
+				return exitStatus(code)
+			}
+			return exitStatus(1)
+		}
+		return fmt.Errorf("could not run the plugin %s: %v", p.name, err)
+	}
+	return nil
+}
+
+// pluginEnv is the environment telling plugins about the API and the app in
+// use.
+func pluginEnv() ([]string, error) {
+	env := []string{
+		"API_URL=" + apiURL().String(),
+		"FN_CONTEXT=" + globals.contextName,
+		"FN_HOME=" + fnHome(),
+	}
+	if globals.token != "" {
+		env = append(env, "IRON_TOKEN="+globals.token)
+	}
+	app, err := defaultApp()
+	if err != nil {
+		return nil, err
+	}
+	if app != "" {
+		env = append(env, "FN_APP="+app)
+	}
+	if self, err := os.Executable(); err == nil {
+		env = append(env, "FN_CLI="+self)
+	}
+	return env, nil
+}
+
+func pluginCmd() cli.Command {
+	return cli.Command{
+		Name:  "plugin",
+		Usage: "list and install the plugins adding commands to fn",
+		Subcommands: []cli.Command{
+			{
+				Name:  "list",
+				Usage: "list the plugins, installed and on PATH",
+				Action: func(c *cli.Context) error {
+					builtins := newFn().Commands
+					w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+					fmt.Fprint(w, "NAME", "\t", "PATH", "\n")
+					for _, p := range findPlugins() {
+						where := p.path
+						if findCommand(builtins, p.name) != nil {
+							where += " (shadowed by fn " + p.name + ")"
+						}
+						fmt.Fprint(w, p.name, "\t", where, "\n")
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "install",
+				Usage:     "install a plugin from a URL or a file, in ~/.fn/plugins",
+				ArgsUsage: "<url|file>",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "name",
+						Usage: "name of the plugin, taken from the file name fn-<name> by default",
+					},
+					cli.StringFlag{
+						Name:  "sha256",
+						Usage: "checksum the plugin must match",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					src := c.Args().First()
+					if src == "" {
+						return usageError("plugin install takes the URL or the file of the plugin")
+					}
+					name := c.String("name")
+					if name == "" {
+						name = strings.TrimPrefix(path.Base(filepath.ToSlash(src)), pluginPrefix)
+						if name == path.Base(filepath.ToSlash(src)) {
+							return usageError("%s is not named fn-<name>, give its name with --name", src)
+						}
+					}
+					dst, err := installPlugin(src, name, c.String("sha256"))
+					if err != nil {
+						return err
+					}
+					progress("plugin", name, "installed in", dst)
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "remove a plugin installed in ~/.fn/plugins",
+				ArgsUsage: "<name>",
+				Action: func(c *cli.Context) error {
+					name := c.Args().First()
+					if name == "" {
+						return usageError("plugin remove takes the name of the plugin")
+					}
+					if err := checkPluginName(name); err != nil {
+						return err
+					}
+					files, _ := filepath.Glob(filepath.Join(pluginsDir(), pluginPrefix+name+"*"))
+					removed := false
+					for _, f := range files {
+						if info, err := os.Stat(f); err == nil {
+							if n, ok := pluginName(info); ok && n == name {
+								if err := os.Remove(f); err != nil {
+									return err
+								}
+								removed = true
+							}
+						}
+					}
+					if !removed {
+						return newNotFoundError("no plugin " + name + " installed in " + pluginsDir())
+					}
+					progress("plugin", name, "removed")
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// checkPluginName makes sure name, given by users, names a file of the
+// plugins directory rather than a path out of it.
+func checkPluginName(name string) error {
+	if name == "" || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) || name != filepath.Base(name) {
+		return usageError("invalid plugin name %q, it cannot hold path separators nor ..", name)
+	}
+	return nil
+}
+
+// installPlugin copies the plugin at src, a URL or a file, into the plugins
+// directory as name, once its checksum matches sum when given.
+func installPlugin(src, name, sum string) (string, error) {
+	if err := checkPluginName(name); err != nil {
+		return "", err
+	}
+	var r io.ReadCloser
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		resp, err := httpDownload(src)
+		if err != nil {
+			return "", err
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return "", err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(pluginsDir(), 0755); err != nil {
+		return "", err
+	}
+	file := pluginPrefix + name
+	if runtime.GOOS == "windows" && filepath.Ext(file) == "" {
+		file += ".exe"
+	}
+	dst := filepath.Join(pluginsDir(), file)
+	tmp, err := ioutil.TempFile(pluginsDir(), ".install")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		return "", err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); sum != "" && !strings.EqualFold(got, sum) {
+		return "", fmt.Errorf("the checksum of %s is %s, expected %s, the plugin was not installed", src, got, sum)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestPlugins(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	bin := filepath.Join(home, "bin")
+	os.Mkdir(bin, 0755)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	fakeTool(t, bin, "fn-hello", `env | grep -e ^API_URL= -e ^FN_APP= | sort > `+filepath.Join(bin, "env")+`; exit 3`)
+	fakeTool(t, bin, "fn-apps", "")
+	ioutil.WriteFile(filepath.Join(bin, "fn-notexec"), nil, 0644)
+
+	installed := filepath.Join(pluginsDir(), "fn-hello")
+	os.MkdirAll(pluginsDir(), 0755)
+	ioutil.WriteFile(installed, []byte("#!/bin/sh\n"), 0755)
+	for name, want := range map[string]string{
+		"hello":           installed,
+		"apps":            filepath.Join(bin, "fn-apps"),
+		"notexec":         "",
+		"missing":         "",
+		"../bin/fn-hello": "",
+	} {
+		if p, ok := lookupPlugin(name); p.path != want || ok != (want != "") {
+			t.Errorf("lookupPlugin(%q) = %q, %v, want %q", name, p.path, ok, want)
+		}
+	}
+	os.Remove(installed)
+
+	// plugins run as the commands fn does not know, never replacing its own
+	defer func(exiter func(int)) { cli.OsExiter = exiter }(cli.OsExiter)
+	cli.OsExiter = func(int) {}
+	defer func(w io.Writer) { cli.ErrWriter = w }(cli.ErrWriter)
+	cli.ErrWriter = ioutil.Discard
+	if err := newFn().Run([]string{"fn", "hello", "world"}); err != exitStatus(3) {
+		t.Errorf("expected fn hello to run the plugin, got %v", err)
+	}
+	app := newFn()
+	app.Writer = ioutil.Discard
+	if err := app.Run([]string{"fn", "apps", "--help"}); err != nil {
+		t.Errorf("expected fn apps to stay the command of fn, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(bin, "fn-apps.args")); !os.IsNotExist(err) {
+		t.Error("expected fn apps not to run the plugin")
+	}
+
+	defer func(app, u string) { globals.app, globals.apiURL = app, u }(globals.app, globals.apiURL)
+	globals.app, globals.apiURL = "myapp", "http://api:8080"
+	err = runPlugin(plugin{name: "hello", path: filepath.Join(bin, "fn-hello")}, []string{"world", "--loud"})
+	if err != exitStatus(3) {
+		t.Errorf("expected the exit status of the plugin, got %v", err)
+	}
+	if got := toolArgs(t, bin, "fn-hello"); !reflect.DeepEqual(got, []string{"world", "--loud"}) {
+		t.Errorf("expected the plugin to be given its arguments, got %q", got)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(bin, "env")); string(b) != "API_URL=http://api:8080\nFN_APP=myapp\n" {
+		t.Errorf("expected the plugin to be told the API and the app, got %q", b)
+	}
+}
+
+func TestInstallPlugin(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#!/bin/sh\necho hi\n"))
+	}))
+	defer srv.Close()
+
+	if _, err := installPlugin(srv.URL+"/fn-hi", "hi", "0000"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("expected a plugin not matching its checksum to be rejected, got %v", err)
+	}
+	dst, err := installPlugin(srv.URL+"/fn-hi", "hi", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dst); err != nil || info.Mode()&0111 == 0 || filepath.Base(dst) != "fn-hi" {
+		t.Errorf("expected an executable fn-hi, got %s %v", dst, err)
+	}
+
+	for _, name := range []string{"../hi", "x/../../hi", "..", "sub/hi", `sub\hi`, "/tmp/hi", ""} {
+		if dst, err := installPlugin(srv.URL+"/fn-hi", name, ""); err == nil {
+			t.Errorf("expected the plugin name %q to be rejected, installed %s", name, dst)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, "fn-hi")); !os.IsNotExist(err) {
+		t.Error("a plugin was installed out of the plugins directory")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/urfave/cli"
+)
+
+// parallelFlag sets how many operations bulk commands run at a time.
+func parallelFlag(value int) cli.IntFlag {
+	return cli.IntFlag{
+		Name:  "parallel",
+		Usage: "number of operations run at a time",
+		Value: value,
+	}
+}
+
+// parallelism returns --parallel, checked.
+func parallelism(c *cli.Context) (int, error) {
+	n := c.Int("parallel")
+	if n < 1 {
+		return 0, usageError("--parallel must be at least 1")
+	}
+	return n, nil
+}
+
+// pool runs tasks concurrently, at most size at a time. Once its context is
+// done, the tasks not started yet are not run anymore, those running are
+// waited for.
+type pool struct {
+	ctx context.Context
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+func newPool(ctx context.Context, size int) *pool {
+	if size < 1 {
+		size = 1
+	}
+	return &pool{ctx: ctx, sem: make(chan struct{}, size)}
+}
+
+// run runs task once fewer than size tasks are running, and tells whether it
+// does: it does not once the context of the pool is done.
+func (p *pool) run(task func(ctx context.Context)) bool {
+	select {
+	case p.sem <- struct{}{}:
+	case <-p.ctx.Done():
+		return false
+	}
+	if p.ctx.Err() != nil {
+		<-p.sem
+		return false
+	}
+	p.wg.Add(1)
+	go func() {
+		defer func() { <-p.sem; p.wg.Done() }()
+		task(p.ctx)
+	}()
+	return true
+}
+
+// wait waits for the tasks running to complete.
+func (p *pool) wait() {
+	p.wg.Wait()
+}
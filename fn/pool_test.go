@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	var running, most int32
+	p := newPool(context.Background(), 3)
+	for i := 0; i < 20; i++ {
+		if !p.run(func(context.Context) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&most)
+				if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}) {
+			t.Fatal("expected the task to run")
+		}
+	}
+	p.wait()
+	if most < 2 || most > 3 {
+		t.Errorf("expected up to 3 tasks at a time, got %d", most)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newPool(ctx, 2)
+	report := newBulkReport("deleted")
+
+	release := make(chan struct{})
+	for _, item := range []string{"a", "b", "c", "d"} {
+		item := item
+		ok := p.run(func(context.Context) {
+			<-release
+			report.succeed(item)
+		})
+		if !ok {
+			report.interrupt(item)
+		}
+		if item == "b" {
+			// interrupted while the first tasks run
+			cancel()
+		}
+	}
+	close(release)
+	p.wait()
+
+	if report.count(bulkSucceeded) != 2 || report.count(bulkSkipped) != 2 {
+		t.Errorf("expected the tasks started to complete and the others to be skipped, got %+v", report.items)
+	}
+	if e, ok := report.err().(*fnError); !ok || e.Kind != kindPartial {
+		t.Errorf("expected an interrupted operation to be a partial failure, got %v", report.err())
+	}
+}
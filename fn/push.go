@@ -1,8 +1,8 @@
 package main
 
 import (
-	"errors"
 	"fmt"
+	"os"
 
 	"github.com/urfave/cli"
 )
@@ -15,22 +15,31 @@ func push() cli.Command {
 		Name:   "push",
 		Usage:  "push function to Docker Hub",
 		Flags:  flags,
+		Before: loadValues,
 		Action: cmd.push,
 	}
 }
 
 type pushcmd struct {
 	verbose bool
+	retries int
+	cosign  cosignOptions
 }
 
 func (p *pushcmd) flags() []cli.Flag {
-	return []cli.Flag{
+	flags := []cli.Flag{
 		cli.BoolFlag{
 			Name:        "v",
 			Usage:       "verbose mode",
 			Destination: &p.verbose,
 		},
+		retryFlag(&p.retries),
+		registryFlag,
+		envFlag,
+		valuesFlag,
+		setFlag,
 	}
+	return append(flags, signFlags(&p.cosign)...)
 }
 
 // push will take the found function and check for the presence of a
@@ -40,20 +49,31 @@ func (p *pushcmd) flags() []cli.Flag {
 func (p *pushcmd) push(c *cli.Context) error {
 	verbwriter := verbwriter(p.verbose)
 
-	ff, err := loadFuncfile()
+	path, err := findFuncfile(".")
+	if err != nil {
+		return usageError("image name is missing or no function file found")
+	}
+	ff, err := parsefuncfile(path)
 	if err != nil {
-		if _, ok := err.(*notFoundError); ok {
-			return errors.New("error: image name is missing or no function file found")
-		}
 		return err
 	}
 
 	fmt.Fprintln(verbwriter, "pushing", ff.FullName())
 
-	if err := dockerpush(ff); err != nil {
+	digest, err := dockerpush(os.Stdout, ff, p.retries)
+	if err != nil {
 		return err
 	}
+	if err := storeDigest(path, ff, digest); err != nil {
+		return err
+	}
+	if p.cosign.sign {
+		if err := signImage(os.Stdout, cleanImageName(ff.FullName())+"@"+digest, p.cosign); err != nil {
+			return err
+		}
+	}
 
-	fmt.Printf("Function %v pushed successfully to Docker Hub.\n", ff.FullName())
+	fmt.Printf("Function %v pushed successfully as %s.\n", ff.FullName(), digest)
+	fmt.Fprintln(verbwriter, "recorded image_digest", ff.ImageDigest, "in", path)
 	return nil
 }
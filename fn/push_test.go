@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDockerpush(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer func(d time.Duration) { pushBackoff = d }(pushBackoff)
+	pushBackoff = 0
+
+	digest := "sha256:" + strings.Repeat("a4", 32)
+	attempts := filepath.Join(bin, "attempts")
+	// pushes fail as often as $FAILURES tells, with $ERROR, and the registry
+	// serves the image as $SERVED
+	fakeTool(t, bin, "docker", `if [ "$1" = manifest ]; then echo "{\"Descriptor\": {\"digest\": \"$SERVED\"}}"; exit; fi
+echo x >> `+attempts+`
+if [ $(wc -l < `+attempts+`) -le $FAILURES ]; then echo "$ERROR"; exit 1; fi
+echo "0.0.2: digest: `+digest+` size: 527"`)
+
+	ff := &funcfile{Name: "acme/hello", Version: "0.0.2"}
+	cases := []struct {
+		failures, retries int
+		error, served     string
+		attempts          int
+		ok                bool
+	}{
+		{0, 3, "", digest, 1, true},
+		{2, 3, "net/http: TLS handshake timeout", digest, 3, true},
+		{4, 3, "net/http: TLS handshake timeout", digest, 4, false},
+		{1, 3, "received unexpected HTTP status: 503 Service Unavailable", digest, 2, true},
+		{1, 3, "denied: requested access to the resource is denied", digest, 1, false},
+		{1, 3, "open /etc/docker/certs.d/ca.crt: permission denied", digest, 1, false},
+		{0, 3, "", "sha256:" + strings.Repeat("b1", 32), 1, false},
+	}
+	for _, c := range cases {
+		os.Remove(attempts)
+		os.Setenv("FAILURES", strconv.Itoa(c.failures))
+		os.Setenv("ERROR", c.error)
+		os.Setenv("SERVED", c.served)
+
+		got, err := dockerpush(ioutil.Discard, ff, c.retries)
+		if (err == nil) != c.ok || (c.ok && got != digest) {
+			t.Errorf("dockerpush() failing %d times with %q = %q, %v, want ok %v", c.failures, c.error, got, err, c.ok)
+		}
+		b, _ := ioutil.ReadFile(attempts)
+		if n := strings.Count(string(b), "\n"); n != c.attempts {
+			t.Errorf("dockerpush() failing %d times with %q pushed %d times, want %d", c.failures, c.error, n, c.attempts)
+		}
+	}
+	os.Unsetenv("FAILURES")
+	os.Unsetenv("ERROR")
+	os.Unsetenv("SERVED")
+}
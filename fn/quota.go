@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+
+	fnclient "github.com/iron-io/functions_go/client"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+// defaultRouteMemory is the memory, in MB, the server gives routes not
+// asking for any.
+const defaultRouteMemory = 128
+
+// appQuota limits the resources of an app, on servers enforcing quotas. They
+// expose them under /v1/apps/:app/quota. Zero fields are not limited.
+type appQuota struct {
+	MaxRoutes int64 `json:"max_routes,omitempty"`
+	MaxMemory int64 `json:"max_memory,omitempty"`
+}
+
+// quotaUsage is what an app uses of its quota, memory being the total of its
+// routes, in MB.
+type quotaUsage struct {
+	Routes int64
+	Memory int64
+}
+
+// getQuota returns the quota of an app, or nil if the server has none.
+func getQuota(appName string) (*appQuota, error) {
+	var w struct {
+		Quota *appQuota `json:"quota"`
+	}
+	if err := apiCall("GET", path.Join("/v1/apps", url.PathEscape(appName), "quota"), nil, &w); err != nil {
+		if e, ok := err.(*fnError); ok && e.Kind == kindNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return w.Quota, nil
+}
+
+func liveRoutes(client *fnclient.Functions, appName string) ([]*fnmodels.Route, error) {
+	resp, err := client.Routes.GetAppsAppRoutes(&apiroutes.GetAppsAppRoutesParams{
+		Context: cacheable(cmdContext()),
+		App:     appName,
+	})
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return resp.Payload.Routes, nil
+}
+
+// projectUsage tells what an app would use once the routes in want are
+// stored, created or updated, along with the live ones.
+func projectUsage(live []*fnmodels.Route, want []fnmodels.Route) quotaUsage {
+	memory := make(map[string]int64)
+	for _, r := range live {
+		memory[r.Path] = r.Memory
+	}
+	for _, r := range want {
+		if _, ok := memory[r.Path]; !ok || r.Memory != 0 {
+			memory[r.Path] = r.Memory
+		}
+	}
+
+	u := quotaUsage{Routes: int64(len(memory))}
+	for _, m := range memory {
+		if m == 0 {
+			m = defaultRouteMemory
+		}
+		u.Memory += m
+	}
+	return u
+}
+
+// exceeded lists the limits of q that u goes over.
+func (q *appQuota) exceeded(u quotaUsage) []string {
+	var over []string
+	if q.MaxRoutes > 0 && u.Routes > q.MaxRoutes {
+		over = append(over, fmt.Sprintf("%s routes, over the quota of %s", formatCount(u.Routes), formatCount(q.MaxRoutes)))
+	}
+	if q.MaxMemory > 0 && u.Memory > q.MaxMemory {
+		over = append(over, fmt.Sprintf("%s of memory, over the quota of %s", formatMemory(u.Memory), formatMemory(q.MaxMemory)))
+	}
+	return over
+}
+
+// warnQuota warns when storing the routes in want would take the app over
+// its quota, which the server would then refuse halfway. Failing to tell is
+// not an error, the server has the final say anyway.
+func warnQuota(w io.Writer, client *fnclient.Functions, appName string, want []fnmodels.Route) {
+	q, err := getQuota(appName)
+	if err != nil || q == nil {
+		return
+	}
+	live, err := liveRoutes(client, appName)
+	if err != nil {
+		return
+	}
+	for _, over := range q.exceeded(projectUsage(live, want)) {
+		fmt.Fprintf(w, "warning: this would bring %s to %s\n", appName, over)
+	}
+}
+
+// quotaReport is the usage of an app against its quota, as shown by apps
+// inspect.
+type quotaReport struct {
+	Routes quotaLimit `json:"routes"`
+	Memory quotaLimit `json:"memory"`
+}
+
+type quotaLimit struct {
+	Used int64 `json:"used"`
+	Max  int64 `json:"max,omitempty"`
+}
+
+func appQuotaReport(client *fnclient.Functions, appName string) (*quotaReport, error) {
+	q, err := getQuota(appName)
+	if err != nil || q == nil {
+		return nil, err
+	}
+	live, err := liveRoutes(client, appName)
+	if err != nil {
+		return nil, err
+	}
+	u := projectUsage(live, nil)
+	return &quotaReport{
+		Routes: quotaLimit{Used: u.Routes, Max: q.MaxRoutes},
+		Memory: quotaLimit{Used: u.Memory, Max: q.MaxMemory},
+	}, nil
+}
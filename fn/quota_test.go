@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestProjectUsage(t *testing.T) {
+	defer func(raw bool) { globals.raw = raw }(globals.raw)
+	globals.raw = true
+
+	live := []*fnmodels.Route{
+		{Path: "/a", Memory: 256},
+		{Path: "/b"},
+	}
+	want := []fnmodels.Route{
+		{Path: "/a", Memory: 512},
+		{Path: "/b"},
+		{Path: "/c"},
+	}
+
+	u := projectUsage(live, want)
+	if u.Routes != 3 || u.Memory != 512+2*defaultRouteMemory {
+		t.Errorf("unexpected usage %+v", u)
+	}
+
+	q := &appQuota{MaxRoutes: 3, MaxMemory: 512}
+	over := q.exceeded(u)
+	if len(over) != 1 || over[0] != "768 of memory, over the quota of 512" {
+		t.Errorf("expected the memory quota only to be exceeded, got %v", over)
+	}
+}
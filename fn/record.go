@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// fixture is a call recorded with fn call --record, which fn test --replay
+// sends again to the function run locally, expecting the same output.
+type fixture struct {
+	Route   string      `json:"route"`
+	Method  string      `json:"method"`
+	Query   string      `json:"query,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Request string      `json:"request"`
+
+	Status   int    `json:"status"`
+	Response string `json:"response"`
+
+	// Encoding is base64 when the bodies are not text, and encoded as such.
+	Encoding   string    `json:"encoding,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+func newFixture(route, method, query string, headers http.Header, request []byte, status int, response []byte) *fixture {
+	f := &fixture{
+		Route:      route,
+		Method:     method,
+		Query:      query,
+		Headers:    headers,
+		Status:     status,
+		RecordedAt: time.Now().UTC(),
+	}
+	if utf8.Valid(request) && utf8.Valid(response) {
+		f.Request, f.Response = string(request), string(response)
+	} else {
+		f.Encoding = "base64"
+		f.Request = base64.StdEncoding.EncodeToString(request)
+		f.Response = base64.StdEncoding.EncodeToString(response)
+	}
+	return f
+}
+
+// bodies returns the request and response bodies, decoded.
+func (f *fixture) bodies() (request, response string, err error) {
+	if f.Encoding == "" {
+		return f.Request, f.Response, nil
+	}
+	if f.Encoding != "base64" {
+		return "", "", fmt.Errorf("unknown encoding %q", f.Encoding)
+	}
+	req, err := base64.StdEncoding.DecodeString(f.Request)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid request: %v", err)
+	}
+	resp, err := base64.StdEncoding.DecodeString(f.Response)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid response: %v", err)
+	}
+	return string(req), string(resp), nil
+}
+
+// save writes the fixture to dir, named after the time it was recorded and
+// its route so that fixtures are replayed in the order they were recorded.
+func (f *fixture) save(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.json", f.RecordedAt.Format("20060102T150405.000000000"), pathSlug(f.Route))
+	file := filepath.Join(dir, name)
+	return file, ioutil.WriteFile(file, append(b, '\n'), 0644)
+}
+
+// loadFixtures reads the fixtures of dir, by name.
+func loadFixtures(dir string) (names []string, fixtures []*fixture, err error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		f := &fixture{}
+		if err := json.Unmarshal(b, f); err != nil {
+			return nil, nil, fmt.Errorf("%s is not a fixture: %v", file, err)
+		}
+		names = append(names, strings.TrimSuffix(filepath.Base(file), ".json"))
+		fixtures = append(fixtures, f)
+	}
+	if len(fixtures) == 0 {
+		return nil, nil, newNotFoundError(fmt.Sprintf("no fixture found in %s, record some with fn call --record %s", dir, dir))
+	}
+	return names, fixtures, nil
+}
+
+// replayTest is the test replaying the fixture: the function is expected to
+// fail when the recorded call did, and to answer the same output otherwise.
+func (f *fixture) replayTest(name string) (fftest, error) {
+	request, response, err := f.bodies()
+	if err != nil {
+		return fftest{}, fmt.Errorf("fixture %s: %v", name, err)
+	}
+	tt := fftest{Name: name, In: &request, Path: f.Route, Status: f.Status}
+	if f.Status < 400 {
+		tt.Out = &response
+	}
+	return tt, nil
+}
+
+// replayOptions are the options of the local run of the fixture, which get
+// the request as the server passes it to functions.
+func (f *fixture) replayOptions(opts runOptions) runOptions {
+	opts.method = f.Method
+	opts.env = append([]string(nil), opts.env...)
+	u := f.Route
+	if f.Query != "" {
+		u += "?" + f.Query
+	}
+	opts.env = append(opts.env, kvEq("REQUEST_URL", u))
+	var names []string
+	for k := range f.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		opts.env = append(opts.env, kvEq(toEnvName("HEADER", k), strings.Join(f.Headers[k], " ")))
+	}
+	return opts
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndLoadFixtures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) == "boom" {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"message":"boom"}}`)
+			return
+		}
+		fmt.Fprintf(w, "Hello %s!\n", b)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	u, _ := url.Parse(srv.URL + "/r/myapp/hello?lang=en")
+	opts := callOptions{headers: http.Header{"X-Trace": {"1"}}}
+	var a routesCmd
+
+	var out bytes.Buffer
+	if err := a.record(dir, "/hello", u, strings.NewReader("Johnny"), &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Hello Johnny!\n" {
+		t.Errorf("expected the response to be written out, got %q", out.String())
+	}
+	if err := a.record(dir, "/hello", u, strings.NewReader("boom"), ioutil.Discard, opts); err == nil {
+		t.Error("expected the failed call to fail")
+	}
+
+	names, fixtures, err := loadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 2 || !strings.HasSuffix(names[0], "-hello") {
+		t.Fatalf("expected 2 fixtures of /hello, got %v", names)
+	}
+	ok, failed := fixtures[0], fixtures[1]
+	if ok.Method != "POST" || ok.Query != "lang=en" || ok.Headers.Get("X-Trace") != "1" || ok.Status != 200 || ok.Response != "Hello Johnny!\n" {
+		t.Errorf("unexpected fixture of the successful call: %+v", ok)
+	}
+	if failed.Status != 500 || failed.Request != "boom" || failed.Response != `{"error":{"message":"boom"}}` {
+		t.Errorf("unexpected fixture of the failed call: %+v", failed)
+	}
+
+	tt, err := ok.replayTest(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tt.In != "Johnny" || tt.Out == nil || *tt.Out != "Hello Johnny!\n" || tt.Status != 200 {
+		t.Errorf("unexpected test of the successful call: %+v", tt)
+	}
+	if tt, _ := failed.replayTest(names[1]); tt.Out != nil || tt.Status != 500 {
+		t.Errorf("expected only the failure of the failed call to be checked, got %+v", tt)
+	}
+}
+
+func TestLoadFixturesEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, _, err := loadFixtures(dir); err == nil {
+		t.Error("expected a directory without fixtures to fail")
+	}
+}
+
+func TestFixtureBinaryBodies(t *testing.T) {
+	f := newFixture("/img", "POST", "", nil, []byte{0xff, 0xd8}, 200, []byte("ok"))
+	if f.Encoding != "base64" || f.Request != "/9g=" {
+		t.Fatalf("expected the bodies to be encoded, got %+v", f)
+	}
+	req, resp, err := f.bodies()
+	if err != nil || req != "\xff\xd8" || resp != "ok" {
+		t.Errorf("unexpected bodies %q, %q, %v", req, resp, err)
+	}
+}
+
+func TestFixtureReplayOptions(t *testing.T) {
+	f := &fixture{Route: "/hello", Method: "PUT", Query: "lang=en", Headers: http.Header{"Content-Type": {"text/plain"}, "X-Trace": {"1"}}}
+	opts := f.replayOptions(runOptions{env: []string{"ROUTE=/hello"}})
+	if opts.method != "PUT" {
+		t.Errorf("expected the method of the call, got %q", opts.method)
+	}
+	want := []string{"ROUTE=/hello", "REQUEST_URL=/hello?lang=en", "HEADER_CONTENT_TYPE=text/plain", "HEADER_X_TRACE=1"}
+	if !reflect.DeepEqual(opts.env, want) {
+		t.Errorf("expected env %v, got %v", want, opts.env)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	if diff := lineDiff("Hello\n", "Bye\n"); diff != "" {
+		t.Errorf("expected single lines not to be diffed, got %q", diff)
+	}
+	diff := lineDiff("a\nb\nc\n", "a\nB\nc\nd\n")
+	if want := "  a\n- b\n+ B\n  c\n+ d\n"; diff != want {
+		t.Errorf("expected diff %q, got %q", want, diff)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	"github.com/urfave/cli"
+)
+
+// ecrRegistry matches the registries of AWS ECR, capturing their region.
+var ecrRegistry = regexp.MustCompile(`^\d+\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com$`)
+
+// gcrRegistry matches the registries of Google Container and Artifact
+// Registry.
+var gcrRegistry = regexp.MustCompile(`^([a-z]+\.)?gcr\.io$|^[a-z0-9-]+-docker\.pkg\.dev$`)
+
+func registry() cli.Command {
+	return cli.Command{
+		Name:  "registry",
+		Usage: "manage the credentials of the registries images are pushed to",
+		Subcommands: []cli.Command{
+			{
+				Name:      "login",
+				Usage:     "store the credentials of a registry where docker, buildkit and kaniko find them",
+				ArgsUsage: "[registry]",
+				Action:    registryLogin,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "username, u",
+						Usage: "user name",
+					},
+					cli.BoolFlag{
+						Name:  "password-stdin",
+						Usage: "read the password from stdin",
+					},
+				},
+			},
+		},
+	}
+}
+
+// registryLogin stores the credentials of the registry given, or else the
+// one of the function file of the current directory, or of the context. Those
+// of ECR and GCR are taken from the aws and gcloud CLIs when no password is
+// given.
+func registryLogin(c *cli.Context) error {
+	reg := c.Args().First()
+	if reg == "" {
+		reg = firstNonEmpty(funcfileRegistry(), ffile.ImageRegistry(globals.registry+"/"))
+		if reg == "" {
+			return usageError("the registry is missing, and the function file of the current directory has none")
+		}
+	}
+	reg = strings.TrimSuffix(strings.TrimPrefix(reg, "https://"), "/")
+
+	user, secret := c.String("username"), ""
+	switch {
+	case c.Bool("password-stdin"):
+		if user == "" {
+			return usageError("--password-stdin needs the --username")
+		}
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		secret = strings.TrimRight(string(b), "\r\n")
+	case ecrRegistry.MatchString(reg):
+		region := ecrRegistry.FindStringSubmatch(reg)[1]
+		out, err := exec.Command("aws", "ecr", "get-login-password", "--region", region).Output()
+		if err != nil {
+			return fmt.Errorf("error running aws ecr get-login-password: %v", err)
+		}
+		user, secret = "AWS", strings.TrimSpace(string(out))
+	case gcrRegistry.MatchString(reg):
+		out, err := exec.Command("gcloud", "auth", "print-access-token").Output()
+		if err != nil {
+			return fmt.Errorf("error running gcloud auth print-access-token: %v", err)
+		}
+		user, secret = "oauth2accesstoken", strings.TrimSpace(string(out))
+	default:
+		return usageError("give the password of %s with --username and --password-stdin", reg)
+	}
+
+	if err := storeCredentials(reg, user, secret); err != nil {
+		return err
+	}
+	progress("Logged in to", reg)
+	return nil
+}
+
+// funcfileRegistry returns the registry of the function file of the current
+// directory, if any.
+func funcfileRegistry() string {
+	path, err := findFuncfile(".")
+	if err != nil {
+		return ""
+	}
+	ff, err := parsefuncfile(path)
+	if err != nil {
+		return ""
+	}
+	return firstNonEmpty(ff.Registry, ffile.ImageRegistry(ff.Name))
+}
+
+// dockerConfigFile is the Docker configuration, which docker, buildkit and
+// kaniko read credentials from.
+func dockerConfigFile() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".docker", "config.json")
+}
+
+// dockerHubRegistry is the key of the credentials of Docker Hub, where images
+// without a registry in their name are.
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// readDockerConfig reads the Docker configuration, empty when there is none.
+func readDockerConfig() (map[string]interface{}, error) {
+	file := dockerConfigFile()
+	config := make(map[string]interface{})
+	if b, err := ioutil.ReadFile(file); err == nil {
+		if err := json.Unmarshal(b, &config); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return config, nil
+}
+
+// credentialHelper returns the credential helper the Docker configuration
+// sets for the registry, if any.
+func credentialHelper(config map[string]interface{}, reg string) string {
+	helper, _ := config["credsStore"].(string)
+	if helpers, ok := config["credHelpers"].(map[string]interface{}); ok {
+		if h, ok := helpers[reg].(string); ok {
+			helper = h
+		}
+	}
+	return helper
+}
+
+// storeCredentials stores the credentials of the registry with the credential
+// helper the Docker configuration sets for it, or else in the configuration
+// itself.
+func storeCredentials(reg, user, secret string) error {
+	config, err := readDockerConfig()
+	if err != nil {
+		return err
+	}
+
+	if helper := credentialHelper(config, reg); helper != "" {
+		b, err := json.Marshal(map[string]string{"ServerURL": reg, "Username": user, "Secret": secret})
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command("docker-credential-"+helper, "store")
+		cmd.Stdin = bytes.NewReader(b)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error running docker-credential-%s: %v: %s", helper, err, bytes.TrimSpace(out))
+		}
+		return nil
+	}
+
+	auths, ok := config["auths"].(map[string]interface{})
+	if !ok {
+		auths = make(map[string]interface{})
+		config["auths"] = auths
+	}
+	auths[reg] = map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte(user + ":" + secret))}
+
+	b, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	file := dockerConfigFile()
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0600)
+}
+
+// loadCredentials returns the credentials of the registry, as docker finds
+// them: from the credential helper the Docker configuration sets for it, or
+// else from the configuration itself. The user is empty when there are none.
+func loadCredentials(reg string) (string, string, error) {
+	config, err := readDockerConfig()
+	if err != nil {
+		return "", "", err
+	}
+
+	if helper := credentialHelper(config, reg); helper != "" {
+		cmd := exec.Command("docker-credential-"+helper, "get")
+		cmd.Stdin = strings.NewReader(reg)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if bytes.Contains(out, []byte("credentials not found")) {
+				return "", "", nil
+			}
+			return "", "", fmt.Errorf("error running docker-credential-%s: %v: %s", helper, err, bytes.TrimSpace(append(out, stderr.Bytes()...)))
+		}
+		var creds struct {
+			Username string
+			Secret   string
+		}
+		if err := json.Unmarshal(out, &creds); err != nil {
+			return "", "", fmt.Errorf("docker-credential-%s: %v", helper, err)
+		}
+		return creds.Username, creds.Secret, nil
+	}
+
+	auths, _ := config["auths"].(map[string]interface{})
+	for key, v := range auths {
+		// keys are written with or without their scheme
+		host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		if key != reg && strings.TrimSuffix(host, "/") != reg {
+			continue
+		}
+		auth, _ := v.(map[string]interface{})["auth"].(string)
+		b, err := base64.StdEncoding.DecodeString(auth)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: invalid auth of %s: %v", dockerConfigFile(), key, err)
+		}
+		if i := bytes.IndexByte(b, ':'); i >= 0 {
+			return string(b[:i]), string(b[i+1:]), nil
+		}
+	}
+	return "", "", nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+)
+
+func TestRegistryImageNames(t *testing.T) {
+	cases := []struct {
+		ff       funcfile
+		fullName string
+		path     string
+	}{
+		{funcfile{Name: "acme/hello", Version: "0.0.2"}, "acme/hello:0.0.2", "/hello"},
+		{funcfile{Name: "acme/hello", Version: "0.0.2", Registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com"}, "123456789012.dkr.ecr.us-east-1.amazonaws.com/acme/hello:0.0.2", "/hello"},
+		{funcfile{Name: "acme/hello", Version: "0.0.2", Registry: "localhost:5000/"}, "localhost:5000/acme/hello:0.0.2", "/hello"},
+		// names with a registry keep it
+		{funcfile{Name: "gcr.io/acme/hello", Version: "0.0.2", Registry: "localhost:5000"}, "gcr.io/acme/hello:0.0.2", "/acme/hello"},
+	}
+	for _, c := range cases {
+		if got := c.ff.FullName(); got != c.fullName {
+			t.Errorf("FullName() of %+v = %s, want %s", c.ff, got, c.fullName)
+		}
+		if got := fndeploy.Route(&c.ff).Path; got != c.path {
+			t.Errorf("route path of %+v = %s, want %s", c.ff, got, c.path)
+		}
+	}
+
+	if got := cleanImageName("localhost:5000/acme/hello:0.0.2"); got != "localhost:5000/acme/hello" {
+		t.Errorf("cleanImageName() = %s, want localhost:5000/acme/hello", got)
+	}
+}
+
+func TestStoreCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("DOCKER_CONFIG", os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config := `{"credHelpers": {"gcr.io": "gcr"}, "detachKeys": "ctrl-e,e"}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fakeTool(t, dir, "docker-credential-gcr", `cat > `+filepath.Join(dir, "stored"))
+
+	if err := storeCredentials("registry.example.org", "ci", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeCredentials("gcr.io", "oauth2accesstoken", "t0ken"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Auths      map[string]map[string]string `json:"auths"`
+		DetachKeys string                       `json:"detachKeys"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if auth := got.Auths["registry.example.org"]["auth"]; auth != "Y2k6czNjcmV0" {
+		t.Errorf("auth of registry.example.org = %q, want base64 of ci:s3cret", auth)
+	}
+	if _, ok := got.Auths["gcr.io"]; ok {
+		t.Error("gcr.io credentials stored in the config rather than with its helper")
+	}
+	if got.DetachKeys != "ctrl-e,e" {
+		t.Errorf("detachKeys = %q, want the other settings kept", got.DetachKeys)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, "stored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]string
+	if err := json.Unmarshal(b, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored["ServerURL"] != "gcr.io" || stored["Secret"] != "t0ken" {
+		t.Errorf("docker-credential-gcr stored %v", stored)
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("DOCKER_CONFIG", os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("DOCKER_CONFIG", dir)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config := `{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "aHViOmh1YnBhc3M="},
+			"registry.example.org": {"auth": "Y2k6czNjcmV0"}
+		},
+		"credHelpers": {"gcr.io": "gcr", "quay.io": "none"}
+	}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fakeTool(t, dir, "docker-credential-gcr", `echo '{"ServerURL": "gcr.io", "Username": "<token>", "Secret": "t0ken"}'`)
+	fakeTool(t, dir, "docker-credential-none", `echo "credentials not found in native keychain"; exit 1`)
+
+	cases := []struct {
+		image string
+		want  map[string]string
+	}{
+		{"acme/hello:0.0.1", map[string]string{"serveraddress": dockerHubRegistry, "username": "hub", "password": "hubpass"}},
+		{"registry.example.org/acme/hello", map[string]string{"serveraddress": "registry.example.org", "username": "ci", "password": "s3cret"}},
+		{"gcr.io/acme/hello", map[string]string{"serveraddress": "gcr.io", "identitytoken": "t0ken"}},
+		{"quay.io/acme/hello", nil},
+		{"localhost:5000/acme/hello", nil},
+	}
+	for _, c := range cases {
+		auth, err := registryAuth(c.image)
+		if err != nil {
+			t.Errorf("registryAuth(%s): %v", c.image, err)
+			continue
+		}
+		var got map[string]string
+		if auth != "" {
+			b, err := base64.URLEncoding.DecodeString(auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			json.Unmarshal(b, &got)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("registryAuth(%s) = %v, want %v", c.image, got, c.want)
+		}
+	}
+}
@@ -15,4 +15,8 @@ html_url=$(echo "$output" | python -c 'import json,sys;obj=json.load(sys.stdin);
 
 curl --data-binary "@fn_linux"  -H "Content-Type: application/octet-stream" -u $GH_DEPLOY_USER:$GH_DEPLOY_KEY $upload_url\?name\=fn_linux >/dev/null
 curl --data-binary "@fn_mac"    -H "Content-Type: application/octet-stream" -u $GH_DEPLOY_USER:$GH_DEPLOY_KEY $upload_url\?name\=fn_mac >/dev/null
-curl --data-binary "@fn.exe"    -H "Content-Type: application/octet-stream" -u $GH_DEPLOY_USER:$GH_DEPLOY_KEY $upload_url\?name\=fn.exe >/dev/null
\ No newline at end of file
+curl --data-binary "@fn.exe"    -H "Content-Type: application/octet-stream" -u $GH_DEPLOY_USER:$GH_DEPLOY_KEY $upload_url\?name\=fn.exe >/dev/null
+
+# fn update verifies the binaries it downloads against their checksums
+sha256sum fn_linux fn_mac fn.exe > checksums.txt
+curl --data-binary "@checksums.txt" -H "Content-Type: text/plain" -u $GH_DEPLOY_USER:$GH_DEPLOY_KEY $upload_url\?name\=checksums.txt >/dev/null
\ No newline at end of file
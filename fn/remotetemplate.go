@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// templateSource is where the template of fn init --template is: the git
+// repository to clone, the branch or tag of it, and the directory of the
+// template in the repository.
+type templateSource struct {
+	repo, ref, subdir string
+}
+
+// parseTemplateSource reads host/owner/repo[/dir...][@ref] references, cloned
+// over https, and git URLs, whose directory follows a double slash, as in
+// https://git.acme.com/fn-templates.git//kafka-consumer@v2.
+func parseTemplateSource(s string) (templateSource, error) {
+	var src templateSource
+	if i := strings.LastIndex(s, "@"); i > strings.LastIndex(s, "/") && i > strings.LastIndex(s, ":") {
+		s, src.ref = s[:i], s[i+1:]
+	}
+
+	if strings.Contains(s, "://") || strings.HasPrefix(s, "git@") {
+		start := 0
+		if i := strings.Index(s, "://"); i >= 0 {
+			start = i + len("://")
+		}
+		src.repo = s
+		if i := strings.Index(s[start:], "//"); i >= 0 {
+			src.repo, src.subdir = s[:start+i], s[start+i+2:]
+		}
+		return src, nil
+	}
+
+	parts := strings.Split(strings.Trim(s, "/"), "/")
+	if len(parts) < 3 || !strings.Contains(parts[0], ".") {
+		return src, usageError("%s is not a template, expected a directory, host/owner/repository[/directory][@ref] or a git URL", s)
+	}
+	src.repo = "https://" + strings.Join(parts[:3], "/")
+	src.subdir = strings.Join(parts[3:], "/")
+	return src, nil
+}
+
+// fetchTemplate returns the directory of the template s, a local directory or
+// one of a git repository, which is cloned to a temporary directory removed
+// by calling cleanup.
+func fetchTemplate(out io.Writer, s string) (dir string, cleanup func(), err error) {
+	if exists(s) {
+		return s, func() {}, nil
+	}
+	src, err := parseTemplateSource(s)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tmp, err := ioutil.TempDir("", "fn-template")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(tmp) }
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if src.ref != "" {
+		args = append(args, "--branch", src.ref)
+	}
+	clone := filepath.Join(tmp, "repo")
+	cmd := exec.Command("git", append(args, src.repo, clone)...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error cloning %s: %v", src.repo, err)
+	}
+
+	dir = filepath.Join(clone, filepath.FromSlash(src.subdir))
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		cleanup()
+		return "", nil, usageError("%s has no template %s", src.repo, src.subdir)
+	}
+	return dir, cleanup, nil
+}
+
+// templatePackage is the last part of the name of a function, in lowercase
+// letters and digits, as Go and Java packages are named.
+func templatePackage(name string) string {
+	name = name[strings.LastIndex(name, "/")+1:]
+	var b []rune
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b = append(b, r)
+		}
+	}
+	return string(b)
+}
+
+// templateAuthor is the git user name, or else the login of the user.
+func templateAuthor() string {
+	if b, err := exec.Command("git", "config", "user.name").Output(); err == nil {
+		if author := strings.TrimSpace(string(b)); author != "" {
+			return author
+		}
+	}
+	return os.Getenv("USER")
+}
+
+// writeTemplate generates the function named name in dir from the template s,
+// leaving the files which exist already as they are, and returns the names of
+// those it wrote.
+func writeTemplate(out io.Writer, dir, s, name string) ([]string, error) {
+	tdir, cleanup, err := fetchTemplate(out, s)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	files := make(map[string]string)
+	if err := readTemplateDir(tdir, files); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, usageError("template %s has no files", s)
+	}
+	return writeTemplates(dir, files, scaffoldData{
+		Name:    name,
+		Package: templatePackage(name),
+		Author:  templateAuthor(),
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplateSource(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want templateSource
+	}{
+		{"github.com/acme/fn-templates", templateSource{repo: "https://github.com/acme/fn-templates"}},
+		{"github.com/acme/fn-templates/kafka-consumer", templateSource{"https://github.com/acme/fn-templates", "", "kafka-consumer"}},
+		{"github.com/acme/fn-templates/go/kafka@v2", templateSource{"https://github.com/acme/fn-templates", "v2", "go/kafka"}},
+		{"https://git.acme.com/fn-templates.git", templateSource{repo: "https://git.acme.com/fn-templates.git"}},
+		{"https://git.acme.com/fn-templates.git//kafka@main", templateSource{"https://git.acme.com/fn-templates.git", "main", "kafka"}},
+		{"git@github.com:acme/fn-templates.git//kafka", templateSource{"git@github.com:acme/fn-templates.git", "", "kafka"}},
+	} {
+		got, err := parseTemplateSource(c.in)
+		if err != nil {
+			t.Errorf("parseTemplateSource(%q): %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseTemplateSource(%q) = %+v, want %+v", c.in, got, c.want)
+		}
+	}
+
+	for _, in := range []string{"kafka-consumer", "acme/fn-templates/kafka"} {
+		if _, err := parseTemplateSource(in); err == nil {
+			t.Errorf("parseTemplateSource(%q) should fail", in)
+		}
+	}
+}
+
+func TestTemplatePackage(t *testing.T) {
+	for in, want := range map[string]string{
+		"acme/kafka-consumer":          "kafkaconsumer",
+		"registry.acme.com/acme/Hello": "hello",
+		"hello_2":                      "hello2",
+	} {
+		if got := templatePackage(in); got != want {
+			t.Errorf("templatePackage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is missing")
+	}
+	dir, err := ioutil.TempDir("", "fn-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "templates")
+	for name, content := range map[string]string{
+		"kafka/func.go":             "package main // {{ .Name }} by {{ .Author }}\n",
+		"kafka/{{ .Package }}.yaml": "package: {{ .Package }}\n",
+		"other/func.js":             "\n",
+	} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=fn", "-c", "user.email=fn@example.com", "commit", "--quiet", "-m", "templates"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if b, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, b)
+		}
+	}
+
+	fn := filepath.Join(dir, "fn")
+	if err := os.MkdirAll(fn, 0755); err != nil {
+		t.Fatal(err)
+	}
+	written, err := writeTemplate(ioutil.Discard, fn, "file://"+repo+"//kafka", "acme/kafka-consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"func.go", "kafkaconsumer.yaml"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("writeTemplate() wrote %v, want %v", written, want)
+	}
+	want := "package main // acme/kafka-consumer by " + templateAuthor() + "\n"
+	if b, err := ioutil.ReadFile(filepath.Join(fn, "func.go")); err != nil || string(b) != want {
+		t.Errorf("func.go = %q, %v, want %q", b, err, want)
+	}
+
+	if _, err := writeTemplate(ioutil.Discard, fn, "file://"+repo+"//missing", "acme/kafka-consumer"); err == nil {
+		t.Error("writeTemplate() of a missing template should fail")
+	}
+}
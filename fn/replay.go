@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxReplayedLine is the size of the longest payload replay reads.
+const maxReplayedLine = 16 << 20
+
+// replayResult pairs a payload replayed with how the function answered it.
+type replayResult struct {
+	Line    int         `json:"line"`
+	Input   interface{} `json:"input"`
+	Status  int         `json:"status,omitempty"`
+	Latency string      `json:"latency,omitempty"`
+	Output  interface{} `json:"output,omitempty"`
+	Error   string      `json:"error,omitempty"`
+
+	seq int
+}
+
+// jsonOrString keeps b as is in JSON documents if it is JSON itself, as a
+// string otherwise.
+func jsonOrString(b []byte) interface{} {
+	var raw json.RawMessage
+	if json.Unmarshal(b, &raw) == nil {
+		return raw
+	}
+	return string(b)
+}
+
+// replay calls the function at u once for every line of input, concurrency
+// calls at a time, and writes a result per line out, in the order of the
+// input. Once ctx is done, the lines left are not called.
+func replay(ctx context.Context, u string, input io.Reader, results io.Writer, opts callOptions, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	opts.include, opts.textOnly, opts.wait, opts.ndjson = false, false, false, false
+
+	type job struct {
+		seq, n int
+		line   []byte
+	}
+	jobs := make(chan job)
+	done := make(chan *replayResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := &replayResult{Line: j.n, Input: jsonOrString(j.line), seq: j.seq}
+				o := opts
+				o.summary = func(s callSummary) {
+					r.Status = s.Status
+					r.Latency = s.Duration.String()
+				}
+				var out bytes.Buffer
+				start := time.Now()
+				if err := callfn(u, bytes.NewReader(j.line), &out, o); err != nil {
+					r.Error = classify(err).Message
+					if r.Latency == "" {
+						r.Latency = time.Since(start).String()
+					}
+				} else {
+					r.Output = jsonOrString(bytes.TrimSpace(out.Bytes()))
+				}
+				done <- r
+			}
+		}()
+	}
+
+	var scanErr error
+	go func() {
+		defer close(jobs)
+		s := bufio.NewScanner(input)
+		s.Buffer(make([]byte, 64<<10), maxReplayedLine)
+		seq := 0
+		for n := 1; s.Scan(); n++ {
+			line := bytes.TrimSpace(s.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			select {
+			case jobs <- job{seq, n, append([]byte(nil), line...)}:
+			case <-ctx.Done():
+				return
+			}
+			seq++
+		}
+		scanErr = s.Err()
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// results come in as calls complete, hold them back until those of the
+	// previous lines are written
+	var (
+		pending       = make(map[int]*replayResult)
+		next          int
+		calls, failed int
+		enc           = json.NewEncoder(results)
+		writeErr      error
+	)
+	for r := range done {
+		calls++
+		if r.Error != "" {
+			failed++
+		}
+		pending[r.seq] = r
+		for r, ok := pending[next]; ok; r, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if writeErr == nil {
+				writeErr = enc.Encode(r)
+			}
+		}
+	}
+	if scanErr != nil {
+		return fmt.Errorf("could not read the payloads: %v", scanErr)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	fmt.Fprintf(os.Stderr, "%s calls, %s failed\n", formatCount(int64(calls)), formatCount(int64(failed)))
+	if ctx.Err() != nil {
+		return &fnError{Kind: kindPartial, Message: fmt.Sprintf("interrupted after %d calls, the lines left were not called", calls)}
+	}
+	if failed == 0 {
+		return nil
+	}
+	e := &fnError{Kind: kindPartial, Message: fmt.Sprintf("%d of %d calls failed", failed, calls)}
+	if failed == calls {
+		e.Kind = kindError
+	}
+	return e
+}
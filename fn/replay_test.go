@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ N int }
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "bad input")
+			return
+		}
+		// answer out of order
+		time.Sleep(time.Duration(5-in.N) * time.Millisecond)
+		fmt.Fprintf(w, `{"double":%d}`, in.N*2)
+	}))
+	defer srv.Close()
+
+	input := "{\"n\":1}\n\n{\"n\":2}\nnot json\n{\"n\":4}\n"
+	var results bytes.Buffer
+	err := replay(context.Background(), srv.URL, strings.NewReader(input), &results, callOptions{}, 4)
+	if e, ok := err.(*fnError); !ok || e.Kind != kindPartial {
+		t.Errorf("expected a partial failure, got %v", err)
+	}
+
+	var got []replayResult
+	s := bufio.NewScanner(&results)
+	for s.Scan() {
+		var r replayResult
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	lines := []int{1, 3, 4, 5}
+	if len(got) != len(lines) {
+		t.Fatalf("expected %d results, got %d", len(lines), len(got))
+	}
+	for i, r := range got {
+		if r.Line != lines[i] {
+			t.Errorf("expected result %d to be for line %d, got line %d", i, lines[i], r.Line)
+		}
+	}
+	if got[1].Status != 200 || fmt.Sprint(got[1].Output) != "map[double:4]" {
+		t.Errorf("unexpected result for line 3: %+v", got[1])
+	}
+	if got[2].Status != 400 || got[2].Input != "not json" || got[2].Error == "" {
+		t.Errorf("unexpected result for line 4: %+v", got[2])
+	}
+}
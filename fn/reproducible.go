@@ -0,0 +1,322 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Images are built to be reproducible: identical inputs give byte-identical
+// images. The build context is sent to docker as a tar of its files sorted,
+// owned by root and dated SOURCE_DATE_EPOCH, which is also passed to the
+// build for the timestamps of the image, and the base images of generated
+// Dockerfiles are pinned to their digests.
+
+// sourceDateEpoch tells the timestamp of the build inputs: $SOURCE_DATE_EPOCH,
+// or the time of the last git commit of dir, or else the epoch.
+func sourceDateEpoch(dir string) (int64, error) {
+	if s := os.Getenv("SOURCE_DATE_EPOCH"); s != "" {
+		epoch, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", s)
+		}
+		return epoch, nil
+	}
+
+	cmd := exec.Command("git", "log", "-1", "--format=%ct")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, nil
+	}
+	epoch, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	return epoch, nil
+}
+
+// dockerPattern is a pattern of a .dockerignore file, matched as docker
+// does: ** matching any number of directories, and exceptions, starting with
+// !, including again what the patterns before excluded.
+type dockerPattern struct {
+	re        *regexp.Regexp
+	exception bool
+}
+
+// dockerignore reads the patterns of the .dockerignore file of dir.
+func dockerignore(dir string) ([]dockerPattern, error) {
+	lines, err := readIgnoreLines(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return nil, err
+	}
+	var patterns []dockerPattern
+	for _, l := range lines {
+		var p dockerPattern
+		if strings.HasPrefix(l, "!") {
+			p.exception, l = true, strings.TrimSpace(l[1:])
+		}
+		l = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(l)), "/")
+		if p.re, err = regexp.Compile(dockerPatternRegexp(l)); err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %v", l, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// dockerPatternRegexp translates a pattern of a .dockerignore file to a
+// regular expression matching the slashed paths it matches.
+func dockerPatternRegexp(pattern string) string {
+	var re strings.Builder
+	re.WriteString("^")
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if inClass {
+			// character classes are the same, but for their negation
+			if c == '!' && pattern[i-1] == '[' {
+				c = '^'
+			}
+			inClass = c != ']'
+			re.WriteByte(c)
+			continue
+		}
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+				}
+				if i+1 == len(pattern) {
+					re.WriteString(".*")
+				} else {
+					re.WriteString("(.*/)?")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			inClass = true
+			re.WriteByte(c)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+// dockerignored tells whether the patterns leave rel out of the build
+// context, matching it or one of its parent directories, the last pattern
+// matching deciding.
+func dockerignored(rel string, patterns []dockerPattern) bool {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	matched := false
+	for _, p := range patterns {
+		// only exceptions undo a match, and only other patterns make one
+		if p.exception != matched {
+			continue
+		}
+		match := false
+		for i := range parts {
+			if p.re.MatchString(strings.Join(parts[:i+1], "/")) {
+				match = true
+				break
+			}
+		}
+		if match {
+			matched = !p.exception
+		}
+	}
+	return matched
+}
+
+// hasExceptions tells whether some patterns include again what others
+// excluded, in which case the directories excluded must still be walked.
+func hasExceptions(patterns []dockerPattern) bool {
+	for _, p := range patterns {
+		if p.exception {
+			return true
+		}
+	}
+	return false
+}
+
+// readIgnoreFile reads the patterns of an ignore file, like .fnignore, there
+// being none when it does not exist. Exception patterns, starting with !, are
+// not supported and ignored.
+func readIgnoreFile(name string) ([]string, error) {
+	lines, err := readIgnoreLines(name)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "!") {
+			patterns = append(patterns, filepath.Clean(l))
+		}
+	}
+	return patterns, nil
+}
+
+// readIgnoreLines reads the lines of an ignore file but for blank ones and
+// comments.
+func readIgnoreLines(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, scanner.Err()
+}
+
+func ignored(rel string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walkContext calls fn for the files of the build context of dir, in lexical
+// order, with their paths relative to dir. Those .dockerignore leaves out are
+// skipped.
+func walkContext(dir string, fn func(path, rel string, info os.FileInfo) error) error {
+	patterns, err := dockerignore(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if dockerignored(rel, patterns) {
+			if info.IsDir() && !hasExceptions(patterns) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, rel, info)
+	})
+}
+
+// writeContext writes the build context of dir to w as a tar whose bytes only
+// depend on the names, contents and executable bits of the files.
+func writeContext(w io.Writer, dir string, epoch int64) error {
+	mtime := time.Unix(epoch, 0)
+
+	tw := tar.NewWriter(w)
+	err := walkContext(dir, func(path, rel string, info os.FileInfo) error {
+		var err error
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			ModTime: mtime,
+			Mode:    0644,
+		}
+		switch {
+		case info.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			hdr.Mode = 0755
+		case info.Mode()&os.ModeSymlink != 0:
+			hdr.Typeflag = tar.TypeSymlink
+			if hdr.Linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+			hdr.Mode = 0777
+		case info.Mode().IsRegular():
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = info.Size()
+			if info.Mode()&0100 != 0 {
+				hdr.Mode = 0755
+			}
+		default:
+			return nil
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// pinImage returns the digest reference of a base image, repository@sha256,
+// pulling it if needed. Images which cannot be resolved are left as they are.
+func pinImage(verbwriter io.Writer, image string) string {
+	if strings.Contains(image, "@") {
+		return image
+	}
+	if exec.Command("docker", "image", "inspect", image).Run() != nil {
+		pull := exec.CommandContext(cmdContext(), "docker", "pull", image)
+		pull.Stdout = verbwriter
+		pull.Stderr = verbwriter
+		if err := pull.Run(); err != nil {
+			fmt.Fprintf(verbwriter, "could not pin %s to its digest: %v\n", image, err)
+			return image
+		}
+	}
+	digest, err := dockerdigest(image)
+	if err != nil {
+		fmt.Fprintf(verbwriter, "could not pin %s to its digest: %v\n", image, err)
+		return image
+	}
+	return digest
+}
+
+// imageID returns the ID of a local image, the digest of its configuration.
+func imageID(image string) (string, error) {
+	out, err := exec.Command("docker", "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("error running docker inspect: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
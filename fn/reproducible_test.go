@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+func TestWriteContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"func.yaml":        "name: test/hello\n",
+		"lib/util.rb":      "puts 1\n",
+		"func.rb":          "puts 'hello'\n",
+		"tmp/cache":        "junk",
+		".dockerignore":    "# comments are skipped\ntmp\n*.log\n!tmp/keep\n",
+		"tmp/keep":         "kept",
+		"debug.log":        "junk",
+		"lib/nested/a.txt": "a",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var first, second bytes.Buffer
+	if err := writeContext(&first, dir, 1500000000); err != nil {
+		t.Fatal(err)
+	}
+	// changing times and permissions must not change the context
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "func.rb"), later, later)
+	os.Chmod(filepath.Join(dir, "func.yaml"), 0640)
+	if err := writeContext(&second, dir, 1500000000); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("expected identical contexts for identical files")
+	}
+
+	var names []string
+	tr := tar.NewReader(&first)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.ModTime.Unix() != 1500000000 || hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Errorf("expected %s to be dated the epoch and owned by root, got %v %d:%d", hdr.Name, hdr.ModTime, hdr.Uid, hdr.Gid)
+		}
+	}
+	expected := []string{".dockerignore", "func.rb", "func.yaml", "lib/", "lib/nested/", "lib/nested/a.txt", "lib/util.rb", "tmp/keep"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v in the context, got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Fatalf("expected %v in the context, got %v", expected, names)
+		}
+	}
+}
+
+func TestDockerignore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-dockerignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ignore := `
+**/*.log
+!keep.log
+node_modules
+!node_modules/vendored
+/docs/**
+docs/[!r]*.md
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(ignore), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := dockerignore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"debug.log":                      true,
+		"lib/deep/debug.log":             true,
+		"keep.log":                       false,
+		"lib/keep.log":                   true,
+		"node_modules":                   true,
+		"node_modules/left/index.js":     true,
+		"node_modules/vendored":          false,
+		"node_modules/vendored/index.js": false,
+		"docs/guide/intro.md":            true,
+		"func.rb":                        false,
+		"lib/node_modules_helper.rb":     false,
+		"lib/debug.logger":               false,
+	}
+	for rel, want := range cases {
+		if got := dockerignored(filepath.FromSlash(rel), patterns); got != want {
+			t.Errorf("dockerignored(%s) = %v, want %v", rel, got, want)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"*.md":         `^[^/]*\.md$`,
+		"a/**/b":       `^a/(.*/)?b$`,
+		"[!r]?.go":     `^[^r][^/]\.go$`,
+		`not\*a\*glob`: `^not\*a\*glob$`,
+	} {
+		if got := dockerPatternRegexp(name); got != want {
+			t.Errorf("dockerPatternRegexp(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	defer os.Setenv("SOURCE_DATE_EPOCH", os.Getenv("SOURCE_DATE_EPOCH"))
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1234")
+	if epoch, err := sourceDateEpoch("."); err != nil || epoch != 1234 {
+		t.Errorf("expected SOURCE_DATE_EPOCH to be used, got %d %v", epoch, err)
+	}
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := sourceDateEpoch("."); err == nil {
+		t.Error("expected an invalid SOURCE_DATE_EPOCH to be an error")
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	os.Setenv("FN_TEST_PROXY", "http://proxy:3128")
+	defer os.Unsetenv("FN_TEST_PROXY")
+
+	ff := &funcfile{BuildArgs: map[string]string{
+		"HTTP_PROXY": "${FN_TEST_PROXY}",
+		"GOFLAGS":    "-mod=vendor",
+	}}
+	ff.Interpolate()
+	want := []string{"GOFLAGS=-mod=vendor", "HTTP_PROXY=http://proxy:3128"}
+	if got := funcfileBuildArgs(ff); !reflect.DeepEqual(got, want) {
+		t.Errorf("funcfileBuildArgs() = %v, want %v", got, want)
+	}
+
+	set := flag.NewFlagSet("build", 0)
+	buildArgFlag.Apply(set)
+	set.Parse([]string{"--build-arg", "HTTP_PROXY=", "--build-arg", "GOPRIVATE_TOKEN"})
+	want = []string{"HTTP_PROXY=", "GOPRIVATE_TOKEN"}
+	if got := buildArgs(cli.NewContext(nil, set, nil)); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildArgs() = %v, want %v", got, want)
+	}
+}
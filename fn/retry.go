@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxRetryDelay   = 30 * time.Second
+	maxReplayedBody = 1 << 20
+)
+
+// retryTransport retries requests that failed for reasons likely to be
+// transient: errors connecting and 5xx responses. As a function erroring out
+// or timing out must not be called twice, nor a change made twice, requests
+// which failed once written are not retried, nor are 504s, which the server
+// answers for functions which ran and timed out. 503s, telling the request
+// was not served, are retried, and other server errors only for idempotent
+// requests to the API.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Body.(*ndjsonReader); ok {
+		// streamed as it is read, holding it back would defeat the purpose
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// keep small bodies around to send them again, large ones are
+		// streamed once and not retried.
+		b, err := ioutil.ReadAll(io.LimitReader(req.Body, maxReplayedBody+1))
+		if err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+		r := *req
+		if len(b) > maxReplayedBody {
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(b), req.Body), req.Body}
+			return t.next.RoundTrip(&r)
+		}
+		req.Body.Close()
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(b)), nil
+		}
+		r.Body, _ = r.GetBody()
+		req = &r
+	}
+
+	for attempt := 0; ; attempt++ {
+		var wrote int32
+		trace := &httptrace.ClientTrace{
+			WroteRequest: func(httptrace.WroteRequestInfo) { atomic.StoreInt32(&wrote, 1) },
+		}
+		resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+		if attempt >= t.retries || !t.retriable(req, resp, err, atomic.LoadInt32(&wrote) == 1) {
+			return resp, err
+		}
+
+		delay := t.delay(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r := *req
+			r.Body = body
+			req = &r
+		}
+	}
+}
+
+// retriable tells whether req, which got resp or err, is sent again, wrote
+// telling whether it was sent at all.
+func (t *retryTransport) retriable(req *http.Request, resp *http.Response, err error, wrote bool) bool {
+	if err != nil {
+		return !wrote && req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusServiceUnavailable:
+		return true
+	case http.StatusGatewayTimeout:
+		return false
+	}
+	if resp.StatusCode < 500 || isFunctionCall(req.Context()) {
+		return false
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// delay is how long to wait before the next attempt: what the server asked
+// for in Retry-After if it did, an exponential backoff with jitter otherwise.
+func (t *retryTransport) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+
+	d := t.backoff << uint(attempt)
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func retryAfter(h string) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(h); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		d := t.Sub(time.Now())
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+type functionCallKey struct{}
+
+// functionCall marks the requests made with ctx as calls of functions, which
+// are not retried as API requests are.
+func functionCall(ctx context.Context) context.Context {
+	return context.WithValue(ctx, functionCallKey{}, true)
+}
+
+func isFunctionCall(ctx context.Context) bool {
+	ok, _ := ctx.Value(functionCallKey{}).(bool)
+	return ok
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
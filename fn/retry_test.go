@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	cases := []struct {
+		method   string
+		call     bool
+		statuses []int
+		attempts int
+		status   int
+	}{
+		{"GET", false, []int{503, 200}, 2, 200},
+		{"POST", false, []int{503, 503, 200}, 3, 200},
+		{"POST", false, []int{500, 200}, 1, 500},
+		{"POST", false, []int{502, 200}, 1, 502},
+		{"GET", false, []int{500, 500, 500, 500}, 3, 500},
+		{"GET", false, []int{404, 200}, 1, 404},
+		// functions which timed out ran, and are not called again
+		{"GET", false, []int{504, 200}, 1, 504},
+		{"POST", true, []int{504, 200}, 1, 504},
+		{"GET", true, []int{500, 200}, 1, 500},
+		{"GET", true, []int{502, 200}, 1, 502},
+		{"GET", true, []int{503, 200}, 2, 200},
+	}
+
+	for i, c := range cases {
+		attempts := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if b, _ := ioutil.ReadAll(r.Body); r.Method == "POST" && string(b) != "payload" {
+				t.Errorf("case %d: body not replayed, got %q", i, b)
+			}
+			w.WriteHeader(c.statuses[attempts])
+			attempts++
+		}))
+
+		client := &http.Client{Transport: &retryTransport{next: http.DefaultTransport, retries: 2, backoff: time.Millisecond}}
+		req, _ := http.NewRequest(c.method, srv.URL, ioutil.NopCloser(strings.NewReader("payload")))
+		if c.call {
+			req = req.WithContext(functionCall(req.Context()))
+		}
+		resp, err := client.Do(req)
+		srv.Close()
+		if err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		resp.Body.Close()
+		if attempts != c.attempts || resp.StatusCode != c.status {
+			t.Errorf("case %d: expected %d attempts and %d, got %d attempts and %d", i, c.attempts, c.status, attempts, resp.StatusCode)
+		}
+	}
+}
+
+func TestRetryTransportWritten(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// the connection is lost once the request is sent
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &retryTransport{next: http.DefaultTransport, retries: 2, backoff: time.Millisecond}}
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Fatal("expected the lost connection to fail the request")
+	}
+	if attempts != 1 {
+		t.Errorf("expected a request sent not to be retried, got %d attempts", attempts)
+	}
+
+	// nothing was sent to a server not listening
+	u := srv.URL
+	srv.Close()
+	tries := 0
+	client.Transport = &retryTransport{next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		tries++
+		return http.DefaultTransport.RoundTrip(req)
+	}), retries: 2, backoff: time.Millisecond}
+	if _, err := client.Post(u, "text/plain", strings.NewReader("payload")); err == nil {
+		t.Fatal("expected the request to a closed server to fail")
+	}
+	if tries != 3 {
+		t.Errorf("expected a request failing to connect to be retried, got %d tries", tries)
+	}
+}
+
+func TestRetryTransportLargeBody(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b, _ := ioutil.ReadAll(r.Body); len(b) != maxReplayedBody+10 {
+			t.Errorf("expected the whole body, got %d bytes", len(b))
+		}
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &retryTransport{next: http.DefaultTransport, retries: 2, backoff: time.Millisecond}}
+	body := ioutil.NopCloser(strings.NewReader(strings.Repeat("x", maxReplayedBody+10)))
+	req, _ := http.NewRequest("POST", srv.URL, body)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if attempts != 1 {
+		t.Errorf("expected a large body not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d, ok := retryAfter("3"); !ok || d != 3*time.Second {
+		t.Errorf("expected 3s, got %v", d)
+	}
+	if _, ok := retryAfter("soon"); ok {
+		t.Error("expected an invalid Retry-After to be ignored")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
@@ -14,7 +19,7 @@ import (
 	"text/tabwriter"
 	"time"
 
-	"github.com/Sirupsen/logrus"
+	fnapi "github.com/iron-io/functions/fn/pkg/client"
 	fnclient "github.com/iron-io/functions_go/client"
 	apiroutes "github.com/iron-io/functions_go/client/routes"
 	"github.com/iron-io/functions_go/models"
@@ -39,24 +44,30 @@ func routes() cli.Command {
 			{
 				Name:      "call",
 				Usage:     "call a route",
-				ArgsUsage: "`app` /path",
+				ArgsUsage: "[`app`] /path",
 				Action:    r.call,
-				Flags:     runflags(),
+				Flags:     callflags(),
 			},
 			{
 				Name:      "list",
 				Aliases:   []string{"l"},
 				Usage:     "list routes for `app`",
-				ArgsUsage: "`app`",
+				ArgsUsage: "[`app`]",
 				Action:    r.list,
+				Flags: []cli.Flag{
+					appFlag,
+					failOnEmptyFlag,
+				},
 			},
 			{
 				Name:      "create",
 				Aliases:   []string{"c"},
-				Usage:     "create a route in an `app`",
-				ArgsUsage: "`app` /path [image]",
+				Usage:     "create a route in an `app`, or the routes the function file declares",
+				ArgsUsage: "[`app`] [/path [image]]",
 				Action:    r.create,
 				Flags: []cli.Flag{
+					appFlag,
+					pathFlag,
 					cli.Int64Flag{
 						Name:  "memory,m",
 						Usage: "memory in MiB",
@@ -71,6 +82,10 @@ func routes() cli.Command {
 						Name:  "config,c",
 						Usage: "route configuration",
 					},
+					cli.StringSliceFlag{
+						Name:  "headers",
+						Usage: "route response headers",
+					},
 					cli.StringFlag{
 						Name:  "format,f",
 						Usage: "hot function IO format - json or http",
@@ -86,15 +101,20 @@ func routes() cli.Command {
 						Usage: "route timeout",
 						Value: 30 * time.Second,
 					},
+					pinDigestFlag,
+					fromJSONFlag,
+					parallelFlag(bulkConcurrency),
 				},
 			},
 			{
 				Name:      "update",
 				Aliases:   []string{"u"},
 				Usage:     "update a route in an `app`",
-				ArgsUsage: "`app` /path [image]",
+				ArgsUsage: "[`app`] /path [image]",
 				Action:    r.update,
 				Flags: []cli.Flag{
+					appFlag,
+					pathFlag,
 					cli.StringFlag{
 						Name:  "image,i",
 						Usage: "image name",
@@ -127,6 +147,8 @@ func routes() cli.Command {
 						Name:  "timeout",
 						Usage: "route timeout (eg. 30s)",
 					},
+					pinDigestFlag,
+					fromJSONFlag,
 				},
 			},
 			{
@@ -137,105 +159,545 @@ func routes() cli.Command {
 						Name:      "set",
 						Aliases:   []string{"s"},
 						Usage:     "store a configuration key for this route",
-						ArgsUsage: "`app` /path <key> <value>",
+						ArgsUsage: "[`app`] /path <key> <value>",
 						Action:    r.configSet,
+						Flags:     []cli.Flag{appFlag, pathFlag},
 					},
 					{
 						Name:      "unset",
 						Aliases:   []string{"u"},
 						Usage:     "remove a configuration key for this route",
-						ArgsUsage: "`app` /path <key>",
+						ArgsUsage: "[`app`] /path <key>",
 						Action:    r.configUnset,
+						Flags:     []cli.Flag{appFlag, pathFlag},
 					},
 				},
 			},
+			{
+				Name:      "restore",
+				Usage:     "recreate a deleted route from the trash",
+				ArgsUsage: "[`app`] /path",
+				Action:    r.restore,
+				Flags:     []cli.Flag{appFlag, pathFlag},
+			},
 			{
 				Name:      "delete",
 				Aliases:   []string{"d"},
 				Usage:     "delete a route from `app`",
-				ArgsUsage: "`app` /path",
+				ArgsUsage: "[`app`] /path",
 				Action:    r.delete,
+				Flags: []cli.Flag{
+					appFlag,
+					pathFlag,
+					cli.StringFlag{
+						Name:  "selector,l",
+						Usage: "delete all routes whose configuration matches, eg. env=preview,team!=core",
+					},
+					cli.BoolFlag{
+						Name:  "all-apps",
+						Usage: "look for routes matching --selector in every app",
+					},
+					cli.BoolFlag{
+						Name:  "yes,y",
+						Usage: "do not ask for confirmation",
+					},
+					parallelFlag(bulkConcurrency),
+				},
 			},
 			{
 				Name:      "inspect",
 				Aliases:   []string{"i"},
 				Usage:     "retrieve one or all routes properties",
-				ArgsUsage: "`app` /path [property.[key]]",
+				ArgsUsage: "[`app`] /path [property.[key]]",
 				Action:    r.inspect,
+				Flags:     []cli.Flag{appFlag, pathFlag},
+			},
+			{
+				Name:      "endpoint",
+				Aliases:   []string{"e"},
+				Usage:     "print the URL a route is called at",
+				ArgsUsage: "[`app`] /path",
+				Action:    r.endpoint,
+				Flags: []cli.Flag{
+					appFlag,
+					pathFlag,
+					cli.BoolFlag{
+						Name:  "all",
+						Usage: "print the URL of every route of the app",
+					},
+					failOnEmptyFlag,
+				},
 			},
 		},
 	}
 }
 
+// maxErrorBody is how much of an error response is shown.
+const maxErrorBody = 64 << 10
+
+func callflags() []cli.Flag {
+	return append(runflags(),
+		appFlag,
+		pathFlag,
+		cli.BoolFlag{
+			Name:  "include,i",
+			Usage: "print the response status and headers before its body",
+		},
+		cli.StringFlag{
+			Name:  "content-type",
+			Usage: "content type of the payload, guessed from it by default",
+		},
+		cli.Int64Flag{
+			Name:  "content-length",
+			Usage: "size of the payload in bytes, for it to be sent with a Content-Length rather than chunked when it cannot be told, eg. read from a pipe",
+		},
+		cli.BoolFlag{
+			Name:  "chunked",
+			Usage: "send the payload chunked, even when its size is known",
+		},
+		cli.StringFlag{
+			Name:  "output-file,O",
+			Usage: "write the response body to `file` instead of stdout",
+		},
+		cli.BoolFlag{
+			Name:  "base64",
+			Usage: "encode the response body in base64",
+		},
+		cli.BoolFlag{
+			Name:  "wait,w",
+			Usage: "for async functions, wait for the call to complete and print its log",
+		},
+		cli.BoolFlag{
+			Name:  "summary,s",
+			Usage: "print how the call went to stderr: status, duration and execution details reported by the server",
+		},
+		cli.BoolFlag{
+			Name:  "ndjson",
+			Usage: "stream newline delimited JSON: send each line of the payload as soon as it is read, and print the lines of the response as they arrive",
+		},
+		signKeyFlag(),
+		cli.BoolFlag{
+			Name:  "grpc",
+			Usage: "call the function over gRPC, with grpcurl; --method then names the gRPC method, eg. pkg.Service/Method",
+		},
+		cli.StringFlag{
+			Name:  "proto",
+			Usage: "with --grpc, the `file` defining the service, discovered through server reflection by default",
+		},
+		cli.StringFlag{
+			Name:  "grpc-addr",
+			Usage: "with --grpc, the host:port of the gRPC endpoint, the API address by default",
+		},
+		cli.BoolFlag{
+			Name:  "stream",
+			Usage: "for functions streaming their response, eg. Server-Sent Events: print it a line at a time as it arrives, without timing out",
+		},
+		cli.DurationFlag{
+			Name:  "heartbeat",
+			Usage: "with --stream, give up when nothing, not even a heartbeat, was received for that long",
+		},
+		cli.StringFlag{
+			Name:  "input-ndjson",
+			Usage: "call the function once for every line of `file`, - for stdin, and write the results as NDJSON",
+		},
+		cli.StringFlag{
+			Name:  "record",
+			Usage: "save the request and response of the call as a fixture in `DIR`, for fn test --replay",
+		},
+		cli.IntFlag{
+			Name:  "concurrency,c,parallel",
+			Usage: "number of concurrent callers, for load tests and --input-ndjson",
+			Value: 1,
+		},
+		cli.IntFlag{
+			Name:  "iterations,n",
+			Usage: "load test: call the function that many times and report latencies, throughput and errors",
+		},
+		cli.DurationFlag{
+			Name:  "duration",
+			Usage: "load test: call the function for that long, eg. 60s",
+		},
+		cli.StringFlag{
+			Name:  "metrics-addr",
+			Usage: "load test: " + metricsAddrFlag.Usage,
+		},
+		cli.BoolFlag{
+			Name:  "env-headers",
+			Usage: "deprecated, send the environment variables selected with -e as headers",
+		},
+		cli.BoolFlag{
+			Name:  "override-budget",
+			Usage: "allow calls over the calls a minute budget of the context",
+		},
+		cli.BoolFlag{
+			Name:  "curl",
+			Usage: "print the equivalent curl command instead of calling the function",
+		},
+	)
+}
+
 func call() cli.Command {
 	r := routesCmd{client: apiClient()}
 
 	return cli.Command{
 		Name:      "call",
 		Usage:     "call a remote function",
-		ArgsUsage: "`app` /path",
-		Flags:     runflags(),
+		ArgsUsage: "[`app`] /path",
+		Flags:     callflags(),
 		Action:    r.call,
 	}
 }
 
 func (a *routesCmd) list(c *cli.Context) error {
-	if len(c.Args()) < 1 {
-		return errors.New("error: routes listing takes one argument: an app name")
+	args, err := routeArgs(c, "app")
+	if err != nil {
+		return err
 	}
 
-	appName := c.Args().Get(0)
+	appName := args.Get(0)
 
 	resp, err := a.client.Routes.GetAppsAppRoutes(&apiroutes.GetAppsAppRoutesParams{
-		Context: context.Background(),
+		Context: cacheable(cmdContext()),
 		App:     appName,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiroutes.GetAppsAppRoutesNotFound:
-			return fmt.Errorf("error: %v", err.(*apiroutes.GetAppsAppRoutesNotFound).Payload.Error.Message)
-		case *apiroutes.GetAppsAppRoutesDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiroutes.GetAppsAppRoutesDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
+	}
+
+	routes := resp.Payload.Routes
+	if len(routes) == 0 && c.Bool("fail-on-empty") {
+		return emptyError("routes")
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 0, '\t', 0)
-	fmt.Fprint(w, "path", "\t", "image", "\t", "endpoint", "\n")
-	for _, route := range resp.Payload.Routes {
-		u, err := url.Parse("../")
-		u.Path = path.Join(u.Path, "r", appName, route.Path)
+	fmt.Fprint(w, "path", "\t", "image", "\t", "memory", "\t", "endpoint", "\n")
+	for _, route := range routes {
+		fmt.Fprint(w, route.Path, "\t", route.Image, "\t", formatMemory(route.Memory), "\t", routeURL(appName, route.Path), "\n")
+	}
+	w.Flush()
+
+	return nil
+}
+
+func (a *routesCmd) call(c *cli.Context) error {
+	args, err := routeArgs(c, "app", "path")
+	if err != nil {
+		return err
+	}
+
+	appName := args.Get(0)
+	route := args.Get(1)
+
+	content, contentType, err := payload(c)
+	if err != nil {
+		return err
+	}
+	headers, query, err := headersAndQuery(c)
+	if err != nil {
+		return err
+	}
+
+	budget, err := loadBudget(c.Bool("override-budget"))
+	if err != nil {
+		return err
+	}
+	defer budget.save()
+
+	record := c.String("record")
+	if record != "" {
+		for _, name := range []string{"grpc", "curl", "input-ndjson", "iterations", "duration", "ndjson", "stream", "include"} {
+			if c.IsSet(name) {
+				return usageError("--record records single calls, it cannot be used with --%s", name)
+			}
+		}
+	}
+
+	if c.Bool("grpc") {
+		if c.String("sign-key") != "" {
+			return usageError("gRPC calls cannot be signed")
+		}
+		if c.Bool("curl") {
+			return usageError("gRPC calls cannot be printed as curl commands")
+		}
+		if err := budget.take(); err != nil {
+			return err
+		}
+		return a.grpc(appName, path.Join("/", route), content, headers, c.String("method"), c.String("proto"), c.String("grpc-addr"))
+	}
+
+	u := routeURL(appName, route)
+	u.RawQuery = query.Encode()
+
+	opts := callOptions{
+		method:        c.String("method"),
+		headers:       headers,
+		include:       c.Bool("include"),
+		contentType:   firstNonEmpty(c.String("content-type"), contentType),
+		app:           appName,
+		route:         path.Join("/", route),
+		wait:          c.Bool("wait"),
+		ndjson:        c.Bool("ndjson"),
+		stream:        c.Bool("stream"),
+		heartbeat:     c.Duration("heartbeat"),
+		contentLength: c.Int64("content-length"),
+		chunked:       c.Bool("chunked"),
+		budget:        budget,
+	}
+	switch {
+	case opts.contentLength < 0:
+		return usageError("--content-length cannot be negative")
+	case opts.contentLength > 0 && opts.chunked:
+		return usageError("--content-length and --chunked cannot be used together")
+	case opts.contentLength > 0 && (content == nil || opts.ndjson):
+		return usageError("--content-length is only meaningful with a payload, and not with --ndjson")
+	}
+	if key := c.String("sign-key"); key != "" {
+		if opts.ndjson {
+			return usageError("NDJSON streams cannot be signed")
+		}
+		opts.signKey = []byte(key)
+	}
+	if opts.heartbeat > 0 && !opts.stream {
+		return usageError("--heartbeat is only meaningful with --stream")
+	}
+	if opts.ndjson && content == nil {
+		// lines typed in are streamed too
+		content = os.Stdin
+	}
+	if c.Bool("summary") {
+		opts.summary = func(s callSummary) { fmt.Fprintln(os.Stderr, s) }
+	}
+	if env := c.StringSlice("e"); len(env) > 0 {
+		if c.Bool("env-headers") {
+			opts.env = env
+		} else {
+			logger.warn("-e is ignored by call, use --header to send headers, or --env-headers to keep sending environment variables as headers")
+		}
+	}
+
+	if c.IsSet("metrics-addr") && !c.IsSet("iterations") && !c.IsSet("duration") {
+		return usageError("--metrics-addr is only meaningful for load tests, with --iterations or --duration")
+	}
+
+	if c.Bool("curl") {
+		return a.curl(c, u.String(), content, opts)
+	}
+	if c.IsSet("input-ndjson") {
+		return a.replay(c, u.String(), opts)
+	}
+	if c.IsSet("iterations") || c.IsSet("duration") {
+		return a.load(c, u.String(), content, opts)
+	}
+
+	var output io.Writer = os.Stdout
+	if file := c.String("output-file"); file != "" {
+		f, err := os.Create(file)
 		if err != nil {
-			return fmt.Errorf("error parsing functions route path: %v", err)
+			return err
 		}
+		defer f.Close()
+		output = f
+	} else if !c.Bool("base64") {
+		// binary garbage would mess the terminal up
+		opts.textOnly = isTerminal(int(os.Stdout.Fd()))
+	}
+	if c.Bool("base64") {
+		enc := base64.NewEncoder(base64.StdEncoding, output)
+		defer fmt.Fprintln(output)
+		defer enc.Close()
+		output = enc
+	}
 
-		fmt.Fprint(w, route.Path, "\t", route.Image, "\n")
+	if record != "" {
+		return a.record(record, path.Join("/", route), u, content, output, opts)
+	}
+	return callfn(u.String(), content, output, opts)
+}
+
+// record makes the call, saving its request and response as a fixture in
+// dir, failed calls included.
+func (a *routesCmd) record(dir, route string, u *url.URL, content io.Reader, output io.Writer, opts callOptions) error {
+	var request []byte
+	if content != nil {
+		var err error
+		if request, err = ioutil.ReadAll(content); err != nil {
+			return err
+		}
+		content = bytes.NewReader(request)
+	}
+	method := opts.method
+	if method == "" {
+		method = "GET"
+		if content != nil {
+			method = "POST"
+		}
+	}
+	headers := make(http.Header)
+	for k, v := range opts.headers {
+		headers[k] = v
+	}
+	if opts.contentType != "" {
+		headers.Set("Content-Type", opts.contentType)
+	}
+
+	var response bytes.Buffer
+	status := 0
+	summary := opts.summary
+	opts.summary = func(s callSummary) {
+		status = s.Status
+		if summary != nil {
+			summary(s)
+		}
+	}
+	err := callfn(u.String(), content, io.MultiWriter(output, &response), opts)
+	if fe, ok := err.(*fnError); ok && fe.Kind == kindFunction {
+		// the body of the response follows the status line of the error
+		if i := strings.Index(fe.Message, "\n"); i >= 0 {
+			response.WriteString(fe.Message[i+1:])
+		}
+	} else if err != nil {
+		return err
+	}
+
+	f := newFixture(route, method, u.RawQuery, headers, request, status, response.Bytes())
+	file, serr := f.save(dir)
+	if serr != nil {
+		return serr
+	}
+	fmt.Fprintln(os.Stderr, "recorded", file)
+	return err
+}
+
+func (a *routesCmd) load(c *cli.Context, u string, content io.Reader, opts callOptions) error {
+	if opts.ndjson {
+		return usageError("--ndjson cannot be used for load tests")
+	}
+	lo := loadOptions{
+		concurrency: c.Int("concurrency"),
+		iterations:  c.Int("iterations"),
+		duration:    c.Duration("duration"),
+	}
+	if lo.iterations <= 0 && lo.duration <= 0 {
+		return usageError("load tests need a positive --iterations or --duration")
+	}
+
+	// the same payload is sent on every call
+	var body []byte
+	if content != nil {
+		var err error
+		if body, err = ioutil.ReadAll(content); err != nil {
+			return err
+		}
 	}
-	w.Flush()
 
+	if lo.iterations > 0 {
+		if err := opts.budget.check(lo.iterations); err != nil {
+			return err
+		}
+	}
+	stopMetrics, err := serveMetrics(c.String("metrics-addr"))
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	report := loadTest(u, body, opts, lo)
+	if globals.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(report)
+	}
+	fmt.Println(report)
 	return nil
 }
 
-func (a *routesCmd) call(c *cli.Context) error {
-	if len(c.Args()) < 2 {
-		return errors.New("error: routes listing takes three arguments: an app name and a path")
+func (a *routesCmd) replay(c *cli.Context, u string, opts callOptions) error {
+	for _, name := range []string{"data", "body-file", "form", "ndjson", "iterations", "duration"} {
+		if c.IsSet(name) {
+			return usageError("--%s cannot be used with --input-ndjson", name)
+		}
 	}
 
-	appName := c.Args().Get(0)
-	route := c.Args().Get(1)
+	var input io.Reader = os.Stdin
+	if file := c.String("input-ndjson"); file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
 
-	u := url.URL{
-		Scheme: "http",
-		Host:   host(),
+	var results io.Writer = os.Stdout
+	if file := c.String("output-file"); file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		results = f
 	}
-	u.Path = path.Join(u.Path, "r", appName, route)
-	content := stdin()
 
-	return callfn(u.String(), content, os.Stdout, c.String("method"), c.StringSlice("e"))
+	return replay(cmdContext(), u, input, results, opts, c.Int("concurrency"))
+}
+
+type callOptions struct {
+	method  string
+	headers http.Header
+
+	// env lists environment variables sent as headers. Deprecated in favor
+	// of headers.
+	env []string
+
+	// contentType of the request body, sniffed from it when empty.
+	contentType string
+
+	// include writes the status line and headers of the response out before
+	// its body.
+	include bool
+
+	// textOnly refuses to write out binary responses.
+	textOnly bool
+
+	// app the function belongs to. When set, the call ID returned for async
+	// functions is printed alone, or waited for with wait.
+	app  string
+	wait bool
+
+	// route called, for the metrics of the call.
+	route string
+
+	// ndjson streams the request body a line at a time, and writes the
+	// response out a line at a time.
+	ndjson bool
+
+	// signKey signs the call with HMAC-SHA256, which requires reading the
+	// whole body upfront.
+	signKey []byte
+
+	// stream keeps the call open as long as the function streams its
+	// response, written out a line at a time. With heartbeat, the call is
+	// given up after that long without receiving anything.
+	stream    bool
+	heartbeat time.Duration
+
+	// contentLength is the size of the request body when it cannot be told
+	// from it, 0 when unknown. Bodies of unknown size are sent chunked, as
+	// all bodies are with chunked.
+	contentLength int64
+	chunked       bool
+
+	// summary, when set, is told how the call went once it is over.
+	summary func(callSummary)
+
+	// budget, when set, counts the call against the budget of the context.
+	budget *callBudget
 }
 
-func callfn(u string, content io.Reader, output io.Writer, method string, env []string) error {
+// newCallRequest prepares the request calling the function at u, whether it
+// is sent by callfn or printed as a curl command.
+func newCallRequest(u string, content io.Reader, opts callOptions) (*http.Request, error) {
+	method := opts.method
 	if method == "" {
 		if content == nil {
 			method = "GET"
@@ -244,25 +706,186 @@ func callfn(u string, content io.Reader, output io.Writer, method string, env []
 		}
 	}
 
-	req, err := http.NewRequest(method, u, content)
+	// told before the body is wrapped
+	size := bodySize(content)
+
+	contentType := opts.contentType
+	if opts.ndjson {
+		contentType = firstNonEmpty(contentType, ndjsonContentType)
+		if content != nil {
+			content = newNDJSONReader(content)
+		}
+	}
+	if contentType == "" && content != nil {
+		br := bufio.NewReaderSize(content, 512)
+		contentType = sniffContentType(br)
+		content = br
+	}
+
+	var body []byte
+	if opts.signKey != nil && content != nil {
+		var err error
+		if body, err = ioutil.ReadAll(content); err != nil {
+			return nil, err
+		}
+		content = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(functionCall(cmdContext()), method, u, content)
 	if err != nil {
-		return fmt.Errorf("error running route: %v", err)
+		return nil, fmt.Errorf("error running route: %v", err)
+	}
+	if opts.signKey != nil {
+		signRequest(req, opts.signKey, body, time.Now())
+	}
+	switch {
+	case content == nil || opts.ndjson:
+	case opts.chunked:
+		req.ContentLength = -1
+	case opts.contentLength > 0:
+		req.ContentLength = opts.contentLength
+	case req.ContentLength == 0 && size > 0:
+		req.ContentLength = size
+	}
+
+	req.Header.Set("Content-Type", firstNonEmpty(contentType, "application/json"))
+	if opts.ndjson {
+		req.Header.Set("Accept", ndjsonContentType)
+	}
+	if opts.stream && req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", eventStreamContentType+", */*")
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	if len(opts.env) > 0 {
+		envAsHeader(req, opts.env)
+	}
+	for k, v := range opts.headers {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	return req, nil
+}
 
-	if len(env) > 0 {
-		envAsHeader(req, env)
+// callfn calls the function at u, streaming its response to output as it
+// arrives. A response with an error status is returned as an error carrying
+// its body instead.
+func callfn(u string, content io.Reader, output io.Writer, opts callOptions) error {
+	req, err := newCallRequest(u, content, opts)
+	if err != nil {
+		return err
+	}
+	if err := opts.budget.take(); err != nil {
+		return err
+	}
+	method := req.Method
+
+	client := httpClient()
+	var hb *heartbeat
+	if opts.stream {
+		// streams last as long as the function wants them to
+		c := *client
+		c.Timeout = 0
+		client = &c
+		if opts.heartbeat > 0 {
+			hb = &heartbeat{interval: opts.heartbeat}
+			ctx, cancel := hb.watch(req.Context())
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error running route: %v", err)
+		observeCall(opts.app, opts.route, 0, time.Since(start))
+		if err := hb.err(nil); err != nil {
+			return err
+		}
+		return &fnError{Kind: kindNetwork, Message: fmt.Sprintf("error running route: %v", err)}
+	}
+	defer drainBody(resp.Body)
+	defer func() { observeCall(opts.app, opts.route, resp.StatusCode, time.Since(start)) }()
+	if opts.summary != nil {
+		defer func() {
+			opts.summary(callSummary{
+				Status:       resp.StatusCode,
+				Duration:     time.Since(start),
+				callMetadata: parseCallMetadata(resp.Header),
+			})
+		}()
+	}
+
+	if opts.include {
+		fmt.Fprintf(output, "%s %s\r\n", resp.Proto, resp.Status)
+		if err := resp.Header.Write(output); err != nil {
+			return err
+		}
+		fmt.Fprint(output, "\r\n")
 	}
 
-	io.Copy(output, resp.Body)
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		msg := fmt.Sprintf("%s %s: %s", method, req.URL.Path, resp.Status)
+		if b := strings.TrimSpace(string(body)); b != "" {
+			msg += "\n" + b
+		}
+		return &fnError{Kind: kindFunction, Message: msg, Status: resp.StatusCode}
+	}
 
-	return nil
+	if resp.StatusCode == http.StatusAccepted && opts.app != "" {
+		id, err := asyncCallID(resp.Body)
+		if err != nil {
+			return err
+		}
+		if opts.wait {
+			return waitCall(opts.app, id, output)
+		}
+		return printCallID(output, id)
+	}
+
+	if opts.textOnly && !isText(resp.Header.Get("Content-Type")) {
+		return usageError("the response is %s, save it with --output-file or encode it with --base64", resp.Header.Get("Content-Type"))
+	}
+
+	if opts.stream {
+		return copyStream(output, resp.Body, isEventStream(resp.Header.Get("Content-Type")), hb)
+	}
+	if opts.ndjson {
+		return copyLines(output, resp.Body)
+	}
+	_, err = io.Copy(output, resp.Body)
+	return err
+}
+
+// sniffContentType guesses the content type of the body about to be read
+// from br, without consuming it.
+func sniffContentType(br *bufio.Reader) string {
+	head, _ := br.Peek(512)
+	if len(head) == 0 {
+		return ""
+	}
+	if trimmed := bytes.TrimSpace(head); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return "application/json"
+	}
+	return http.DetectContentType(head)
+}
+
+func isText(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// no or unknown content type, trust the function
+		return true
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		strings.HasSuffix(mt, "+json"),
+		strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", ndjsonContentType, "application/xml", "application/javascript", "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
 }
 
 func envAsHeader(req *http.Request, selectedEnv []string) {
@@ -279,25 +902,33 @@ func envAsHeader(req *http.Request, selectedEnv []string) {
 }
 
 func (a *routesCmd) create(c *cli.Context) error {
-	// todo: @pedro , why aren't you just checking the length here?
-	if len(c.Args()) < 2 {
-		return errors.New("error: routes listing takes at least two arguments: an app name and a path")
+	args, err := routeArgs(c, "app")
+	if err != nil {
+		return err
+	}
+	if c.String("from-json") != "" {
+		return a.createFromDocument(c, args.Get(0), args.Get(1))
+	}
+	if len(args) == 1 {
+		return a.createFromFuncfile(c, args.First())
 	}
 
-	appName := c.Args().Get(0)
-	route := c.Args().Get(1)
-	image := c.Args().Get(2)
+	appName := args.Get(0)
+	route := args.Get(1)
+	image := args.Get(2)
 	var (
 		format  string
 		maxC    int
 		timeout time.Duration
+		ff      *funcfile
 	)
 	if image == "" {
 		// todo: why do we only load the func file if image isn't set?  Don't we need to read the rest of these things regardless?
-		ff, err := loadFuncfile()
+		var err error
+		ff, err = loadFuncfile()
 		if err != nil {
 			if _, ok := err.(*notFoundError); ok {
-				return errors.New("error: image name is missing or no function file found")
+				return usageError("image name is missing or no function file found")
 			}
 			return err
 		}
@@ -305,22 +936,26 @@ func (a *routesCmd) create(c *cli.Context) error {
 		if ff.Format != nil {
 			format = *ff.Format
 		}
-		if ff.maxConcurrency != nil {
-			maxC = *ff.maxConcurrency
+		if ff.MaxConcurrency != nil {
+			maxC = *ff.MaxConcurrency
 		}
 		if ff.Timeout != nil {
 			timeout = *ff.Timeout
 		}
-		if route == "" && ff.path != nil {
-			route = *ff.path
+		if route == "" && ff.RoutePath != nil {
+			route = *ff.RoutePath
 		}
 	}
 
 	if route == "" {
-		return errors.New("error: route path is missing")
+		return usageError("route path is missing")
 	}
 	if image == "" {
-		return errors.New("error: function image name is missing")
+		return usageError("function image name is missing")
+	}
+	image, err = pinnedImage(c, image, ff)
+	if err != nil {
+		return err
 	}
 
 	if f := c.String("format"); f != "" {
@@ -333,6 +968,7 @@ func (a *routesCmd) create(c *cli.Context) error {
 		timeout = t
 	}
 
+	config, headers := routeConfigHeaders(ff, c)
 	to := int64(timeout.Seconds())
 	body := &models.RouteWrapper{
 		Route: &models.Route{
@@ -340,130 +976,91 @@ func (a *routesCmd) create(c *cli.Context) error {
 			Image:          image,
 			Memory:         c.Int64("memory"),
 			Type:           c.String("type"),
-			Config:         extractEnvConfig(c.StringSlice("config")),
+			Config:         config,
+			Headers:        headers,
 			Format:         format,
 			MaxConcurrency: int32(maxC),
 			Timeout:        &to,
 		},
 	}
 
+	warnQuota(os.Stderr, a.client, appName, []fnmodels.Route{*body.Route})
+	if err := checkRouteCompat(body.Route); err != nil {
+		return err
+	}
+
 	resp, err := a.client.Routes.PostAppsAppRoutes(&apiroutes.PostAppsAppRoutesParams{
-		Context: context.Background(),
+		Context: cmdContext(),
 		App:     appName,
 		Body:    body,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiroutes.PostAppsAppRoutesBadRequest:
-			return fmt.Errorf("error: %v", err.(*apiroutes.PostAppsAppRoutesBadRequest).Payload.Error.Message)
-		case *apiroutes.PostAppsAppRoutesConflict:
-			return fmt.Errorf("error: %v", err.(*apiroutes.PostAppsAppRoutesConflict).Payload.Error.Message)
-		case *apiroutes.PostAppsAppRoutesDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiroutes.PostAppsAppRoutesDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
-	fmt.Println(resp.Payload.Route.Path, "created with", resp.Payload.Route.Image)
+	progress(resp.Payload.Route.Path, "created with", resp.Payload.Route.Image)
 	return nil
 }
 
-func (a *routesCmd) patchRoute(appName, routePath string, r *fnmodels.Route) error {
-	resp, err := a.client.Routes.GetAppsAppRoutesRoute(&apiroutes.GetAppsAppRoutesRouteParams{
-		Context: context.Background(),
-		App:     appName,
-		Route:   routePath,
-	})
-
-	if err != nil {
-		switch err.(type) {
-		case *apiroutes.GetAppsAppRoutesRouteNotFound:
-			return fmt.Errorf("error: %v", err.(*apiroutes.GetAppsAppRoutesRouteNotFound).Payload.Error.Message)
-		case *apiroutes.GetAppsAppRoutesDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiroutes.GetAppsAppRoutesDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
-	}
-
-	if resp.Payload.Route.Config == nil {
-		resp.Payload.Route.Config = map[string]string{}
+// patchRoute applies the changes in r to the route, merged with the changes
+// someone else made meanwhile, or reported as a conflict when they touch the
+// same fields.
+func (a *routesCmd) patchRoute(ctx context.Context, appName, routePath string, r *fnmodels.Route) (err error) {
+	ctx, span := startSpan(ctx, "route "+routePath, spanInternal)
+	span.set("fn.app", appName)
+	defer func() { span.finish(err) }()
+	if err := checkRouteCompat(r); err != nil {
+		return err
 	}
-
-	if resp.Payload.Route.Headers == nil {
-		resp.Payload.Route.Headers = map[string][]string{}
+	if globals.offline {
+		// the patch is queued, and merged into the route by fn sync
+		patch := fnapi.CopyRoute(r)
+		patch.Path = ""
+		_, err := a.client.Routes.PatchAppsAppRoutesRoute(&apiroutes.PatchAppsAppRoutesRouteParams{
+			Context: ctx,
+			App:     appName,
+			Route:   routePath,
+			Body:    &fnmodels.RouteWrapper{Route: patch},
+		})
+		return apiError(err)
 	}
-
-	resp.Payload.Route.Path = ""
-	if r != nil {
-		if r.Config != nil {
-			for k, v := range r.Config {
-				if string(k[0]) == "-" {
-					delete(resp.Payload.Route.Config, string(k[1:]))
-					continue
-				}
-				resp.Payload.Route.Config[k] = v
-			}
-		}
-		if r.Headers != nil {
-			for k, v := range r.Headers {
-				if string(k[0]) == "-" {
-					delete(resp.Payload.Route.Headers, k)
-					continue
-				}
-				resp.Payload.Route.Headers[k] = v
-			}
-		}
-		if r.Image != "" {
-			resp.Payload.Route.Image = r.Image
-		}
-		if r.Format != "" {
-			resp.Payload.Route.Format = r.Format
-		}
-		if r.Type != "" {
-			resp.Payload.Route.Type = r.Type
-		}
-		if r.MaxConcurrency > 0 {
-			resp.Payload.Route.MaxConcurrency = r.MaxConcurrency
-		}
-		if r.Memory > 0 {
-			resp.Payload.Route.Memory = r.Memory
-		}
-		if r.Timeout != nil {
-			resp.Payload.Route.Timeout = r.Timeout
-		}
+	err = fnapi.New(a.client).PatchRoute(ctx, appName, routePath, r)
+	if e, ok := err.(*fnapi.ConflictError); ok {
+		return conflictError(e)
 	}
+	return apiError(err)
+}
 
-	_, err = a.client.Routes.PatchAppsAppRoutesRoute(&apiroutes.PatchAppsAppRoutesRouteParams{
-		Context: context.Background(),
+func (a *routesCmd) getRoute(appName, routePath string) (*fnmodels.Route, error) {
+	resp, err := a.client.Routes.GetAppsAppRoutesRoute(&apiroutes.GetAppsAppRoutesRouteParams{
+		Context: cmdContext(),
 		App:     appName,
 		Route:   routePath,
-		Body:    resp.Payload,
 	})
-
 	if err != nil {
-		switch err.(type) {
-		case *apiroutes.PatchAppsAppRoutesRouteBadRequest:
-			return fmt.Errorf("error: %v", err.(*apiroutes.PatchAppsAppRoutesRouteBadRequest).Payload.Error.Message)
-		case *apiroutes.PatchAppsAppRoutesRouteNotFound:
-			return fmt.Errorf("error: %v", err.(*apiroutes.PatchAppsAppRoutesRouteNotFound).Payload.Error.Message)
-		case *apiroutes.PatchAppsAppRoutesRouteDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiroutes.PatchAppsAppRoutesRouteDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return nil, apiError(err)
 	}
-
-	return nil
+	return resp.Payload.Route, nil
 }
 
 func (a *routesCmd) update(c *cli.Context) error {
-	if len(c.Args()) < 2 {
-		return errors.New("error: route update takes at least two arguments: an app name and a path")
+	names := []string{"app", "path"}
+	if c.String("from-json") != "" {
+		// the path may be that of the document
+		names = names[:1]
+	}
+	args, err := routeArgs(c, names...)
+	if err != nil {
+		return err
+	}
+	if c.String("from-json") != "" {
+		return a.updateFromDocument(c, args.Get(0), args.Get(1))
 	}
 
-	appName := c.Args().Get(0)
-	route := c.Args().Get(1)
-	image := c.Args().Get(2)
+	appName := args.Get(0)
+	route := args.Get(1)
+	image := args.Get(2)
 	var (
 		format  string
 		maxC    int
@@ -474,31 +1071,38 @@ func (a *routesCmd) update(c *cli.Context) error {
 		if _, ok := err.(*notFoundError); ok {
 			if image == "" {
 				// the no image flag or func file
-				return errors.New("error: image name is missing or no function file found")
+				return usageError("image name is missing or no function file found")
 			}
-			logrus.Warnln("func file not found, continuing...")
+			logger.warn("func file not found, continuing...")
 		} else {
 			return err
 		}
 	}
-	if image != "" { // flags take precedence
-		image = ff.FullName()
-	}
-	if ff.Format != nil {
-		format = *ff.Format
-	}
-	if ff.maxConcurrency != nil {
-		maxC = *ff.maxConcurrency
-	}
-	if ff.Timeout != nil {
-		timeout = *ff.Timeout
-	}
-	if route == "" && ff.path != nil {
-		route = *ff.path
+	if ff != nil {
+		if image == "" { // flags take precedence
+			image = ff.FullName()
+		}
+		if ff.Format != nil {
+			format = *ff.Format
+		}
+		if ff.MaxConcurrency != nil {
+			maxC = *ff.MaxConcurrency
+		}
+		if ff.Timeout != nil {
+			timeout = *ff.Timeout
+		}
+		if route == "" && ff.RoutePath != nil {
+			route = *ff.RoutePath
+		}
 	}
 
 	if route == "" {
-		return errors.New("error: route path is missing")
+		return usageError("route path is missing")
+	}
+	if image != "" {
+		if image, err = pinnedImage(c, image, ff); err != nil {
+			return err
+		}
 	}
 	// if image == "" {
 	// return errors.New("error: function image name is missing")
@@ -514,42 +1118,85 @@ func (a *routesCmd) update(c *cli.Context) error {
 		timeout = t
 	}
 
-	headers := map[string][]string{}
-	for _, header := range c.StringSlice("headers") {
-		parts := strings.Split(header, "=")
-		headers[parts[0]] = strings.Split(parts[1], ";")
-	}
-
+	config, headers := routeConfigHeaders(ff, c)
 	to := int64(timeout.Seconds())
 	patchRoute := &fnmodels.Route{
 		Image:          image,
 		Memory:         c.Int64("memory"),
 		Type:           c.String("type"),
-		Config:         extractEnvConfig(c.StringSlice("config")),
+		Config:         config,
 		Headers:        headers,
 		Format:         format,
 		MaxConcurrency: int32(maxC),
 		Timeout:        &to,
 	}
 
-	err = a.patchRoute(appName, route, patchRoute)
+	err = a.patchRoute(cmdContext(), appName, route, patchRoute)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(appName, route, "updated")
+	progress(appName, route, "updated")
 	return nil
 }
 
+// pinnedImage returns the image by digest with --pin-digest: the digest the
+// function file recorded for its image, or else the one of the local image.
+func pinnedImage(c *cli.Context, image string, ff *funcfile) (string, error) {
+	if !c.Bool("pin-digest") || strings.Contains(image, "@") {
+		return image, nil
+	}
+	if ff != nil && image == ff.FullName() {
+		return pinnedFuncImage(ff)
+	}
+	return dockerdigest(image)
+}
+
+// headersFlag parses the headers given with --headers, as name=value1;value2.
+func headersFlag(c *cli.Context) map[string][]string {
+	headers := map[string][]string{}
+	for _, header := range c.StringSlice("headers") {
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) == 2 {
+			headers[parts[0]] = strings.Split(parts[1], ";")
+		}
+	}
+	return headers
+}
+
+// routeConfigHeaders returns the config and headers of the function file, if
+// any, as interpolated when parsed, those given with --config and --headers
+// taking precedence.
+func routeConfigHeaders(ff *funcfile, c *cli.Context) (map[string]string, map[string][]string) {
+	config := make(map[string]string)
+	headers := make(map[string][]string)
+	if ff != nil {
+		for k, v := range ff.Config {
+			config[k] = v
+		}
+		for k, v := range ff.Headers {
+			headers[k] = []string{v}
+		}
+	}
+	for k, v := range extractEnvConfig(c.StringSlice("config")) {
+		config[k] = v
+	}
+	for k, v := range headersFlag(c) {
+		headers[k] = v
+	}
+	return config, headers
+}
+
 func (a *routesCmd) configSet(c *cli.Context) error {
-	if len(c.Args()) < 4 {
-		return errors.New("error: route configuration updates tak four arguments: an app name, a path, a key and a value")
+	args, err := routeArgs(c, "app", "path", "key", "value")
+	if err != nil {
+		return err
 	}
 
-	appName := c.Args().Get(0)
-	route := c.Args().Get(1)
-	key := c.Args().Get(2)
-	value := c.Args().Get(3)
+	appName := args.Get(0)
+	route := args.Get(1)
+	key := args.Get(2)
+	value := args.Get(3)
 
 	patchRoute := fnmodels.Route{
 		Config: make(map[string]string),
@@ -557,23 +1204,24 @@ func (a *routesCmd) configSet(c *cli.Context) error {
 
 	patchRoute.Config[key] = value
 
-	err := a.patchRoute(appName, route, &patchRoute)
+	err = a.patchRoute(cmdContext(), appName, route, &patchRoute)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(appName, route, "updated", key, "with", value)
+	progress(appName, route, "updated", key, "with", value)
 	return nil
 }
 
 func (a *routesCmd) configUnset(c *cli.Context) error {
-	if len(c.Args()) < 3 {
-		return errors.New("error: route configuration updates take three arguments: an app name, a path and a key")
+	args, err := routeArgs(c, "app", "path", "key")
+	if err != nil {
+		return err
 	}
 
-	appName := c.Args().Get(0)
-	route := c.Args().Get(1)
-	key := c.Args().Get(2)
+	appName := args.Get(0)
+	route := args.Get(1)
+	key := args.Get(2)
 
 	patchRoute := fnmodels.Route{
 		Config: make(map[string]string),
@@ -581,38 +1229,33 @@ func (a *routesCmd) configUnset(c *cli.Context) error {
 
 	patchRoute.Config["-"+key] = ""
 
-	err := a.patchRoute(appName, route, &patchRoute)
+	err = a.patchRoute(cmdContext(), appName, route, &patchRoute)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("removed key '%s' from the route '%s%s'", key, appName, key)
+	progressf("removed key '%s' from the route '%s%s'\n", key, appName, route)
 	return nil
 }
 
 func (a *routesCmd) inspect(c *cli.Context) error {
-	if len(c.Args()) < 2 {
-		return errors.New("error: routes listing takes three arguments: an app name and a path")
+	args, err := routeArgs(c, "app", "path")
+	if err != nil {
+		return err
 	}
 
-	appName := c.Args().Get(0)
-	route := c.Args().Get(1)
-	prop := c.Args().Get(2)
+	appName := args.Get(0)
+	route := args.Get(1)
+	prop := args.Get(2)
 
 	resp, err := a.client.Routes.GetAppsAppRoutesRoute(&apiroutes.GetAppsAppRoutesRouteParams{
-		Context: context.Background(),
+		Context: cmdContext(),
 		App:     appName,
 		Route:   route,
 	})
 
 	if err != nil {
-		switch err.(type) {
-		case *apiroutes.GetAppsAppRoutesRouteNotFound:
-			return fmt.Errorf("error: %v", err.(*apiroutes.GetAppsAppRoutesRouteNotFound).Payload.Error.Message)
-		case *apiroutes.GetAppsAppRoutesRouteDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiroutes.GetAppsAppRoutesRouteDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+		return apiError(err)
 	}
 
 	enc := json.NewEncoder(os.Stdout)
@@ -644,28 +1287,37 @@ func (a *routesCmd) inspect(c *cli.Context) error {
 }
 
 func (a *routesCmd) delete(c *cli.Context) error {
-	if len(c.Args()) < 2 {
-		return errors.New("error: routes delete takes two arguments: an app name and a path")
+	if c.Bool("all-apps") || c.String("selector") != "" {
+		return a.bulkDelete(c)
+	}
+	args, err := routeArgs(c, "app", "path")
+	if err != nil {
+		return err
 	}
 
-	appName := c.Args().Get(0)
-	route := c.Args().Get(1)
+	appName := args.Get(0)
+	route := args.Get(1)
 
-	_, err := a.client.Routes.DeleteAppsAppRoutesRoute(&apiroutes.DeleteAppsAppRoutesRouteParams{
-		Context: context.Background(),
-		App:     appName,
-		Route:   route,
-	})
-	if err != nil {
-		switch err.(type) {
-		case *apiroutes.DeleteAppsAppRoutesRouteNotFound:
-			return fmt.Errorf("error: %v", err.(*apiroutes.DeleteAppsAppRoutesRouteNotFound).Payload.Error.Message)
-		case *apiroutes.DeleteAppsAppRoutesRouteDefault:
-			return fmt.Errorf("unexpected error: %v", err.(*apiroutes.DeleteAppsAppRoutesRouteDefault).Payload.Error.Message)
-		}
-		return fmt.Errorf("unexpected error: %v", err)
+	if err := a.deleteRoute(cmdContext(), appName, route); err != nil {
+		return err
 	}
 
-	fmt.Println(appName, route, "deleted")
+	progress(appName, route, "deleted")
 	return nil
 }
+
+// deleteRoute deletes the route, keeping it in the trash first.
+func (a *routesCmd) deleteRoute(ctx context.Context, appName, route string) error {
+	// offline, the route is kept in the trash by fn sync
+	if !globals.offline {
+		r, err := a.getRoute(appName, route)
+		if err != nil {
+			return err
+		}
+		if err := trashRoute(appName, r); err != nil {
+			return fmt.Errorf("could not keep %s%s in the trash: %v", appName, route, err)
+		}
+	}
+
+	return apiError(fnapi.New(a.client).DeleteRoute(ctx, appName, route))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	apiapps "github.com/iron-io/functions_go/client/apps"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+// bulkConcurrency is how many routes bulk commands create or delete at a
+// time by default.
+const bulkConcurrency = 8
+
+type appRoute struct {
+	app, path string
+}
+
+// bulkDelete deletes every route matching the selector, within one app or
+// across all of them, once the user confirmed the list of matches.
+func (a *routesCmd) bulkDelete(c *cli.Context) error {
+	sel, err := parseSelector(c.String("selector"))
+	if err != nil {
+		return err
+	}
+	if len(sel) == 0 {
+		return usageError("bulk delete requires a --selector")
+	}
+	parallel, err := parallelism(c)
+	if err != nil {
+		return err
+	}
+
+	var appNames []string
+	if c.Bool("all-apps") {
+		appNames, err = a.appNames()
+		if err != nil {
+			return err
+		}
+	} else {
+		app := firstNonEmpty(c.String("app"), c.Args().First())
+		if app == "" {
+			return usageError("bulk delete takes an app name, or --all-apps")
+		}
+		appNames = []string{app}
+	}
+
+	var matches []appRoute
+	for _, appName := range appNames {
+		resp, err := a.client.Routes.GetAppsAppRoutes(&apiroutes.GetAppsAppRoutesParams{
+			Context: cmdContext(),
+			App:     appName,
+		})
+		if err != nil {
+			return apiError(err)
+		}
+		for _, route := range resp.Payload.Routes {
+			if sel.matches(route.Config) {
+				matches = append(matches, appRoute{appName, route.Path})
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		progress("no routes found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "app", "\t", "path", "\n")
+	for _, m := range matches {
+		fmt.Fprint(w, m.app, "\t", m.path, "\n")
+	}
+	w.Flush()
+
+	if !c.Bool("yes") && !confirm(fmt.Sprintf("delete these %s routes?", formatCount(int64(len(matches))))) {
+		return errors.New("aborted")
+	}
+
+	p := newPool(cmdContext(), parallel)
+	report := newBulkReport("deleted")
+	for _, m := range matches {
+		m, item := m, m.app+" "+m.path
+		started := p.run(func(ctx context.Context) {
+			report.finish(ctx, item, a.deleteRoute(ctx, m.app, m.path))
+		})
+		if !started {
+			report.interrupt(item)
+		}
+	}
+	p.wait()
+
+	return report.writeAndErr()
+}
+
+func (a *routesCmd) appNames() ([]string, error) {
+	resp, err := a.client.Apps.GetApps(&apiapps.GetAppsParams{
+		Context: cmdContext(),
+	})
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	var names []string
+	for _, app := range resp.Payload.Apps {
+		names = append(names, app.Name)
+	}
+	return names, nil
+}
+
+// createFromFuncfile creates the routes declared by the function file, the
+// flags given overriding their settings.
+func (a *routesCmd) createFromFuncfile(c *cli.Context, appName string) error {
+	ff, err := loadFuncfile()
+	if err != nil {
+		if _, ok := err.(*notFoundError); ok {
+			return usageError("route path is missing or no function file found")
+		}
+		return err
+	}
+	if len(ff.Paths) == 0 && len(ff.Routes) == 0 {
+		return usageError("route path is missing, and the function file declares no routes")
+	}
+	parallel, err := parallelism(c)
+	if err != nil {
+		return err
+	}
+	routes, err := fndeploy.Routes(ff)
+	if err != nil {
+		return err
+	}
+
+	image, err := pinnedImage(c, ff.FullName(), ff)
+	if err != nil {
+		return err
+	}
+
+	for i := range routes {
+		r := &routes[i]
+		r.Image = image
+		if c.IsSet("memory") {
+			r.Memory = c.Int64("memory")
+		}
+		if c.IsSet("type") {
+			r.Type = c.String("type")
+		}
+		if c.IsSet("format") {
+			r.Format = c.String("format")
+		}
+		if c.IsSet("max-concurrency") {
+			r.MaxConcurrency = int32(c.Int("max-concurrency"))
+		}
+		if c.IsSet("timeout") {
+			to := int64(c.Duration("timeout").Seconds())
+			r.Timeout = &to
+		}
+		if config := extractEnvConfig(c.StringSlice("config")); len(config) > 0 {
+			if r.Config == nil {
+				r.Config = make(map[string]string)
+			}
+			for k, v := range config {
+				r.Config[k] = v
+			}
+		}
+		if headers := headersFlag(c); len(headers) > 0 {
+			if r.Headers == nil {
+				r.Headers = make(map[string][]string)
+			}
+			for k, v := range headers {
+				r.Headers[k] = v
+			}
+		}
+	}
+
+	warnQuota(os.Stderr, a.client, appName, routes)
+	sent := make([]*fnmodels.Route, len(routes))
+	for i := range routes {
+		sent[i] = &routes[i]
+	}
+	if err := checkRouteCompat(sent...); err != nil {
+		return err
+	}
+
+	p := newPool(cmdContext(), parallel)
+	report := newBulkReport("created")
+	for i := range routes {
+		r := &routes[i]
+		started := p.run(func(ctx context.Context) {
+			_, err := a.client.Routes.PostAppsAppRoutes(&apiroutes.PostAppsAppRoutesParams{
+				Context: ctx,
+				App:     appName,
+				Body:    &fnmodels.RouteWrapper{Route: r},
+			})
+			report.finish(ctx, r.Path, apiError(err))
+		})
+		if !started {
+			report.interrupt(r.Path)
+		}
+	}
+	p.wait()
+	return report.writeAndErr()
+}
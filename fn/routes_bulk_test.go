@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+func TestBulkDelete(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer func(exiter func(int)) { cli.OsExiter = exiter }(cli.OsExiter)
+	cli.OsExiter = func(int) {}
+	defer func(w io.Writer) { cli.ErrWriter = w }(cli.ErrWriter)
+	cli.ErrWriter = ioutil.Discard
+
+	routes := map[string]map[string]string{
+		"/preview-api":  {"env": "preview", "team": "api"},
+		"/preview-web":  {"env": "preview", "team": "web"},
+		"/preview-core": {"env": "preview", "team": "core"},
+		"/prod-api":     {"env": "prod", "team": "api"},
+		"/untagged":     nil,
+	}
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, "/v1/apps/myapp/routes")
+		switch {
+		case r.Method == "GET" && path == "":
+			var ws fnmodels.RoutesWrapper
+			for p, config := range routes {
+				ws.Routes = append(ws.Routes, &fnmodels.Route{Path: p, Image: "acme" + p, Config: config})
+			}
+			json.NewEncoder(w).Encode(ws)
+		case r.Method == "GET" && routes[path] != nil:
+			json.NewEncoder(w).Encode(fnmodels.RouteWrapper{Route: &fnmodels.Route{Path: path, Image: "acme" + path, Config: routes[path]}})
+		case r.Method == "DELETE" && path == "/preview-web":
+			// one of the routes fails to be deleted
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "route in use"}})
+		case r.Method == "DELETE":
+			deleted = append(deleted, path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer os.Setenv("API_URL", os.Getenv("API_URL"))
+	os.Setenv("API_URL", srv.URL)
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.apiURL = srv.URL
+
+	err = newFn().Run([]string{"fn", "routes", "delete", "--selector", "env=preview,team!=core", "--yes", "myapp"})
+	if e, ok := err.(*fnError); !ok || e.Kind != kindPartial {
+		t.Errorf("expected a partial failure, got %v", err)
+	}
+	sort.Strings(deleted)
+	if want := []string{"/preview-api"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("expected %v deleted, got %v", want, deleted)
+	}
+
+	deleted = nil
+	if err := newFn().Run([]string{"fn", "routes", "delete", "--selector", "env=staging", "--yes", "myapp"}); err != nil {
+		t.Errorf("expected no match to succeed, got %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("expected nothing deleted without match, got %v", deleted)
+	}
+
+	if err := newFn().Run([]string{"fn", "routes", "delete", "--selector", "env", "--yes", "myapp"}); err == nil {
+		t.Error("expected an invalid selector to be refused")
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	fnapi "github.com/iron-io/functions/fn/pkg/client"
+)
+
+// conflictError reports the fields of a route someone else changed meanwhile,
+// as they were, are and would have been.
+func conflictError(e *fnapi.ConflictError) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "route %s%s was changed by someone else meanwhile, nothing was updated\n", e.App, e.Path)
+	w := tabwriter.NewWriter(&buf, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "field", "\t", "was", "\t", "theirs", "\t", "yours", "\n")
+	for _, c := range e.Conflicts {
+		fmt.Fprint(w, c.Field, "\t", orNone(c.Base), "\t", orNone(c.Theirs), "\t", orNone(c.Yours), "\n")
+	}
+	w.Flush()
+	return &fnError{Kind: kindConflict, Message: strings.TrimSpace(buf.String())}
+}
+
+func orNone(v interface{}) interface{} {
+	if v == nil {
+		return "-"
+	}
+	return v
+}
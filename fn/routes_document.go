@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// With --from-json, routes are created or updated from a document holding the
+// whole route, as fn routes inspect prints it or wrapped as the API takes it.
+// The document is sent as it is read, thus fields fn does not know of reach
+// the server too.
+
+var fromJSONFlag = cli.StringFlag{
+	Name:  "from-json",
+	Usage: "take the route from `file`, - for stdin: a route as routes inspect prints it, or {\"route\": ...}, in JSON or YAML",
+}
+
+// routeFieldFlags are the flags --from-json replaces.
+var routeFieldFlags = []string{"image", "memory", "type", "config", "headers", "format", "max-concurrency", "timeout"}
+
+// readRouteDocument reads the route of the document at file, - for stdin.
+func readRouteDocument(file string) (map[string]interface{}, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if file == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRouteDocument(file, b)
+}
+
+func parseRouteDocument(file string, b []byte) (map[string]interface{}, error) {
+	// YAML reads JSON documents as well
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, usageError("%s: %v", file, err)
+	}
+	doc, ok := ffile.NormalizeTree(v).(map[string]interface{})
+	if !ok {
+		return nil, usageError("%s: expected a route", file)
+	}
+	if w, ok := doc["route"]; ok && len(doc) == 1 {
+		if doc, ok = w.(map[string]interface{}); !ok {
+			return nil, usageError("%s: expected a route under route", file)
+		}
+	}
+	return doc, nil
+}
+
+// routeDocumentPath returns the path of the route of doc, which routePath,
+// given on the command line, sets when not empty.
+func routeDocumentPath(doc map[string]interface{}, routePath string) (string, error) {
+	if routePath != "" {
+		return routePath, nil
+	}
+	p, _ := doc["path"].(string)
+	if p == "" {
+		return "", usageError("the route has no path, add it to the document or give it on the command line")
+	}
+	return path.Join("/", p), nil
+}
+
+// knownRoute decodes the fields of doc fn knows of.
+func knownRoute(doc map[string]interface{}) (*fnmodels.Route, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var r fnmodels.Route
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, usageError("invalid route: %v", err)
+	}
+	return &r, nil
+}
+
+func checkRouteDocumentFlags(c *cli.Context) error {
+	for _, name := range routeFieldFlags {
+		if c.IsSet(name) {
+			return usageError("--from-json cannot be used with --%s, set it in the document instead", name)
+		}
+	}
+	return nil
+}
+
+// createFromDocument creates the route of the document given with
+// --from-json in appName.
+func (a *routesCmd) createFromDocument(c *cli.Context, appName, routePath string) error {
+	if err := checkRouteDocumentFlags(c); err != nil {
+		return err
+	}
+	doc, err := readRouteDocument(c.String("from-json"))
+	if err != nil {
+		return err
+	}
+	if doc["path"], err = routeDocumentPath(doc, routePath); err != nil {
+		return err
+	}
+	r, err := knownRoute(doc)
+	if err != nil {
+		return err
+	}
+	if r.Image == "" {
+		return usageError("the route has no image")
+	}
+	if err := checkRouteCompat(r); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"route": doc})
+	if err != nil {
+		return err
+	}
+	var w fnmodels.RouteWrapper
+	if err := apiCall("POST", path.Join("/v1/apps", url.PathEscape(appName), "routes"), bytes.NewReader(body), &w); err != nil {
+		return err
+	}
+	if w.Route != nil {
+		progress(w.Route.Path, "created with", w.Route.Image)
+	}
+	return nil
+}
+
+// updateFromDocument updates the route of appName with the fields of the
+// document given with --from-json, leaving the others as they are.
+func (a *routesCmd) updateFromDocument(c *cli.Context, appName, routePath string) error {
+	if err := checkRouteDocumentFlags(c); err != nil {
+		return err
+	}
+	doc, err := readRouteDocument(c.String("from-json"))
+	if err != nil {
+		return err
+	}
+	if routePath, err = routeDocumentPath(doc, routePath); err != nil {
+		return err
+	}
+	// the path of a route cannot be changed
+	delete(doc, "path")
+	r, err := knownRoute(doc)
+	if err != nil {
+		return err
+	}
+	if err := checkRouteCompat(r); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"route": doc})
+	if err != nil {
+		return err
+	}
+	p := path.Join("/v1/apps", url.PathEscape(appName), "routes", routePath)
+	if err := apiCall("PATCH", p, bytes.NewReader(body), nil); err != nil {
+		return err
+	}
+	progress(appName, routePath, "updated")
+	return nil
+}
@@ -1,9 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
 )
 
 func TestEnvAsHeader(t *testing.T) {
@@ -23,3 +40,591 @@ func TestEnvAsHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestSelector(t *testing.T) {
+	config := map[string]string{"env": "preview", "team": "core"}
+
+	cases := []struct {
+		selector string
+		match    bool
+	}{
+		{"", true},
+		{"env=preview", true},
+		{"env=prod", false},
+		{"env=preview,team=core", true},
+		{"env=preview,team!=core", false},
+		{"owner!=bob", true},
+		{"owner=", false},
+	}
+	for _, c := range cases {
+		sel, err := parseSelector(c.selector)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.selector, err)
+			continue
+		}
+		if found := sel.matches(config); found != c.match {
+			t.Errorf("%q: expected match %v, got %v", c.selector, c.match, found)
+		}
+	}
+
+	if _, err := parseSelector("env"); err == nil {
+		t.Error("expected error for a requirement without value")
+	}
+}
+
+func TestCallfn(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "yes")
+		if r.URL.Path == "/r/myapp/hello" && r.Header.Get("X-Foo") != "bar" {
+			t.Errorf("expected custom header, got %v", r.Header)
+		}
+		if r.URL.Path == "/r/myapp/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprint(w, "output")
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	if err := callfn(srv.URL+"/r/myapp/hello", nil, &out, callOptions{include: true, headers: http.Header{"X-Foo": {"bar"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); !strings.HasPrefix(s, "HTTP/1.1 200 OK\r\n") || !strings.Contains(s, "X-Test: yes\r\n") || !strings.HasSuffix(s, "\r\n\r\noutput") {
+		t.Errorf("unexpected output with headers: %q", s)
+	}
+
+	out.Reset()
+	err := callfn(srv.URL+"/r/myapp/fail", nil, &out, callOptions{})
+	e, ok := err.(*fnError)
+	if !ok || e.ExitCode() != 25 || !strings.Contains(e.Message, "output") {
+		t.Errorf("expected a function error carrying the body, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output on error, got %q", out.String())
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	cases := []struct {
+		body, contentType string
+	}{
+		{` {"name": "Johnny"}`, "application/json"},
+		{"name=Johnny", "text/plain; charset=utf-8"},
+		{"\x89PNG\r\n\x1a\n", "image/png"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		br := bufio.NewReader(strings.NewReader(c.body))
+		if got := sniffContentType(br); got != c.contentType {
+			t.Errorf("expected %q to be %s, got %s", c.body, c.contentType, got)
+		}
+		if rest, _ := br.ReadString(0); rest != c.body {
+			t.Errorf("sniffing consumed the body, %q left", rest)
+		}
+	}
+
+	if isText("image/png") || !isText("application/json; charset=utf-8") || !isText("") {
+		t.Error("unexpected text detection")
+	}
+}
+
+func TestMultipartForm(t *testing.T) {
+	f, err := ioutil.TempFile("", "fn-form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("file content")
+	f.Close()
+
+	body, contentType, err := multipartForm([]string{"name=Johnny", "upload=@" + f.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form, err := multipart.NewReader(body, params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := form.Value["name"]; len(v) != 1 || v[0] != "Johnny" {
+		t.Errorf("unexpected name field %v", v)
+	}
+	if fh := form.File["upload"]; len(fh) != 1 || fh[0].Size != int64(len("file content")) {
+		t.Errorf("unexpected upload field %v", fh)
+	}
+
+	if _, _, err := multipartForm([]string{"nofield"}); err == nil {
+		t.Error("expected an invalid field to be rejected")
+	}
+}
+
+func TestCallfnAsync(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r/myapp/async":
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"call_id":"42"}`)
+		case "/v1/apps/myapp/calls/42":
+			status := "running"
+			if polls++; polls > 1 {
+				status = "success"
+			}
+			fmt.Fprintf(w, `{"call":{"id":"42","status":"%s"}}`, status)
+		case "/v1/apps/myapp/calls/42/log":
+			fmt.Fprint(w, `{"log":{"log":"done"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+
+	var out bytes.Buffer
+	if err := callfn(srv.URL+"/r/myapp/async", nil, &out, callOptions{app: "myapp"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "42\n" {
+		t.Errorf("expected the call ID alone, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := callfn(srv.URL+"/r/myapp/async", nil, &out, callOptions{app: "myapp", wait: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "done" || polls != 2 {
+		t.Errorf("expected the call log after 2 polls, got %q after %d", out.String(), polls)
+	}
+}
+
+func TestParseCallMetadata(t *testing.T) {
+	h := http.Header{}
+	h.Set("Fn-Container-Id", "c0ffee")
+	h.Set("Fn-Slot", "3")
+	h.Set("Fn-Queue-Wait", "12.5")
+
+	m := parseCallMetadata(h)
+	if m.ContainerID != "c0ffee" || m.Slot != "3" || m.QueueWait != 12500*time.Microsecond {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+
+	h.Set("Fn-Queue-Wait", "2s")
+	if m := parseCallMetadata(h); m.QueueWait != 2*time.Second {
+		t.Errorf("expected a 2s queue wait, got %v", m.QueueWait)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+
+	for _, image := range []string{"iron/hello:1", "iron/hello:2"} {
+		if err := trashRoute("myapp", &fnmodels.Route{Path: "/hello", Image: image}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := trashList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Route.Image != "iron/hello:2" || all[0].App != "myapp" {
+		t.Errorf("expected both snapshots, the latest first, got %+v", all)
+	}
+}
+
+func TestListCalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/apps/myapp/calls" || r.URL.Query().Get("status") != "error" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// a server ignoring the filter
+		fmt.Fprint(w, `{"calls":[
+			{"id":"1","path":"/hello","status":"error","created_at":"2017-01-01T10:00:00Z"},
+			{"id":"2","path":"/hello","status":"success","created_at":"2017-01-01T11:00:00Z"},
+			{"id":"3","path":"/hello","status":"error","created_at":"2017-01-01T12:00:00Z"},
+			{"id":"4","path":"/other","status":"error","created_at":"2017-01-01T13:00:00Z"}
+		]}`)
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+
+	calls, err := listCalls("myapp", callFilter{Path: "/hello", Status: "error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0].ID != "3" || calls[1].ID != "1" {
+		t.Errorf("expected calls 3 and 1, got %+v", calls)
+	}
+}
+
+func TestCallfnNDJSON(t *testing.T) {
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		br := bufio.NewReader(r.Body)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				break
+			}
+			received <- line
+		}
+		close(received)
+		w.Header().Set("Content-Type", r.Header.Get("Accept"))
+		fmt.Fprint(w, "{\"n\":1}\n{\"n\":2}\n")
+	}))
+	defer srv.Close()
+	defer func(t http.RoundTripper) { transport = t }(transport)
+	transport = &retryTransport{next: http.DefaultTransport, retries: 2, backoff: time.Millisecond}
+
+	pr, pw := io.Pipe()
+	var out bytes.Buffer
+	done := make(chan error)
+	go func() { done <- callfn(srv.URL, pr, &out, callOptions{ndjson: true}) }()
+
+	// each line must reach the function before the next one is written
+	for _, line := range []string{"{\"a\":1}\n", "\n", "{\"a\":2}"} {
+		if _, err := io.WriteString(pw, line); err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			// the last line is only known to be complete at the end
+			pw.Close()
+		}
+		select {
+		case got := <-received:
+			if got != strings.TrimSuffix(line, "\n")+"\n" {
+				t.Errorf("expected %q, got %q", line, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("line %q was not streamed", line)
+		}
+	}
+	pw.Close()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Errorf("unexpected response %q", out.String())
+	}
+}
+
+func TestFailOnEmpty(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+	defer func(exiter func(int)) { cli.OsExiter = exiter }(cli.OsExiter)
+	cli.OsExiter = func(int) {}
+	defer func(w io.Writer) { cli.ErrWriter = w }(cli.ErrWriter)
+	cli.ErrWriter = ioutil.Discard
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/apps/myapp/routes":
+			fmt.Fprint(w, `{"routes": [{"path": "/hello", "image": "acme/hello"}]}`)
+		case "/v1/apps/myapp/calls":
+			fmt.Fprint(w, `{"calls": [{"id": "1", "path": "/hello", "status": "success"}]}`)
+		case "/v1/apps/empty/routes":
+			fmt.Fprint(w, `{"routes": []}`)
+		case "/v1/apps/empty/calls":
+			fmt.Fprint(w, `{"calls": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer os.Setenv("API_URL", os.Getenv("API_URL"))
+	os.Setenv("API_URL", srv.URL)
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.apiURL = srv.URL
+
+	for _, args := range [][]string{
+		{"trash", "list"},
+		{"routes", "list", "empty"},
+		{"calls", "list", "empty"},
+	} {
+		if err := newFn().Run(append([]string{"fn"}, args...)); err != nil {
+			t.Errorf("%s: expected an empty list to succeed, got %v", strings.Join(args, " "), err)
+		}
+		err = newFn().Run(append([]string{"fn", args[0], args[1], "--fail-on-empty"}, args[2:]...))
+		if e, ok := err.(*fnError); !ok || e.ExitCode() != 2 {
+			t.Errorf("%s --fail-on-empty: expected an error exiting with 2, got %v", strings.Join(args, " "), err)
+		}
+	}
+	for _, args := range [][]string{
+		{"routes", "list", "--fail-on-empty", "myapp"},
+		{"calls", "list", "--fail-on-empty", "myapp"},
+	} {
+		if err := newFn().Run(append([]string{"fn"}, args...)); err != nil {
+			t.Errorf("%s: expected a list to succeed, got %v", strings.Join(args, " "), err)
+		}
+	}
+}
+
+func TestRouteURL(t *testing.T) {
+	defer func(g globalOptions) { globals = g }(globals)
+
+	for apiURL, expected := range map[string]string{
+		"http://localhost:8080":          "http://localhost:8080/r/myapp/hello",
+		"https://fn.example.org/api/v1/": "https://fn.example.org/api/v1/r/myapp/hello",
+	} {
+		globals.apiURL = apiURL
+		if u := routeURL("myapp", "hello").String(); u != expected {
+			t.Errorf("expected %s for %s, got %s", expected, apiURL, u)
+		}
+	}
+}
+
+func TestRouteConfigHeaders(t *testing.T) {
+	set := flag.NewFlagSet("create", flag.ContinueOnError)
+	config := cli.StringSlice{"DB=postgres://db.prod"}
+	set.Var(&config, "config", "")
+	headers := cli.StringSlice{"Cache-Control=no-cache;no-store"}
+	set.Var(&headers, "headers", "")
+	c := cli.NewContext(nil, set, nil)
+
+	ff := &funcfile{
+		Config:  map[string]string{"DB": "postgres://db.staging", "QUEUE": "orders", "PATH": "$HOME/bin"},
+		Headers: map[string]string{"Cache-Control": "max-age=60", "Content-Type": "text/plain"},
+	}
+	cfg, hdrs := routeConfigHeaders(ff, c)
+	if cfg["DB"] != "postgres://db.prod" || cfg["QUEUE"] != "orders" {
+		t.Errorf("expected the config of the function file, overridden by flags, got %v", cfg)
+	}
+	if cfg["PATH"] != "$HOME/bin" {
+		t.Errorf("expected the config of the function file to be expanded only when parsed, got %s", cfg["PATH"])
+	}
+	if strings.Join(hdrs["Cache-Control"], ";") != "no-cache;no-store" || strings.Join(hdrs["Content-Type"], ";") != "text/plain" {
+		t.Errorf("expected the headers of the function file, overridden by flags, got %v", hdrs)
+	}
+
+	cfg, hdrs = routeConfigHeaders(nil, c)
+	if len(cfg) != 1 || len(hdrs) != 1 {
+		t.Errorf("expected only the flags without function file, got %v and %v", cfg, hdrs)
+	}
+}
+
+func TestPinnedImage(t *testing.T) {
+	const digest = "sha256:4fd0cbdf0d8d2ef5d5ac4e8c8de8e08e07aaa1b4e2b7c2a1e1b5c1bd3c3e2b8e"
+	set := flag.NewFlagSet("update", flag.ContinueOnError)
+	set.Bool("pin-digest", true, "")
+	c := cli.NewContext(nil, set, nil)
+
+	ff := &funcfile{Name: "acme/hello", Version: "0.0.2", ImageDigest: digest}
+	image, err := pinnedImage(c, ff.FullName(), ff)
+	if err != nil || image != "acme/hello@"+digest {
+		t.Errorf("expected the image by the digest of the function file, got %q, %v", image, err)
+	}
+	if image, err := pinnedImage(c, "acme/hello@"+digest, nil); err != nil || image != "acme/hello@"+digest {
+		t.Errorf("expected images by digest to be kept, got %q, %v", image, err)
+	}
+	if _, err := pinnedImage(c, "acme/hello:0.0.2", &funcfile{Name: "acme/hello", Version: "0.0.2"}); err == nil {
+		t.Error("expected an error for a function file without digest")
+	}
+
+	set.Set("pin-digest", "false")
+	if image, err := pinnedImage(c, ff.FullName(), ff); err != nil || image != "acme/hello:0.0.2" {
+		t.Errorf("expected the image by tag without --pin-digest, got %q, %v", image, err)
+	}
+}
+
+func TestRouteFromDocument(t *testing.T) {
+	var got map[string]map[string]interface{}
+	var method, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		method, path = r.Method, r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(got)
+	}))
+	defer srv.Close()
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = srv.URL
+
+	dir, err := ioutil.TempDir("", "fn-route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// as routes inspect prints it, with a field fn does not know of
+	file := filepath.Join(dir, "route.json")
+	err = ioutil.WriteFile(file, []byte(`{"path": "/hello", "image": "iron/hello:0.0.2", "memory": 256, "retries": 3}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("create", flag.ContinueOnError)
+	set.String("from-json", file, "")
+	c := cli.NewContext(nil, set, nil)
+	r := routesCmd{}
+	if err := r.createFromDocument(c, "myapp", ""); err != nil {
+		t.Fatal(err)
+	}
+	if method != "POST" || path != "/v1/apps/myapp/routes" {
+		t.Errorf("expected the route to be posted to the routes of myapp, got %s %s", method, path)
+	}
+	if route := got["route"]; route["path"] != "/hello" || route["memory"] != float64(256) || route["retries"] != float64(3) {
+		t.Errorf("expected the whole document to be sent, got %v", got)
+	}
+
+	// wrapped, in YAML, the path given on the command line
+	err = ioutil.WriteFile(file, []byte("route:\n  path: /other\n  config:\n    DB: postgres\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.updateFromDocument(c, "myapp", "/hello"); err != nil {
+		t.Fatal(err)
+	}
+	if method != "PATCH" || path != "/v1/apps/myapp/routes/hello" {
+		t.Errorf("expected /hello to be patched, got %s %s", method, path)
+	}
+	if route := got["route"]; route["path"] != nil || route["config"].(map[string]interface{})["DB"] != "postgres" {
+		t.Errorf("expected the config to be sent without the path, got %v", got)
+	}
+
+	memory := flag.NewFlagSet("create", flag.ContinueOnError)
+	memory.String("from-json", file, "")
+	memory.Int64("memory", 0, "")
+	memory.Parse([]string{"--memory", "512"})
+	if err := r.createFromDocument(cli.NewContext(nil, memory, nil), "myapp", ""); err == nil {
+		t.Error("expected --from-json with --memory to be rejected")
+	}
+}
+
+func TestCallfnLargePayload(t *testing.T) {
+	size := int64(2 << 30)
+	if testing.Short() {
+		size = 64 << 20
+	}
+
+	type received struct {
+		n             int64
+		contentLength int64
+		chunked       bool
+	}
+	var got received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// payloads cut short are read until then
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		got = received{n, r.ContentLength, len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked"}
+	}))
+	defer srv.Close()
+
+	// pipe feeds size bytes, as a command piped into fn call would
+	pipe := func(size int64) io.Reader {
+		pr, pw := io.Pipe()
+		go func() {
+			chunk := bytes.Repeat([]byte("x"), 1<<20)
+			for left := size; left > 0; left -= int64(len(chunk)) {
+				if left < int64(len(chunk)) {
+					chunk = chunk[:left]
+				}
+				if _, err := pw.Write(chunk); err != nil {
+					return
+				}
+			}
+			pw.Close()
+		}()
+		return pr
+	}
+
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > peak {
+				peak = m.HeapAlloc
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+	err := callfn(srv.URL, pipe(size), ioutil.Discard, callOptions{contentType: "application/octet-stream"})
+	close(done)
+	<-sampled
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.n != size || !got.chunked {
+		t.Errorf("got %d bytes, chunked: %v, want %d bytes chunked", got.n, got.chunked, size)
+	}
+	if peak > 64<<20 {
+		t.Errorf("sending %d bytes took up to %d bytes of memory, the payload is not streamed", size, peak)
+	}
+
+	// sizes told are sent, pipes included
+	const told = 8 << 20
+	err = callfn(srv.URL, pipe(told), ioutil.Discard, callOptions{contentLength: told})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.n != told || got.contentLength != told || got.chunked {
+		t.Errorf("got %d bytes, Content-Length %d, chunked: %v, want %d bytes with their size", got.n, got.contentLength, got.chunked, told)
+	}
+	if err := callfn(srv.URL, pipe(told-1), ioutil.Discard, callOptions{contentLength: told}); err == nil {
+		t.Error("a payload shorter than told was sent")
+	}
+}
+
+func TestCallContentLength(t *testing.T) {
+	f, err := ioutil.TempFile("", "payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString("0123456789")
+	f.Seek(2, io.SeekStart)
+
+	cases := []struct {
+		content io.Reader
+		opts    callOptions
+		want    int64
+	}{
+		{f, callOptions{}, 8},
+		{strings.NewReader("abc"), callOptions{}, 3},
+		{strings.NewReader("abc"), callOptions{chunked: true}, -1},
+		{bufio.NewReader(strings.NewReader("abc")), callOptions{}, 0},
+		{bufio.NewReader(strings.NewReader("abc")), callOptions{contentLength: 3}, 3},
+		{nil, callOptions{contentLength: 3}, 0},
+	}
+	for i, c := range cases {
+		req, err := newCallRequest("http://localhost/r/myapp/hello", c.content, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.ContentLength != c.want {
+			t.Errorf("case %d: got Content-Length %d, want %d", i, req.ContentLength, c.want)
+		}
+	}
+}
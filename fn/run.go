@@ -1,13 +1,23 @@
 package main
 
 import (
-	"errors"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httputil"
 	"os"
-	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	fnmodels "github.com/iron-io/functions_go/models"
 	"github.com/urfave/cli"
 )
 
@@ -18,7 +28,7 @@ func run() cli.Command {
 		Name:      "run",
 		Usage:     "run a function locally",
 		ArgsUsage: "USERNAME/image:tag",
-		Flags:     append(runflags(), []cli.Flag{}...),
+		Flags:     append(runflags(), hotFlag),
 		Action:    r.run,
 	}
 }
@@ -26,7 +36,7 @@ func run() cli.Command {
 type runCmd struct{}
 
 func runflags() []cli.Flag {
-	return []cli.Flag{
+	return append([]cli.Flag{
 		cli.StringSliceFlag{
 			Name:  "e",
 			Usage: "select environment variables to be sent to function",
@@ -36,37 +46,253 @@ func runflags() []cli.Flag {
 			Usage: "select container links for the function",
 		},
 		cli.StringFlag{
-			Name: "method",
+			Name:  "method",
 			Usage: "http method for function",
 		},
-	}
+		cli.StringFlag{
+			Name:  "route",
+			Usage: "`PATH` of the route of the function file whose settings are used, the first one by default",
+		},
+		cli.StringSliceFlag{
+			Name:  "config",
+			Usage: "add `KEY=VALUE` to the config of the route",
+		},
+		cli.Int64Flag{
+			Name:  "memory,m",
+			Usage: "memory limit in MiB, that of the route by default",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "time the function has to answer, that of the route by default",
+		},
+		cli.StringFlag{
+			Name:  "format,f",
+			Usage: "IO format - default or http, that of the route by default",
+		},
+	}, requestFlags()...)
+}
+
+// runOptions are how a function is run locally, as the server runs it.
+type runOptions struct {
+	method string
+	// env is what the server tells the function, as KEY=value.
+	env   []string
+	links []string
+	// memory is in MiB.
+	memory  int64
+	timeout time.Duration
+	format  string
+	// entrypoint overrides that of the image, and ports of the container are
+	// published on the same ports of localhost.
+	entrypoint []string
+	ports      []int
+	// binds are volumes of the container, as HOST:CONTAINER paths.
+	binds []string
 }
 
 func (r *runCmd) run(c *cli.Context) error {
+	route := fnmodels.Route{Path: "/"}
 	image := c.Args().First()
 	if image == "" {
 		ff, err := loadFuncfile()
 		if err != nil {
 			if _, ok := err.(*notFoundError); ok {
-				return errors.New("error: image name is missing or no function file found")
+				return usageError("image name is missing or no function file found")
 			}
 			return err
 		}
 		image = ff.FullName()
+
+		if route, err = funcfileRoute(ff, c.String("route")); err != nil {
+			return err
+		}
+	}
+
+	body, contentType, err := payload(c)
+	if err != nil {
+		return err
+	}
+	opts, err := runOptionsFrom(c, route, contentType)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("hot") {
+		switch opts.format {
+		case "json":
+			return usageError("the json format is not implemented by the server, hot functions use the http one")
+		case "", "default":
+			opts.format = "http"
+		}
+		calls, prompt := hotCalls(body)
+		return runHot(image, calls, prompt, os.Stdout, os.Stderr, opts)
+	}
+	return runff(image, body, os.Stdout, os.Stderr, opts)
+}
+
+// runOptionsFrom are the options of the run flags, on top of the settings of
+// the route, the payload being of contentType.
+func runOptionsFrom(c *cli.Context, route fnmodels.Route, contentType string) (runOptions, error) {
+	headers, query, err := headersAndQuery(c)
+	if err != nil {
+		return runOptions{}, err
+	}
+	if contentType != "" {
+		headers.Set("Content-Type", contentType)
+	}
+
+	opts := routeRunOptions(route, extractEnvConfig(c.StringSlice("config")))
+	opts.method = c.String("method")
+	opts.links = c.StringSlice("link")
+	if c.IsSet("memory") {
+		opts.memory = c.Int64("memory")
+	}
+	if c.IsSet("timeout") {
+		opts.timeout = c.Duration("timeout")
+	}
+	if c.IsSet("format") {
+		opts.format = c.String("format")
+	}
+
+	// what the server would tell the function about the request
+	requestURL := route.Path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	opts.env = append(opts.env, kvEq("REQUEST_URL", requestURL))
+	for k, v := range headers {
+		opts.env = append(opts.env, kvEq(toEnvName("HEADER", k), strings.Join(v, " ")))
+	}
+	for _, e := range c.StringSlice("e") {
+		opts.env = append(opts.env, extractEnvVar(e))
+	}
+	return opts, nil
+}
+
+// funcfileRoute is the route of the function file at path, or its first one,
+// with its secrets resolved.
+func funcfileRoute(ff *funcfile, path string) (fnmodels.Route, error) {
+	routes, err := fndeploy.Routes(ff)
+	if err != nil {
+		return fnmodels.Route{}, err
+	}
+	route := routes[0]
+	if path != "" {
+		found := false
+		for _, r := range routes {
+			if r.Path == path {
+				route, found = r, true
+			}
+		}
+		if !found {
+			return route, usageError("%s has no route %s", ff.Name, path)
+		}
+	}
+
+	secrets, err := resolveSecrets(".", ff)
+	if err != nil {
+		return route, err
+	}
+	return *withSecrets(&route, secrets), nil
+}
+
+// routeRunOptions are the settings the server runs the function of the route
+// with, config being added to its own.
+func routeRunOptions(route fnmodels.Route, config map[string]string) runOptions {
+	opts := runOptions{memory: route.Memory, format: route.Format}
+	if route.Timeout != nil {
+		opts.timeout = time.Duration(*route.Timeout) * time.Second
+	}
+
+	all := make(map[string]string)
+	for k, v := range route.Config {
+		all[k] = v
+	}
+	for k, v := range config {
+		all[k] = v
 	}
+	var keys []string
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	opts.env = []string{kvEq("ROUTE", route.Path)}
+	for _, k := range keys {
+		// as the server names them
+		opts.env = append(opts.env, kvEq(toEnvName("", k), all[k]))
+	}
+	return opts
+}
 
-	return runff(image, stdin(), os.Stdout, os.Stderr, c.String("method"), c.StringSlice("e"), c.StringSlice("link"))
+// runff runs the image with the Docker daemon as the server would: with the
+// memory limit and timeout of the route, its defaults otherwise, and calls
+// framed as HTTP requests and responses for hot functions of the http format.
+func runff(image string, stdin io.Reader, stdout, stderr io.Writer, opts runOptions) error {
+	c, err := startContainer(image, stdin, stderr, opts)
+	if err != nil {
+		return err
+	}
+	defer c.remove()
+	return c.run(stdin, stdout, stderr, opts.format)
 }
 
-func runff(image string, stdin io.Reader, stdout, stderr io.Writer, method string, restrictedEnv []string, links []string) error {
-	sh := []string{"docker", "run", "--rm", "-i"}
+// run sends stdin to the function started, in the format, and waits for it
+// to answer.
+func (c *runContainer) run(stdin io.Reader, stdout, stderr io.Writer, format string) error {
+	if format == "http" {
+		return newHotFunction(c, stderr).call(stdin, stdout, c.timeout)
+	}
+
+	go func() {
+		if stdin != nil {
+			io.Copy(c.stream.conn, stdin)
+		}
+		c.stream.closeStdin()
+	}()
+	output := make(chan error, 1)
+	go func() { output <- c.stream.demux(stdout, stderr) }()
 
-	var env []string
-	detectedEnv := os.Environ()
-	if len(restrictedEnv) > 0 {
-		detectedEnv = restrictedEnv
+	ctx, cancel := context.WithTimeout(cmdContext(), c.timeout)
+	defer cancel()
+	status, err := c.docker.wait(ctx, c.id)
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		c.docker.kill(c.id)
+		return timeoutError(c.timeout)
+	case context.Canceled:
+		c.docker.kill(c.id)
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
 	}
+	if err := <-output; err != nil {
+		return err
+	}
+	if status != 0 {
+		return &fnError{Kind: kindFunction, Status: http.StatusInternalServerError, Message: fmt.Sprintf("the function exited with status %d", status)}
+	}
+	return nil
+}
 
+func timeoutError(timeout time.Duration) error {
+	return &fnError{Kind: kindFunction, Status: http.StatusGatewayTimeout, Message: fmt.Sprintf("the function timed out after %s", timeout)}
+}
+
+// runContainer is a container of a function started, attached to.
+type runContainer struct {
+	docker  *dockerClient
+	id      string
+	stream  *dockerStream
+	env     []string
+	timeout time.Duration
+}
+
+// startContainer starts the container of the function, stdin telling the
+// method of calls which do not set it.
+func startContainer(image string, stdin io.Reader, stderr io.Writer, opts runOptions) (*runContainer, error) {
+	method := opts.method
 	if method == "" {
 		if stdin == nil {
 			method = "GET"
@@ -74,43 +300,161 @@ func runff(image string, stdin io.Reader, stdout, stderr io.Writer, method strin
 			method = "POST"
 		}
 	}
-	sh = append(sh, "-e", kvEq("METHOD", method))
+	env := append([]string{kvEq("METHOD", method)}, opts.env...)
 
-	for _, e := range detectedEnv {
-		shellvar, envvar := extractEnvVar(e)
-		sh = append(sh, shellvar...)
-		env = append(env, envvar)
+	memory := opts.memory
+	if memory == 0 {
+		memory = defaultMemory
+	}
+	timeout := opts.timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
 	}
 
-	for _, l := range links {
-		sh = append(sh, "--link", l)
+	docker, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := cmdContext()
+	cfg := dockerContainer{
+		Image:        image,
+		Entrypoint:   opts.entrypoint,
+		Env:          env,
+		OpenStdin:    true,
+		StdinOnce:    true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		HostConfig: dockerHostConfig{
+			// no swap, as on the server
+			Memory:     memory << 20,
+			MemorySwap: memory << 20,
+			Links:      opts.links,
+			Binds:      opts.binds,
+		},
+	}
+	for _, port := range opts.ports {
+		p := strconv.Itoa(port) + "/tcp"
+		if cfg.ExposedPorts == nil {
+			cfg.ExposedPorts = make(map[string]struct{})
+			cfg.HostConfig.PortBindings = make(map[string][]dockerPortBinding)
+		}
+		cfg.ExposedPorts[p] = struct{}{}
+		cfg.HostConfig.PortBindings[p] = []dockerPortBinding{{HostIP: "127.0.0.1", HostPort: strconv.Itoa(port)}}
 	}
+	id, err := docker.createContainer(ctx, stderr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &runContainer{docker: docker, id: id, env: env, timeout: timeout}
 
-	dockerenv := []string{"DOCKER_TLS_VERIFY", "DOCKER_HOST", "DOCKER_CERT_PATH", "DOCKER_MACHINE_NAME"}
-	for _, e := range dockerenv {
-		env = append(env, fmt.Sprint(e, "=", os.Getenv(e)))
+	if c.stream, err = docker.attach(id); err != nil {
+		c.remove()
+		return nil, err
+	}
+	if err := docker.start(ctx, id); err != nil {
+		c.remove()
+		return nil, err
 	}
+	return c, nil
+}
+
+// remove removes the container, running or not.
+func (c *runContainer) remove() {
+	if c.stream != nil {
+		c.stream.Close()
+	}
+	c.docker.remove(c.id)
+}
+
+// hotFunction is a function of the http format running in its container,
+// called as the server does: with GET requests carrying the environment of
+// the call as headers, the answer being the body of the response the
+// function writes. The container keeps running between calls.
+type hotFunction struct {
+	c   *runContainer
+	out *bufio.Reader
+}
+
+func newHotFunction(c *runContainer, stderr io.Writer) *hotFunction {
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(c.stream.demux(pw, stderr)) }()
+	return &hotFunction{c, bufio.NewReader(pr)}
+}
+
+// call sends body to the function, writing the body of its response to
+// stdout, and returns the response.
+func (h *hotFunction) call(body io.Reader, stdout io.Writer, timeout time.Duration) error {
+	_, err := h.roundTrip(body, nil, stdout, timeout)
+	return err
+}
+
+// roundTrip calls the function, env adding to, or overriding, the environment
+// of the container for this call.
+func (h *hotFunction) roundTrip(body io.Reader, env []string, stdout io.Writer, timeout time.Duration) (*http.Response, error) {
+	var b bytes.Buffer
+	if body != nil {
+		if _, err := io.Copy(&b, body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest("GET", "/", &b)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range append(h.c.env, env...) {
+		kv := strings.SplitN(e, "=", 2)
+		req.Header.Set(kv[0], kv[1])
+	}
+	req.Header.Set("Content-Length", fmt.Sprint(b.Len()))
+	req.Header.Set("Task-ID", taskID())
+	raw, err := httputil.DumpRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.c.stream.conn.Write(raw); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		res *http.Response
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := http.ReadResponse(h.out, req)
+		if err != nil {
+			done <- result{nil, fmt.Errorf("the function did not answer with an HTTP response: %v", err)}
+			return
+		}
+		defer res.Body.Close()
+		_, err = io.Copy(stdout, res.Body)
+		done <- result{res, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-time.After(timeout):
+		return nil, timeoutError(timeout)
+	}
+}
 
-	sh = append(sh, image)
-	cmd := exec.Command(sh[0], sh[1:]...)
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-	cmd.Env = env
-	return cmd.Run()
+func taskID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
-func extractEnvVar(e string) ([]string, string) {
-	kv := strings.Split(e, "=")
+// extractEnvVar sends the variable e, NAME=value or the NAME of one of fn, as
+// the header NAME.
+func extractEnvVar(e string) string {
+	kv := strings.SplitN(e, "=", 2)
 	name := toEnvName("HEADER", kv[0])
-	sh := []string{"-e", name}
-	var v string
 	if len(kv) > 1 {
-		v = kv[1]
-	} else {
-		v = os.Getenv(kv[0])
+		return kvEq(name, kv[1])
 	}
-	return sh, kvEq(name, v)
+	return kvEq(name, os.Getenv(kv[0]))
 }
 
 func kvEq(k, v string) string {
@@ -5,6 +5,8 @@ package main
 import (
 	"io"
 	"os"
+	"os/exec"
+	"syscall"
 )
 
 func stdin() io.Reader {
@@ -14,3 +16,30 @@ func stdin() io.Reader {
 	}
 	return os.Stdin
 }
+
+func isTerminal(fd int) bool {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return false
+	}
+	return st.Mode&syscall.S_IFMT == syscall.S_IFCHR
+}
+
+// disableEcho stops the terminal from echoing what is typed, until the
+// returned function is called.
+func disableEcho() func() {
+	if !isTerminal(int(os.Stdin.Fd())) {
+		return func() {}
+	}
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-echo")
+	return func() { stty("echo") }
+}
+
+// defaultDockerHost is where the Docker daemon listens when $DOCKER_HOST is
+// not set.
+const defaultDockerHost = "unix:///var/run/docker.sock"
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+// fakeDocker is a Docker daemon running containers which greet what they
+// are sent, as functions of the default format, or of the http one for the
+// acme/hot image.
+type fakeDocker struct {
+	created dockerContainer
+	exited  chan int
+	removed bool
+	// name is that given to the container created, and the container
+	// removed.
+	name string
+	// hang makes containers run until they are killed.
+	hang bool
+}
+
+func (d *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/containers/create":
+		json.NewDecoder(r.Body).Decode(&d.created)
+		d.name = r.URL.Query().Get("name")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"Id": "c1"}`)
+	case strings.HasSuffix(r.URL.Path, "/attach"):
+		conn, rw, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		frame := func(stream byte, s string) {
+			header := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(header[4:], uint32(len(s)))
+			conn.Write(append(header, s...))
+		}
+		if d.hang {
+			<-d.exited
+			return
+		}
+		// hot containers answer calls until they are removed
+		for d.created.Image == "acme/hot" {
+			req, err := http.ReadRequest(rw.Reader)
+			if err != nil {
+				return
+			}
+			b, _ := ioutil.ReadAll(req.Body)
+			body := "Hello " + string(b) + " from " + req.Header.Get("Route")
+			frame(1, "HTTP/1.1 200 OK\r\nContent-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body)
+		}
+		b, _ := ioutil.ReadAll(rw.Reader)
+		frame(2, "greeting\n")
+		frame(1, "Hello "+string(b))
+		d.exited <- len(b) % 2
+	case strings.HasSuffix(r.URL.Path, "/start"):
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(r.URL.Path, "/wait"):
+		select {
+		case status := <-d.exited:
+			json.NewEncoder(w).Encode(map[string]int{"StatusCode": status})
+		case <-r.Context().Done():
+		}
+	case strings.HasSuffix(r.URL.Path, "/kill"):
+		close(d.exited)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE":
+		d.removed = true
+		d.name = strings.TrimPrefix(r.URL.Path, "/containers/")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startFakeDocker(t *testing.T, d *fakeDocker) func() {
+	dir, err := ioutil.TempDir("", "fn-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, d)
+	old := os.Getenv("DOCKER_HOST")
+	os.Setenv("DOCKER_HOST", "unix://"+sock)
+	return func() {
+		os.Setenv("DOCKER_HOST", old)
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRunff(t *testing.T) {
+	d := &fakeDocker{exited: make(chan int, 1)}
+	defer startFakeDocker(t, d)()
+
+	route := fnmodels.Route{Path: "/hello", Memory: 256, Config: map[string]string{"db-url": "postgres://db"}}
+	opts := routeRunOptions(route, map[string]string{"LEVEL": "debug"})
+	var stdout, stderr bytes.Buffer
+	if err := runff("acme/hello:0.0.1", strings.NewReader("Johnny"), &stdout, &stderr, opts); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "Hello Johnny" || stderr.String() != "greeting\n" {
+		t.Errorf("runff() wrote %q and %q, want the output of the function", stdout.String(), stderr.String())
+	}
+	if !d.removed {
+		t.Error("runff() left the container behind")
+	}
+
+	c := d.created
+	if c.Image != "acme/hello:0.0.1" || c.HostConfig.Memory != 256<<20 || c.HostConfig.MemorySwap != 256<<20 {
+		t.Errorf("runff() created %+v, want the image and memory of the route", c)
+	}
+	if want := []string{"METHOD=POST", "ROUTE=/hello", "_LEVEL=debug", "_DB_URL=postgres://db"}; strings.Join(c.Env, " ") != strings.Join(want, " ") {
+		t.Errorf("runff() set %v, want %v", c.Env, want)
+	}
+
+	// failing functions fail calls with a 500, as on the server
+	err := runff("acme/hello:0.0.1", strings.NewReader("Joe"), ioutil.Discard, ioutil.Discard, opts)
+	if fe, ok := err.(*fnError); !ok || fe.Kind != kindFunction || fe.Status != 500 {
+		t.Errorf("runff() of a failing function = %#v, want a 500", err)
+	}
+}
+
+func TestRunffHTTPFormat(t *testing.T) {
+	d := &fakeDocker{exited: make(chan int)}
+	defer startFakeDocker(t, d)()
+
+	opts := routeRunOptions(fnmodels.Route{Path: "/hello", Format: "http"}, nil)
+	var stdout bytes.Buffer
+	if err := runff("acme/hot", strings.NewReader("Johnny"), &stdout, ioutil.Discard, opts); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "Hello Johnny from /hello" {
+		t.Errorf("runff() wrote %q, want the body of the response of the function", stdout.String())
+	}
+}
+
+func TestRunffTimeout(t *testing.T) {
+	d := &fakeDocker{exited: make(chan int), hang: true}
+	defer startFakeDocker(t, d)()
+
+	opts := runOptions{timeout: 100 * time.Millisecond}
+	err := runff("acme/hello:0.0.1", nil, ioutil.Discard, ioutil.Discard, opts)
+	if fe, ok := err.(*fnError); !ok || fe.Status != 504 {
+		t.Errorf("runff() of a function running too long = %#v, want a 504", err)
+	}
+	if !d.removed {
+		t.Error("runff() left the container behind")
+	}
+}
+
+func TestDemux(t *testing.T) {
+	var in bytes.Buffer
+	for _, f := range []struct {
+		stream byte
+		s      string
+	}{{1, "out"}, {2, "err"}, {1, "put"}} {
+		header := []byte{f.stream, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[4:], uint32(len(f.s)))
+		in.Write(append(header, f.s...))
+	}
+	s := &dockerStream{br: bufio.NewReader(&in)}
+	var stdout, stderr bytes.Buffer
+	if err := s.demux(&stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "output" || stderr.String() != "err" {
+		t.Errorf("demux() wrote %q and %q", stdout.String(), stderr.String())
+	}
+}
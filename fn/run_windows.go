@@ -23,3 +23,24 @@ func isTerminal(fd int) bool {
 	r, _, e := syscall.Syscall(procGetConsoleMode.Addr(), 2, uintptr(fd), uintptr(unsafe.Pointer(&st)), 0)
 	return r != 0 && e == 0
 }
+
+const enableEchoInput = 0x4
+
+// disableEcho stops the console from echoing what is typed, until the
+// returned function is called.
+func disableEcho() func() {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleMode := kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode := kernel32.NewProc("SetConsoleMode")
+	fd := os.Stdin.Fd()
+	var mode uint32
+	if r, _, _ := syscall.Syscall(procGetConsoleMode.Addr(), 2, fd, uintptr(unsafe.Pointer(&mode)), 0); r == 0 {
+		return func() {}
+	}
+	syscall.Syscall(procSetConsoleMode.Addr(), 2, fd, uintptr(mode&^enableEchoInput), 0)
+	return func() { syscall.Syscall(procSetConsoleMode.Addr(), 2, fd, uintptr(mode), 0) }
+}
+
+// defaultDockerHost is where the Docker daemon listens when $DOCKER_HOST is
+// not set. Named pipes are not supported, a tcp:// DOCKER_HOST is needed.
+const defaultDockerHost = "npipe:////./pipe/docker_engine"
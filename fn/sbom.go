@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// sbomFormat is a format of software bills of materials.
+type sbomFormat struct {
+	// output is the name syft and docker sbom give the format.
+	output    string
+	mediaType string
+	ext       string
+}
+
+var sbomFormats = map[string]sbomFormat{
+	"cyclonedx": {"cyclonedx-json", "application/vnd.cyclonedx+json", ".cdx.json"},
+	"spdx":      {"spdx-json", "application/spdx+json", ".spdx.json"},
+}
+
+// sbomOptions tell how the SBOMs of images are generated, and where they go.
+type sbomOptions struct {
+	format string
+	dir    string
+	attach bool
+}
+
+func sbomFlags(opts *sbomOptions) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "sbom",
+			Usage:       "generate the software bill of materials of images in `FORMAT` - cyclonedx or spdx",
+			Destination: &opts.format,
+		},
+		cli.StringFlag{
+			Name:        "sbom-dir",
+			Usage:       "`DIR` SBOMs are written to, that of the report with fn deploy, the current one otherwise",
+			Destination: &opts.dir,
+		},
+	}
+}
+
+// sbomAttachFlag pushes SBOMs along with images.
+func sbomAttachFlag(opts *sbomOptions) cli.Flag {
+	return cli.BoolFlag{
+		Name:        "sbom-attach",
+		Usage:       "push SBOMs to the registry as OCI referrers of their images, with oras",
+		Destination: &opts.attach,
+	}
+}
+
+func (o *sbomOptions) check() error {
+	if o.format == "" {
+		if o.attach {
+			return usageError("--sbom-attach needs the --sbom format")
+		}
+		return nil
+	}
+	if _, ok := sbomFormats[o.format]; !ok {
+		return usageError("unknown SBOM format %s, expected cyclonedx or spdx", o.format)
+	}
+	return nil
+}
+
+// sbomFile is the name of the SBOM of the image of the function.
+func sbomFile(ff *funcfile, opts sbomOptions) string {
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(cleanImageName(ff.FullName()))
+	if ff.Version != "" {
+		name += "-" + ff.Version
+	}
+	return filepath.Join(opts.dir, name+sbomFormats[opts.format].ext)
+}
+
+// generateSBOM writes the SBOM of image, a tag or digest reference of the
+// image of the function, with syft, or else docker sbom, returning the file
+// it wrote.
+func generateSBOM(out io.Writer, image string, ff *funcfile, opts sbomOptions) (string, error) {
+	format := sbomFormats[opts.format]
+	file := sbomFile(ff, opts)
+	if opts.dir != "" {
+		if err := os.MkdirAll(opts.dir, 0755); err != nil {
+			return "", err
+		}
+	}
+
+	tool, cmd := "syft", exec.CommandContext(cmdContext(), "syft", image, "-o", format.output+"="+file)
+	if _, err := exec.LookPath("syft"); err != nil {
+		tool, cmd = "docker sbom", exec.CommandContext(cmdContext(), "docker", "sbom", "--format", format.output, "--output", file, image)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running %s: %v", tool, err)
+	}
+	fmt.Fprintf(out, "wrote the SBOM of %s to %s\n", image, file)
+	return file, nil
+}
+
+// attachSBOM pushes the SBOM of the image pushed as digest to its registry,
+// as an OCI referrer of the image. oras runs in the directory of the SBOM, as
+// it names the file as it is given.
+func attachSBOM(out io.Writer, digest, file string, opts sbomOptions) error {
+	mediaType := sbomFormats[opts.format].mediaType
+	cmd := exec.CommandContext(cmdContext(), "oras", "attach", "--artifact-type", mediaType, digest, filepath.Base(file)+":"+mediaType)
+	cmd.Dir = filepath.Dir(file)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running oras attach: %v", err)
+	}
+	return nil
+}
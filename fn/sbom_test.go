@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSBOM(t *testing.T) {
+	bin, err := ioutil.TempDir("", "fn-sbom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bin)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin)
+
+	ff := &funcfile{Name: "acme/hello", Version: "0.0.2", Registry: "registry.example.org:5000"}
+	opts := sbomOptions{format: "cyclonedx", dir: filepath.Join(bin, "reports")}
+	want := filepath.Join(bin, "reports", "registry.example.org_5000_acme_hello-0.0.2.cdx.json")
+
+	// docker sbom is the fallback of syft
+	fakeTool(t, bin, "docker", "")
+	file, err := generateSBOM(ioutil.Discard, "acme/hello@sha256:a4d", ff, opts)
+	if err != nil || file != want {
+		t.Errorf("generateSBOM() = %q, %v, want %q", file, err, want)
+	}
+	if got := strings.Join(toolArgs(t, bin, "docker"), " "); got != "sbom --format cyclonedx-json --output "+want+" acme/hello@sha256:a4d" {
+		t.Errorf("generateSBOM() ran docker %s", got)
+	}
+
+	fakeTool(t, bin, "syft", "")
+	opts.format = "spdx"
+	if file, err = generateSBOM(ioutil.Discard, "acme/hello:0.0.2", ff, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(toolArgs(t, bin, "syft"), " "), "acme/hello:0.0.2 -o spdx-json="+file; got != want {
+		t.Errorf("generateSBOM() ran syft %s, want syft %s", got, want)
+	}
+
+	fakeTool(t, bin, "oras", "pwd > "+filepath.Join(bin, "oras.pwd"))
+	if err := attachSBOM(ioutil.Discard, "acme/hello@sha256:a4d", file, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(toolArgs(t, bin, "oras"), " "), "attach --artifact-type application/spdx+json acme/hello@sha256:a4d "+filepath.Base(file)+":application/spdx+json"; got != want {
+		t.Errorf("attachSBOM() ran oras %s, want oras %s", got, want)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(bin, "oras.pwd")); strings.TrimSpace(string(b)) != filepath.Dir(file) {
+		t.Errorf("attachSBOM() ran oras in %s, want %s", b, filepath.Dir(file))
+	}
+
+	for _, o := range []sbomOptions{{format: "swid"}, {attach: true}} {
+		if err := o.check(); err == nil {
+			t.Errorf("check() of %+v succeeded, want an error", o)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+// scaffold is the boilerplate fn init writes for functions of a runtime which
+// have no code yet: a hello world handler, its tests and a .gitignore. Files
+// are templates, told the name, runtime and entrypoint of the function, its
+// package and author.
+// Templates of ~/.fn/templates/<runtime> are added on top of the built-in
+// ones, replacing those of the same name.
+type scaffold struct {
+	// handler is the file of the function, scaffolded when it is missing.
+	handler    string
+	entrypoint string
+	files      map[string]string
+}
+
+var scaffolds = map[string]scaffold{
+	"go": {"func.go", "./func", map[string]string{
+		"func.go": `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// hello greets the person whose name is sent as JSON, or the world.
+func hello(in io.Reader, out io.Writer) error {
+	p := struct{ Name string }{Name: "World"}
+	if err := json.NewDecoder(in).Decode(&p); err != nil && err != io.EOF {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "Hello %s!\n", p.Name)
+	return err
+}
+
+func main() {
+	if err := hello(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`,
+		"func_test.go": `package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHello(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"", "Hello World!\n"},
+		{"{\"name\": \"Johnny\"}", "Hello Johnny!\n"},
+	} {
+		var out bytes.Buffer
+		if err := hello(strings.NewReader(c.in), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.want {
+			t.Errorf("hello(%q) = %q, want %q", c.in, out.String(), c.want)
+		}
+	}
+}
+`,
+		"go.mod": `module function
+`,
+		".gitignore": `/func
+`,
+	}},
+	"node": {"func.js", "node func.js", map[string]string{
+		"func.js": `// hello greets the person whose name is sent as JSON, or the world.
+function hello(input) {
+  var name = 'World';
+  if (input.trim() !== '') {
+    name = JSON.parse(input).name || name;
+  }
+  return 'Hello ' + name + '!';
+}
+
+module.exports = hello;
+
+if (require.main === module) {
+  var input = '';
+  process.stdin.setEncoding('utf8');
+  process.stdin.on('data', function (chunk) { input += chunk; });
+  process.stdin.on('end', function () { console.log(hello(input)); });
+}
+`,
+		"func.test.js": `var assert = require('assert');
+var hello = require('./func');
+
+assert.strictEqual(hello(''), 'Hello World!');
+assert.strictEqual(hello('{"name": "Johnny"}'), 'Hello Johnny!');
+console.log('ok');
+`,
+		".gitignore": `node_modules/
+`,
+	}},
+	"python": {"func.py", "python2 func.py", map[string]string{
+		"func.py": `import json
+import sys
+
+
+def hello(data):
+    """Greets the person whose name is sent as JSON, or the world."""
+    name = "World"
+    if data.strip():
+        name = json.loads(data).get("name", name)
+    return "Hello %s!" % name
+
+
+if __name__ == "__main__":
+    print(hello(sys.stdin.read()))
+`,
+		"test_func.py": `import unittest
+
+from func import hello
+
+
+class HelloTest(unittest.TestCase):
+    def test_world(self):
+        self.assertEqual(hello(""), "Hello World!")
+
+    def test_name(self):
+        self.assertEqual(hello('{"name": "Johnny"}'), "Hello Johnny!")
+
+
+if __name__ == "__main__":
+    unittest.main()
+`,
+		".gitignore": `*.pyc
+packages/
+`,
+	}},
+	"ruby": {"func.rb", "ruby func.rb", map[string]string{
+		"func.rb": `require 'json'
+
+# Greets the person whose name is sent as JSON, or the world.
+def hello(input)
+  name = 'World'
+  name = JSON.parse(input).fetch('name', name) unless input.strip.empty?
+  "Hello #{name}!"
+end
+
+puts hello(STDIN.read) if __FILE__ == $PROGRAM_NAME
+`,
+		"func_test.rb": `require 'minitest/autorun'
+require_relative 'func'
+
+class HelloTest < Minitest::Test
+  def test_world
+    assert_equal 'Hello World!', hello('')
+  end
+
+  def test_name
+    assert_equal 'Hello Johnny!', hello('{"name": "Johnny"}')
+  end
+end
+`,
+		".gitignore": `.bundle/
+bundle/
+`,
+	}},
+	"java": {"Func.java", "java Func", map[string]string{
+		"Func.java": `import java.io.BufferedReader;
+import java.io.IOException;
+import java.io.InputStreamReader;
+import java.util.regex.Matcher;
+import java.util.regex.Pattern;
+import java.util.stream.Collectors;
+
+public class Func {
+    private static final Pattern NAME = Pattern.compile("\"name\"\\s*:\\s*\"([^\"]*)\"");
+
+    // hello greets the person whose name is sent as JSON, or the world.
+    public static String hello(String input) {
+        Matcher m = NAME.matcher(input);
+        return "Hello " + (m.find() ? m.group(1) : "World") + "!";
+    }
+
+    public static void main(String[] args) throws IOException {
+        BufferedReader in = new BufferedReader(new InputStreamReader(System.in));
+        System.out.println(hello(in.lines().collect(Collectors.joining("\n"))));
+    }
+}
+`,
+		"FuncTest.java": `public class FuncTest {
+    private static void check(String input, String want) {
+        String got = Func.hello(input);
+        if (!got.equals(want)) {
+            throw new AssertionError("hello(" + input + ") = " + got + ", want " + want);
+        }
+    }
+
+    public static void main(String[] args) {
+        check("", "Hello World!");
+        check("{\"name\": \"Johnny\"}", "Hello Johnny!");
+        System.out.println("ok");
+    }
+}
+`,
+		".gitignore": `*.class
+classes/
+`,
+	}},
+}
+
+// scaffoldData is what scaffold templates are told.
+type scaffoldData struct {
+	Name, Runtime, Entrypoint string
+
+	// Package is the last part of the name, in lowercase letters and digits,
+	// and Author the git user name.
+	Package, Author string
+}
+
+// templateDir is where the scaffold templates of users are, by runtime.
+func templateDir() string {
+	return filepath.Join(fnHome(), "templates")
+}
+
+// scaffoldFiles returns the templates of the scaffold of the runtime, by
+// name, those of userDir/<runtime> taking precedence over the built-in ones.
+func scaffoldFiles(runtime, userDir string) (map[string]string, error) {
+	files := make(map[string]string)
+	for name, content := range scaffolds[runtime].files {
+		files[name] = content
+	}
+
+	dir := filepath.Join(userDir, runtime)
+	if !exists(dir) {
+		return files, nil
+	}
+	return files, readTemplateDir(dir, files)
+}
+
+// readTemplateDir adds the templates of dir to files, by their slash
+// separated path relative to dir. Git metadata is left out.
+func readTemplateDir(dir string, files map[string]string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+}
+
+// writeScaffold writes the scaffold of the runtime to dir, leaving the files
+// which exist already as they are, and returns the names of those it wrote.
+func writeScaffold(dir, runtime, userDir string, data scaffoldData) ([]string, error) {
+	files, err := scaffoldFiles(runtime, userDir)
+	if err != nil {
+		return nil, err
+	}
+	return writeTemplates(dir, files, data)
+}
+
+// writeTemplates renders the templates of files, by name, to dir, leaving
+// the files which exist already as they are, and returns the names of those
+// it wrote. Names are templates too.
+func writeTemplates(dir string, files map[string]string, data scaffoldData) ([]string, error) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var written []string
+	for _, tname := range names {
+		name, err := renderTemplate(tname, tname, data)
+		if err != nil {
+			return written, err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if exists(path) {
+			continue
+		}
+		content, err := renderTemplate(tname, files[tname], data)
+		if err != nil {
+			return written, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return written, err
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			return written, err
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
+
+func renderTemplate(name, text string, data scaffoldData) (string, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %v", name, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("template %s: %v", name, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteScaffold(t *testing.T) {
+	for runtime, s := range scaffolds {
+		dir, err := ioutil.TempDir("", "fn-scaffold")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		written, err := writeScaffold(dir, runtime, filepath.Join(dir, "none"), scaffoldData{Name: "acme/hello", Runtime: runtime, Entrypoint: s.entrypoint})
+		if err != nil {
+			t.Fatalf("%s: %v", runtime, err)
+		}
+		if len(written) != len(s.files) {
+			t.Errorf("%s: writeScaffold() wrote %v, want %d files", runtime, written, len(s.files))
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(dir, s.handler)); err != nil || string(b) != s.files[s.handler] {
+			t.Errorf("%s: writeScaffold() wrote the handler %q, %v", runtime, b, err)
+		}
+	}
+}
+
+func TestWriteScaffoldUserTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-scaffold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	userDir := filepath.Join(dir, "templates")
+	for name, content := range map[string]string{
+		"node/func.js":        "// {{ .Name }} runs {{ .Entrypoint }}\n",
+		"node/lib/greeter.js": "module.exports = 'hi';\n",
+	} {
+		path := filepath.Join(userDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fn := filepath.Join(dir, "fn")
+	if err := os.MkdirAll(fn, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// existing files are left as they are
+	if err := ioutil.WriteFile(filepath.Join(fn, ".gitignore"), []byte("dist/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := writeScaffold(fn, "node", userDir, scaffoldData{Name: "acme/hello", Runtime: "node", Entrypoint: "node func.js"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"func.js", "func.test.js", "lib/greeter.js"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("writeScaffold() wrote %v, want %v", written, want)
+	}
+	for name, want := range map[string]string{
+		"func.js":        "// acme/hello runs node func.js\n",
+		"lib/greeter.js": "module.exports = 'hi';\n",
+		".gitignore":     "dist/\n",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(fn, name))
+		if err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v, want %q", name, b, err, want)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(userDir, "node", "bad.js"), []byte("{{ .Nope"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeScaffold(fn, "node", userDir, scaffoldData{}); err == nil || !strings.Contains(err.Error(), "bad.js") {
+		t.Errorf("writeScaffold() of a broken template = %v, want an error naming it", err)
+	}
+}
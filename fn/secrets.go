@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	fnapi "github.com/iron-io/functions/fn/pkg/client"
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+// Function files refer to secrets rather than holding them, in their secrets
+// section mapping config keys to references like vault:secret/db#password.
+// The references are resolved when deploying, the values only being sent to
+// the server as route config: they are neither written in fn.lock nor shown
+// by fn plan.
+
+// secretResolver resolves a reference, without its scheme, to the secret.
+// dir is the directory of the function file.
+type secretResolver func(dir, ref string) (string, error)
+
+// secretResolvers are the resolvers by scheme. Resolvers for other secret
+// stores are added here.
+var secretResolvers = map[string]secretResolver{
+	"env":   envSecret,
+	"file":  fileSecret,
+	"vault": vaultSecret,
+	"ssm":   ssmSecret,
+}
+
+// resolvedSecrets holds the secrets resolved so far, to redact them from
+// traces.
+var resolvedSecrets struct {
+	sync.Mutex
+	values []string
+}
+
+// redactSecrets replaces the resolved secrets found in b.
+func redactSecrets(b []byte) []byte {
+	resolvedSecrets.Lock()
+	defer resolvedSecrets.Unlock()
+	for _, s := range resolvedSecrets.values {
+		b = bytes.Replace(b, []byte(s), []byte(redacted), -1)
+	}
+	return b
+}
+
+func splitSecretRef(ref string) (scheme, rest string, err error) {
+	i := strings.Index(ref, ":")
+	if i <= 0 {
+		return "", "", fmt.Errorf("%q is not a secret reference, expected scheme:reference", ref)
+	}
+	scheme, rest = ref[:i], ref[i+1:]
+	if _, ok := secretResolvers[scheme]; !ok {
+		var schemes []string
+		for s := range secretResolvers {
+			schemes = append(schemes, s)
+		}
+		sort.Strings(schemes)
+		return "", "", fmt.Errorf("unknown secret store %s in %q, expected one of %s", scheme, ref, strings.Join(schemes, ", "))
+	}
+	return scheme, rest, nil
+}
+
+// resolveSecrets resolves the secrets of the function file at dir, by config
+// key.
+func resolveSecrets(dir string, ff *funcfile) (map[string]string, error) {
+	return resolveSecretRefs(dir, ff.Secrets)
+}
+
+// resolveSecretRefs resolves refs, the secret references of the function file
+// at dir by config key.
+func resolveSecretRefs(dir string, refs map[string]string) (map[string]string, error) {
+	secrets := make(map[string]string, len(refs))
+	for key, ref := range refs {
+		scheme, rest, err := splitSecretRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %v", key, err)
+		}
+		value, err := secretResolvers[scheme](dir, rest)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %v", key, err)
+		}
+		secrets[key] = value
+
+		if value != "" {
+			resolvedSecrets.Lock()
+			resolvedSecrets.values = append(resolvedSecrets.values, value)
+			resolvedSecrets.Unlock()
+		}
+	}
+	return secrets, nil
+}
+
+// withSecrets returns a copy of the route with the secrets in its config.
+func withSecrets(route *fnmodels.Route, secrets map[string]string) *fnmodels.Route {
+	r := fnapi.CopyRoute(route)
+	if len(secrets) > 0 && r.Config == nil {
+		r.Config = make(map[string]string)
+	}
+	for k, v := range secrets {
+		r.Config[k] = v
+	}
+	return r
+}
+
+// secretKeys returns the sorted config keys the secrets of the function file
+// are set in.
+func secretKeys(ff *funcfile) []string {
+	var keys []string
+	for k := range ff.Secrets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// maskSecrets sets the secret keys of the wanted config to their live value,
+// as they are not compared, or to a placeholder if they are not set yet. live
+// is nil for routes to create.
+func maskSecrets(want, live *fnmodels.Route, keys []string) {
+	if len(keys) > 0 && want.Config == nil {
+		want.Config = make(map[string]string)
+	}
+	for _, k := range keys {
+		want.Config[k] = redacted
+		if live == nil {
+			continue
+		}
+		if v, ok := live.Config[k]; ok {
+			want.Config[k] = v
+		}
+	}
+}
+
+// env:NAME is the environment variable NAME.
+func envSecret(dir, ref string) (string, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return v, nil
+}
+
+// file:path is the content of the file, relative to the function file,
+// without its trailing newline.
+func fileSecret(dir, ref string) (string, error) {
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(dir, ref)
+	}
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// vault:path#field is the field of the secret at path in HashiCorp Vault, at
+// $VAULT_ADDR with $VAULT_TOKEN or the token vault login stored. Both
+// versions of the key/value engine are supported.
+func vaultSecret(dir, ref string) (string, error) {
+	secretPath, field := ref, ""
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		secretPath, field = ref[:i], ref[i+1:]
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		b, err := ioutil.ReadFile(filepath.Join(os.Getenv("HOME"), ".vault-token"))
+		if err != nil {
+			return "", fmt.Errorf("VAULT_TOKEN is not set and no token found from vault login")
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(secretPath, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: %s: %s", secretPath, resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("vault: %s: %v", secretPath, err)
+	}
+	data := secret.Data
+	// version 2 of the key/value engine nests the data along its metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	if field == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("vault: %s holds %d fields, pick one with %s#field", secretPath, len(data), secretPath)
+		}
+		for f := range data {
+			field = f
+		}
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no field %s", secretPath, field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// ssm:name is the AWS SSM parameter, decrypted, read with the aws CLI and its
+// configuration.
+func ssmSecret(dir, ref string) (string, error) {
+	cmd := exec.Command("aws", "ssm", "get-parameter", "--name", ref, "--with-decryption", "--query", "Parameter.Value", "--output", "text")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ssm: %s: %v: %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "db.pass"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("FN_TEST_API_KEY")
+	os.Setenv("FN_TEST_API_KEY", "k3y")
+
+	ff := &funcfile{Secrets: map[string]string{
+		"DB_PASS": "file:db.pass",
+		"API_KEY": "env:FN_TEST_API_KEY",
+	}}
+	secrets, err := resolveSecrets(dir, ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets["DB_PASS"] != "s3cret" || secrets["API_KEY"] != "k3y" {
+		t.Errorf("expected the secrets to be resolved, got %v", secrets)
+	}
+	if b := redactSecrets([]byte(`{"DB_PASS":"s3cret"}`)); string(b) != `{"DB_PASS":"<redacted>"}` {
+		t.Errorf("expected the resolved secrets to be redacted, got %s", b)
+	}
+
+	for ref, expected := range map[string]string{
+		"env:FN_TEST_UNSET": "environment variable FN_TEST_UNSET is not set",
+		"s3:bucket/key":     "unknown secret store s3",
+		"plaintext":         "is not a secret reference",
+	} {
+		_, err := resolveSecrets(dir, &funcfile{Secrets: map[string]string{"KEY": ref}})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q for %s, got %v", expected, ref, err)
+		}
+	}
+}
+
+func TestVaultSecret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "t0ken" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			w.Write([]byte(`{"data":{"data":{"password":"s3cret","user":"fn"},"metadata":{"version":2}}}`))
+		case "/v1/kv/api":
+			w.Write([]byte(`{"data":{"key":"k3y"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+	os.Setenv("VAULT_ADDR", srv.URL)
+	os.Setenv("VAULT_TOKEN", "t0ken")
+
+	for ref, expected := range map[string]string{
+		"secret/data/db#password": "s3cret",
+		"kv/api":                  "k3y",
+	} {
+		v, err := vaultSecret("", ref)
+		if err != nil || v != expected {
+			t.Errorf("expected %q for %s, got %q, %v", expected, ref, v, err)
+		}
+	}
+	if _, err := vaultSecret("", "secret/data/db"); err == nil {
+		t.Error("expected an error without field for a secret with several fields")
+	}
+	if _, err := vaultSecret("", "secret/data/missing#password"); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	want := fnmodels.Route{Config: map[string]string{"DB": "postgres"}}
+	live := &fnmodels.Route{Config: map[string]string{"DB": "postgres", "DB_PASS": "s3cret"}}
+	maskSecrets(&want, live, []string{"DB_PASS"})
+	if changes := routeDiff(&want, live); len(changes) != 0 {
+		t.Errorf("expected secrets not to be compared, got %v", changes)
+	}
+
+	want = fnmodels.Route{}
+	maskSecrets(&want, nil, []string{"DB_PASS"})
+	if want.Config["DB_PASS"] != redacted {
+		t.Errorf("expected secrets to create to be shown redacted, got %v", want.Config)
+	}
+}
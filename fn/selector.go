@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// selector filters routes by their configuration, which is what routes have
+// closest to labels. It is written as comma separated key=value or key!=value
+// requirements, all of which must hold, eg. "env=preview,team!=core".
+type selector []requirement
+
+type requirement struct {
+	key, value string
+	negate     bool
+}
+
+func parseSelector(s string) (selector, error) {
+	var sel selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r := requirement{}
+		kv := strings.SplitN(part, "!=", 2)
+		if len(kv) == 2 {
+			r.negate = true
+		} else {
+			kv = strings.SplitN(part, "=", 2)
+		}
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid selector requirement %q, expected key=value or key!=value", part)
+		}
+		r.key, r.value = kv[0], kv[1]
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+func (sel selector) matches(config map[string]string) bool {
+	for _, r := range sel {
+		v, ok := config[r.key]
+		if r.negate == (ok && v == r.value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/urfave/cli"
+)
+
+const localServerImage = "iron/functions"
+
+type setupCmd struct{}
+
+func setup() cli.Command {
+	s := setupCmd{}
+	return cli.Command{
+		Name:   "setup",
+		Usage:  "configure fn to talk to an IronFunctions installation",
+		Action: s.setup,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "api-url",
+				Usage: "IronFunctions API address, asked for when not set",
+			},
+			cli.StringFlag{
+				Name:  "registry",
+				Usage: "Docker Hub user or registry to push functions to, asked for when not set",
+			},
+			cli.StringFlag{
+				Name:  "name",
+				Usage: "name of the context to store the settings in",
+				Value: defaultContextName,
+			},
+			cli.BoolFlag{
+				Name:  "start-server",
+				Usage: "start a local IronFunctions server if none is reachable, without asking",
+			},
+		},
+	}
+}
+
+func (s *setupCmd) setup(c *cli.Context) error {
+	fmt.Println("Welcome to IronFunctions! Let's get fn ready to go.")
+	fmt.Println()
+
+	apiURL := c.String("api-url")
+	if apiURL == "" {
+		def := globals.apiURL
+		if def == defaultAPIURL {
+			fmt.Print("Looking for a local server... ")
+			if v, err := versionAt(defaultAPIURL); err == nil {
+				fmt.Println("found version", v)
+			} else {
+				fmt.Println("none found")
+			}
+		}
+		apiURL = ask("IronFunctions API URL", def)
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return usageError("invalid API URL %s", apiURL)
+	}
+
+	v, err := versionAt(apiURL)
+	if err != nil {
+		fmt.Println("Could not reach", apiURL+":", err)
+		if !isLocal(u) {
+			return err
+		}
+		if !c.Bool("start-server") && !confirm("Start a local server with Docker?") {
+			return err
+		}
+		if v, err = startLocalServer(apiURL, u.Port()); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Connected to IronFunctions", v, "at", apiURL)
+
+	registry := c.String("registry")
+	if registry == "" {
+		registry = ask("Docker Hub user name, or registry, to push your functions to", globals.registry)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := c.String("name")
+	fctx, ok := cfg.Contexts[name]
+	if !ok {
+		fctx = &fnContext{}
+		cfg.Contexts[name] = fctx
+	}
+	fctx.APIURL = apiURL
+	fctx.Registry = registry
+	cfg.CurrentContext = name
+	if err := storeConfig(cfg); err != nil {
+		return err
+	}
+	progress("Settings saved in context", name, "of", configPath())
+
+	prefix := "<DOCKERHUB_USERNAME>/"
+	if registry != "" {
+		prefix = ""
+	}
+	fmt.Printf(`
+You are all set, now create your first function:
+
+  mkdir hello && cd hello
+  echo 'package main; import "fmt"; func main() { fmt.Println("Hello World!") }' > func.go
+  fn init %shello
+  fn apps create myapp
+  fn deploy myapp
+  fn call myapp /hello
+
+Check the manual at https://github.com/iron-io/functions/blob/master/fn/README.md
+`, prefix)
+	return nil
+}
+
+// versionAt asks the server at apiURL for its version, checking along the
+// way that it can be reached.
+func versionAt(apiURL string) (string, error) {
+	defer func(u string) { globals.apiURL = u }(globals.apiURL)
+	globals.apiURL = apiURL
+	return serverVersion()
+}
+
+func isLocal(u *url.URL) bool {
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// startLocalServer starts the IronFunctions server in the background, as fn
+// start --detach does, and waits for it to answer.
+func startLocalServer(apiURL, port string) (string, error) {
+	if port == "" {
+		port = "80"
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", usageError("invalid port %s", port)
+	}
+	s := &startcmd{port: p, image: localServerImage, name: "functions", detach: true}
+
+	fmt.Println("Starting", localServerImage, "on port", port)
+	docker, err := newDockerClient()
+	if err != nil {
+		return "", err
+	}
+	id, err := s.create(docker)
+	if err != nil {
+		return "", err
+	}
+	if err := docker.start(cmdContext(), id); err != nil {
+		docker.remove(id)
+		return "", err
+	}
+	if err := waitForServer(s.url(), serverStartTimeout); err != nil {
+		return "", err
+	}
+	return versionAt(apiURL)
+}
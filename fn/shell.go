@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+func shell() cli.Command {
+	cmd := shellcmd{}
+	return cli.Command{
+		Name:      "shell",
+		Usage:     "open a shell in the image of the function, set up as it runs, to look around",
+		ArgsUsage: "[USERNAME/image:tag|.]",
+		Flags:     cmd.flags(),
+		Before:    loadValues,
+		Action:    cmd.run,
+	}
+}
+
+type shellcmd struct {
+	command string
+	mountAt string
+	noMount bool
+}
+
+func (s *shellcmd) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "shell",
+			Usage:       "`COMMAND` of the shell",
+			Value:       "/bin/sh",
+			Destination: &s.command,
+		},
+		cli.StringFlag{
+			Name:        "mount-at",
+			Usage:       "`PATH` of the container the working directory is mounted at",
+			Value:       "/src",
+			Destination: &s.mountAt,
+		},
+		cli.BoolFlag{
+			Name:        "no-mount",
+			Usage:       "do not mount the working directory",
+			Destination: &s.noMount,
+		},
+		cli.StringFlag{
+			Name:  "route",
+			Usage: "`PATH` of the route of the function file whose settings are used, the first one by default",
+		},
+		cli.StringSliceFlag{
+			Name:  "config,c",
+			Usage: "add `KEY=VALUE` to the config of the route",
+		},
+		envFlag,
+		valuesFlag,
+		setFlag,
+	}
+}
+
+func (s *shellcmd) run(c *cli.Context) error {
+	image := c.Args().First()
+	route := fnmodels.Route{Path: "/"}
+	if image == "" || image == "." {
+		ff, err := loadFuncfile()
+		if err != nil {
+			if _, ok := err.(*notFoundError); ok {
+				return usageError("image name is missing or no function file found")
+			}
+			return err
+		}
+		image = ff.FullName()
+		if route, err = funcfileRoute(ff, c.String("route")); err != nil {
+			return err
+		}
+	}
+
+	opts := routeRunOptions(route, extractEnvConfig(c.StringSlice("config")))
+	mount := ""
+	if !s.noMount {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		mount = wd + ":" + filepath.ToSlash(s.mountAt)
+	}
+
+	args := shellArgs(image, opts, s.command, mount, isTerminal(int(os.Stdin.Fd())))
+	cmd := exec.Command("docker", args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			// the shell told what went wrong
+			return nil
+		}
+		return fmt.Errorf("error running docker: %v", err)
+	}
+	return nil
+}
+
+// shellArgs are those of docker run, running the shell in the image with the
+// environment and memory limit the function runs with, mount being a volume
+// as HOST:CONTAINER paths, if any.
+func shellArgs(image string, opts runOptions, shell, mount string, tty bool) []string {
+	memory := opts.memory
+	if memory == 0 {
+		memory = defaultMemory
+	}
+	args := []string{"run", "--rm", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	limit := strconv.FormatInt(memory, 10) + "m"
+	args = append(args, "--entrypoint", shell, "--memory", limit, "--memory-swap", limit)
+	if mount != "" {
+		args = append(args, "-v", mount)
+	}
+	for _, e := range append([]string{kvEq("METHOD", "GET")}, opts.env...) {
+		args = append(args, "-e", e)
+	}
+	return append(args, image)
+}
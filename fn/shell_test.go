@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+func TestShellArgs(t *testing.T) {
+	route := fnmodels.Route{Path: "/hello", Memory: 256, Config: map[string]string{"db-url": "postgres://db"}}
+	opts := routeRunOptions(route, nil)
+
+	args := strings.Join(shellArgs("acme/hello:0.0.1", opts, "/bin/bash", "/src/hello:/src", true), " ")
+	want := "run --rm -i -t --entrypoint /bin/bash --memory 256m --memory-swap 256m -v /src/hello:/src -e METHOD=GET -e ROUTE=/hello -e _DB_URL=postgres://db acme/hello:0.0.1"
+	if args != want {
+		t.Errorf("shellArgs() = %s\nwant %s", args, want)
+	}
+
+	args = strings.Join(shellArgs("acme/hello", runOptions{}, "/bin/sh", "", false), " ")
+	if want := "run --rm -i --entrypoint /bin/sh --memory 128m --memory-swap 128m -e METHOD=GET acme/hello"; args != want {
+		t.Errorf("shellArgs() without a tty nor mount = %s\nwant %s", args, want)
+	}
+}
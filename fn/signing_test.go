@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	// as computed by: printf '1500000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	const expected = "sha256=9b122666c0d5c14c39667bf533010c2de24e6f5853f2ec835100c80e98b00e2c"
+	sig := signature([]byte("secret"), 1500000000, []byte(`{"a":1}`))
+	if sig != expected {
+		t.Fatalf("expected %s, got %s", expected, sig)
+	}
+
+	now := time.Unix(1500000060, 0)
+	if err := verifySignature([]byte("secret"), "1500000000", sig, []byte(`{"a":1}`), now, 5*time.Minute); err != nil {
+		t.Errorf("expected the signature to be valid, got %v", err)
+	}
+	if err := verifySignature([]byte("secret"), "1500000000", sig, []byte(`{"a":2}`), now, 5*time.Minute); err == nil {
+		t.Error("expected a tampered body to be rejected")
+	}
+	if err := verifySignature([]byte("secret"), "1500000000", sig, []byte(`{"a":1}`), now.Add(time.Hour), 5*time.Minute); err == nil {
+		t.Error("expected an old signature to be rejected")
+	}
+}
+
+func TestCallfnSigned(t *testing.T) {
+	var verr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		verr = verifySignature([]byte("secret"), r.Header.Get(headerTimestamp), r.Header.Get(headerSignature), body, time.Now(), time.Minute)
+	}))
+	defer srv.Close()
+
+	if err := callfn(srv.URL, strings.NewReader(`{"a":1}`), ioutil.Discard, callOptions{signKey: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if verr != nil {
+		t.Errorf("expected the function to verify the signature, got %v", verr)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// localContextName is the context fn start points fn at.
+const localContextName = "local"
+
+// serverStartTimeout is how long fn start waits for the server to answer.
+const serverStartTimeout = 60 * time.Second
+
+func start() cli.Command {
+	cmd := startcmd{}
+	return cli.Command{
+		Name:   "start",
+		Usage:  "start an IronFunctions server locally for development, and use it",
+		Flags:  cmd.flags(),
+		Action: cmd.start,
+	}
+}
+
+type startcmd struct {
+	port   int
+	data   string
+	image  string
+	name   string
+	detach bool
+	stop   bool
+}
+
+func (s *startcmd) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:        "port,p",
+			Usage:       "local `PORT` the server listens on",
+			Value:       8080,
+			Destination: &s.port,
+		},
+		cli.StringFlag{
+			Name:        "data",
+			Usage:       "`DIR` the server keeps its apps, routes and queue in, " + filepath.Join("~", ".fn", "data") + " by default",
+			Destination: &s.data,
+		},
+		cli.StringFlag{
+			Name:        "image",
+			Usage:       "`IMAGE` of the server",
+			Value:       localServerImage,
+			Destination: &s.image,
+		},
+		cli.StringFlag{
+			Name:        "name",
+			Usage:       "`NAME` of the container of the server",
+			Value:       "functions",
+			Destination: &s.name,
+		},
+		cli.BoolFlag{
+			Name:        "detach,d",
+			Usage:       "run the server in the background rather than showing its logs until ^C",
+			Destination: &s.detach,
+		},
+		cli.BoolFlag{
+			Name:        "stop",
+			Usage:       "stop the server started in the background",
+			Destination: &s.stop,
+		},
+	}
+}
+
+func (s *startcmd) start(c *cli.Context) error {
+	docker, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	if s.stop {
+		return s.stopServer(docker)
+	}
+
+	id, err := s.create(docker)
+	if err != nil {
+		return err
+	}
+
+	var logs chan error
+	if !s.detach {
+		stream, err := docker.attach(id)
+		if err != nil {
+			docker.remove(id)
+			return err
+		}
+		defer stream.Close()
+		logs = make(chan error, 1)
+		go func() { logs <- stream.demux(os.Stdout, os.Stderr) }()
+	}
+	if err := docker.start(cmdContext(), id); err != nil {
+		docker.remove(id)
+		return err
+	}
+
+	url := s.url()
+	if err := waitForServer(url, serverStartTimeout); err != nil {
+		docker.remove(id)
+		return err
+	}
+	if err := useLocalContext(url); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "IronFunctions is running at %s, now using context %s\n", url, localContextName)
+
+	if s.detach {
+		fmt.Fprintln(os.Stderr, "stop it with fn start --stop")
+		return nil
+	}
+
+	// the server goes along with fn
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	select {
+	case <-interrupt:
+		fmt.Fprintln(os.Stderr, "stopping IronFunctions")
+		return s.stopServer(docker)
+	case err := <-logs:
+		docker.remove(id)
+		if err != nil {
+			return err
+		}
+		return &fnError{Kind: kindServer, Message: "the server exited"}
+	}
+}
+
+// create creates the container of the server, returning its ID.
+func (s *startcmd) create(docker *dockerClient) (string, error) {
+	if s.port <= 0 || s.port > 65535 {
+		return "", usageError("invalid port %d", s.port)
+	}
+	data := s.data
+	if data == "" {
+		data = filepath.Join(fnHome(), "data")
+	}
+	data, err := filepath.Abs(data)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(data, 0700); err != nil {
+		return "", err
+	}
+
+	id, err := docker.createContainer(cmdContext(), os.Stderr, s.container(docker, data))
+	if fe, ok := err.(*fnError); ok && fe.Kind == kindConflict {
+		return "", &fnError{Kind: kindConflict, Message: fmt.Sprintf("a container named %s exists already, stop it with fn start --stop", s.name)}
+	}
+	return id, err
+}
+
+func (s *startcmd) url() string {
+	return "http://localhost:" + strconv.Itoa(s.port)
+}
+
+// container is the container of the server, keeping its data in data and
+// running functions with the Docker daemon of fn when it is local, rather
+// than in one of its own.
+func (s *startcmd) container(docker *dockerClient, data string) dockerContainer {
+	binds := []string{data + ":/app/data"}
+	if docker.socket != "" {
+		binds = append(binds, docker.socket+":/var/run/docker.sock")
+	}
+	return dockerContainer{
+		Name:         s.name,
+		Image:        s.image,
+		AttachStdout: !s.detach,
+		AttachStderr: !s.detach,
+		ExposedPorts: map[string]struct{}{"8080/tcp": {}},
+		HostConfig: dockerHostConfig{
+			Binds: binds,
+			PortBindings: map[string][]dockerPortBinding{
+				"8080/tcp": {{HostIP: "127.0.0.1", HostPort: strconv.Itoa(s.port)}},
+			},
+		},
+	}
+}
+
+// stopServer removes the container of the server, and stops using its
+// context.
+func (s *startcmd) stopServer(docker *dockerClient) error {
+	if err := docker.remove(s.name); err != nil {
+		if isDockerNotFound(err) {
+			return &fnError{Kind: kindNotFound, Message: fmt.Sprintf("no server named %s is running", s.name)}
+		}
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.CurrentContext == localContextName {
+		cfg.CurrentContext = ""
+		if err := storeConfig(cfg); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "now using context", defaultContextName)
+	}
+	return nil
+}
+
+// waitForServer waits for the server at url to answer, for up to timeout.
+func waitForServer(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url + "/version")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return &fnError{Kind: kindNetwork, Message: fmt.Sprintf("the server did not answer at %s within %s", url, timeout)}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// useLocalContext points the local context at url, keeping its other
+// settings, and makes it the current one.
+func useLocalContext(url string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	fctx, ok := cfg.Contexts[localContextName]
+	if !ok {
+		fctx = &fnContext{}
+		cfg.Contexts[localContextName] = fctx
+	}
+	fctx.APIURL = url
+	cfg.CurrentContext = localContextName
+	return storeConfig(cfg)
+}
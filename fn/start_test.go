@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+
+	d := &fakeDocker{}
+	defer startFakeDocker(t, d)()
+	// the server the container would run
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	s := &startcmd{port: port, image: "iron/functions", name: "functions", detach: true}
+	if err := s.start(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c := d.created
+	if d.name != "functions" || c.Image != "iron/functions" || c.AttachStdout {
+		t.Errorf("start() created %s as %+v, want the detached server", d.name, c)
+	}
+	data := filepath.Join(home, "data")
+	if len(c.HostConfig.Binds) != 2 || c.HostConfig.Binds[0] != data+":/app/data" || !strings.HasSuffix(c.HostConfig.Binds[1], ":/var/run/docker.sock") {
+		t.Errorf("start() mounted %v, want %s and the Docker socket", c.HostConfig.Binds, data)
+	}
+	if b := c.HostConfig.PortBindings["8080/tcp"]; len(b) != 1 || b[0].HostPort != u.Port() {
+		t.Errorf("start() bound %v, want port %s", c.HostConfig.PortBindings, u.Port())
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CurrentContext != localContextName || cfg.Contexts[localContextName].APIURL != "http://localhost:"+u.Port() {
+		t.Errorf("start() left the config %+v, want the server in use", cfg)
+	}
+
+	s.stop = true
+	if err := s.start(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !d.removed || d.name != "functions" {
+		t.Errorf("start --stop removed %q, want the server", d.name)
+	}
+	if cfg, _ = loadConfig(); cfg.CurrentContext != "" {
+		t.Errorf("start --stop left context %s in use", cfg.CurrentContext)
+	}
+}
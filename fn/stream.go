@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"sync/atomic"
+	"time"
+)
+
+const eventStreamContentType = "text/event-stream"
+
+func isEventStream(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	return mt == eventStreamContentType
+}
+
+// heartbeat cancels a streamed call once nothing, not even a heartbeat, was
+// received for its interval.
+type heartbeat struct {
+	interval time.Duration
+	timer    *time.Timer
+	expired  int32
+}
+
+// watch returns ctx, cancelled when the heartbeat is missed.
+func (h *heartbeat) watch(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.timer = time.AfterFunc(h.interval, func() {
+		atomic.StoreInt32(&h.expired, 1)
+		cancel()
+	})
+	return ctx, func() {
+		h.timer.Stop()
+		cancel()
+	}
+}
+
+func (h *heartbeat) beat() {
+	h.timer.Reset(h.interval)
+}
+
+// err tells why the stream broke, err being the error it broke with.
+func (h *heartbeat) err(err error) error {
+	if h != nil && atomic.LoadInt32(&h.expired) == 1 {
+		return &fnError{Kind: kindNetwork, Message: fmt.Sprintf("nothing received for %s, the stream is considered dead", h.interval)}
+	}
+	return err
+}
+
+// copyStream writes a streamed response out a line at a time as soon as
+// each line arrives, until the function closes the stream. The comment lines
+// of Server-Sent Events, used as heartbeats, are left out.
+func copyStream(w io.Writer, r io.Reader, sse bool, hb *heartbeat) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if hb != nil {
+				hb.beat()
+			}
+			if !(sse && bytes.HasPrefix(line, []byte(":"))) {
+				if _, werr := w.Write(line); werr != nil {
+					return werr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return hb.err(err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCallfnStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", eventStreamContentType)
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, ": ping\n\ndata: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		if r.URL.Path == "/hang" {
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+	defer func(d time.Duration) { globals.callTimeout = d }(globals.callTimeout)
+	globals.callTimeout = 10 * time.Millisecond
+
+	var out bytes.Buffer
+	if err := callfn(srv.URL, nil, &out, callOptions{stream: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "\ndata: 1\n\n\ndata: 2\n\n\ndata: 3\n\n" {
+		t.Errorf("expected the events without heartbeats, got %q", out.String())
+	}
+
+	out.Reset()
+	err := callfn(srv.URL+"/hang", nil, &out, callOptions{stream: true, heartbeat: 100 * time.Millisecond})
+	if e, ok := err.(*fnError); !ok || e.Kind != kindNetwork {
+		t.Errorf("expected the stream to be given up, got %v", err)
+	}
+}
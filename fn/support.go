@@ -0,0 +1,224 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	vers "github.com/iron-io/functions/api/version"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// redacted replaces secrets in support bundles.
+const redacted = "<redacted>"
+
+// auditLines is how many of the last audit log entries go in support bundles.
+const auditLines = 100
+
+func supportBundle() cli.Command {
+	return cli.Command{
+		Name:      "support-bundle",
+		Usage:     "collect diagnostics in an archive to attach to bug reports",
+		ArgsUsage: "[-- command to reproduce]",
+		Action:    supportBundleAction,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "output-file,O",
+				Usage: "archive to write, fn-support-<time>.tar.gz by default",
+			},
+			cli.StringSliceFlag{
+				Name:  "app",
+				Usage: "app whose route definitions are collected, can be repeated",
+			},
+		},
+	}
+}
+
+// bundle is a tar.gz archive of diagnostics files.
+type bundle struct {
+	tw      *tar.Writer
+	secrets []string
+}
+
+// add adds a file to the bundle, with the known secrets redacted.
+func (b *bundle) add(name string, content []byte) error {
+	for _, s := range b.secrets {
+		if s != "" {
+			content = bytes.Replace(content, []byte(s), []byte(redacted), -1)
+		}
+	}
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(content)
+	return err
+}
+
+func (b *bundle) addJSON(name string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return b.add(name, append(content, '\n'))
+}
+
+func supportBundleAction(c *cli.Context) error {
+	file := c.String("output-file")
+	if file == "" {
+		file = "fn-support-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	b := &bundle{tw: tar.NewWriter(zw)}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	b.secrets = append(b.secrets, globals.token, os.Getenv("IRON_TOKEN"))
+	for _, ctx := range cfg.Contexts {
+		b.secrets = append(b.secrets, ctx.Token)
+	}
+
+	if err := writeBundle(b, cfg, c.StringSlice("app"), c.Args()); err != nil {
+		return err
+	}
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	progress("Support bundle written to", file)
+	fmt.Fprintln(os.Stderr, "secrets fn knows of are redacted, review the bundle before sharing it anyway")
+	return nil
+}
+
+func writeBundle(b *bundle, cfg *config, apps, command []string) error {
+	info := map[string]string{
+		"time":           time.Now().UTC().Format(time.RFC3339),
+		"client_version": vers.Version,
+		"go_version":     runtime.Version(),
+		"platform":       runtime.GOOS + "/" + runtime.GOARCH,
+		"api_url":        apiURL().String(),
+		"context":        globals.contextName,
+	}
+	if v, err := serverVersion(); err != nil {
+		info["server_error"] = err.Error()
+	} else {
+		info["server_version"] = v
+	}
+	if err := b.addJSON("info.json", info); err != nil {
+		return err
+	}
+
+	conf, err := yaml.Marshal(redactConfig(cfg))
+	if err != nil {
+		return err
+	}
+	if err := b.add("config.yaml", conf); err != nil {
+		return err
+	}
+
+	if log, err := readState(auditPath()); err == nil {
+		if err := b.add("audit.log", lastLines(log, auditLines)); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	client := apiClient()
+	for _, appName := range apps {
+		name := "routes/" + appName + ".json"
+		routes, err := liveRoutes(client, appName)
+		if err != nil {
+			if err := b.add(name+".error", []byte(classify(err).Message+"\n")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, r := range routes {
+			for k := range r.Config {
+				r.Config[k] = redacted
+			}
+		}
+		if err := b.addJSON(name, routes); err != nil {
+			return err
+		}
+	}
+
+	if len(command) > 0 {
+		return b.add("transcript.txt", transcript(command))
+	}
+	return nil
+}
+
+// redactConfig returns a copy of the configuration without its tokens.
+func redactConfig(cfg *config) *config {
+	r := *cfg
+	r.Contexts = make(map[string]*fnContext, len(cfg.Contexts))
+	for name, ctx := range cfg.Contexts {
+		c := *ctx
+		if c.Token != "" {
+			c.Token = redacted
+		}
+		r.Contexts[name] = &c
+	}
+	return &r
+}
+
+func lastLines(b []byte, n int) []byte {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// transcript runs fn again with the command reproducing the problem, tracing
+// its requests, and returns what it printed.
+func transcript(command []string) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "$ fn -vv %s\n", strings.Join(command, " "))
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(&out, "could not run fn:", err)
+		return out.Bytes()
+	}
+	cmd := exec.Command(self, append([]string{"-vv"}, command...)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	if ee, ok := err.(*exec.ExitError); ok {
+		fmt.Fprintf(&out, "\nexit: %v\n", ee)
+	} else if err != nil {
+		fmt.Fprintln(&out, "\ncould not run fn:", err)
+	} else {
+		fmt.Fprintln(&out, "\nexit: 0")
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSupportBundle(t *testing.T) {
+	home, err := ioutil.TempDir("", "fn-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("FN_HOME", os.Getenv("FN_HOME"))
+	os.Setenv("FN_HOME", home)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			w.Write([]byte(`{"version":"0.2.0"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	defer func(g globalOptions) { globals = g }(globals)
+	globals.apiURL = srv.URL
+	globals.token = "s3cr3t"
+
+	if err := audit("routes-delete", "myapp", "/hello", "deleted by s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config{Contexts: map[string]*fnContext{"prod": {APIURL: "https://fn.example.org", Token: "s3cr3t"}}}
+
+	var buf bytes.Buffer
+	b := &bundle{tw: tar.NewWriter(&buf), secrets: []string{globals.token}}
+	if err := writeBundle(b, cfg, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	b.tw.Close()
+
+	files := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(tr)
+		files[hdr.Name] = string(content)
+	}
+	for _, name := range []string{"info.json", "config.yaml", "audit.log"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the bundle, got %v", name, files)
+		}
+		if strings.Contains(files[name], "s3cr3t") {
+			t.Errorf("expected the token to be redacted from %s:\n%s", name, files[name])
+		}
+	}
+	if !strings.Contains(files["info.json"], `"server_version": "0.2.0"`) {
+		t.Errorf("expected the server version in info.json:\n%s", files["info.json"])
+	}
+	if cfg.Contexts["prod"].Token != "s3cr3t" {
+		t.Error("expected the configuration itself to be left alone")
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	if s := string(lastLines([]byte("a\nb\nc\n"), 2)); s != "b\nc\n" {
+		t.Errorf("expected the last 2 lines, got %q", s)
+	}
+	if s := string(lastLines([]byte("a\nb"), 5)); s != "a\nb" {
+		t.Errorf("expected every line, got %q", s)
+	}
+}
@@ -3,20 +3,23 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
-	"net/url"
+	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	functions "github.com/iron-io/functions_go"
 	"github.com/urfave/cli"
 )
 
 func testfn() cli.Command {
-	cmd := testcmd{RoutesApi: functions.NewRoutesApi()}
+	cmd := testcmd{}
 	return cli.Command{
 		Name:   "test",
 		Usage:  "run functions test if present",
@@ -26,10 +29,13 @@ func testfn() cli.Command {
 }
 
 type testcmd struct {
-	*functions.RoutesApi
-
 	build  bool
 	remote string
+	junit  string
+	replay string
+
+	coverage     bool
+	coverprofile string
 }
 
 func (t *testcmd) flags() []cli.Flag {
@@ -44,9 +50,44 @@ func (t *testcmd) flags() []cli.Flag {
 			Usage:       "run tests by calling the function on IronFunctions daemon on `appname`",
 			Destination: &t.remote,
 		},
+		cli.StringFlag{
+			Name:        "junit",
+			Usage:       "also write the results as JUnit XML to `FILE`, for CI",
+			Destination: &t.junit,
+		},
+		cli.StringFlag{
+			Name:        "replay",
+			Usage:       "run the function locally with the calls recorded in `DIR` by fn call --record, rather than the tests of the function file, expecting the same outputs",
+			Destination: &t.replay,
+		},
+		cli.BoolFlag{
+			Name:        "coverage",
+			Usage:       "run go functions instrumented for coverage, built with the local go toolchain, and report the coverage of the tests",
+			Destination: &t.coverage,
+		},
+		cli.StringFlag{
+			Name:        "coverprofile",
+			Usage:       "with --coverage, write the merged coverage profile to `FILE`, and the HTML report next to it",
+			Value:       "coverage.out",
+			Destination: &t.coverprofile,
+		},
 	}
 }
 
+// testOutput is what a function answered a test with. Local runs succeed
+// with 200 and fail with 500.
+type testOutput struct {
+	status         int
+	stdout, stderr string
+	remote         bool
+	// err is the function failing.
+	err error
+}
+
+// testrunner runs a test against target, the image or URL of the function,
+// its error telling the function could not be run at all.
+type testrunner func(target string, tt fftest) (*testOutput, error)
+
 func (t *testcmd) test(c *cli.Context) error {
 	if t.build {
 		b := &buildcmd{verbose: true}
@@ -61,38 +102,112 @@ func (t *testcmd) test(c *cli.Context) error {
 		return err
 	}
 
-	if len(ff.Tests) == 0 {
+	tests := ff.Tests
+	var fixtures map[string]*fixture
+	if t.replay != "" {
+		if t.remote != "" {
+			return usageError("fixtures are replayed locally, --replay cannot be used with --remote")
+		}
+		names, fxs, err := loadFixtures(t.replay)
+		if err != nil {
+			return err
+		}
+		tests, fixtures = nil, make(map[string]*fixture)
+		for i, f := range fxs {
+			tt, err := f.replayTest(names[i])
+			if err != nil {
+				return err
+			}
+			tests = append(tests, tt)
+			fixtures[names[i]] = f
+		}
+	}
+
+	if len(tests) == 0 {
 		return errors.New("no tests found for this function")
 	}
 
-	target := ff.FullName()
-	runtest := runlocaltest
+	image := ff.FullName()
+	var cover *coverage
+	if t.coverage {
+		if t.remote != "" {
+			return usageError("coverage is collected locally, --coverage cannot be used with --remote")
+		}
+		path, err := findFuncfile(".")
+		if err != nil {
+			return err
+		}
+		if cover, err = newCoverage(os.Stdout, path, ff); err != nil {
+			return err
+		}
+		defer cover.close()
+		image = cover.image
+		fmt.Println()
+	}
+
+	var runtest testrunner = runremotetest
+	var paths []string
 	if t.remote != "" {
-		if ff.path == nil || *ff.path == "" {
+		paths = routePaths(ff)
+		if len(paths) == 0 {
 			return errors.New("execution of tests on remote server demand that this function to have a `path`.")
 		}
-		if err := resetBasePath(t.Configuration); err != nil {
-			return fmt.Errorf("error setting endpoint: %v", err)
-		}
-		baseURL, err := url.Parse(t.Configuration.BasePath)
+	} else {
+		// local runs get the settings of the route, as deployed
+		route, err := funcfileRoute(ff, "")
 		if err != nil {
-			return fmt.Errorf("error parsing base path: %v", err)
+			return err
+		}
+		local := routeRunOptions(route, nil)
+		runtest = func(target string, tt fftest) (*testOutput, error) {
+			opts := local
+			f := fixtures[tt.Name]
+			if f != nil {
+				if route, err := funcfileRoute(ff, f.Route); err == nil {
+					opts = routeRunOptions(route, nil)
+				}
+				opts = f.replayOptions(opts)
+			}
+			if cover != nil {
+				opts = cover.options(opts)
+			}
+			out, err := runlocaltest(target, tt, opts)
+			if out != nil && f != nil {
+				// what the function logs was not recorded
+				out.stderr = ""
+			}
+			return out, err
 		}
-
-		u, err := url.Parse("../")
-		u.Path = path.Join(u.Path, "r", t.remote, *ff.path)
-		target = baseURL.ResolveReference(u).String()
-		runtest = runremotetest
 	}
 
 	var foundErr bool
-	fmt.Println("running tests on", ff.FullName(), ":")
-	for _, tt := range ff.Tests {
+	suite := junitSuite{Name: ff.FullName()}
+	if t.replay != "" {
+		fmt.Println("replaying", t.replay, "on", ff.FullName(), ":")
+	} else {
+		fmt.Println("running tests on", ff.FullName(), ":")
+	}
+	for _, tt := range tests {
+		target := image
+		if t.remote != "" {
+			route := tt.Path
+			if route == "" {
+				route = paths[0]
+			}
+			u := apiURL()
+			u.Path = path.Join(u.Path, "r", t.remote, route)
+			target = u.String()
+		}
+
 		start := time.Now()
-		var err error
-		err = runtest(target, tt.In, tt.Out, tt.Err, tt.Env)
+		out, err := runtest(target, tt)
+		if err == nil {
+			err = checkTest(tt, out)
+		}
+		took := time.Since(start)
 
-		fmt.Print("\t - ", tt.Name, " (", time.Since(start), "): ")
+		fmt.Print("\t - ", tt.Name, " (", took, "): ")
+		suite.add(tt.Name, took, err)
 
 		if err != nil {
 			fmt.Println()
@@ -111,81 +226,316 @@ func (t *testcmd) test(c *cli.Context) error {
 		fmt.Println("OK")
 	}
 
+	if t.junit != "" {
+		if err := suite.write(t.junit); err != nil {
+			return err
+		}
+	}
+	if cover != nil {
+		fmt.Println()
+		if err := cover.report(os.Stdout, t.coverprofile); err != nil {
+			return err
+		}
+	}
 	if foundErr {
 		return errors.New("errors found")
 	}
 	return nil
 }
 
-func runlocaltest(target string, in, expectedOut, expectedErr *string, env map[string]string) error {
+// setTestEnv sets the environment of the test, returning the names of the
+// variables set and a func restoring their values.
+func setTestEnv(env map[string]string) (restrictedEnv []string, restore func()) {
+	old := make(map[string]string)
+	for k, v := range env {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+		restrictedEnv = append(restrictedEnv, k)
+	}
+	return restrictedEnv, func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func runlocaltest(target string, tt fftest, opts runOptions) (*testOutput, error) {
 	stdin := &bytes.Buffer{}
-	if in != nil {
-		stdin = bytes.NewBufferString(*in)
+	if tt.In != nil {
+		stdin = bytes.NewBufferString(*tt.In)
 	}
 
 	var stdout, stderr bytes.Buffer
-	var restrictedEnv []string
-	for k, v := range env {
-		oldv := os.Getenv(k)
-		defer func(oldk, oldv string) {
-			os.Setenv(oldk, oldv)
-		}(k, oldv)
-		os.Setenv(k, v)
-		restrictedEnv = append(restrictedEnv, k)
+	restrictedEnv, restore := setTestEnv(tt.Env)
+	defer restore()
+
+	opts.env = append([]string(nil), opts.env...)
+	for _, e := range restrictedEnv {
+		opts.env = append(opts.env, extractEnvVar(e))
+	}
+	out := &testOutput{status: 200}
+	if err := runff(target, stdin, &stdout, &stderr, opts); err != nil {
+		out.status, out.err = 500, err
 	}
+	out.stdout, out.stderr = stdout.String(), stderr.String()
+	return out, nil
+}
 
-	if err := runff(target, stdin, &stdout, &stderr, "", restrictedEnv, nil); err != nil {
-		return fmt.Errorf("%v\nstdout:%s\nstderr:%s\n", err, stdout.String(), stderr.String())
+func runremotetest(target string, tt fftest) (*testOutput, error) {
+	stdin := &bytes.Buffer{}
+	if tt.In != nil {
+		stdin = bytes.NewBufferString(*tt.In)
 	}
 
-	out := stdout.String()
-	if expectedOut == nil && out != "" {
+	var stdout bytes.Buffer
+	restrictedEnv, restore := setTestEnv(tt.Env)
+	defer restore()
+
+	out := &testOutput{remote: true}
+	err := callfn(target, stdin, &stdout, callOptions{
+		env:     restrictedEnv,
+		summary: func(s callSummary) { out.status = s.Status },
+	})
+	if err != nil {
+		fe, ok := err.(*fnError)
+		if !ok || fe.Kind != kindFunction {
+			return nil, err
+		}
+		out.status, out.err = fe.Status, err
+	}
+	out.stdout = stdout.String()
+	return out, nil
+}
+
+// checkTest compares what the function answered with what the test expects.
+func checkTest(tt fftest, o *testOutput) error {
+	if tt.Status == 0 && o.err != nil {
+		if o.remote {
+			return fmt.Errorf("%v\nstdout:%s\n", o.err, o.stdout)
+		}
+		return fmt.Errorf("%v\nstdout:%s\nstderr:%s\n", o.err, o.stdout, o.stderr)
+	}
+	if tt.Status != 0 {
+		failed := tt.Status >= 400
+		if o.remote && o.status != tt.Status || !o.remote && failed != (o.err != nil) {
+			return fmt.Errorf("mismatched status found.\nexpected: %d\ngot: %d\nstdout:%s\n", tt.Status, o.status, o.stdout)
+		}
+	}
+
+	out := o.stdout
+	if tt.Out == nil && out != "" && tt.Contains == "" && len(tt.JSON) == 0 && tt.Status == 0 {
 		return fmt.Errorf("unexpected output found: %s", out)
-	} else if expectedOut != nil && *expectedOut != out {
-		return fmt.Errorf("mismatched output found.\nexpected (%d bytes):\n%s\ngot (%d bytes):\n%s\n", len(*expectedOut), *expectedOut, len(out), out)
+	} else if tt.Out != nil && *tt.Out != out {
+		msg := fmt.Sprintf("mismatched output found.\nexpected (%d bytes):\n%s\ngot (%d bytes):\n%s\n", len(*tt.Out), *tt.Out, len(out), out)
+		if diff := lineDiff(*tt.Out, out); diff != "" {
+			msg += "diff:\n" + diff
+		}
+		return errors.New(msg)
+	}
+	if tt.Contains != "" && !strings.Contains(out, tt.Contains) {
+		return fmt.Errorf("output does not contain %q:\n%s\n", tt.Contains, out)
+	}
+	if len(tt.JSON) > 0 {
+		if err := checkJSON(out, tt.JSON); err != nil {
+			return err
+		}
 	}
 
-	err := stderr.String()
-	if expectedErr == nil && err != "" {
+	if o.remote {
+		if tt.Err != nil {
+			return fmt.Errorf("cannot process stderr in remote calls")
+		}
+		return nil
+	}
+	err := o.stderr
+	if tt.Err == nil && err != "" {
 		return fmt.Errorf("unexpected error output found: %s", err)
-	} else if expectedErr != nil && *expectedErr != err {
-		return fmt.Errorf("mismatched error output found.\nexpected (%d bytes):\n%s\ngot (%d bytes):\n%s\n", len(*expectedErr), *expectedErr, len(err), err)
+	} else if tt.Err != nil && *tt.Err != err {
+		return fmt.Errorf("mismatched error output found.\nexpected (%d bytes):\n%s\ngot (%d bytes):\n%s\n", len(*tt.Err), *tt.Err, len(err), err)
 	}
-
 	return nil
 }
 
-func runremotetest(target string, in, expectedOut, expectedErr *string, env map[string]string) error {
-	stdin := &bytes.Buffer{}
-	if in != nil {
-		stdin = bytes.NewBufferString(*in)
+// maxDiffLines is the number of lines above which outputs are not diffed.
+const maxDiffLines = 1000
+
+// lineDiff lists the lines of want and got, those only in want prefixed with
+// - and those only in got with +, when either has several lines.
+func lineDiff(want, got string) string {
+	a := strings.SplitAfter(want, "\n")
+	b := strings.SplitAfter(got, "\n")
+	if len(a) < 3 && len(b) < 3 || len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return ""
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
 	}
 
-	var stdout bytes.Buffer
+	var diff strings.Builder
+	line := func(prefix, s string) {
+		if s != "" {
+			diff.WriteString(prefix + strings.TrimSuffix(s, "\n") + "\n")
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			line("  ", a[i])
+			i, j = i+1, j+1
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			line("- ", a[i])
+			i++
+		default:
+			line("+ ", b[j])
+			j++
+		}
+	}
+	return diff.String()
+}
 
-	var restrictedEnv []string
-	for k, v := range env {
-		oldv := os.Getenv(k)
-		defer func(oldk, oldv string) {
-			os.Setenv(oldk, oldv)
-		}(k, oldv)
-		os.Setenv(k, v)
-		restrictedEnv = append(restrictedEnv, k)
+// checkJSON checks the values of the JSON output at the paths of want,
+// strings being compared as they are and other values as JSON.
+func checkJSON(out string, want map[string]string) error {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		return fmt.Errorf("output is not JSON: %v\n%s\n", err, out)
 	}
-	if err := callfn(target, stdin, &stdout, "", restrictedEnv); err != nil {
-		return fmt.Errorf("%v\nstdout:%s\n", err, stdout.String())
+	var paths []string
+	for p := range want {
+		paths = append(paths, p)
 	}
+	sort.Strings(paths)
 
-	out := stdout.String()
-	if expectedOut == nil && out != "" {
-		return fmt.Errorf("unexpected output found: %s", out)
-	} else if expectedOut != nil && *expectedOut != out {
-		return fmt.Errorf("mismatched output found.\nexpected (%d bytes):\n%s\ngot (%d bytes):\n%s\n", len(*expectedOut), *expectedOut, len(out), out)
+	var mismatches []string
+	for _, p := range paths {
+		v, err := jsonPath(doc, p)
+		if err != nil {
+			mismatches = append(mismatches, err.Error())
+			continue
+		}
+		got, ok := v.(string)
+		if !ok {
+			b, _ := json.Marshal(v)
+			got = string(b)
+		}
+		if got != want[p] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %s, expected %s", p, got, want[p]))
+		}
 	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("mismatched JSON found:\n%s\n", strings.Join(mismatches, "\n"))
+	}
+	return nil
+}
 
-	if expectedErr != nil {
-		return fmt.Errorf("cannot process stderr in remote calls")
+// jsonPath returns the value of doc at p, a JSONPath of members and indexes
+// like $.items[0].name or $["content-type"].
+func jsonPath(doc interface{}, p string) (interface{}, error) {
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("%s is not a JSONPath, expected it to start with $", p)
 	}
+	v, rest := doc, p[1:]
+	for rest != "" {
+		var key string
+		index := -1
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key, rest = rest[1:end+1], rest[end+1:]
+		case strings.HasPrefix(rest, `["`) || strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest[2:], rest[1:2]+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("%s is not a JSONPath, a ] is missing", p)
+			}
+			key, rest = rest[2:end+2], rest[end+4:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("%s is not a JSONPath, a ] is missing", p)
+			}
+			n, err := strconv.Atoi(rest[1:end])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%s is not a JSONPath, expected an index in []", p)
+			}
+			index, rest = n, rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%s is not a JSONPath, unexpected %s", p, rest)
+		}
 
-	return nil
+		if index >= 0 {
+			a, ok := v.([]interface{})
+			if !ok || index >= len(a) {
+				return nil, fmt.Errorf("%s is missing", p)
+			}
+			v = a[index]
+			continue
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is missing", p)
+		}
+		if v, ok = m[key]; !ok {
+			return nil, fmt.Errorf("%s is missing", p)
+		}
+	}
+	return v, nil
+}
+
+// junitSuite is the JUnit XML report of the tests of a function.
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (s *junitSuite) add(name string, took time.Duration, err error) {
+	c := junitCase{Name: name, ClassName: s.Name, Time: took.Seconds()}
+	if err != nil {
+		msg := strings.SplitN(err.Error(), "\n", 2)[0]
+		c.Failure = &junitFailure{Message: msg, Text: err.Error()}
+		s.Failures++
+	}
+	s.Tests++
+	s.Time += took.Seconds()
+	s.Cases = append(s.Cases, c)
+}
+
+func (s *junitSuite) write(file string) error {
+	b, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append([]byte(xml.Header), append(b, '\n')...), 0644)
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestCheckTest(t *testing.T) {
+	var tests []fftest
+	err := yaml.Unmarshal([]byte(`
+- name: exact
+  out: "Hello World!\n"
+- name: contains
+  contains: Johnny
+- name: json
+  json:
+    $.greeting: Hello Johnny!
+    $.items[1].id: 2
+    $["content-type"]: text/plain
+- name: not found
+  status: 404
+`), &tests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact, contains, json, notFound := tests[0], tests[1], tests[2], tests[3]
+
+	jsonOut := `{"greeting": "Hello Johnny!", "items": [{"id": 1}, {"id": 2}], "content-type": "text/plain"}`
+	for _, c := range []struct {
+		tt   fftest
+		out  testOutput
+		fail string
+	}{
+		{exact, testOutput{status: 200, stdout: "Hello World!\n"}, ""},
+		{exact, testOutput{status: 200, stdout: "Hello Johnny!\n"}, "mismatched output"},
+		{exact, testOutput{status: 200, stdout: "Hello World!\n", stderr: "warning\n"}, "unexpected error output"},
+		{exact, testOutput{status: 500, err: errors.New("exit status 1")}, "exit status 1"},
+		{contains, testOutput{status: 200, stdout: "Hello Johnny!\n"}, ""},
+		{contains, testOutput{status: 200, stdout: "Hello World!\n"}, "does not contain"},
+		{json, testOutput{status: 200, stdout: jsonOut}, ""},
+		{json, testOutput{status: 200, stdout: strings.Replace(jsonOut, `"id": 2`, `"id": 3`, 1)}, "$.items[1].id is 3, expected 2"},
+		{json, testOutput{status: 200, stdout: "Hello"}, "not JSON"},
+		{notFound, testOutput{status: 404, remote: true, err: errors.New("GET /hello: 404 Not Found")}, ""},
+		{notFound, testOutput{status: 200, remote: true}, "mismatched status"},
+		// locally, failing is all 4xx and 5xx statuses can tell
+		{notFound, testOutput{status: 500, err: errors.New("exit status 1")}, ""},
+		{notFound, testOutput{status: 200}, "mismatched status"},
+	} {
+		err := checkTest(c.tt, &c.out)
+		if c.fail == "" && err != nil {
+			t.Errorf("%s: checkTest(%+v) = %v", c.tt.Name, c.out, err)
+		} else if c.fail != "" && (err == nil || !strings.Contains(err.Error(), c.fail)) {
+			t.Errorf("%s: checkTest(%+v) = %v, want an error containing %q", c.tt.Name, c.out, err, c.fail)
+		}
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"a": map[string]interface{}{"b.c": []interface{}{"x", "y"}},
+	}
+	for _, c := range []struct {
+		path string
+		want interface{}
+	}{
+		{"$.a['b.c'][1]", "y"},
+		{`$["a"]["b.c"][0]`, "x"},
+	} {
+		got, err := jsonPath(doc, c.path)
+		if err != nil || got != c.want {
+			t.Errorf("jsonPath(%q) = %v, %v, want %v", c.path, got, err, c.want)
+		}
+	}
+	for _, p := range []string{"a.b", "$.a.d", "$.a['b.c'][2]", "$.a[x]", "$.a['b.c'"} {
+		if _, err := jsonPath(doc, p); err == nil {
+			t.Errorf("jsonPath(%q) should fail", p)
+		}
+	}
+}
+
+func TestJUnitSuite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := junitSuite{Name: "acme/hello:0.0.1"}
+	s.add("world", 1500*time.Millisecond, nil)
+	s.add("johnny", 500*time.Millisecond, errors.New("mismatched output found.\nexpected: Hello Johnny!"))
+	file := filepath.Join(dir, "junit.xml")
+	if err := s.write(file); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<testsuite name="acme/hello:0.0.1" tests="2" failures="1" time="2">`,
+		`<testcase name="world" classname="acme/hello:0.0.1" time="1.5"></testcase>`,
+		`<failure message="mismatched output found.">mismatched output found.&#xA;expected: Hello Johnny!</failure>`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("junit.xml = %s, want it to contain %s", b, want)
+		}
+	}
+}
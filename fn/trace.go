@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// tracingTransport logs every request going through the wrapped transport at
+// the debug level, with its status and latency, to help understanding what
+// the server is unhappy about. On verbosity 2 the full requests and responses
+// are dumped.
+type tracingTransport struct {
+	next  http.RoundTripper
+	level int
+}
+
+func newTracingTransport(next http.RoundTripper, level int) *tracingTransport {
+	return &tracingTransport{next: next, level: level}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.level > 1 && logger.enabled(levelDebug) {
+		req = t.dumpRequest(req)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		logger.debug("request", "method", req.Method, "url", req.URL, "error", err, "latency", latency)
+		return nil, err
+	}
+	logger.debug("request", "method", req.Method, "url", req.URL, "status", resp.StatusCode, "latency", latency)
+
+	if t.level > 1 && logger.enabled(levelDebug) {
+		dump, err := httputil.DumpResponse(resp, dumpedBody(resp.ContentLength))
+		if err != nil {
+			logger.debug("could not dump response", "error", err)
+		} else {
+			logger.debug("response", "dump", string(prefixLines("< ", dump)))
+		}
+	}
+	return resp, nil
+}
+
+// dumpRequest writes the request out, with credentials redacted, and returns
+// the request to send. Its body, when small enough, is read for the dump, the
+// request returned being then a clone holding a copy of it, as transports
+// must not modify the requests they are given.
+func (t *tracingTransport) dumpRequest(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	if r.Header.Get("Authorization") != "" {
+		r.Header.Set("Authorization", "<redacted>")
+	}
+
+	dump, err := httputil.DumpRequestOut(r, r.Body == nil || r.Body == http.NoBody || r.ContentLength > 0 && dumpedBody(r.ContentLength))
+	if r.Body != req.Body {
+		sent := req.Clone(req.Context())
+		sent.Body = r.Body
+		req = sent
+	}
+	if err != nil {
+		logger.debug("could not dump request", "error", err)
+		return req
+	}
+	logger.debug("request", "dump", string(prefixLines("> ", redactSecrets(dump))))
+	return req
+}
+
+// maxDumpedBody is the largest body dumped, larger ones and those of unknown
+// size being streamed rather than held in memory.
+const maxDumpedBody = 64 << 10
+
+func dumpedBody(contentLength int64) bool {
+	return contentLength >= 0 && contentLength <= maxDumpedBody
+}
+
+func prefixLines(prefix string, b []byte) []byte {
+	var out []byte
+	bol := true
+	for _, c := range b {
+		if bol {
+			out = append(out, prefix...)
+		}
+		out = append(out, c)
+		bol = c == '\n'
+	}
+	return out
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixLines(t *testing.T) {
+	cases := map[string]string{
+		"":                 "",
+		"GET / HTTP/1.1":   "> GET / HTTP/1.1",
+		"a\r\nb\r\n":       "> a\r\n> b\r\n",
+		"a\n\nbody":        "> a\n> \n> body",
+		"trailing\nline\n": "> trailing\n> line\n",
+	}
+	for in, want := range cases {
+		if got := string(prefixLines("> ", []byte(in))); got != want {
+			t.Errorf("prefixLines(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTracingTransport(t *testing.T) {
+	var dumps bytes.Buffer
+	defer func(l *cliLogger) { logger = l }(logger)
+	logger = &cliLogger{out: &dumps, level: levelDebug, now: time.Now}
+	resolvedSecrets.Lock()
+	saved := resolvedSecrets.values
+	resolvedSecrets.values = append(saved[:len(saved):len(saved)], "hunter2")
+	resolvedSecrets.Unlock()
+	defer func() {
+		resolvedSecrets.Lock()
+		resolvedSecrets.values = saved
+		resolvedSecrets.Unlock()
+	}()
+
+	var auth string
+	var received int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		b, _ := ioutil.ReadAll(r.Body)
+		received = len(b)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: newTracingTransport(http.DefaultTransport, 2)}
+
+	body := `{"route": {"config": {"DB_PASS": "hunter2"}}}`
+	req, _ := http.NewRequest("POST", srv.URL+"/v1/apps/myapp/routes", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer t0ken")
+	reqBody := req.Body
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	dump := dumps.String()
+	for _, leaked := range []string{"Bearer t0ken", "hunter2"} {
+		if strings.Contains(dump, leaked) {
+			t.Errorf("%s leaked in the trace:\n%s", leaked, dump)
+		}
+	}
+	if !strings.Contains(dump, "Authorization: <redacted>") || !strings.Contains(dump, `"DB_PASS": "<redacted>"`) {
+		t.Errorf("expected the credentials and secrets redacted in the trace:\n%s", dump)
+	}
+	if auth != "Bearer t0ken" || received != len(body) {
+		t.Errorf("expected the request sent as it was, got authorization %q and %d bytes", auth, received)
+	}
+	if req.Header.Get("Authorization") != "Bearer t0ken" || req.Body != reqBody {
+		t.Error("expected the request given to the transport to be left alone")
+	}
+
+	// larger bodies are sent without being dumped
+	dumps.Reset()
+	big := strings.Repeat("x", maxDumpedBody+1)
+	req, _ = http.NewRequest("PUT", srv.URL+"/big", strings.NewReader(big))
+	if resp, err = client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if received != len(big) {
+		t.Errorf("expected the %d bytes of the body sent, got %d", len(big), received)
+	}
+	if strings.Contains(dumps.String(), big[:1024]) || !strings.Contains(dumps.String(), "Content-Length: "+strconv.Itoa(len(big))) {
+		t.Errorf("expected the large body left out of the dump:\n%.2000s", dumps.String())
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+// transport is the single http.RoundTripper every outgoing request goes
+// through, be it API calls made by the swagger client or function calls.
+// Proxies are honored through the usual HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables. Connections are kept open to be reused, and speak
+// HTTP/2 with servers offering it over TLS.
+var transport http.RoundTripper = http.DefaultTransport
+
+func setupTransport() error {
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	transport = newHTTPTransport(tlsConfig)
+	if globals.verbose > 0 {
+		transport = newTracingTransport(transport, globals.verbose)
+	}
+	if globals.retries > 0 {
+		transport = &retryTransport{next: transport, retries: globals.retries, backoff: globals.retryBackoff}
+	}
+	if tracer != nil {
+		transport = spanTransport{next: transport}
+	}
+	return nil
+}
+
+func newHTTPTransport(tlsConfig *tls.Config) *http.Transport {
+	idle := globals.maxIdleConnsPerHost
+	if idle <= 0 {
+		idle = http.DefaultMaxIdleConnsPerHost
+	}
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          idle,
+		MaxIdleConnsPerHost:   idle,
+		MaxConnsPerHost:       globals.maxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// a TLS config of our own disables HTTP/2 unless asked for
+		ForceAttemptHTTP2: !globals.noHTTP2,
+	}
+	if globals.noHTTP2 {
+		// a non-nil empty map turns HTTP/2 off
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+func newTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: globals.insecure}
+
+	if globals.tlsCA != "" {
+		pem, err := ioutil.ReadFile(globals.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", globals.tlsCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (globals.tlsCert == "") != (globals.tlsKey == "") {
+		return nil, errors.New("both --tls-cert and --tls-key must be set for mutual TLS")
+	}
+	if globals.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(globals.tlsCert, globals.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+var callClient struct {
+	sync.Mutex
+	client *http.Client
+}
+
+// httpClient returns the client used to call functions, the same for every
+// call so that connections are reused. It must not be changed, but copied.
+func httpClient() *http.Client {
+	callClient.Lock()
+	defer callClient.Unlock()
+	if c := callClient.client; c == nil || c.Transport != transport || c.Timeout != globals.callTimeout {
+		callClient.client = &http.Client{
+			Transport: transport,
+			Timeout:   globals.callTimeout,
+		}
+	}
+	return callClient.client
+}
+
+// drainBody reads what is left of body, up to a limit, and closes it, so that
+// its connection can be reused.
+func drainBody(body io.ReadCloser) error {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrainedBody))
+	return body.Close()
+}
+
+// maxDrainedBody is how much of a response is read to reuse its connection,
+// closing it being cheaper beyond.
+const maxDrainedBody = 256 << 10
+
+// apiTransport points the requests built by the swagger client at the API
+// address resolved for this run, and authenticates them. The swagger client
+// is created before flags and contexts are parsed, therefore it cannot be
+// told these upfront.
+type apiTransport struct{}
+
+func (apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if globals.offline {
+		return offlineRoundTrip(req)
+	}
+	u := apiURL()
+
+	r := req.WithContext(req.Context())
+	ru := *req.URL
+	ru.Scheme = u.Scheme
+	ru.Host = u.Host
+	ru.Path = path.Join("/", u.Path, req.URL.Path)
+	r.URL = &ru
+	r.Host = u.Host
+
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	if globals.token != "" && r.Header.Get("Authorization") == "" {
+		r.Header.Set("Authorization", "Bearer "+globals.token)
+	}
+
+	if isCacheable(r) {
+		if resp := lookupCache(r); resp != nil {
+			return resp, nil
+		}
+		resp, err := sendAPI(r)
+		if err != nil {
+			return nil, err
+		}
+		return storeCache(r, resp)
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		invalidateCache()
+	}
+	return sendAPI(r)
+}
+
+// sendAPI sends r to the API, within --api-timeout.
+func sendAPI(r *http.Request) (*http.Response, error) {
+	if globals.apiTimeout <= 0 {
+		return transport.RoundTrip(r)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), globals.apiTimeout)
+	resp, err := transport.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of an API call only once its response
+// body has been consumed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
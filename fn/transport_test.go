@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCallConnectionReuse(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a body the caller does not read whole
+		fmt.Fprint(w, strings.Repeat("x", 64<<10))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	defer func(t http.RoundTripper) { transport = t }(transport)
+	transport = newHTTPTransport(nil)
+
+	for i := 0; i < 5; i++ {
+		if err := callfn(srv.URL, nil, &bytes.Buffer{}, callOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("5 calls opened %d connections, want 1", n)
+	}
+	if httpClient() != httpClient() {
+		t.Error("calls do not share their client")
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	defer func(v bool) { globals.noHTTP2 = v }(globals.noHTTP2)
+	for _, c := range []struct {
+		noHTTP2 bool
+		proto   string
+	}{
+		{false, "HTTP/2.0"},
+		{true, "HTTP/1.1"},
+	} {
+		globals.noHTTP2 = c.noHTTP2
+		client := &http.Client{Transport: newHTTPTransport(tlsConfig.Clone())}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Proto != c.proto {
+			t.Errorf("--no-http2=%v: got %s, want %s", c.noHTTP2, resp.Proto, c.proto)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+// trashed is the snapshot of a deleted route, kept so it can be restored.
+type trashed struct {
+	APIURL    string          `json:"api_url"`
+	App       string          `json:"app"`
+	DeletedAt time.Time       `json:"deleted_at"`
+	Route     *fnmodels.Route `json:"route"`
+
+	file string
+}
+
+func trashDir() string {
+	return filepath.Join(fnHome(), "trash")
+}
+
+func trashRoute(appName string, route *fnmodels.Route) error {
+	t := trashed{
+		APIURL:    apiURL().String(),
+		App:       appName,
+		DeletedAt: time.Now().UTC(),
+		Route:     route,
+	}
+	if err := os.MkdirAll(trashDir(), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(t, "", "\t")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.json", url.PathEscape(appName+route.Path), t.DeletedAt.UnixNano())
+	return writeState(filepath.Join(trashDir(), name), b)
+}
+
+// trashList returns the snapshots in the trash, the most recent first.
+func trashList() ([]*trashed, error) {
+	files, err := ioutil.ReadDir(trashDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var all []*trashed
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		file := filepath.Join(trashDir(), f.Name())
+		b, err := readState(file)
+		if err != nil {
+			return nil, err
+		}
+		t := &trashed{file: file}
+		if err := json.Unmarshal(b, t); err != nil || t.Route == nil {
+			fmt.Fprintln(os.Stderr, "skipping invalid trash entry", file)
+			continue
+		}
+		all = append(all, t)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].DeletedAt.After(all[j].DeletedAt) })
+	return all, nil
+}
+
+func (a *routesCmd) restore(c *cli.Context) error {
+	args, err := routeArgs(c, "app", "path")
+	if err != nil {
+		return err
+	}
+	appName := args.Get(0)
+	route := args.Get(1)
+
+	all, err := trashList()
+	if err != nil {
+		return err
+	}
+	var t *trashed
+	for _, candidate := range all {
+		if candidate.App == appName && candidate.Route.Path == route && candidate.APIURL == apiURL().String() {
+			t = candidate
+			break
+		}
+	}
+	if t == nil {
+		return newNotFoundError(fmt.Sprintf("no deleted route %s%s in the trash", appName, route))
+	}
+
+	if err := checkRouteCompat(t.Route); err != nil {
+		return err
+	}
+	_, err = a.client.Routes.PostAppsAppRoutes(&apiroutes.PostAppsAppRoutesParams{
+		Context: cmdContext(),
+		App:     appName,
+		Body:    &fnmodels.RouteWrapper{Route: t.Route},
+	})
+	if err != nil {
+		return apiError(err)
+	}
+	if err := os.Remove(t.file); err != nil {
+		return err
+	}
+
+	progress(appName, route, "restored with", t.Route.Image)
+	return nil
+}
+
+type trashCmd struct{}
+
+func trash() cli.Command {
+	t := trashCmd{}
+	return cli.Command{
+		Name:  "trash",
+		Usage: "manage the deleted routes kept for restoring",
+		Subcommands: []cli.Command{
+			{
+				Name:    "list",
+				Aliases: []string{"l"},
+				Usage:   "list deleted routes",
+				Action:  t.list,
+				Flags:   []cli.Flag{failOnEmptyFlag},
+			},
+			{
+				Name:   "empty",
+				Usage:  "permanently forget deleted routes",
+				Action: t.empty,
+				Flags: []cli.Flag{
+					cli.DurationFlag{
+						Name:  "older-than",
+						Usage: "only forget routes deleted longer ago than that, eg. 720h",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *trashCmd) list(c *cli.Context) error {
+	all, err := trashList()
+	if err != nil {
+		return err
+	}
+	if len(all) == 0 && c.Bool("fail-on-empty") {
+		return emptyError("deleted routes")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "deleted", "\t", "app", "\t", "path", "\t", "image", "\t", "api-url", "\n")
+	for _, t := range all {
+		fmt.Fprint(w, t.DeletedAt.Local().Format("2006-01-02 15:04"), "\t", t.App, "\t", t.Route.Path, "\t", t.Route.Image, "\t", t.APIURL, "\n")
+	}
+	return w.Flush()
+}
+
+func (t *trashCmd) empty(c *cli.Context) error {
+	all, err := trashList()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-c.Duration("older-than"))
+	removed := 0
+	for _, t := range all {
+		if t.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(t.file); err != nil {
+			return err
+		}
+		removed++
+	}
+
+	progress(formatCount(int64(removed)), "deleted routes forgotten")
+	return nil
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	fnclient "github.com/iron-io/functions_go/client"
+	apiapps "github.com/iron-io/functions_go/client/apps"
+	apiroutes "github.com/iron-io/functions_go/client/routes"
+	fnmodels "github.com/iron-io/functions_go/models"
+	"github.com/urfave/cli"
+)
+
+// fn ui draws its dashboard with ANSI escape sequences, the terminal being put
+// in raw mode with stty as disableEcho does, and reads the keys typed one at a
+// time. The dashboard itself only knows of keys and of the API, for tests.
+
+// uiRefresh is how often logs are fetched while tailing them.
+const uiRefresh = 2 * time.Second
+
+// uiMaxOutput is the number of lines of responses and logs kept.
+const uiMaxOutput = 500
+
+func ui() cli.Command {
+	return cli.Command{
+		Name:  "ui",
+		Usage: "browse apps and routes, tail the logs of routes and call them in a terminal dashboard",
+		Flags: []cli.Flag{metricsAddrFlag},
+		Action: func(c *cli.Context) error {
+			if !isTerminal(int(os.Stdin.Fd())) || !isTerminal(int(os.Stdout.Fd())) {
+				return usageError("fn ui needs a terminal")
+			}
+			stopMetrics, err := serveMetrics(c.String("metrics-addr"))
+			if err != nil {
+				return err
+			}
+			defer stopMetrics()
+			return newDashboard(apiDashboard{client: apiClient()}).run(os.Stdin, os.Stdout)
+		},
+	}
+}
+
+// dashboardAPI is what the dashboard reads and calls.
+type dashboardAPI interface {
+	apps() ([]string, error)
+	routes(app string) ([]*fnmodels.Route, error)
+	logs(app string, q logQuery) ([]*logLine, error)
+	call(app, route string, payload []byte) ([]byte, error)
+}
+
+// dashboard browses apps, then the routes of an app, then a route, whose
+// logs can be tailed and which can be called with a payload edited in place.
+type dashboard struct {
+	api dashboardAPI
+
+	apps   []string
+	app    string
+	routes []*fnmodels.Route
+	route  *fnmodels.Route
+
+	// selected is the line selected in lists, and the first line shown of
+	// routes.
+	selected int
+
+	// output is the response of the last call, or the logs tailed.
+	output  []string
+	tailing bool
+	tail    *logTail
+	logs    bytes.Buffer
+
+	// editing is on while the payload is typed in.
+	editing bool
+	payload []byte
+
+	status string
+	quit   bool
+}
+
+func newDashboard(api dashboardAPI) *dashboard {
+	return &dashboard{api: api}
+}
+
+// run draws the dashboard on out until q is typed, reading keys from in.
+func (d *dashboard) run(in io.Reader, out io.Writer) error {
+	restore, err := rawTerminal()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// on the alternate screen, without cursor
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, k := range parseKeys(buf[:n]) {
+				keys <- k
+			}
+		}
+	}()
+	ticker := time.NewTicker(uiRefresh)
+	defer ticker.Stop()
+
+	d.refresh()
+	for !d.quit {
+		rows, cols := terminalSize()
+		d.render(out, rows, cols)
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			d.handle(k)
+		case <-ticker.C:
+			if d.tailing {
+				d.fetchLogs()
+			}
+		}
+	}
+	return nil
+}
+
+// handle acts on a key, as returned by parseKeys.
+func (d *dashboard) handle(key string) {
+	if d.editing {
+		d.edit(key)
+		return
+	}
+	d.status = ""
+	switch key {
+	case "q", "ctrl-c":
+		d.quit = true
+	case "up", "k":
+		d.move(-1)
+	case "down", "j":
+		d.move(1)
+	case "enter", "right":
+		d.open()
+	case "esc", "backspace", "left":
+		d.back()
+	case "r":
+		d.refresh()
+	case "l":
+		if d.route != nil {
+			d.toggleLogs()
+		}
+	case "c":
+		if d.route != nil {
+			d.editing = true
+			d.tailing = false
+		}
+	}
+}
+
+func (d *dashboard) move(delta int) {
+	d.selected += delta
+	if n := len(d.items()); d.selected >= n {
+		d.selected = n - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+}
+
+func (d *dashboard) open() {
+	switch {
+	case d.app == "" && d.selected < len(d.apps):
+		d.app = d.apps[d.selected]
+	case d.app != "" && d.route == nil && d.selected < len(d.routes):
+		d.route = d.routes[d.selected]
+		d.output, d.tailing = nil, false
+	default:
+		return
+	}
+	d.selected = 0
+	d.refresh()
+}
+
+func (d *dashboard) back() {
+	switch {
+	case d.route != nil:
+		path := d.route.Path
+		d.route, d.tailing, d.output = nil, false, nil
+		d.refresh()
+		for i, r := range d.routes {
+			if r.Path == path {
+				d.selected = i
+			}
+		}
+	case d.app != "":
+		app := d.app
+		d.app, d.routes = "", nil
+		d.refresh()
+		for i, a := range d.apps {
+			if a == app {
+				d.selected = i
+			}
+		}
+	}
+}
+
+// refresh reads again what is shown.
+func (d *dashboard) refresh() {
+	var err error
+	switch {
+	case d.route != nil:
+		if d.tailing {
+			d.fetchLogs()
+		}
+		return
+	case d.app != "":
+		d.routes, err = d.api.routes(d.app)
+	default:
+		d.apps, err = d.api.apps()
+	}
+	if err != nil {
+		d.status = err.Error()
+	}
+	d.move(0)
+}
+
+func (d *dashboard) toggleLogs() {
+	d.tailing = !d.tailing
+	if !d.tailing {
+		return
+	}
+	d.logs.Reset()
+	d.tail = &logTail{out: &d.logs}
+	d.selected = 0
+	d.fetchLogs()
+}
+
+// fetchLogs appends the lines logged by the route since the last fetch.
+func (d *dashboard) fetchLogs() {
+	q := logQuery{Path: d.route.Path, Since: d.tail.last}
+	if q.Since.IsZero() {
+		q.Tail = 50
+	}
+	lines, err := d.api.logs(d.app, q)
+	if err == nil {
+		err = d.tail.print(lines)
+	}
+	if err != nil {
+		d.status = err.Error()
+	}
+	d.output = outputLines(d.logs.Bytes())
+}
+
+// edit types a key in the payload, which ctrl-d sends and esc cancels.
+func (d *dashboard) edit(key string) {
+	switch key {
+	case "esc", "ctrl-c":
+		d.editing = false
+	case "ctrl-d", "ctrl-s":
+		d.editing = false
+		d.call()
+	case "enter":
+		d.payload = append(d.payload, '\n')
+	case "backspace":
+		if _, size := utf8.DecodeLastRune(d.payload); size > 0 {
+			d.payload = d.payload[:len(d.payload)-size]
+		}
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			d.payload = append(d.payload, key...)
+		}
+	}
+}
+
+func (d *dashboard) call() {
+	start := time.Now()
+	resp, err := d.api.call(d.app, d.route.Path, d.payload)
+	took := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		d.status = fmt.Sprintf("call failed after %s", took)
+		resp = []byte(err.Error())
+	} else {
+		d.status = fmt.Sprintf("called in %s", took)
+	}
+	d.output = outputLines(resp)
+	d.selected = 0
+}
+
+// items are the lines of the list shown, the details and output of the route
+// when one is shown.
+func (d *dashboard) items() []string {
+	switch {
+	case d.route != nil:
+		b, _ := json.MarshalIndent(d.route, "", "  ")
+		items := strings.Split(string(b), "\n")
+		switch {
+		case d.editing:
+			items = append(items, "", "payload, ctrl-d to send it, esc to cancel:")
+			items = append(items, strings.Split(string(d.payload)+"_", "\n")...)
+		case d.tailing:
+			items = append(items, "", "logs:")
+			items = append(items, d.output...)
+		case d.output != nil:
+			items = append(items, "", "response:")
+			items = append(items, d.output...)
+		}
+		return items
+	case d.app != "":
+		var items []string
+		for _, r := range d.routes {
+			items = append(items, fmt.Sprintf("%-30s %-40s %s", r.Path, r.Image, formatMemory(r.Memory)))
+		}
+		return items
+	}
+	return d.apps
+}
+
+func (d *dashboard) help() string {
+	switch {
+	case d.editing:
+		return "type the payload   ctrl-d send   esc cancel"
+	case d.route != nil:
+		return "c call   l logs   up/down scroll   esc back   q quit"
+	}
+	return "up/down move   enter open   esc back   r refresh   q quit"
+}
+
+// render draws the dashboard on a terminal of rows lines of cols characters.
+func (d *dashboard) render(w io.Writer, rows, cols int) {
+	crumbs := []string{"apps"}
+	if d.app != "" {
+		crumbs = append(crumbs, d.app)
+	}
+	if d.route != nil {
+		crumbs = append(crumbs, d.route.Path)
+	}
+	lines := []string{
+		fmt.Sprintf("fn ui - %s (%s)", globals.contextName, apiURL()),
+		strings.Join(crumbs, " > "),
+		strings.Repeat("-", cols),
+	}
+
+	items := d.items()
+	height := rows - len(lines) - 2
+	if height < 1 {
+		height = 1
+	}
+	top := 0
+	if d.route != nil {
+		// routes scroll rather than select, following what is typed in
+		top = d.selected
+		if d.editing && len(items) > height {
+			top = len(items) - height
+		}
+	} else if d.selected >= height {
+		top = d.selected - height + 1
+	}
+	for i := top; i < top+height; i++ {
+		switch {
+		case i >= len(items):
+			lines = append(lines, "")
+		case d.route == nil && i == d.selected && globals.noColor:
+			lines = append(lines, "> "+truncate(items[i], cols-2))
+		case d.route == nil && i == d.selected:
+			lines = append(lines, "\x1b[7m> "+truncate(items[i], cols-2)+"\x1b[0m")
+		case d.route == nil:
+			lines = append(lines, "  "+truncate(items[i], cols-2))
+		default:
+			lines = append(lines, truncate(items[i], cols))
+		}
+	}
+	if d.app == "" && len(d.apps) == 0 || d.app != "" && d.route == nil && len(d.routes) == 0 {
+		lines[3] = "  (none)"
+	}
+	status := d.help()
+	if d.status != "" {
+		status = d.status
+	}
+	lines = append(lines, strings.Repeat("-", cols), truncate(status, cols))
+
+	// raw terminals need carriage returns
+	fmt.Fprint(w, "\x1b[H\x1b[2J"+strings.Join(lines, "\r\n"))
+}
+
+func truncate(s string, n int) string {
+	s = strings.Replace(s, "\t", "    ", -1)
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// outputLines are the last lines of b shown.
+func outputLines(b []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(lastLines(b, uiMaxOutput)), "\n"), "\n")
+}
+
+// parseKeys splits what was read from the terminal into keys, naming the
+// special ones.
+func parseKeys(b []byte) []string {
+	named := map[string]string{
+		"\x1b[A": "up", "\x1bOA": "up",
+		"\x1b[B": "down", "\x1bOB": "down",
+		"\x1b[C": "right", "\x1bOC": "right",
+		"\x1b[D": "left", "\x1bOD": "left",
+	}
+	var keys []string
+	for len(b) > 0 {
+		if b[0] == 0x1b && len(b) >= 3 {
+			if k, ok := named[string(b[:3])]; ok {
+				keys = append(keys, k)
+				b = b[3:]
+				continue
+			}
+		}
+		switch b[0] {
+		case 0x1b:
+			keys = append(keys, "esc")
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 0x7f, '\b':
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl-c")
+		case 0x04:
+			keys = append(keys, "ctrl-d")
+		case 0x13:
+			keys = append(keys, "ctrl-s")
+		default:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+func stty(args ...string) ([]byte, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	return cmd.Output()
+}
+
+// rawTerminal passes keys as they are typed, without echoing them, until the
+// returned function is called.
+func rawTerminal() (restore func(), err error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("could not set the terminal up with stty: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("could not set the terminal up with stty: %v", err)
+	}
+	return func() { stty(strings.TrimSpace(string(state))) }, nil
+}
+
+// terminalSize returns the lines and columns of the terminal, 24x80 when
+// they cannot be told.
+func terminalSize() (rows, cols int) {
+	rows, cols = 24, 80
+	out, err := stty("size")
+	if err != nil {
+		return
+	}
+	f := strings.Fields(string(out))
+	if len(f) == 2 {
+		if r, err := strconv.Atoi(f[0]); err == nil && r > 0 {
+			rows = r
+		}
+		if c, err := strconv.Atoi(f[1]); err == nil && c > 0 {
+			cols = c
+		}
+	}
+	return
+}
+
+// apiDashboard reads and calls through the client and helpers of the
+// commands.
+type apiDashboard struct {
+	client *fnclient.Functions
+}
+
+func (a apiDashboard) apps() ([]string, error) {
+	resp, err := a.client.Apps.GetApps(&apiapps.GetAppsParams{Context: cmdContext()})
+	if err != nil {
+		return nil, apiError(err)
+	}
+	var names []string
+	for _, app := range resp.Payload.Apps {
+		names = append(names, app.Name)
+	}
+	return names, nil
+}
+
+func (a apiDashboard) routes(app string) ([]*fnmodels.Route, error) {
+	resp, err := a.client.Routes.GetAppsAppRoutes(&apiroutes.GetAppsAppRoutesParams{Context: cmdContext(), App: app})
+	if err != nil {
+		return nil, apiError(err)
+	}
+	return resp.Payload.Routes, nil
+}
+
+func (apiDashboard) logs(app string, q logQuery) ([]*logLine, error) {
+	return fetchLogs(app, q)
+}
+
+func (apiDashboard) call(app, route string, payload []byte) ([]byte, error) {
+	budget, err := loadBudget(false)
+	if err != nil {
+		return nil, err
+	}
+	defer budget.save()
+	var content io.Reader
+	if len(payload) > 0 {
+		content = bytes.NewReader(payload)
+	}
+	var out bytes.Buffer
+	err = callfn(routeURL(app, route).String(), content, &out, callOptions{app: app, route: route, budget: budget})
+	return out.Bytes(), err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	fnmodels "github.com/iron-io/functions_go/models"
+)
+
+type fakeDashboardAPI struct {
+	called  []string
+	queries []logQuery
+}
+
+func (f *fakeDashboardAPI) apps() ([]string, error) { return []string{"myapp", "shop"}, nil }
+
+func (f *fakeDashboardAPI) routes(app string) ([]*fnmodels.Route, error) {
+	if app != "shop" {
+		return nil, errors.New("no such app")
+	}
+	return []*fnmodels.Route{{Path: "/cart", Image: "acme/cart"}, {Path: "/pay", Image: "acme/pay"}}, nil
+}
+
+func (f *fakeDashboardAPI) logs(app string, q logQuery) ([]*logLine, error) {
+	f.queries = append(f.queries, q)
+	return []*logLine{{Time: time.Unix(1, 0), CallID: "c1", Path: q.Path, Line: "paid"}}, nil
+}
+
+func (f *fakeDashboardAPI) call(app, route string, payload []byte) ([]byte, error) {
+	f.called = append(f.called, app+route+" "+string(payload))
+	return []byte("paid 42\n"), nil
+}
+
+func TestDashboard(t *testing.T) {
+	api := &fakeDashboardAPI{}
+	d := newDashboard(api)
+	d.refresh()
+	keys := func(keys ...string) {
+		for _, k := range keys {
+			d.handle(k)
+		}
+	}
+
+	keys("down", "down", "enter", "down", "enter")
+	if d.app != "shop" || d.route == nil || d.route.Path != "/pay" {
+		t.Fatalf("expected /pay of shop to be shown, got %s %+v", d.app, d.route)
+	}
+
+	keys("c", "4", "2", "x", "backspace", "ctrl-d")
+	if want := []string{"shop/pay 42"}; !reflect.DeepEqual(api.called, want) {
+		t.Errorf("expected the calls %q, got %q", want, api.called)
+	}
+	if !reflect.DeepEqual(d.output, []string{"paid 42"}) {
+		t.Errorf("expected the response to be shown, got %q", d.output)
+	}
+
+	keys("l")
+	if !d.tailing || len(api.queries) != 1 || api.queries[0].Path != "/pay" || api.queries[0].Tail != 50 {
+		t.Errorf("expected the last logs of /pay to be fetched, got %+v", api.queries)
+	}
+	d.fetchLogs()
+	if q := api.queries[1]; !q.Since.Equal(time.Unix(1, 0)) {
+		t.Errorf("expected the logs since the last line to be fetched, got %+v", q)
+	}
+	if len(d.output) != 1 || !strings.HasSuffix(d.output[0], "c1 paid") {
+		t.Errorf("expected the line logged once, got %q", d.output)
+	}
+
+	var out bytes.Buffer
+	d.render(&out, 24, 80)
+	for _, want := range []string{"apps > shop > /pay", `"image": "acme/pay"`, "logs:", "c1 paid"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected the dashboard to show %q, got %q", want, out.String())
+		}
+	}
+
+	keys("esc")
+	if d.route != nil || d.selected != 1 {
+		t.Errorf("expected the routes of shop with /pay selected, got %+v selecting %d", d.route, d.selected)
+	}
+	keys("esc", "q")
+	if d.app != "" || d.selected != 1 || !d.quit {
+		t.Errorf("expected the apps with shop selected, then to quit, got %s selecting %d", d.app, d.selected)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("\x1b[Aj\r\x7f\x1bé\x04"))
+	want := []string{"up", "j", "enter", "backspace", "esc", "é", "ctrl-d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseKeys() = %q, want %q", got, want)
+	}
+}
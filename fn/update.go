@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	vers "github.com/iron-io/functions/api/version"
+	"github.com/urfave/cli"
+)
+
+// fn is released on GitHub, each release holding the binaries of fn for
+// every platform and checksums.txt, their SHA-256 as written by sha256sum.
+// Stable releases are the full ones, nightly builds are pre-releases.
+//
+// Binaries are named fn_<os>_<arch>, .exe on Windows. Releases from before
+// held only amd64 binaries, named fn_linux, fn_mac and fn.exe.
+
+const (
+	defaultReleasesURL = "https://api.github.com/repos/iron-io/functions/releases"
+	checksumsAsset     = "checksums.txt"
+	channelStable      = "stable"
+	channelNightly     = "nightly"
+)
+
+type release struct {
+	Tag        string         `json:"tag_name"`
+	Prerelease bool           `json:"prerelease"`
+	Draft      bool           `json:"draft"`
+	Assets     []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func (r *release) version() string { return strings.TrimPrefix(r.Tag, "v") }
+
+func (r *release) asset(name string) *releaseAsset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+func channelFlag() cli.StringFlag {
+	return cli.StringFlag{
+		Name:   "channel",
+		Usage:  "release channel, stable or nightly",
+		EnvVar: "FN_CHANNEL",
+		Value:  channelStable,
+	}
+}
+
+func update() cli.Command {
+	return cli.Command{
+		Name:  "update",
+		Usage: "replace fn with its latest release, once its checksum is verified",
+		Flags: []cli.Flag{
+			channelFlag(),
+			cli.BoolFlag{
+				Name:  "force",
+				Usage: "install the latest release even when fn is as recent",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			r, err := latestRelease(c.String("channel"))
+			if err != nil {
+				return err
+			}
+			if !c.Bool("force") && compareVersions(r.version(), vers.Version) <= 0 {
+				progress("fn", vers.Version, "is up to date")
+				return nil
+			}
+
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			if exe, err = filepath.EvalSymlinks(exe); err != nil {
+				return err
+			}
+			bin := r.binary(runtime.GOOS, runtime.GOARCH)
+			if bin == nil {
+				return newNotFoundError(fmt.Sprintf("fn %s is not released for %s/%s, fn was not updated", r.version(), runtime.GOOS, runtime.GOARCH))
+			}
+			progress("downloading fn", r.version())
+			if err := selfUpdate(r, bin.Name, exe); err != nil {
+				return err
+			}
+			progress("fn updated from", vers.Version, "to", r.version())
+			return nil
+		},
+	}
+}
+
+func releasesURL() string {
+	return firstNonEmpty(os.Getenv("FN_RELEASES_URL"), defaultReleasesURL)
+}
+
+// latestRelease returns the most recent release of channel.
+func latestRelease(channel string) (*release, error) {
+	if channel != channelStable && channel != channelNightly {
+		return nil, usageError("unknown channel %s, expected stable or nightly", channel)
+	}
+
+	var releases []release
+	resp, err := httpGet(releasesURL())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("could not read the releases of fn: %v", err)
+	}
+
+	var latest *release
+	for i, r := range releases {
+		if r.Draft || r.Prerelease && channel == channelStable {
+			continue
+		}
+		if latest == nil || compareVersions(r.version(), latest.version()) > 0 {
+			latest = &releases[i]
+		}
+	}
+	if latest == nil {
+		return nil, newNotFoundError("no " + channel + " release of fn found")
+	}
+	return latest, nil
+}
+
+// binary returns the binary of fn released for goos and goarch, nil when r
+// has none.
+func (r *release) binary(goos, goarch string) *releaseAsset {
+	name := "fn_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	if a := r.asset(name); a != nil || goarch != "amd64" {
+		return a
+	}
+	switch goos {
+	case "darwin":
+		return r.asset("fn_mac")
+	case "windows":
+		return r.asset("fn.exe")
+	}
+	return r.asset("fn_" + goos)
+}
+
+// selfUpdate replaces exe with the binary of r, once its checksum matches the
+// one released. The binary is downloaded next to exe so that it can be
+// renamed over it.
+func selfUpdate(r *release, binary, exe string) error {
+	bin, sums := r.asset(binary), r.asset(checksumsAsset)
+	if bin == nil {
+		return newNotFoundError(fmt.Sprintf("fn %s has no %s", r.version(), binary))
+	}
+	if sums == nil {
+		return fmt.Errorf("fn %s has no %s, its binary cannot be verified", r.version(), checksumsAsset)
+	}
+	want, err := releaseChecksum(sums.URL, binary)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".fn-update")
+	if err != nil {
+		return fmt.Errorf("could not replace %s, retry with the permissions to write it: %v", exe, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	resp, err := httpDownload(bin.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("the checksum of %s is %s, expected %s, fn was not updated", binary, got, want)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		// running executables cannot be replaced, but can be renamed
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// releaseChecksum returns the checksum of binary listed at url.
+func releaseChecksum(url, binary string) (string, error) {
+	resp, err := httpGet(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == binary {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no checksum for %s, fn was not updated", checksumsAsset, binary)
+}
+
+// httpGet gets url within the API timeout, failing on statuses other than
+// 200.
+func httpGet(url string) (*http.Response, error) {
+	return getURL(cmdContext(), url, globals.apiTimeout)
+}
+
+// httpDownload gets url like httpGet, but for as long as the download of its
+// body takes, binaries of megabytes taking longer than API calls on slow
+// links. Only an interrupt stops it.
+func httpDownload(url string) (*http.Response, error) {
+	return getURL(cmdContext(), url, 0)
+}
+
+func getURL(ctx context.Context, url string, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &fnError{
+			Kind:    kindFromStatus(resp.StatusCode),
+			Message: fmt.Sprintf("GET %s: %s", url, resp.Status),
+			Status:  resp.StatusCode,
+		}
+	}
+	return resp, nil
+}
+
+// compareVersions compares the versions a and b, like 0.2.21, returning -1,
+// 0 or 1. Pre-releases, like 0.2.22-nightly.20170301, come before their
+// release.
+func compareVersions(a, b string) int {
+	a, b = strings.TrimPrefix(a, "v"), strings.TrimPrefix(b, "v")
+	anum, apre := splitPrerelease(a)
+	bnum, bpre := splitPrerelease(b)
+
+	as, bs := strings.Split(anum, "."), strings.Split(bnum, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return sign(x - y)
+		}
+	}
+
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+	return strings.Compare(apre, bpre)
+}
+
+func splitPrerelease(v string) (string, string) {
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
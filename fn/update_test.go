@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"0.2.21", "0.2.21", 0},
+		{"0.2.22", "0.2.21", 1},
+		{"0.10.0", "0.9.9", 1},
+		{"v0.2.21", "0.2.21", 0},
+		{"0.2.22-nightly.20170301", "0.2.22", -1},
+		{"0.2.22-nightly.20170302", "0.2.22-nightly.20170301", 1},
+		{"0.2", "0.2.1", -1},
+	}
+	for _, c := range cases {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestReleaseBinary(t *testing.T) {
+	r := &release{Assets: []releaseAsset{
+		{Name: "fn_linux"}, {Name: "fn_mac"}, {Name: "fn.exe"},
+		{Name: "fn_linux_arm64"}, {Name: "fn_windows_amd64.exe"},
+	}}
+	cases := []struct {
+		goos, goarch, want string
+	}{
+		{"linux", "arm64", "fn_linux_arm64"},
+		{"windows", "amd64", "fn_windows_amd64.exe"},
+		// releases of amd64 binaries only
+		{"linux", "amd64", "fn_linux"},
+		{"darwin", "amd64", "fn_mac"},
+		{"darwin", "arm64", ""},
+		{"linux", "386", ""},
+		{"freebsd", "amd64", ""},
+	}
+	for _, c := range cases {
+		var got string
+		if a := r.binary(c.goos, c.goarch); a != nil {
+			got = a.Name
+		}
+		if got != c.want {
+			t.Errorf("binary(%s, %s) = %q, want %q", c.goos, c.goarch, got, c.want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho fn 0.2.23\n")
+	sum := sha256.Sum256(binary)
+	checksums := hex.EncodeToString(sum[:]) + "  fn_linux\n"
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases":
+			fmt.Fprintf(w, `[
+				{"tag_name": "0.2.23-nightly.1", "prerelease": true},
+				{"tag_name": "0.2.22", "assets": [
+					{"name": "fn_linux", "browser_download_url": "%[1]s/fn_linux"},
+					{"name": "checksums.txt", "browser_download_url": "%[1]s/checksums.txt"}
+				]},
+				{"tag_name": "0.2.21"}
+			]`, srv.URL)
+		case "/fn_linux":
+			// slower than the API timeout, which downloads are not bound to
+			w.Write(binary[:4])
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			w.Write(binary[4:])
+		case "/checksums.txt":
+			fmt.Fprint(w, checksums)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer os.Setenv("FN_RELEASES_URL", os.Getenv("FN_RELEASES_URL"))
+	os.Setenv("FN_RELEASES_URL", srv.URL+"/releases")
+	defer func(d time.Duration) { globals.apiTimeout = d }(globals.apiTimeout)
+	globals.apiTimeout = 30 * time.Millisecond
+
+	if r, err := latestRelease(channelNightly); err != nil || r.version() != "0.2.23-nightly.1" {
+		t.Errorf("expected the nightly release, got %+v, %v", r, err)
+	}
+	r, err := latestRelease(channelStable)
+	if err != nil || r.version() != "0.2.22" {
+		t.Fatalf("expected the stable release, got %+v, %v", r, err)
+	}
+
+	dir, err := ioutil.TempDir("", "fn-update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "fn")
+	if err := ioutil.WriteFile(exe, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := selfUpdate(r, "fn_linux", exe); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(exe); string(b) != string(binary) {
+		t.Errorf("expected fn to be replaced, got %q", b)
+	}
+
+	checksums = "0000  fn_linux\n"
+	ioutil.WriteFile(exe, []byte("old"), 0755)
+	if err := selfUpdate(r, "fn_linux", exe); err == nil {
+		t.Error("expected a binary not matching its checksum to be rejected")
+	}
+	if b, _ := ioutil.ReadFile(exe); string(b) != "old" {
+		t.Errorf("expected fn to be left as it was, got %q", b)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected the download to be removed, got %d files", len(files))
+	}
+}
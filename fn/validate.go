@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	fndeploy "github.com/iron-io/functions/fn/pkg/deploy"
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Levels of validation findings.
+const (
+	findingError   = "error"
+	findingWarning = "warning"
+)
+
+// finding is a problem found in a function file. Errors would make building
+// or deploying the function fail, warnings are likely mistakes.
+type finding struct {
+	Level   string `json:"level"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f finding) String() string {
+	if f.Field == "" {
+		return f.Level + ": " + f.Message
+	}
+	return f.Level + ": " + f.Field + ": " + f.Message
+}
+
+type validation struct {
+	findings []finding
+}
+
+func (v *validation) errorf(field, format string, a ...interface{}) {
+	v.findings = append(v.findings, finding{findingError, field, fmt.Sprintf(format, a...)})
+}
+
+func (v *validation) warnf(field, format string, a ...interface{}) {
+	v.findings = append(v.findings, finding{findingWarning, field, fmt.Sprintf(format, a...)})
+}
+
+func (v *validation) count(level string) int {
+	n := 0
+	for _, f := range v.findings {
+		if f.Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+// validateFuncfile checks the function file at path, as fn reads it.
+func validateFuncfile(path string) ([]finding, error) {
+	if !exists(path) {
+		return nil, newNotFoundError("could not find " + path)
+	}
+	v := &validation{}
+
+	raw, err := ffile.ReadTree(path)
+	if err == ffile.ErrUnexpectedFormat {
+		return nil, err
+	} else if err != nil {
+		v.errorf("", "%v", err)
+		return v.findings, nil
+	}
+
+	// files are decoded as YAML, whose line numbers only make sense for
+	// YAML files
+	yamlFile := filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml"
+	var b []byte
+	if yamlFile {
+		b, err = ioutil.ReadFile(path)
+	} else {
+		b, err = yaml.Marshal(raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ff funcfile
+	if err := yaml.Unmarshal(b, &ff); err != nil {
+		if te, ok := err.(*yaml.TypeError); ok {
+			for _, e := range te.Errors {
+				if !yamlFile {
+					e = yamlLine.ReplaceAllString(e, "")
+				}
+				v.errorf("", "%s", e)
+			}
+		} else {
+			v.errorf("", "%v", err)
+		}
+	}
+
+	v.unknownKeys("", raw, reflect.TypeOf(funcfile{}))
+	if v.count(findingError) > 0 {
+		// the values are only checked once the file can be decoded
+		return v.findings, nil
+	}
+	if !globals.noExpand {
+		ff.Interpolate()
+	}
+	v.funcfile(&ff, filepath.Dir(path))
+	return v.findings, nil
+}
+
+// unknownKeys warns about the keys of m the type t has no field for.
+func (v *validation) unknownKeys(prefix string, m map[string]interface{}, t reflect.Type) {
+	known := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name != "" && name != "-" {
+			known[name] = f.Type
+		}
+	}
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ft, ok := known[k]
+		if !ok {
+			v.warnf(prefix+k, "unknown key, it is ignored")
+			continue
+		}
+		// the nested objects are checked too
+		switch {
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			items, _ := m[k].([]interface{})
+			for i, item := range items {
+				if im, ok := item.(map[string]interface{}); ok {
+					v.unknownKeys(fmt.Sprintf("%s%s[%d].", prefix, k, i), im, ft.Elem())
+				}
+			}
+		case ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct:
+			if im, ok := m[k].(map[string]interface{}); ok {
+				v.unknownKeys(prefix+k+".", im, ft.Elem())
+			}
+		case ft.Kind() == reflect.Map && ft.Elem().Kind() == reflect.Struct:
+			items, _ := m[k].(map[string]interface{})
+			for name, item := range items {
+				if im, ok := item.(map[string]interface{}); ok {
+					v.unknownKeys(prefix+k+"."+name+".", im, ft.Elem())
+				}
+			}
+		}
+	}
+}
+
+// platformPattern matches the platforms images are built for, os/arch with an
+// optional variant, like linux/arm/v7.
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// semverPattern matches the versions fn bump can update.
+var semverPattern = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// yamlLine is the position YAML decoding errors start with.
+var yamlLine = regexp.MustCompile(`^line \d+: `)
+
+// digestPattern matches the image digests push records.
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// The rules on routes mirror those of the server.
+var (
+	routeTypes   = []string{"sync", "async"}
+	routeFormats = []string{"default", "http"}
+)
+
+func oneOf(s string, values []string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validation) funcfile(ff *funcfile, dir string) {
+	if ff.Name == "" {
+		v.errorf("name", "missing, it names the image of the function")
+	} else if strings.ContainsAny(ff.Name, " \t") || ff.Name != strings.ToLower(ff.Name) {
+		v.errorf("name", "%q is not a valid image name, it must be lowercase without spaces", ff.Name)
+	} else if !strings.Contains(ff.Name, "/") {
+		v.warnf("name", "%q has no user or registry, the route path cannot be derived from it", ff.Name)
+	}
+	if ff.Version != "" {
+		if !semverPattern.MatchString(ff.Version) {
+			v.errorf("version", "%q is not a semantic version, fn bump cannot update it", ff.Version)
+		}
+	}
+
+	if strings.Contains(ff.Registry, "://") {
+		v.errorf("registry", "%q is a URL, the registry is named by its host, like registry.example.org:5000", ff.Registry)
+	}
+	if ff.ImageDigest != "" && !digestPattern.MatchString(ff.ImageDigest) {
+		v.errorf("image_digest", "%q is not an image digest, like sha256:<64 hex digits>", ff.ImageDigest)
+	}
+
+	if !exists(filepath.Join(dir, "Dockerfile")) {
+		if ff.Runtime == nil || *ff.Runtime == "" {
+			v.errorf("runtime", "missing, and there is no Dockerfile to build the function with")
+		} else if rt, _ := ff.RuntimeTag(); acceptableFnRuntimes[rt] == "" {
+			v.errorf("runtime", "unknown runtime %s", rt)
+		}
+		if ff.Entrypoint == nil || *ff.Entrypoint == "" {
+			v.errorf("entrypoint", "missing, and there is no Dockerfile to build the function with")
+		}
+	}
+
+	if ff.Type != nil && *ff.Type != "" && !oneOf(*ff.Type, routeTypes) {
+		v.errorf("type", "%q is not one of %s", *ff.Type, strings.Join(routeTypes, ", "))
+	}
+	if ff.Format != nil && *ff.Format != "" && !oneOf(*ff.Format, routeFormats) {
+		v.errorf("format", "%q is not one of %s", *ff.Format, strings.Join(routeFormats, ", "))
+	}
+	v.memory("memory", ff.Memory)
+	v.timeout("timeout", ff.Timeout)
+
+	for i, p := range ff.Paths {
+		v.routePath(fmt.Sprintf("paths[%d]", i), p)
+	}
+	for i, r := range ff.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		v.routePath(field+".path", r.Path)
+		if r.Type != nil && !oneOf(*r.Type, routeTypes) {
+			v.errorf(field+".type", "%q is not one of %s", *r.Type, strings.Join(routeTypes, ", "))
+		}
+		if r.Format != nil && !oneOf(*r.Format, routeFormats) {
+			v.errorf(field+".format", "%q is not one of %s", *r.Format, strings.Join(routeFormats, ", "))
+		}
+		v.memory(field+".memory", r.Memory)
+		v.timeout(field+".timeout", r.Timeout)
+	}
+	if _, err := fndeploy.Routes(ff); err != nil && len(ff.Paths)+len(ff.Routes) > 0 {
+		v.errorf("routes", "%v", err)
+	}
+
+	for _, k := range secretKeys(ff) {
+		if _, _, err := splitSecretRef(ff.Secrets[k]); err != nil {
+			v.errorf("secrets."+k, "%v", err)
+		}
+		if _, ok := ff.Config[k]; ok {
+			v.warnf("secrets."+k, "also set in config, the secret takes precedence")
+		}
+	}
+
+	for i, p := range ff.Platforms {
+		if !platformPattern.MatchString(p) {
+			v.errorf(fmt.Sprintf("platforms[%d]", i), "%q is not a platform, like linux/arm64", p)
+		}
+	}
+
+	if hc := ff.Healthcheck; hc != nil {
+		if hc.Path != "" {
+			v.routePath("healthcheck.path", hc.Path)
+		}
+		if hc.Status != 0 && (hc.Status < 100 || hc.Status > 599) {
+			v.errorf("healthcheck.status", "%d is not an HTTP status", hc.Status)
+		}
+		if hc.Retries < 0 {
+			v.errorf("healthcheck.retries", "must not be negative, got %d", hc.Retries)
+		}
+	}
+
+	if h := ff.Hooks; h != nil {
+		for _, hook := range allHooks(h) {
+			for i, cmd := range hook.cmds {
+				if strings.TrimSpace(cmd) == "" {
+					v.errorf(fmt.Sprintf("hooks.%s[%d]", hook.name, i), "empty command")
+				}
+			}
+		}
+	}
+
+	for name, env := range ff.Environments {
+		v.memory("environments."+name+".memory", env.Memory)
+		v.timeout("environments."+name+".timeout", env.Timeout)
+	}
+}
+
+func (v *validation) memory(field string, m *int64) {
+	if m != nil && *m <= 0 {
+		v.errorf(field, "must be a positive number of MB, got %d", *m)
+	}
+}
+
+func (v *validation) timeout(field string, t *time.Duration) {
+	if t != nil && *t < 0 {
+		v.errorf(field, "must not be negative, got %v", *t)
+	}
+}
+
+func (v *validation) routePath(field, p string) {
+	if p == "" {
+		v.errorf(field, "missing")
+		return
+	}
+	u, err := url.Parse(p)
+	switch {
+	case err != nil || u.RawQuery != "" || u.Fragment != "" || u.Host != "":
+		v.errorf(field, "%q is not a valid route path", p)
+	case strings.Contains(u.Path, ":"):
+		v.errorf(field, "%q has a dynamic segment, which routes do not support", p)
+	case !path.IsAbs(u.Path):
+		v.warnf(field, "%q is not absolute, it is taken as /%s", p, p)
+	case path.Clean(u.Path) != u.Path:
+		v.warnf(field, "%q is not clean, it is taken as %s", p, path.Clean(u.Path))
+	}
+}
+
+func validateCmd() cli.Command {
+	return cli.Command{
+		Name:      "validate",
+		Usage:     "check a function file, failing on errors",
+		ArgsUsage: "[path]",
+		Action:    validateAction,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "strict",
+				Usage: "fail on warnings too",
+			},
+		},
+	}
+}
+
+func validateAction(c *cli.Context) error {
+	p, err := funcfileArg(c)
+	if err != nil {
+		return err
+	}
+
+	findings, err := validateFuncfile(p)
+	if err != nil {
+		return err
+	}
+	v := &validation{findings: findings}
+
+	if globals.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(struct {
+			Funcfile string    `json:"funcfile"`
+			Findings []finding `json:"findings"`
+		}{p, append([]finding{}, findings...)}); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Fprintln(os.Stderr, f)
+		}
+	}
+
+	errs, warnings := v.count(findingError), v.count(findingWarning)
+	if errs > 0 || (c.Bool("strict") && warnings > 0) {
+		return &fnError{Kind: kindValidation, Message: fmt.Sprintf("%s: %d errors, %d warnings", p, errs, warnings)}
+	}
+	if globals.output != "json" {
+		fmt.Printf("%s is valid", p)
+		if warnings > 0 {
+			fmt.Printf(", with %d warnings", warnings)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateFuncfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		name     string
+		content  string
+		expected []finding
+	}{
+		{"valid", `name: acme/hello
+version: 0.0.1
+runtime: go
+entrypoint: ./func
+memory: 128
+timeout: 30s
+type: async
+format: http
+`, nil},
+		{"missing fields", `version: 1.0
+`, []finding{
+			{findingError, "name", "missing, it names the image of the function"},
+			{findingError, "version", `"1.0" is not a semantic version, fn bump cannot update it`},
+			{findingError, "runtime", "missing, and there is no Dockerfile to build the function with"},
+			{findingError, "entrypoint", "missing, and there is no Dockerfile to build the function with"},
+		}},
+		{"bad values", `name: acme/hello
+runtime: cobol
+entrypoint: ./func
+type: sometimes
+format: json
+memory: 0
+`, []finding{
+			{findingError, "runtime", "unknown runtime cobol"},
+			{findingError, "type", `"sometimes" is not one of sync, async`},
+			{findingError, "format", `"json" is not one of default, http`},
+			{findingError, "memory", "must be a positive number of MB, got 0"},
+		}},
+		{"type errors", `name: acme/hello
+runtime: go
+entrypoint: ./func
+memory: lots
+`, []finding{
+			{findingError, "", "line 4: cannot unmarshal !!str `lots` into int64"},
+		}},
+		{"routes", `name: acme/hello
+runtime: go
+entrypoint: ./func
+paths:
+- /users/:id
+- users
+routes:
+- path: /orders
+  memory: -1
+  colour: blue
+- path: /orders
+`, []finding{
+			{findingWarning, "routes[0].colour", "unknown key, it is ignored"},
+			{findingError, "paths[0]", `"/users/:id" has a dynamic segment, which routes do not support`},
+			{findingWarning, "paths[1]", `"users" is not absolute, it is taken as /users`},
+			{findingError, "routes[0].memory", "must be a positive number of MB, got -1"},
+			{findingError, "routes", "acme/hello declares route /orders twice"},
+		}},
+		{"unknown keys", `name: acme/hello
+runtime: go
+entrypoint: ./func
+memroy: 256
+environments:
+  prod:
+    tag: stable
+    replicas: 3
+`, []finding{
+			{findingWarning, "environments.prod.replicas", "unknown key, it is ignored"},
+			{findingWarning, "memroy", "unknown key, it is ignored"},
+		}},
+		{"hooks", `name: acme/hello
+runtime: go
+entrypoint: ./func
+hooks:
+  pre_build:
+  - go generate ./...
+  post_deploy:
+  - ""
+  pre_push:
+  - make
+`, []finding{
+			{findingWarning, "hooks.pre_push", "unknown key, it is ignored"},
+			{findingError, "hooks.post_deploy[0]", "empty command"},
+		}},
+	} {
+		path := filepath.Join(dir, "func.yaml")
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		findings, err := validateFuncfile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(findings) != len(tc.expected) {
+			t.Errorf("%s: expected %d findings, got %v", tc.name, len(tc.expected), findings)
+			continue
+		}
+		for i, f := range findings {
+			if f != tc.expected[i] {
+				t.Errorf("%s: expected %v, got %v", tc.name, tc.expected[i], f)
+			}
+		}
+	}
+}
+
+func TestValidateFuncfileDockerfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "func.yaml")
+	if err := ioutil.WriteFile(path, []byte("name: acme/hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	findings, err := validateFuncfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected functions with a Dockerfile to need no runtime, got %v", findings)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	ffile "github.com/iron-io/functions/fn/pkg/funcfile"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Function files can be Go templates, rendered against values given with
+// --values and --set before being parsed, like Helm charts, for one function
+// to be deployed for several tenants or regions:
+//
+//	name: acme/{{ .Values.tenant }}-hello
+//	config:
+//	  REGION: {{ .Values.region | default "eu-west-1" }}
+//
+// Files are only rendered when values are given.
+
+var valuesFlag = cli.StringSliceFlag{
+	Name:  "values",
+	Usage: "YAML `FILE` of values to render function files with as templates, can be repeated",
+}
+
+var setFlag = cli.StringSliceFlag{
+	Name:  "set",
+	Usage: "value to render function files with, as key=value, overriding those of --values, can be repeated",
+}
+
+// loadValues reads the values of --values and --set, the latter overriding
+// the former, and the last files those before them.
+func loadValues(c *cli.Context) error {
+	files, sets := c.StringSlice("values"), c.StringSlice("set")
+	if len(files) == 0 && len(sets) == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{})
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+		m, ok := ffile.NormalizeTree(v).(map[string]interface{})
+		if !ok && v != nil {
+			return usageError("%s: expected a document of keys and values", f)
+		}
+		mergeValues(values, m)
+	}
+	for _, s := range sets {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return usageError("--set %s: expected key=value", s)
+		}
+		if err := setValue(values, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	globals.values = values
+	return nil
+}
+
+// mergeValues merges src into dst, recursively for maps.
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sm, ok := v.(map[string]interface{})
+		dm, dok := dst[k].(map[string]interface{})
+		if ok && dok {
+			mergeValues(dm, sm)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// setValue sets the value at the dotted key, like region.name.
+func setValue(values map[string]interface{}, key, value string) error {
+	parts := strings.Split(key, ".")
+	m := values
+	for i, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]interface{})
+		if !ok {
+			if _, set := m[p]; set {
+				return usageError("--set %s: %s is not a map", key, strings.Join(parts[:i+1], "."))
+			}
+			next = make(map[string]interface{})
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if v == nil || v == "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return v, nil
+	},
+	"quote": func(v interface{}) string {
+		return fmt.Sprintf("%q", fmt.Sprint(v))
+	},
+}
+
+// renderFuncfile renders the function file at path with the values.
+func renderFuncfile(path string, values map[string]interface{}) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=zero").Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, map[string]interface{}{"Values": values}); err != nil {
+		return nil, err
+	}
+	// missing values are only allowed through default
+	if bytes.Contains(out.Bytes(), []byte("<no value>")) {
+		return nil, usageError("%s refers to values which are not set, give them or use default", path)
+	}
+	return out.Bytes(), nil
+}
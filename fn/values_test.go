@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestLoadValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(g globalOptions) { globals = g }(globals)
+
+	values := filepath.Join(dir, "values.yaml")
+	err = ioutil.WriteFile(values, []byte("tenant: acme\nregion:\n  name: eu-west-1\n  zone: a\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	files := cli.StringSlice{values}
+	set.Var(&files, "values", "")
+	sets := cli.StringSlice{"region.zone=b", "memory=256"}
+	set.Var(&sets, "set", "")
+	if err := loadValues(cli.NewContext(nil, set, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	region, _ := globals.values["region"].(map[string]interface{})
+	if globals.values["tenant"] != "acme" || region["name"] != "eu-west-1" || region["zone"] != "b" || globals.values["memory"] != "256" {
+		t.Errorf("expected the values of the file, overridden by --set, got %v", globals.values)
+	}
+
+	sets = cli.StringSlice{"tenant.name=acme"}
+	if err := loadValues(cli.NewContext(nil, set, nil)); err == nil {
+		t.Error("expected an error setting a key below a value which is not a map")
+	}
+}
+
+func TestParsefuncfileValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(g globalOptions) { globals = g }(globals)
+
+	path := filepath.Join(dir, "func.yaml")
+	err = ioutil.WriteFile(path, []byte(`name: acme/{{ .Values.tenant }}-hello
+memory: {{ .Values.memory | default 128 }}
+config:
+  REGION: {{ .Values.region | default "eu-west-1" | quote }}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globals.values = map[string]interface{}{"tenant": "globex", "memory": 512}
+	ff, err := parsefuncfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Name != "acme/globex-hello" || *ff.Memory != 512 || ff.Config["REGION"] != "eu-west-1" {
+		t.Errorf("expected the function file rendered with the values, got %+v", ff)
+	}
+
+	globals.values = map[string]interface{}{}
+	if _, err := parsefuncfile(path); err == nil {
+		t.Error("expected an error for a value which is not set")
+	}
+}
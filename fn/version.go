@@ -2,44 +2,60 @@ package main
 
 import (
 	"fmt"
-	"net/url"
-	"os"
 
 	vers "github.com/iron-io/functions/api/version"
-	functions "github.com/iron-io/functions_go"
 	"github.com/urfave/cli"
 )
 
 func version() cli.Command {
-	r := versionCmd{VersionApi: functions.NewVersionApi()}
+	r := versionCmd{}
 	return cli.Command{
 		Name:   "version",
 		Usage:  "displays fn and functions daemon versions",
 		Action: r.version,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "check",
+				Usage: "also check for a newer release of fn",
+			},
+			channelFlag(),
+		},
 	}
 }
 
-type versionCmd struct {
-	*functions.VersionApi
-}
+type versionCmd struct{}
 
 func (r *versionCmd) version(c *cli.Context) error {
-	apiURL := os.Getenv("API_URL")
-	if apiURL == "" {
-		apiURL = "http://localhost:8080"
+	fmt.Println("Client version:", vers.Version)
+	if c.Bool("check") {
+		r, err := latestRelease(c.String("channel"))
+		if err != nil {
+			return err
+		}
+		if compareVersions(r.version(), vers.Version) > 0 {
+			fmt.Println("Latest version:", r.version(), "(run fn update to install it)")
+		} else {
+			fmt.Println("Latest version:", r.version(), "(up to date)")
+		}
 	}
 
-	u, err := url.Parse(apiURL)
+	v, err := serverVersion()
 	if err != nil {
 		return err
 	}
-	r.Configuration.BasePath = u.String()
-
-	fmt.Println("Client version:", vers.Version)
-	v, _, err := r.VersionGet()
-	if err != nil {
-		return err
+	fmt.Println("Server version", v)
+	if compareVersions(v, vers.Version) > 0 {
+		logger.warn("fn is older than the server, some of its features may be missing or behave differently, run fn update")
 	}
-	fmt.Println("Server version", v.Version)
 	return nil
 }
+
+func serverVersion() (string, error) {
+	var v struct {
+		Version string `json:"version"`
+	}
+	if err := apiCall("GET", "/version", nil, &v); err != nil {
+		return "", err
+	}
+	return v.Version, nil
+}
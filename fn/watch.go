@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/urfave/cli"
+)
+
+// defaultWatchIgnores are never watched, on top of what the .gitignore and
+// .dockerignore files of the function list.
+var defaultWatchIgnores = []string{".git", ".hg", ".svn", ".idea", ".vscode", "*.swp", "*~", ".DS_Store"}
+
+func watch() cli.Command {
+	cmd := watchcmd{}
+	return cli.Command{
+		Name:   "watch",
+		Usage:  "rebuild the function whenever its files change, and run it again locally or redeploy it",
+		Flags:  cmd.flags(),
+		Before: loadValues,
+		Action: cmd.watch,
+	}
+}
+
+type watchcmd struct {
+	local    bool
+	app      string
+	debounce time.Duration
+	ignore   cli.StringSlice
+	verbose  bool
+	skippush bool
+	builder  string
+}
+
+func (w *watchcmd) flags() []cli.Flag {
+	flags := []cli.Flag{
+		cli.BoolFlag{
+			Name:        "local",
+			Usage:       "run the function locally after every build, the previous run being stopped - the default",
+			Destination: &w.local,
+		},
+		cli.StringFlag{
+			Name:        "deploy",
+			Usage:       "deploy the function to `APPNAME` after every build",
+			Destination: &w.app,
+		},
+		cli.DurationFlag{
+			Name:        "debounce",
+			Usage:       "wait for files to stop changing for this long before rebuilding",
+			Value:       300 * time.Millisecond,
+			Destination: &w.debounce,
+		},
+		cli.StringSliceFlag{
+			Name:  "ignore",
+			Usage: "do not watch files or directories matching `PATTERN`, on top of those .gitignore and .dockerignore list",
+			Value: &w.ignore,
+		},
+		cli.BoolFlag{
+			Name:        "v",
+			Usage:       "verbose mode",
+			Destination: &w.verbose,
+		},
+		cli.BoolFlag{
+			Name:        "skip-push",
+			Usage:       "does not push images before deploying them - useful for local servers",
+			Destination: &w.skippush,
+		},
+		builderFlag(&w.builder),
+		buildArgFlag,
+		registryFlag,
+		envFlag,
+		valuesFlag,
+		setFlag,
+		metricsAddrFlag,
+	}
+	// functions are run as fn run runs them
+	return append(flags, runflags()...)
+}
+
+func (w *watchcmd) watch(c *cli.Context) error {
+	if w.local && w.app != "" {
+		return usageError("--local and --deploy cannot be used together")
+	}
+	if w.debounce < 0 {
+		return usageError("--debounce cannot be negative")
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fn, err := findFuncfile(dir)
+	if err != nil {
+		return err
+	}
+	patterns, err := watchIgnores(dir, w.ignore)
+	if err != nil {
+		return err
+	}
+
+	var cycle func() func()
+	if w.app != "" {
+		cycle = w.deployer(c, fn)
+	} else {
+		if cycle, err = w.runner(c, fn); err != nil {
+			return err
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watchDirs(watcher, dir, dir, patterns); err != nil {
+		return err
+	}
+
+	changes := make(chan string)
+	go func() {
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					close(changes)
+					return
+				}
+				if ev.Op == fsnotify.Chmod {
+					continue
+				}
+				rel, err := filepath.Rel(dir, ev.Name)
+				if err != nil || watchIgnored(rel, patterns) {
+					continue
+				}
+				if ev.Op&fsnotify.Create != 0 {
+					// new directories are watched too
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						watchDirs(watcher, dir, ev.Name, patterns)
+					}
+				}
+				changes <- ev.Name
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Fprintln(os.Stderr, "watch:", err)
+			}
+		}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	stopMetrics, err := serveMetrics(c.String("metrics-addr"))
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	fmt.Printf("watching %s for changes, ^C to stop\n", dir)
+	stop := cycle()
+	funcfileContent, _ := ioutil.ReadFile(fn)
+	batches := debounce(changes, w.debounce)
+	for {
+		var (
+			batch []string
+			ok    bool
+		)
+		select {
+		case <-interrupt:
+			// containers are not left behind
+			if stop != nil {
+				stop()
+			}
+			return nil
+		case batch, ok = <-batches:
+			if !ok {
+				return nil
+			}
+		}
+
+		// deploys store the digest of the image in the function file, which
+		// is not a change of the function
+		if len(batch) == 1 && batch[0] == fn {
+			if b, err := ioutil.ReadFile(fn); err == nil && bytes.Equal(b, funcfileContent) {
+				continue
+			}
+		}
+		fmt.Printf("\n%s changed, rebuilding\n", watchSummary(dir, batch))
+		if stop != nil {
+			stop()
+		}
+		stop = cycle()
+		funcfileContent, _ = ioutil.ReadFile(fn)
+	}
+}
+
+// runner builds the function and starts running it locally, returning what
+// stops it from running.
+func (w *watchcmd) runner(c *cli.Context, fn string) (func() func(), error) {
+	body, contentType, err := payload(c)
+	if err != nil {
+		return nil, err
+	}
+	// the payload is sent again every run
+	var b []byte
+	if body != nil {
+		if b, err = ioutil.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+	opts := buildOptionsFrom(c, w.builder)
+
+	return func() func() {
+		ff, _, err := buildfunc(verbwriter(w.verbose), os.Stdout, fn, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil
+		}
+		route, err := funcfileRoute(ff, c.String("route"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil
+		}
+		ropts, err := runOptionsFrom(c, route, contentType)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil
+		}
+
+		fmt.Printf("running %s\n", ff.FullName())
+		container, err := startContainer(ff.FullName(), bytes.NewReader(b), os.Stderr, ropts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return nil
+		}
+
+		var (
+			mu      sync.Mutex
+			stopped bool
+			done    = make(chan struct{})
+		)
+		go func() {
+			defer close(done)
+			start := time.Now()
+			err := container.run(bytes.NewReader(b), os.Stdout, os.Stderr, ropts.format)
+			mu.Lock()
+			defer mu.Unlock()
+			if stopped {
+				return
+			}
+			observeCall("", route.Path, emulatedStatus(err), time.Since(start))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			fmt.Println("waiting for changes")
+		}()
+		return func() {
+			mu.Lock()
+			stopped = true
+			mu.Unlock()
+			container.remove()
+			<-done
+		}
+	}, nil
+}
+
+// deployer builds and deploys the function to the app, there being nothing
+// to stop afterwards.
+func (w *watchcmd) deployer(c *cli.Context, fn string) func() func() {
+	p := &deploycmd{
+		appName:    w.app,
+		client:     apiClient(),
+		verbose:    w.verbose,
+		skippush:   w.skippush,
+		buildOpts:  buildOptionsFrom(c, w.builder),
+		verbwriter: verbwriter(w.verbose),
+	}
+	return func() func() {
+		rec := &deployRecord{Funcfile: filepath.Base(fn)}
+		if err := p.deploy(cmdContext(), fn, rec); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			fmt.Println("deployed, waiting for changes")
+		}
+		return nil
+	}
+}
+
+// watchIgnores are the patterns of the files and directories of dir which are
+// not watched: the default ones, those of its .gitignore and .dockerignore,
+// built files and files left out of images not being the function changing,
+// and extra.
+func watchIgnores(dir string, extra []string) ([]string, error) {
+	patterns := append([]string(nil), defaultWatchIgnores...)
+	for _, name := range []string{".gitignore", ".dockerignore"} {
+		ps, err := readIgnoreFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, ps...)
+	}
+	for _, p := range extra {
+		patterns = append(patterns, filepath.Clean(p))
+	}
+	for i, p := range patterns {
+		// anchored and directory patterns of .gitignore
+		patterns[i] = strings.Trim(p, string(filepath.Separator))
+	}
+	return patterns, nil
+}
+
+// watchIgnored tells whether the patterns match rel, a path relative to the
+// watched directory, patterns without a separator matching the base name of
+// files in subdirectories too.
+func watchIgnored(rel string, patterns []string) bool {
+	if ignored(rel, patterns) {
+		return true
+	}
+	base := filepath.Base(rel)
+	for _, p := range patterns {
+		if strings.ContainsRune(p, filepath.Separator) {
+			continue
+		}
+		if ok, _ := filepath.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// watchDirs watches dir, one of root, and its subdirectories, but for those
+// the patterns match.
+func watchDirs(watcher *fsnotify.Watcher, root, dir string, patterns []string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && watchIgnored(rel, patterns) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// debounce batches the changes, sending the distinct ones, sorted, once none
+// came for quiet. The batches are closed along with changes, once those
+// pending are sent.
+func debounce(changes <-chan string, quiet time.Duration) <-chan []string {
+	batches := make(chan []string)
+	go func() {
+		defer close(batches)
+		pending := make(map[string]bool)
+		flush := func() {
+			if len(pending) == 0 {
+				return
+			}
+			var batch []string
+			for name := range pending {
+				batch = append(batch, name)
+			}
+			sort.Strings(batch)
+			pending = make(map[string]bool)
+			batches <- batch
+		}
+
+		var timer <-chan time.Time
+		for {
+			select {
+			case name, ok := <-changes:
+				if !ok {
+					flush()
+					return
+				}
+				pending[name] = true
+				timer = time.After(quiet)
+			case <-timer:
+				timer = nil
+				flush()
+			}
+		}
+	}()
+	return batches
+}
+
+// watchSummary tells which files of dir changed, naming the first few.
+func watchSummary(dir string, changed []string) string {
+	const shown = 3
+	var names []string
+	for i, name := range changed {
+		if i == shown {
+			break
+		}
+		if rel, err := filepath.Rel(dir, name); err == nil {
+			name = rel
+		}
+		names = append(names, name)
+	}
+	s := strings.Join(names, ", ")
+	if len(changed) > shown {
+		s += fmt.Sprintf(" and %d more", len(changed)-shown)
+	}
+	return s
+}
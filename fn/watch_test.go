@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestDebounce(t *testing.T) {
+	changes := make(chan string)
+	batches := debounce(changes, 50*time.Millisecond)
+
+	for _, name := range []string{"b.go", "a.go", "b.go"} {
+		changes <- name
+	}
+	select {
+	case batch := <-batches:
+		if want := []string{"a.go", "b.go"}; !reflect.DeepEqual(batch, want) {
+			t.Errorf("batch = %v, want %v", batch, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch sent")
+	}
+
+	// pending changes are sent before closing
+	changes <- "c.go"
+	close(changes)
+	if batch := <-batches; !reflect.DeepEqual(batch, []string{"c.go"}) {
+		t.Errorf("last batch = %v, want [c.go]", batch)
+	}
+	if _, ok := <-batches; ok {
+		t.Error("batches not closed along with changes")
+	}
+}
+
+func TestWatchIgnores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("/func\nnode_modules/\n*.pyc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("docs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err := watchIgnores(dir, []string{"tmp/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, want := range map[string]bool{
+		"func.go":                         false,
+		"func":                            true,
+		".git":                            true,
+		"node_modules":                    true,
+		"lib/node_modules":                true,
+		"lib/util.pyc":                    true,
+		"lib/util.py":                     false,
+		"docs":                            true,
+		"tmp":                             true,
+		".func.go.swp":                    true,
+		filepath.Join("handlers", "x.go"): false,
+	} {
+		if got := watchIgnored(filepath.FromSlash(rel), patterns); got != want {
+			t.Errorf("watchIgnored(%s) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestWatchDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fn-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"lib", "node_modules/x", ".git/objects"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	if err := watchDirs(watcher, dir, dir, []string{".git", "node_modules"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes of ignored directories are not seen
+	ioutil.WriteFile(filepath.Join(dir, "node_modules", "x", "a.js"), nil, 0644)
+	name := filepath.Join(dir, "lib", "util.go")
+	if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-watcher.Events:
+		if ev.Name != name {
+			t.Errorf("change of %s seen, want %s", ev.Name, name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not seen")
+	}
+}
+
+func TestWatchSummary(t *testing.T) {
+	dir := filepath.FromSlash("/src/hello")
+	var changed []string
+	for _, name := range []string{"a.go", "b.go", "c.go", "d.go", "e.go"} {
+		changed = append(changed, filepath.Join(dir, name))
+	}
+	if got, want := watchSummary(dir, changed[:1]), "a.go"; got != want {
+		t.Errorf("watchSummary = %q, want %q", got, want)
+	}
+	if got, want := watchSummary(dir, changed), "a.go, b.go, c.go and 2 more"; got != want {
+		t.Errorf("watchSummary = %q, want %q", got, want)
+	}
+}